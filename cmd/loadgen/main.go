@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/dominodatalab/hephaestus/pkg/cmd"
+	"github.com/dominodatalab/hephaestus/pkg/cmd/loadgen"
+)
+
+func main() {
+	if err := loadgen.NewCommand().Execute(); err != nil {
+		cmd.ExitWithErr(err)
+	}
+}
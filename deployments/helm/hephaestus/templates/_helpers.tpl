@@ -85,6 +85,20 @@ Returns the logfile directory.
 /var/log/hephaestus
 {{- end }}
 
+{{/*
+Return the controller directory used to cache remote Docker contexts.
+*/}}
+{{- define "hephaestus.contextCacheDir" -}}
+/var/cache/hephaestus/contexts
+{{- end }}
+
+{{/*
+Return the controller directory builds fetch and extract remote Docker contexts into.
+*/}}
+{{- define "hephaestus.scratchDir" -}}
+/var/lib/hephaestus/scratch
+{{- end }}
+
 {{/*
 Returns the logfile pathname.
 */}}
@@ -206,3 +220,18 @@ Return the buildkit service account name.
 {{- default "default" .Values.buildkit.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Return projected volume sources for registries with a caBundleSecretRef, empty when there are none.
+*/}}
+{{- define "hephaestus.registryCABundles" -}}
+{{- range $domain, $opts := .Values.registries }}
+{{- with $opts.caBundleSecretRef }}
+- secret:
+    name: {{ .name }}
+    items:
+      - key: {{ .key | default "ca.crt" }}
+        path: {{ $domain }}/ca.crt
+{{- end }}
+{{- end }}
+{{- end }}
@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BuildQuotaUsageName is the name of the BuildQuotaUsage maintained in every namespace that submits builds.
+const BuildQuotaUsageName = "build-quota"
+
+// BuildQuotaUsageStatus counts the builds submitted by a namespace and the image bytes they pushed during the current
+// quota window.
+type BuildQuotaUsageStatus struct {
+	// WindowStart is the time the current quota window began, counters are reset once the window elapses.
+	WindowStart metav1.Time `json:"windowStart,omitempty"`
+	// Builds is the number of ImageBuilds submitted during the window.
+	Builds int64 `json:"builds,omitempty"`
+	// PushedBytes is the compressed size of the images pushed by builds that succeeded during the window.
+	PushedBytes int64 `json:"pushedBytes,omitempty"`
+}
+
+// Current returns the usage of the window that contains now. The counters are reset when the recorded window has
+// elapsed or was never started.
+func (in BuildQuotaUsageStatus) Current(now time.Time, window time.Duration) BuildQuotaUsageStatus {
+	if in.WindowStart.IsZero() || !now.Before(in.WindowStart.Add(window)) {
+		return BuildQuotaUsageStatus{WindowStart: metav1.NewTime(now)}
+	}
+
+	return in
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Namespaced,shortName=bqu
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Builds",type=integer,JSONPath=".status.builds"
+// +kubebuilder:printcolumn:name="Pushed Bytes",type=integer,JSONPath=".status.pushedBytes"
+// +kubebuilder:printcolumn:name="Window Start",type=date,JSONPath=".status.windowStart"
+
+// BuildQuotaUsage records the build quota consumption of its namespace. It is written by the controller and read by
+// the ImageBuild webhook, which rejects new builds once a quota is exhausted.
+type BuildQuotaUsage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status BuildQuotaUsageStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+type BuildQuotaUsageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BuildQuotaUsage `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BuildQuotaUsage{}, &BuildQuotaUsageList{})
+}
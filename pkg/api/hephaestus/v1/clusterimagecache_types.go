@@ -0,0 +1,49 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=cic
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Cached Images",type=string,JSONPath=".status.cachedImages"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:printcolumn:name="Target Images",type=string,JSONPath=".spec.images",priority=10
+// +kubebuilder:printcolumn:name="Target Pods",type=string,JSONPath=".status.buildkitPods",priority=10
+
+// ClusterImageCache warms base images on every builder regardless of namespace.
+type ClusterImageCache struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ImageCacheSpec   `json:"spec,omitempty"`
+	Status ImageCacheStatus `json:"status,omitempty"`
+}
+
+func (in *ClusterImageCache) GetConditions() *[]metav1.Condition {
+	return &in.Status.Conditions
+}
+
+func (in *ClusterImageCache) GetPhase() Phase {
+	return in.Status.Phase
+}
+
+func (in *ClusterImageCache) SetPhase(p Phase) {
+	in.Status.Phase = p
+}
+
+// +kubebuilder:object:root=true
+
+type ClusterImageCacheList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterImageCache `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterImageCache{}, &ClusterImageCacheList{})
+}
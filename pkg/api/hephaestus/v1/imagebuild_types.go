@@ -3,13 +3,51 @@ package v1
 import (
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// DefaultAnnotationDomain prefixes ImageBuild annotations unless SetAnnotationDomain is used.
+const DefaultAnnotationDomain = "hephaestus.dominodatalab.com"
+
+var (
+	// ImageCleanupFinalizer holds back the deletion of ImageBuilds that set DeleteImagesOnCleanup until their pushed
+	// images are deleted.
+	ImageCleanupFinalizer = DefaultAnnotationDomain + "/image-cleanup"
+	// RequestedByAnnotation records the username of the user that created an ImageBuild.
+	RequestedByAnnotation = DefaultAnnotationDomain + "/requested-by"
+	// RequestedByGroupsAnnotation records the comma-separated groups of the user that created an ImageBuild.
+	RequestedByGroupsAnnotation = DefaultAnnotationDomain + "/requested-by-groups"
+	// OnDemandOnlyAnnotation prevents an ImageBuild from running on spot/preemptible workers when set to "true".
+	OnDemandOnlyAnnotation = DefaultAnnotationDomain + "/on-demand-only"
+)
+
+// Build args injected into builds that enable BuilderEnv.
+const (
+	// BuildNameArg carries the name of the ImageBuild.
+	BuildNameArg = "HEPHAESTUS_BUILD_NAME"
+	// BuildNamespaceArg carries the namespace of the ImageBuild.
+	BuildNamespaceArg = "HEPHAESTUS_BUILD_NAMESPACE"
+	// RequestedByArg carries the username recorded in the RequestedByAnnotation.
+	RequestedByArg = "HEPHAESTUS_REQUESTED_BY"
+)
+
+// SetAnnotationDomain changes the domain of every ImageBuild annotation and finalizer for deployments that embed
+// Hephaestus under a different name. It must be called before any controller or webhook is started.
+func SetAnnotationDomain(domain string) {
+	ImageCleanupFinalizer = domain + "/image-cleanup"
+	RequestedByAnnotation = domain + "/requested-by"
+	RequestedByGroupsAnnotation = domain + "/requested-by-groups"
+	OnDemandOnlyAnnotation = domain + "/on-demand-only"
+}
+
 type ImageBuildAMQPOverrides struct {
 	ExchangeName string `json:"exchangeName,omitempty"`
 	QueueName    string `json:"queueName,omitempty"`
+	// RoutingKey of the transition messages of this build, e.g. "hephaestus.team-a" to publish to a topic exchange
+	// that tenants bind their queues to. Overrides the routing key configured on the controller.
+	RoutingKey string `json:"routingKey,omitempty"`
 }
 
 // ImageBuildSpec specifies the desired state of an ImageBuild resource.
@@ -18,6 +56,9 @@ type ImageBuildSpec struct {
 	Context string `json:"context,omitempty"`
 	// DockerfileContents specifies the contents of the Dockerfile directly in the CR.  Ignored if context is present.
 	DockerfileContents string `json:"dockerfileContents,omitempty"`
+	// ContextSubPath selects a directory inside the remote context that is used as the build root, so one archive can
+	// host several builds. The Dockerfile and .dockerignore are read from this directory.
+	ContextSubPath string `json:"contextSubPath,omitempty"`
 	// Images is a list of images to build and push.
 	Images []string `json:"images,omitempty"`
 	// BuildArgs are applied to the build at runtime.
@@ -36,6 +77,34 @@ type ImageBuildSpec struct {
 	DisableCacheLayerExport bool `json:"disableCacheExport,omitempty"`
 	// Secrets provides references to Kubernetes secrets to expose to individual image builds.
 	Secrets []SecretReference `json:"secrets,omitempty"`
+	// ImageLabels are applied to the built images as OCI config labels and mirrored onto the image manifests as
+	// annotations so that attribution metadata survives into the registry.
+	ImageLabels map[string]string `json:"imageLabels,omitempty"`
+	// ImageAnnotations are added to the manifests of the built images, and to their index when the build targets more
+	// than one platform.
+	ImageAnnotations map[string]string `json:"imageAnnotations,omitempty"`
+	// SkipIfExists marks the build as succeeded without building when every image already exists in its registry and
+	// references the same digest.
+	SkipIfExists bool `json:"skipIfExists,omitempty"`
+	// ExpectedDigest that the existing images must reference for the build to be skipped. Requires skipIfExists.
+	ExpectedDigest string `json:"expectedDigest,omitempty"`
+	// BuilderName pins the build to a specific buildkit worker pod, bypassing the lease queue. The build fails when the
+	// worker is not running or already leased. Intended for reproducing failures against a known worker cache state.
+	BuilderName string `json:"builderName,omitempty"`
+	// BuilderEnv injects the HEPHAESTUS_BUILD_NAME, HEPHAESTUS_BUILD_NAMESPACE and HEPHAESTUS_REQUESTED_BY build args
+	// so that Dockerfiles can stamp provenance with matching ARG instructions. They cannot be set via buildArgs.
+	BuilderEnv bool `json:"builderEnv,omitempty"`
+	// IgnorePatterns are evaluated after the .dockerignore file of the context using the same syntax, so paths ignored
+	// by the file can be re-included with "!" patterns. Matching paths are not sent to buildkit.
+	IgnorePatterns []string `json:"ignorePatterns,omitempty"`
+	// Platforms the image is built for, e.g. "linux/arm64". Overrides the platforms configured on the controller.
+	// Builds that only target arm64 run on the arm64 worker pool when one is configured.
+	Platforms []string `json:"platforms,omitempty"`
+	// DeleteImagesOnCleanup deletes the pushed images from their registries by digest when the build is deleted, e.g.
+	// by the garbage collector. Every tag referencing the digest is removed with it. Builds that were skipped because
+	// their images already existed never delete them. The build is held back by a finalizer until its images are
+	// deleted, so it has to be deleted before the controller is uninstalled.
+	DeleteImagesOnCleanup bool `json:"deleteImagesOnCleanup,omitempty"`
 }
 
 type ImageBuildTransition struct {
@@ -44,24 +113,51 @@ type ImageBuildTransition struct {
 	OccurredAt    metav1.Time `json:"occurredAt,omitempty"`
 }
 
+// ImageBuildPushProgress reports how much of the image has been uploaded to the registry.
+type ImageBuildPushProgress struct {
+	// PushedBytes is the number of bytes uploaded so far.
+	PushedBytes int64 `json:"pushedBytes"`
+	// TotalBytes is the number of bytes that need to be uploaded, it grows as layers are discovered.
+	TotalBytes int64 `json:"totalBytes"`
+	// UpdatedAt is the time the progress was last reported, updates are throttled.
+	UpdatedAt metav1.Time `json:"updatedAt,omitempty"`
+}
+
+// ImageBuildContextDigest identifies the exact inputs of a build.
+type ImageBuildContextDigest struct {
+	// Archive is the SHA256 digest of the remote context archive, it is blank when the context was not fetched by
+	// the controller.
+	Archive string `json:"archive,omitempty"`
+	// Dockerfile is the SHA256 digest of the Dockerfile used by the build.
+	Dockerfile string `json:"dockerfile,omitempty"`
+}
+
 type ImageBuildStatus struct {
 	// AllocationTime is the total time spent allocating a build pod.
-	AllocationTime string `json:"allocationTime,omitempty"`
+	AllocationTime *metav1.Duration `json:"allocationTime,omitempty"`
 	// BuildTime is the total time spent during the image build process.
-	BuildTime string `json:"buildTime,omitempty"`
+	BuildTime *metav1.Duration `json:"buildTime,omitempty"`
 	// BuilderAddr is the routable address to the buildkit pod used during the image build process.
 	BuilderAddr string `json:"builderAddr,omitempty"`
 	// CompressedImageSizeBytes is the total size of all the compressed layers in the image.
-	CompressedImageSizeBytes string `json:"compressedImageSizeBytes,omitempty"`
+	CompressedImageSizeBytes *resource.Quantity `json:"compressedImageSizeBytes,omitempty"`
 	// Digest is the image digest
 	Digest string `json:"digest,omitempty"`
 	// Map of string keys and values corresponding OCI image config labels.
 	// Labels contains arbitrary metadata for the container.
 	Labels map[string]string `json:"labels,omitempty"`
+	// PushProgress reports the upload of the image layers while the build is pushing to the registry.
+	PushProgress *ImageBuildPushProgress `json:"pushProgress,omitempty"`
+	// ContextDigest records the digests of the build context and Dockerfile for reproducibility audits.
+	ContextDigest *ImageBuildContextDigest `json:"contextDigest,omitempty"`
+	// RegistryAuthResults records the registries whose credentials were verified and the source of the credentials.
+	RegistryAuthResults []RegistryAuthResult `json:"registryAuthResults,omitempty"`
 
 	Conditions  []metav1.Condition     `json:"conditions,omitempty"`
 	Transitions []ImageBuildTransition `json:"transitions,omitempty"`
 	Phase       Phase                  `json:"phase,omitempty"`
+	// PrunedTransitions is the number of older transitions removed from the history to cap its size.
+	PrunedTransitions int `json:"prunedTransitions,omitempty"`
 
 	unappliedTransition ImageBuildTransition `json:"-"`
 }
@@ -73,8 +169,10 @@ type ImageBuildStatus struct {
 // +kubebuilder:printcolumn:name="Status",type=string,JSONPath=".status.phase"
 // +kubebuilder:printcolumn:name="Allocation Time",type=string,JSONPath=".status.allocationTime"
 // +kubebuilder:printcolumn:name="Build Time",type=string,JSONPath=".status.buildTime"
+// +kubebuilder:printcolumn:name="Compressed Size",type=string,JSONPath=".status.compressedImageSizeBytes",priority=10
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:printcolumn:name="Builder Address",type=string,JSONPath=".status.builderAddr",priority=10
+// +kubebuilder:printcolumn:name="Images",type=string,JSONPath=".spec.images",priority=10
 
 type ImageBuild struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -108,6 +206,28 @@ func (in *ImageBuild) SetPhase(p Phase) {
 	in.Status.Phase = p
 }
 
+// PruneTransitions removes the oldest transitions so that at most limit are kept, every transition is kept when limit
+// is zero.
+func (in *ImageBuild) PruneTransitions(limit int) {
+	if n := len(in.Status.Transitions) - limit; limit > 0 && n > 0 {
+		in.Status.Transitions = append([]ImageBuildTransition(nil), in.Status.Transitions[n:]...)
+		in.Status.PrunedTransitions += n
+	}
+}
+
+// QueueTime returns the time the build waited between its creation and the most recent Initializing transition. It
+// is nil until the build has been initialized.
+func (in *ImageBuild) QueueTime() *metav1.Duration {
+	for i := len(in.Status.Transitions) - 1; i >= 0; i-- {
+		trans := in.Status.Transitions[i]
+		if trans.Phase == PhaseInitializing {
+			return &metav1.Duration{Duration: trans.OccurredAt.Sub(in.CreationTimestamp.Time)}
+		}
+	}
+
+	return nil
+}
+
 // +kubebuilder:object:root=true
 
 type ImageBuildList struct {
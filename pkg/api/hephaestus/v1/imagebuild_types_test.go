@@ -0,0 +1,36 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageBuildPruneTransitions(t *testing.T) {
+	ib := &ImageBuild{}
+	for _, p := range []Phase{PhaseInitializing, PhaseRunning, PhaseInitializing, PhaseRunning, PhaseSucceeded} {
+		ib.SetPhase(p)
+	}
+
+	ib.PruneTransitions(0)
+	assert.Len(t, ib.Status.Transitions, 5, "every transition is kept without a limit")
+
+	ib.PruneTransitions(3)
+	assert.Len(t, ib.Status.Transitions, 3)
+	assert.Equal(t, PhaseInitializing, ib.Status.Transitions[0].Phase, "the oldest transitions are pruned")
+	assert.Equal(t, PhaseSucceeded, ib.Status.Transitions[2].Phase)
+	assert.Equal(t, 2, ib.Status.PrunedTransitions)
+	assert.NotNil(t, ib.QueueTime(), "the most recent initializing transition is kept")
+
+	ib.PruneTransitions(3)
+	assert.Equal(t, 2, ib.Status.PrunedTransitions)
+}
+
+func TestSetAnnotationDomain(t *testing.T) {
+	SetAnnotationDomain("builds.acme.io")
+	t.Cleanup(func() { SetAnnotationDomain(DefaultAnnotationDomain) })
+
+	assert.Equal(t, "builds.acme.io/requested-by", RequestedByAnnotation)
+	assert.Equal(t, "builds.acme.io/on-demand-only", OnDemandOnlyAnnotation)
+	assert.Equal(t, "builds.acme.io/image-cleanup", ImageCleanupFinalizer)
+}
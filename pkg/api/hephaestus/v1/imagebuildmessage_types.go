@@ -6,10 +6,20 @@ type ImageBuildMessageAMQPConnection struct {
 	URI      string `json:"uri"`
 	Queue    string `json:"queue"`
 	Exchange string `json:"exchange"`
+	// RoutingKey messages are published with, the queue name when blank.
+	RoutingKey string `json:"routingKey,omitempty"`
+}
+
+// ImageBuildMessageAWSDestination is the SNS topic and/or SQS queue messages are published to.
+type ImageBuildMessageAWSDestination struct {
+	TopicARN string `json:"topicARN,omitempty"`
+	QueueURL string `json:"queueURL,omitempty"`
 }
 
 type ImageBuildMessageSpec struct {
 	AMQP ImageBuildMessageAMQPConnection `json:"amqp"`
+	// AWS destination of the messages, the AMQP connection is blank when set.
+	AWS *ImageBuildMessageAWSDestination `json:"aws,omitempty"`
 }
 
 type ImageBuildMessageRecord struct {
@@ -19,6 +29,9 @@ type ImageBuildMessageRecord struct {
 
 type ImageBuildMessageStatus struct {
 	AMQPSentMessages []ImageBuildMessageRecord `json:"amqpSentMessages,omitempty"`
+	// Transitions is the complete transition history of the ImageBuild when transitions are offloaded, the ImageBuild
+	// itself may only keep the most recent ones.
+	Transitions []ImageBuildTransition `json:"transitions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
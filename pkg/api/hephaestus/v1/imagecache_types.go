@@ -7,6 +7,11 @@ import (
 type ImageCacheSpec struct {
 	Images       []string              `json:"images"`
 	RegistryAuth []RegistryCredentials `json:"registryAuth,omitempty"`
+	// MaxCacheSizeBytes triggers cache eviction on every builder whose cache exceeds this size. Builders are shared,
+	// so they are pruned to the smallest limit set by any image cache.
+	MaxCacheSizeBytes *int64 `json:"maxCacheSizeBytes,omitempty"`
+	// PruneFilters restrict which cache records are evicted using the "buildctl prune --filter" syntax.
+	PruneFilters []string `json:"pruneFilters,omitempty"`
 }
 
 type ImageCacheStatus struct {
@@ -14,6 +19,10 @@ type ImageCacheStatus struct {
 	CachedImages []string           `json:"cachedImages,omitempty"`
 	Conditions   []metav1.Condition `json:"conditions,omitempty"`
 	Phase        Phase              `json:"phase,omitempty"`
+	// ResolvedDigests maps every cached image to the digest it referenced when the cache was last warmed.
+	ResolvedDigests map[string]string `json:"resolvedDigests,omitempty"`
+	// ReclaimedBytes is the total size of cache records evicted from builders.
+	ReclaimedBytes int64 `json:"reclaimedBytes,omitempty"`
 }
 
 // +genclient
@@ -0,0 +1,158 @@
+// Package testing provides builders for valid hephaestus objects to be used in tests.
+package testing
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+const (
+	// DefaultImage is pushed by ImageBuilds and cached by ImageCaches unless other images are provided.
+	DefaultImage = "registry.example.com/hephaestus/test:latest"
+	// DefaultContext is the build context of ImageBuilds unless another one is provided.
+	DefaultContext = "https://artifacts.example.com/hephaestus/context.tgz"
+)
+
+// ImageBuildOption modifies an ImageBuild created by NewImageBuild.
+type ImageBuildOption func(*hephv1.ImageBuild)
+
+// NewImageBuild returns an ImageBuild that passes webhook validation, it pushes DefaultImage built from
+// DefaultContext unless options say otherwise.
+func NewImageBuild(name, namespace string, opts ...ImageBuildOption) *hephv1.ImageBuild {
+	ib := &hephv1.ImageBuild{
+		TypeMeta: metav1.TypeMeta{Kind: hephv1.ImageBuildKind, APIVersion: hephv1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: hephv1.ImageBuildSpec{
+			Images:  []string{DefaultImage},
+			Context: DefaultContext,
+			LogKey:  name,
+		},
+	}
+	for _, opt := range opts {
+		opt(ib)
+	}
+
+	return ib
+}
+
+// WithGenerateName replaces the name of the ImageBuild with a prefix the API server generates a name from.
+func WithGenerateName(prefix string) ImageBuildOption {
+	return func(ib *hephv1.ImageBuild) {
+		ib.Name = ""
+		ib.GenerateName = prefix
+	}
+}
+
+// WithCreationTimestamp sets the creation time of the ImageBuild.
+func WithCreationTimestamp(t time.Time) ImageBuildOption {
+	return func(ib *hephv1.ImageBuild) {
+		ib.CreationTimestamp = metav1.NewTime(t)
+	}
+}
+
+// WithLabels adds labels to the ImageBuild.
+func WithLabels(labels map[string]string) ImageBuildOption {
+	return func(ib *hephv1.ImageBuild) {
+		if ib.Labels == nil {
+			ib.Labels = map[string]string{}
+		}
+		for k, v := range labels {
+			ib.Labels[k] = v
+		}
+	}
+}
+
+// WithImages replaces the images pushed by the ImageBuild.
+func WithImages(images ...string) ImageBuildOption {
+	return func(ib *hephv1.ImageBuild) {
+		ib.Spec.Images = images
+	}
+}
+
+// WithContext replaces the build context of the ImageBuild.
+func WithContext(url string) ImageBuildOption {
+	return func(ib *hephv1.ImageBuild) {
+		ib.Spec.Context = url
+	}
+}
+
+// WithBuildArgs sets the "<key>=<value>" build args of the ImageBuild.
+func WithBuildArgs(args ...string) ImageBuildOption {
+	return func(ib *hephv1.ImageBuild) {
+		ib.Spec.BuildArgs = args
+	}
+}
+
+// WithRegistryAuth adds registry credentials to the ImageBuild.
+func WithRegistryAuth(creds ...hephv1.RegistryCredentials) ImageBuildOption {
+	return func(ib *hephv1.ImageBuild) {
+		ib.Spec.RegistryAuth = append(ib.Spec.RegistryAuth, creds...)
+	}
+}
+
+// WithPhases moves the ImageBuild through the phases in order, recording a transition at the given time for each.
+func WithPhases(at time.Time, phases ...hephv1.Phase) ImageBuildOption {
+	return func(ib *hephv1.ImageBuild) {
+		for _, phase := range phases {
+			ib.Status.Transitions = append(ib.Status.Transitions, hephv1.ImageBuildTransition{
+				PreviousPhase: ib.Status.Phase,
+				Phase:         phase,
+				OccurredAt:    metav1.NewTime(at),
+			})
+			ib.Status.Phase = phase
+		}
+	}
+}
+
+// Succeeded moves the ImageBuild through every phase of a successful build.
+func Succeeded(at time.Time) ImageBuildOption {
+	return WithPhases(at, hephv1.PhaseInitializing, hephv1.PhaseRunning, hephv1.PhaseSucceeded)
+}
+
+// Failed moves the ImageBuild through every phase of a failed build.
+func Failed(at time.Time) ImageBuildOption {
+	return WithPhases(at, hephv1.PhaseInitializing, hephv1.PhaseRunning, hephv1.PhaseFailed)
+}
+
+// ImageCacheOption modifies an ImageCache created by NewImageCache.
+type ImageCacheOption func(*hephv1.ImageCache)
+
+// NewImageCache returns an ImageCache that passes webhook validation, it caches DefaultImage unless options say
+// otherwise.
+func NewImageCache(name, namespace string, opts ...ImageCacheOption) *hephv1.ImageCache {
+	ic := &hephv1.ImageCache{
+		TypeMeta: metav1.TypeMeta{Kind: hephv1.ImageCacheKind, APIVersion: hephv1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: hephv1.ImageCacheSpec{
+			Images: []string{DefaultImage},
+		},
+	}
+	for _, opt := range opts {
+		opt(ic)
+	}
+
+	return ic
+}
+
+// WithCachedImages replaces the images cached by the ImageCache.
+func WithCachedImages(images ...string) ImageCacheOption {
+	return func(ic *hephv1.ImageCache) {
+		ic.Spec.Images = images
+	}
+}
+
+// WithCachePhase sets the phase of the ImageCache.
+func WithCachePhase(phase hephv1.Phase) ImageCacheOption {
+	return func(ic *hephv1.ImageCache) {
+		ic.Status.Phase = phase
+	}
+}
@@ -0,0 +1,40 @@
+package testing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	hephv1testing "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1/testing"
+	"github.com/dominodatalab/hephaestus/pkg/webhook"
+)
+
+func TestNewImageBuild(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ib := hephv1testing.NewImageBuild("build", "ns",
+		hephv1testing.WithCreationTimestamp(created),
+		hephv1testing.WithBuildArgs("A=1"),
+		hephv1testing.Succeeded(created.Add(time.Minute)),
+	)
+
+	_, err := webhook.NewImageBuildValidator(webhook.ImageBuildConfig{}).ValidateCreate(context.Background(), ib)
+	require.NoError(t, err)
+
+	assert.Equal(t, hephv1.PhaseSucceeded, ib.Status.Phase)
+	assert.Len(t, ib.Status.Transitions, 3)
+	if assert.NotNil(t, ib.QueueTime()) {
+		assert.Equal(t, time.Minute, ib.QueueTime().Duration)
+	}
+}
+
+func TestNewImageCache(t *testing.T) {
+	ic := hephv1testing.NewImageCache("cache", "ns", hephv1testing.WithCachePhase(hephv1.PhaseRunning))
+
+	_, err := (&webhook.ImageCacheValidator{}).ValidateCreate(context.Background(), ic)
+	require.NoError(t, err)
+	assert.Equal(t, hephv1.PhaseRunning, ic.Status.Phase)
+}
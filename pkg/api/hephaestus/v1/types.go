@@ -3,8 +3,9 @@ package v1
 import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 const (
-	ImageBuildKind = "ImageBuild"
-	ImageCacheKind = "ImageCache"
+	ImageBuildKind        = "ImageBuild"
+	ImageCacheKind        = "ImageCache"
+	ClusterImageCacheKind = "ClusterImageCache"
 )
 
 const (
@@ -35,6 +36,25 @@ const (
 	OwnedLabel = "hephaestus-owned"
 )
 
+// Cloud providers registry credentials can be retrieved from.
+const (
+	CloudProviderACR  = "acr"
+	CloudProviderECR  = "ecr"
+	CloudProviderGCP  = "gcp"
+	CloudProviderGHCR = "ghcr"
+)
+
+// CloudProviders lists the values accepted by RegistryCredentials.Provider.
+var CloudProviders = []string{CloudProviderACR, CloudProviderECR, CloudProviderGCP, CloudProviderGHCR}
+
+// Sources of registry credentials reported in RegistryAuthResult.
+const (
+	RegistryAuthSourceBasic       = "basic"
+	RegistryAuthSourceSecret      = "secret"
+	RegistryAuthSourceArtifactory = "artifactory"
+	RegistryAuthSourceCloud       = "cloud"
+)
+
 type BasicAuthCredentials struct {
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
@@ -45,6 +65,19 @@ type SecretCredentials struct {
 	Namespace string `json:"namespace,omitempty"`
 }
 
+// ArtifactoryTokenCredentials exchange the token stored in a secret for a short-lived Artifactory access token, which
+// is used as the registry password of the subject.
+type ArtifactoryTokenCredentials struct {
+	// TokenEndpoint of the Artifactory access service, e.g. "https://artifactory.example.com/access/api/v1/tokens".
+	// Its host must be one of the registries configured on the controller.
+	TokenEndpoint string `json:"tokenEndpoint,omitempty"`
+	// Subject the access token is issued for, usually the username of a service account.
+	Subject string `json:"subject,omitempty"`
+	// Secret holding the token allowed to issue access tokens for the subject under the "token" key. It must be in
+	// the namespace of the resource using it, unless the resource is cluster-scoped.
+	Secret *SecretCredentials `json:"secret,omitempty"`
+}
+
 type RegistryCredentials struct {
 	// NOTE: this field was previously used to assert the presence of an auth entry inside of secret credentials. if the
 	//  Server was missing, then an error was raised. this design is limiting because it requires users to create
@@ -57,13 +90,35 @@ type RegistryCredentials struct {
 	// this is now done automatically and this field is no longer necessary.
 	CloudProvided *bool `json:"cloudProvided,omitempty"`
 
-	BasicAuth *BasicAuthCredentials `json:"basicAuth,omitempty"`
-	Secret    *SecretCredentials    `json:"secret,omitempty"`
+	// Provider limits cloud credentials for the server to a single provider ("acr", "ecr", "gcp" or "ghcr"). Every
+	// registered provider matching the server is tried when blank. Only used without another credential source.
+	Provider string `json:"provider,omitempty"`
+
+	BasicAuth   *BasicAuthCredentials        `json:"basicAuth,omitempty"`
+	Secret      *SecretCredentials           `json:"secret,omitempty"`
+	Artifactory *ArtifactoryTokenCredentials `json:"artifactory,omitempty"`
+}
+
+// RegistryAuthResult is the outcome of verifying the credentials of a registry before a build.
+type RegistryAuthResult struct {
+	// Server the credentials were verified against.
+	Server string `json:"server"`
+	// Source of the credentials, one of "basic", "secret", "artifactory" or "cloud".
+	Source string `json:"source,omitempty"`
+	// Verified is true when the registry accepted the credentials.
+	Verified bool `json:"verified"`
+	// Message explains why the credentials were not verified.
+	Message string `json:"message,omitempty"`
 }
 
 type SecretReference struct {
 	Name      string `json:"name,omitempty"`
 	Namespace string `json:"namespace,omitempty"`
+	// MountPath replaces the default "{namespace}/{name}" prefix used to build secret ids, each key in the
+	// secret is exposed to RUN --mount=type=secret,id={mountPath}/{key} instead.
+	MountPath string `json:"mountPath,omitempty"`
+	// Keys limits the secret data exposed to the build, all keys are exposed when empty.
+	Keys []string `json:"keys,omitempty"`
 }
 
 // ImageBuildStatusTransitionMessage contains information about ImageBuild status transitions.
@@ -71,6 +126,8 @@ type SecretReference struct {
 // This type is used to publish JSON-formatted messages to one or more configured messaging
 // endpoints when ImageBuild resources undergo phase changes during the build process.
 type ImageBuildStatusTransitionMessage struct {
+	// SchemaVersion identifies the shape of the message, it is blank for legacy messages.
+	SchemaVersion string `json:"schemaVersion,omitempty"`
 	// Name of the ImageBuild resource that underwent a transition.
 	Name string `json:"name"`
 	// Annotations present on the resource.
@@ -88,4 +145,13 @@ type ImageBuildStatusTransitionMessage struct {
 	ImageURLs []string `json:"imageURLs,omitempty"`
 	// ErrorMessage contains the details of error when one occurs.
 	ErrorMessage string `json:"errorMessage,omitempty"`
+	// QueueTime is the time between the creation of the ImageBuild and the start of build processing.
+	// This field is populated once the ImageBuild has been initialized, starting with schema version v2.
+	QueueTime *metav1.Duration `json:"queueTime,omitempty"`
+	// AllocationTime is the time spent leasing a buildkit worker.
+	// This field is populated once a worker has been leased, starting with schema version v2.
+	AllocationTime *metav1.Duration `json:"allocationTime,omitempty"`
+	// BuilderAddr is the routable address of the buildkit worker used by the build.
+	// This field is populated once a worker has been leased, starting with schema version v2.
+	BuilderAddr string `json:"builderAddr,omitempty"`
 }
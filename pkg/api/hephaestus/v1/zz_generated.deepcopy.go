@@ -6,9 +6,29 @@ package v1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArtifactoryTokenCredentials) DeepCopyInto(out *ArtifactoryTokenCredentials) {
+	*out = *in
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(SecretCredentials)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArtifactoryTokenCredentials.
+func (in *ArtifactoryTokenCredentials) DeepCopy() *ArtifactoryTokenCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(ArtifactoryTokenCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BasicAuthCredentials) DeepCopyInto(out *BasicAuthCredentials) {
 	*out = *in
@@ -24,6 +44,139 @@ func (in *BasicAuthCredentials) DeepCopy() *BasicAuthCredentials {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildQuotaUsage) DeepCopyInto(out *BuildQuotaUsage) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildQuotaUsage.
+func (in *BuildQuotaUsage) DeepCopy() *BuildQuotaUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildQuotaUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BuildQuotaUsage) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildQuotaUsageList) DeepCopyInto(out *BuildQuotaUsageList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]BuildQuotaUsage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildQuotaUsageList.
+func (in *BuildQuotaUsageList) DeepCopy() *BuildQuotaUsageList {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildQuotaUsageList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BuildQuotaUsageList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BuildQuotaUsageStatus) DeepCopyInto(out *BuildQuotaUsageStatus) {
+	*out = *in
+	in.WindowStart.DeepCopyInto(&out.WindowStart)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BuildQuotaUsageStatus.
+func (in *BuildQuotaUsageStatus) DeepCopy() *BuildQuotaUsageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BuildQuotaUsageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterImageCache) DeepCopyInto(out *ClusterImageCache) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterImageCache.
+func (in *ClusterImageCache) DeepCopy() *ClusterImageCache {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterImageCache)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterImageCache) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterImageCacheList) DeepCopyInto(out *ClusterImageCacheList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterImageCache, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterImageCacheList.
+func (in *ClusterImageCacheList) DeepCopy() *ClusterImageCacheList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterImageCacheList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterImageCacheList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageBuild) DeepCopyInto(out *ImageBuild) {
 	*out = *in
@@ -66,6 +219,21 @@ func (in *ImageBuildAMQPOverrides) DeepCopy() *ImageBuildAMQPOverrides {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageBuildContextDigest) DeepCopyInto(out *ImageBuildContextDigest) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageBuildContextDigest.
+func (in *ImageBuildContextDigest) DeepCopy() *ImageBuildContextDigest {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageBuildContextDigest)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageBuildList) DeepCopyInto(out *ImageBuildList) {
 	*out = *in
@@ -103,7 +271,7 @@ func (in *ImageBuildMessage) DeepCopyInto(out *ImageBuildMessage) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -140,6 +308,21 @@ func (in *ImageBuildMessageAMQPConnection) DeepCopy() *ImageBuildMessageAMQPConn
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageBuildMessageAWSDestination) DeepCopyInto(out *ImageBuildMessageAWSDestination) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageBuildMessageAWSDestination.
+func (in *ImageBuildMessageAWSDestination) DeepCopy() *ImageBuildMessageAWSDestination {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageBuildMessageAWSDestination)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageBuildMessageList) DeepCopyInto(out *ImageBuildMessageList) {
 	*out = *in
@@ -193,6 +376,11 @@ func (in *ImageBuildMessageRecord) DeepCopy() *ImageBuildMessageRecord {
 func (in *ImageBuildMessageSpec) DeepCopyInto(out *ImageBuildMessageSpec) {
 	*out = *in
 	out.AMQP = in.AMQP
+	if in.AWS != nil {
+		in, out := &in.AWS, &out.AWS
+		*out = new(ImageBuildMessageAWSDestination)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageBuildMessageSpec.
@@ -215,6 +403,13 @@ func (in *ImageBuildMessageStatus) DeepCopyInto(out *ImageBuildMessageStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Transitions != nil {
+		in, out := &in.Transitions, &out.Transitions
+		*out = make([]ImageBuildTransition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageBuildMessageStatus.
@@ -227,6 +422,22 @@ func (in *ImageBuildMessageStatus) DeepCopy() *ImageBuildMessageStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageBuildPushProgress) DeepCopyInto(out *ImageBuildPushProgress) {
+	*out = *in
+	in.UpdatedAt.DeepCopyInto(&out.UpdatedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageBuildPushProgress.
+func (in *ImageBuildPushProgress) DeepCopy() *ImageBuildPushProgress {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageBuildPushProgress)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageBuildSpec) DeepCopyInto(out *ImageBuildSpec) {
 	*out = *in
@@ -260,6 +471,32 @@ func (in *ImageBuildSpec) DeepCopyInto(out *ImageBuildSpec) {
 	if in.Secrets != nil {
 		in, out := &in.Secrets, &out.Secrets
 		*out = make([]SecretReference, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ImageLabels != nil {
+		in, out := &in.ImageLabels, &out.ImageLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ImageAnnotations != nil {
+		in, out := &in.ImageAnnotations, &out.ImageAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.IgnorePatterns != nil {
+		in, out := &in.IgnorePatterns, &out.IgnorePatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Platforms != nil {
+		in, out := &in.Platforms, &out.Platforms
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
 }
@@ -277,6 +514,21 @@ func (in *ImageBuildSpec) DeepCopy() *ImageBuildSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageBuildStatus) DeepCopyInto(out *ImageBuildStatus) {
 	*out = *in
+	if in.AllocationTime != nil {
+		in, out := &in.AllocationTime, &out.AllocationTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.BuildTime != nil {
+		in, out := &in.BuildTime, &out.BuildTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.CompressedImageSizeBytes != nil {
+		in, out := &in.CompressedImageSizeBytes, &out.CompressedImageSizeBytes
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 	if in.Labels != nil {
 		in, out := &in.Labels, &out.Labels
 		*out = make(map[string]string, len(*in))
@@ -284,6 +536,21 @@ func (in *ImageBuildStatus) DeepCopyInto(out *ImageBuildStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.PushProgress != nil {
+		in, out := &in.PushProgress, &out.PushProgress
+		*out = new(ImageBuildPushProgress)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ContextDigest != nil {
+		in, out := &in.ContextDigest, &out.ContextDigest
+		*out = new(ImageBuildContextDigest)
+		**out = **in
+	}
+	if in.RegistryAuthResults != nil {
+		in, out := &in.RegistryAuthResults, &out.RegistryAuthResults
+		*out = make([]RegistryAuthResult, len(*in))
+		copy(*out, *in)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
@@ -327,6 +594,16 @@ func (in *ImageBuildStatusTransitionMessage) DeepCopyInto(out *ImageBuildStatusT
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.QueueTime != nil {
+		in, out := &in.QueueTime, &out.QueueTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.AllocationTime != nil {
+		in, out := &in.AllocationTime, &out.AllocationTime
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageBuildStatusTransitionMessage.
@@ -429,6 +706,16 @@ func (in *ImageCacheSpec) DeepCopyInto(out *ImageCacheSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.MaxCacheSizeBytes != nil {
+		in, out := &in.MaxCacheSizeBytes, &out.MaxCacheSizeBytes
+		*out = new(int64)
+		**out = **in
+	}
+	if in.PruneFilters != nil {
+		in, out := &in.PruneFilters, &out.PruneFilters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageCacheSpec.
@@ -461,6 +748,13 @@ func (in *ImageCacheStatus) DeepCopyInto(out *ImageCacheStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ResolvedDigests != nil {
+		in, out := &in.ResolvedDigests, &out.ResolvedDigests
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageCacheStatus.
@@ -473,6 +767,21 @@ func (in *ImageCacheStatus) DeepCopy() *ImageCacheStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegistryAuthResult) DeepCopyInto(out *RegistryAuthResult) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryAuthResult.
+func (in *RegistryAuthResult) DeepCopy() *RegistryAuthResult {
+	if in == nil {
+		return nil
+	}
+	out := new(RegistryAuthResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RegistryCredentials) DeepCopyInto(out *RegistryCredentials) {
 	*out = *in
@@ -491,6 +800,11 @@ func (in *RegistryCredentials) DeepCopyInto(out *RegistryCredentials) {
 		*out = new(SecretCredentials)
 		**out = **in
 	}
+	if in.Artifactory != nil {
+		in, out := &in.Artifactory, &out.Artifactory
+		*out = new(ArtifactoryTokenCredentials)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryCredentials.
@@ -521,6 +835,11 @@ func (in *SecretCredentials) DeepCopy() *SecretCredentials {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretReference) DeepCopyInto(out *SecretReference) {
 	*out = *in
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretReference.
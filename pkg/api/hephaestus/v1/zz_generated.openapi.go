@@ -12,16 +12,25 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ArtifactoryTokenCredentials":       schema_pkg_api_hephaestus_v1_ArtifactoryTokenCredentials(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BasicAuthCredentials":              schema_pkg_api_hephaestus_v1_BasicAuthCredentials(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BuildQuotaUsage":                   schema_pkg_api_hephaestus_v1_BuildQuotaUsage(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BuildQuotaUsageList":               schema_pkg_api_hephaestus_v1_BuildQuotaUsageList(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BuildQuotaUsageStatus":             schema_pkg_api_hephaestus_v1_BuildQuotaUsageStatus(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ClusterImageCache":                 schema_pkg_api_hephaestus_v1_ClusterImageCache(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ClusterImageCacheList":             schema_pkg_api_hephaestus_v1_ClusterImageCacheList(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuild":                        schema_pkg_api_hephaestus_v1_ImageBuild(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildAMQPOverrides":           schema_pkg_api_hephaestus_v1_ImageBuildAMQPOverrides(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildContextDigest":           schema_pkg_api_hephaestus_v1_ImageBuildContextDigest(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildList":                    schema_pkg_api_hephaestus_v1_ImageBuildList(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessage":                 schema_pkg_api_hephaestus_v1_ImageBuildMessage(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageAMQPConnection":   schema_pkg_api_hephaestus_v1_ImageBuildMessageAMQPConnection(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageAWSDestination":   schema_pkg_api_hephaestus_v1_ImageBuildMessageAWSDestination(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageList":             schema_pkg_api_hephaestus_v1_ImageBuildMessageList(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageRecord":           schema_pkg_api_hephaestus_v1_ImageBuildMessageRecord(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageSpec":             schema_pkg_api_hephaestus_v1_ImageBuildMessageSpec(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageStatus":           schema_pkg_api_hephaestus_v1_ImageBuildMessageStatus(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildPushProgress":            schema_pkg_api_hephaestus_v1_ImageBuildPushProgress(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildSpec":                    schema_pkg_api_hephaestus_v1_ImageBuildSpec(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildStatus":                  schema_pkg_api_hephaestus_v1_ImageBuildStatus(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildStatusTransitionMessage": schema_pkg_api_hephaestus_v1_ImageBuildStatusTransitionMessage(ref),
@@ -30,12 +39,48 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageCacheList":                    schema_pkg_api_hephaestus_v1_ImageCacheList(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageCacheSpec":                    schema_pkg_api_hephaestus_v1_ImageCacheSpec(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageCacheStatus":                  schema_pkg_api_hephaestus_v1_ImageCacheStatus(ref),
+		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.RegistryAuthResult":                schema_pkg_api_hephaestus_v1_RegistryAuthResult(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.RegistryCredentials":               schema_pkg_api_hephaestus_v1_RegistryCredentials(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.SecretCredentials":                 schema_pkg_api_hephaestus_v1_SecretCredentials(ref),
 		"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.SecretReference":                   schema_pkg_api_hephaestus_v1_SecretReference(ref),
 	}
 }
 
+func schema_pkg_api_hephaestus_v1_ArtifactoryTokenCredentials(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ArtifactoryTokenCredentials exchange the token stored in a secret for a short-lived Artifactory access token, which is used as the registry password of the subject.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"tokenEndpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TokenEndpoint of the Artifactory access service, e.g. \"https://artifactory.example.com/access/api/v1/tokens\". Its host must be one of the registries configured on the controller.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"subject": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Subject the access token is issued for, usually the username of a service account.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"secret": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Secret holding the token allowed to issue access tokens for the subject under the \"token\" key. It must be in the namespace of the resource using it, unless the resource is cluster-scoped.",
+							Ref:         ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.SecretCredentials"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.SecretCredentials"},
+	}
+}
+
 func schema_pkg_api_hephaestus_v1_BasicAuthCredentials(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -60,6 +105,225 @@ func schema_pkg_api_hephaestus_v1_BasicAuthCredentials(ref common.ReferenceCallb
 	}
 }
 
+func schema_pkg_api_hephaestus_v1_BuildQuotaUsage(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "BuildQuotaUsage records the build quota consumption of its namespace. It is written by the controller and read by the ImageBuild webhook, which rejects new builds once a quota is exhausted.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BuildQuotaUsageStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BuildQuotaUsageStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_api_hephaestus_v1_BuildQuotaUsageList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BuildQuotaUsage"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BuildQuotaUsage", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+	}
+}
+
+func schema_pkg_api_hephaestus_v1_BuildQuotaUsageStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "BuildQuotaUsageStatus counts the builds submitted by a namespace and the image bytes they pushed during the current quota window.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"windowStart": {
+						SchemaProps: spec.SchemaProps{
+							Description: "WindowStart is the time the current quota window began, counters are reset once the window elapses.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"builds": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Builds is the number of ImageBuilds submitted during the window.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"pushedBytes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PushedBytes is the compressed size of the images pushed by builds that succeeded during the window.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_api_hephaestus_v1_ClusterImageCache(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClusterImageCache warms base images on every builder regardless of namespace.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageCacheSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageCacheStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageCacheSpec", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageCacheStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_api_hephaestus_v1_ClusterImageCacheList(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Default: map[string]interface{}{},
+							Ref:     ref("k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"),
+						},
+					},
+					"items": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ClusterImageCache"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Required: []string{"items"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ClusterImageCache", "k8s.io/apimachinery/pkg/apis/meta/v1.ListMeta"},
+	}
+}
+
 func schema_pkg_api_hephaestus_v1_ImageBuild(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -124,6 +388,40 @@ func schema_pkg_api_hephaestus_v1_ImageBuildAMQPOverrides(ref common.ReferenceCa
 							Format: "",
 						},
 					},
+					"routingKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RoutingKey of the transition messages of this build, e.g. \"hephaestus.team-a\" to publish to a topic exchange that tenants bind their queues to. Overrides the routing key configured on the controller.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func schema_pkg_api_hephaestus_v1_ImageBuildContextDigest(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ImageBuildContextDigest identifies the exact inputs of a build.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"archive": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Archive is the SHA256 digest of the remote context archive, it is blank when the context was not fetched by the controller.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"dockerfile": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Dockerfile is the SHA256 digest of the Dockerfile used by the build.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 			},
 		},
@@ -251,6 +549,13 @@ func schema_pkg_api_hephaestus_v1_ImageBuildMessageAMQPConnection(ref common.Ref
 							Format:  "",
 						},
 					},
+					"routingKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RoutingKey messages are published with, the queue name when blank.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 				Required: []string{"uri", "queue", "exchange"},
 			},
@@ -258,6 +563,31 @@ func schema_pkg_api_hephaestus_v1_ImageBuildMessageAMQPConnection(ref common.Ref
 	}
 }
 
+func schema_pkg_api_hephaestus_v1_ImageBuildMessageAWSDestination(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ImageBuildMessageAWSDestination is the SNS topic and/or SQS queue messages are published to.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"topicARN": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"queueURL": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 func schema_pkg_api_hephaestus_v1_ImageBuildMessageList(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -340,43 +670,101 @@ func schema_pkg_api_hephaestus_v1_ImageBuildMessageSpec(ref common.ReferenceCall
 				Properties: map[string]spec.Schema{
 					"amqp": {
 						SchemaProps: spec.SchemaProps{
-							Default: map[string]interface{}{},
-							Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageAMQPConnection"),
+							Default: map[string]interface{}{},
+							Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageAMQPConnection"),
+						},
+					},
+					"aws": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AWS destination of the messages, the AMQP connection is blank when set.",
+							Ref:         ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageAWSDestination"),
+						},
+					},
+				},
+				Required: []string{"amqp"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageAMQPConnection", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageAWSDestination"},
+	}
+}
+
+func schema_pkg_api_hephaestus_v1_ImageBuildMessageStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"object"},
+				Properties: map[string]spec.Schema{
+					"amqpSentMessages": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageRecord"),
+									},
+								},
+							},
+						},
+					},
+					"transitions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Transitions is the complete transition history of the ImageBuild when transitions are offloaded, the ImageBuild itself may only keep the most recent ones.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildTransition"),
+									},
+								},
+							},
 						},
 					},
 				},
-				Required: []string{"amqp"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageAMQPConnection"},
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageRecord", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildTransition"},
 	}
 }
 
-func schema_pkg_api_hephaestus_v1_ImageBuildMessageStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_api_hephaestus_v1_ImageBuildPushProgress(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Type: []string{"object"},
+				Description: "ImageBuildPushProgress reports how much of the image has been uploaded to the registry.",
+				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
-					"amqpSentMessages": {
+					"pushedBytes": {
 						SchemaProps: spec.SchemaProps{
-							Type: []string{"array"},
-							Items: &spec.SchemaOrArray{
-								Schema: &spec.Schema{
-									SchemaProps: spec.SchemaProps{
-										Default: map[string]interface{}{},
-										Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageRecord"),
-									},
-								},
-							},
+							Description: "PushedBytes is the number of bytes uploaded so far.",
+							Default:     0,
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"totalBytes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "TotalBytes is the number of bytes that need to be uploaded, it grows as layers are discovered.",
+							Default:     0,
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"updatedAt": {
+						SchemaProps: spec.SchemaProps{
+							Description: "UpdatedAt is the time the progress was last reported, updates are throttled.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
 						},
 					},
 				},
+				Required: []string{"pushedBytes", "totalBytes"},
 			},
 		},
 		Dependencies: []string{
-			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildMessageRecord"},
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
@@ -401,6 +789,13 @@ func schema_pkg_api_hephaestus_v1_ImageBuildSpec(ref common.ReferenceCallback) c
 							Format:      "",
 						},
 					},
+					"contextSubPath": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ContextSubPath selects a directory inside the remote context that is used as the build root, so one archive can host several builds. The Dockerfile and .dockerignore are read from this directory.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"images": {
 						SchemaProps: spec.SchemaProps{
 							Description: "Images is a list of images to build and push.",
@@ -501,6 +896,103 @@ func schema_pkg_api_hephaestus_v1_ImageBuildSpec(ref common.ReferenceCallback) c
 							},
 						},
 					},
+					"imageLabels": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ImageLabels are applied to the built images as OCI config labels and mirrored onto the image manifests as annotations so that attribution metadata survives into the registry.",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"imageAnnotations": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ImageAnnotations are added to the manifests of the built images, and to their index when the build targets more than one platform.",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"skipIfExists": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SkipIfExists marks the build as succeeded without building when every image already exists in its registry and references the same digest.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"expectedDigest": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ExpectedDigest that the existing images must reference for the build to be skipped. Requires skipIfExists.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"builderName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BuilderName pins the build to a specific buildkit worker pod, bypassing the lease queue. The build fails when the worker is not running or already leased. Intended for reproducing failures against a known worker cache state.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"builderEnv": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BuilderEnv injects the HEPHAESTUS_BUILD_NAME, HEPHAESTUS_BUILD_NAMESPACE and HEPHAESTUS_REQUESTED_BY build args so that Dockerfiles can stamp provenance with matching ARG instructions. They cannot be set via buildArgs.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"ignorePatterns": {
+						SchemaProps: spec.SchemaProps{
+							Description: "IgnorePatterns are evaluated after the .dockerignore file of the context using the same syntax, so paths ignored by the file can be re-included with \"!\" patterns. Matching paths are not sent to buildkit.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"platforms": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Platforms the image is built for, e.g. \"linux/arm64\". Overrides the platforms configured on the controller. Builds that only target arm64 run on the arm64 worker pool when one is configured.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"deleteImagesOnCleanup": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DeleteImagesOnCleanup deletes the pushed images from their registries by digest when the build is deleted, e.g. by the garbage collector. Every tag referencing the digest is removed with it. Builds that were skipped because their images already existed never delete them. The build is held back by a finalizer until its images are deleted, so it has to be deleted before the controller is uninstalled.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
 				},
 			},
 		},
@@ -518,15 +1010,13 @@ func schema_pkg_api_hephaestus_v1_ImageBuildStatus(ref common.ReferenceCallback)
 					"allocationTime": {
 						SchemaProps: spec.SchemaProps{
 							Description: "AllocationTime is the total time spent allocating a build pod.",
-							Type:        []string{"string"},
-							Format:      "",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
 						},
 					},
 					"buildTime": {
 						SchemaProps: spec.SchemaProps{
 							Description: "BuildTime is the total time spent during the image build process.",
-							Type:        []string{"string"},
-							Format:      "",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
 						},
 					},
 					"builderAddr": {
@@ -539,8 +1029,7 @@ func schema_pkg_api_hephaestus_v1_ImageBuildStatus(ref common.ReferenceCallback)
 					"compressedImageSizeBytes": {
 						SchemaProps: spec.SchemaProps{
 							Description: "CompressedImageSizeBytes is the total size of all the compressed layers in the image.",
-							Type:        []string{"string"},
-							Format:      "",
+							Ref:         ref("k8s.io/apimachinery/pkg/api/resource.Quantity"),
 						},
 					},
 					"digest": {
@@ -566,6 +1055,32 @@ func schema_pkg_api_hephaestus_v1_ImageBuildStatus(ref common.ReferenceCallback)
 							},
 						},
 					},
+					"pushProgress": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PushProgress reports the upload of the image layers while the build is pushing to the registry.",
+							Ref:         ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildPushProgress"),
+						},
+					},
+					"contextDigest": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ContextDigest records the digests of the build context and Dockerfile for reproducibility audits.",
+							Ref:         ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildContextDigest"),
+						},
+					},
+					"registryAuthResults": {
+						SchemaProps: spec.SchemaProps{
+							Description: "RegistryAuthResults records the registries whose credentials were verified and the source of the credentials.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.RegistryAuthResult"),
+									},
+								},
+							},
+						},
+					},
 					"conditions": {
 						SchemaProps: spec.SchemaProps{
 							Type: []string{"array"},
@@ -598,11 +1113,18 @@ func schema_pkg_api_hephaestus_v1_ImageBuildStatus(ref common.ReferenceCallback)
 							Format: "",
 						},
 					},
+					"prunedTransitions": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PrunedTransitions is the number of older transitions removed from the history to cap its size.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildTransition", "k8s.io/apimachinery/pkg/apis/meta/v1.Condition"},
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildContextDigest", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildPushProgress", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ImageBuildTransition", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.RegistryAuthResult", "k8s.io/apimachinery/pkg/api/resource.Quantity", "k8s.io/apimachinery/pkg/apis/meta/v1.Condition", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
 	}
 }
 
@@ -613,6 +1135,13 @@ func schema_pkg_api_hephaestus_v1_ImageBuildStatusTransitionMessage(ref common.R
 				Description: "ImageBuildStatusTransitionMessage contains information about ImageBuild status transitions.\n\nThis type is used to publish JSON-formatted messages to one or more configured messaging endpoints when ImageBuild resources undergo phase changes during the build process.",
 				Type:        []string{"object"},
 				Properties: map[string]spec.Schema{
+					"schemaVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SchemaVersion identifies the shape of the message, it is blank for legacy messages.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"name": {
 						SchemaProps: spec.SchemaProps{
 							Description: "Name of the ImageBuild resource that underwent a transition.",
@@ -689,12 +1218,31 @@ func schema_pkg_api_hephaestus_v1_ImageBuildStatusTransitionMessage(ref common.R
 							Format:      "",
 						},
 					},
+					"queueTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "QueueTime is the time between the creation of the ImageBuild and the start of build processing. This field is populated once the ImageBuild has been initialized, starting with schema version v2.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"allocationTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AllocationTime is the time spent leasing a buildkit worker. This field is populated once a worker has been leased, starting with schema version v2.",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Duration"),
+						},
+					},
+					"builderAddr": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BuilderAddr is the routable address of the buildkit worker used by the build. This field is populated once a worker has been leased, starting with schema version v2.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 				Required: []string{"name", "objectLink", "previousPhase", "currentPhase", "occurredAt"},
 			},
 		},
 		Dependencies: []string{
-			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
@@ -859,6 +1407,28 @@ func schema_pkg_api_hephaestus_v1_ImageCacheSpec(ref common.ReferenceCallback) c
 							},
 						},
 					},
+					"maxCacheSizeBytes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MaxCacheSizeBytes triggers cache eviction on every builder whose cache exceeds this size. Builders are shared, so they are pruned to the smallest limit set by any image cache.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+					"pruneFilters": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PruneFilters restrict which cache records are evicted using the \"buildctl prune --filter\" syntax.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
 				},
 				Required: []string{"images"},
 			},
@@ -921,6 +1491,29 @@ func schema_pkg_api_hephaestus_v1_ImageCacheStatus(ref common.ReferenceCallback)
 							Format: "",
 						},
 					},
+					"resolvedDigests": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ResolvedDigests maps every cached image to the digest it referenced when the cache was last warmed.",
+							Type:        []string{"object"},
+							AdditionalProperties: &spec.SchemaOrBool{
+								Allows: true,
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
+					"reclaimedBytes": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ReclaimedBytes is the total size of cache records evicted from builders.",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
 				},
 			},
 		},
@@ -929,6 +1522,50 @@ func schema_pkg_api_hephaestus_v1_ImageCacheStatus(ref common.ReferenceCallback)
 	}
 }
 
+func schema_pkg_api_hephaestus_v1_RegistryAuthResult(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "RegistryAuthResult is the outcome of verifying the credentials of a registry before a build.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"server": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Server the credentials were verified against.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"source": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Source of the credentials, one of \"basic\", \"secret\", \"artifactory\" or \"cloud\".",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"verified": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Verified is true when the registry accepted the credentials.",
+							Default:     false,
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Message explains why the credentials were not verified.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"server", "verified"},
+			},
+		},
+	}
+}
+
 func schema_pkg_api_hephaestus_v1_RegistryCredentials(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -949,6 +1586,13 @@ func schema_pkg_api_hephaestus_v1_RegistryCredentials(ref common.ReferenceCallba
 							Format:      "",
 						},
 					},
+					"provider": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Provider limits cloud credentials for the server to a single provider (\"acr\", \"ecr\", \"gcp\" or \"ghcr\"). Every registered provider matching the server is tried when blank. Only used without another credential source.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"basicAuth": {
 						SchemaProps: spec.SchemaProps{
 							Ref: ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BasicAuthCredentials"),
@@ -959,11 +1603,16 @@ func schema_pkg_api_hephaestus_v1_RegistryCredentials(ref common.ReferenceCallba
 							Ref: ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.SecretCredentials"),
 						},
 					},
+					"artifactory": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ArtifactoryTokenCredentials"),
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BasicAuthCredentials", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.SecretCredentials"},
+			"github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.ArtifactoryTokenCredentials", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.BasicAuthCredentials", "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1.SecretCredentials"},
 	}
 }
 
@@ -1009,6 +1658,28 @@ func schema_pkg_api_hephaestus_v1_SecretReference(ref common.ReferenceCallback)
 							Format: "",
 						},
 					},
+					"mountPath": {
+						SchemaProps: spec.SchemaProps{
+							Description: "MountPath replaces the default \"{namespace}/{name}\" prefix used to build secret ids, each key in the secret is exposed to RUN --mount=type=secret,id={mountPath}/{key} instead.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"keys": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Keys limits the secret data exposed to the build, all keys are exposed when empty.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: "",
+										Type:    []string{"string"},
+										Format:  "",
+									},
+								},
+							},
+						},
+					},
 				},
 			},
 		},
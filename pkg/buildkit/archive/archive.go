@@ -5,6 +5,8 @@ import (
 	"bufio"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -18,6 +20,8 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/h2non/filetype"
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/net/http/httpproxy"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
@@ -39,11 +43,93 @@ type fileDownloader interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-type Extractor func(context.Context, logr.Logger, string, string, time.Duration) (*Extraction, error)
+type Extractor func(ctx context.Context, log logr.Logger, url, wd string, opts FetchOptions) (*Extraction, error)
+
+// FetchOptions customize how FetchAndExtract downloads and extracts an archive.
+type FetchOptions struct {
+	// Client downloads the archive, http.DefaultClient is used when nil.
+	Client *http.Client
+	// Cache serves archives from local disk when the server reports them as unchanged.
+	Cache *Cache
+	// Quota is charged for the downloaded archive and every extracted file.
+	Quota Quota
+	// Timeout for the download and extraction, there is no limit when zero.
+	Timeout time.Duration
+}
+
+// Quota limits the amount of data written into the working directory.
+type Quota interface {
+	Reserve(n int64) error
+}
 
 type Extraction struct {
-	Archive     string
-	ContentsDir string
+	Archive string
+	// ArchiveDigest is the SHA256 digest of the downloaded archive.
+	ArchiveDigest digest.Digest
+	ContentsDir   string
+}
+
+const (
+	defaultDialTimeout  = 30 * time.Second
+	defaultMaxRedirects = 10
+)
+
+// ClientOptions customize the HTTP client used to download remote contexts.
+type ClientOptions struct {
+	// RootCAs used to verify server certificates, the system pool is used when nil.
+	RootCAs *x509.CertPool
+	// HTTPProxy, HTTPSProxy and NoProxy replace the proxy environment variables when any of them is set.
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// DialTimeout defaults to 30s when zero.
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout is unlimited when zero.
+	ResponseHeaderTimeout time.Duration
+	// MaxRedirects defaults to 10 when zero.
+	MaxRedirects int
+}
+
+// NewClient returns an HTTP client for FetchAndExtract configured with the options.
+func NewClient(opts ClientOptions) *http.Client {
+	dialTimeout := opts.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	maxRedirects := opts.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+
+	if opts.HTTPProxy != "" || opts.HTTPSProxy != "" || opts.NoProxy != "" {
+		proxyFunc := (&httpproxy.Config{
+			HTTPProxy:  opts.HTTPProxy,
+			HTTPSProxy: opts.HTTPSProxy,
+			NoProxy:    opts.NoProxy,
+		}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) { return proxyFunc(req.URL) }
+	}
+
+	if opts.RootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    opts.RootCAs,
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
 }
 
 func AssertDir(path string) error {
@@ -58,10 +144,16 @@ func AssertDir(path string) error {
 	return nil
 }
 
-func FetchAndExtract(ctx context.Context, log logr.Logger, url, wd string, timeout time.Duration) (*Extraction, error) {
-	if timeout > 0 {
+// FetchAndExtract downloads the archive at url into wd and extracts it.
+func FetchAndExtract(ctx context.Context, log logr.Logger, url, wd string, opts FetchOptions) (*Extraction, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if opts.Timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, timeout)
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
 		defer cancel()
 	}
 
@@ -72,12 +164,17 @@ func FetchAndExtract(ctx context.Context, log logr.Logger, url, wd string, timeo
 	archive := filepath.Join(wd, "archive")
 
 	err := wait.ExponentialBackoffWithContext(ctx, defaultBackoff, func(ctx context.Context) (bool, error) {
-		return downloadFile(ctx, log, http.DefaultClient, url, archive)
+		return downloadFile(ctx, log, client, opts.Cache, opts.Quota, url, archive)
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	archiveDigest, err := fileDigest(archive)
+	if err != nil {
+		return nil, err
+	}
+
 	ct, err := getFileContentType(archive)
 	if err != nil {
 		return nil, err
@@ -90,16 +187,27 @@ func FetchAndExtract(ctx context.Context, log logr.Logger, url, wd string, timeo
 	if err := os.MkdirAll(dest, 0755); err != nil {
 		return nil, err
 	}
-	if err := extract(archive, ct, dest); err != nil {
+	if err := extract(archive, ct, dest, opts.Quota); err != nil {
 		return nil, err
 	}
 
 	return &Extraction{
-		Archive:     archive,
-		ContentsDir: dest,
+		Archive:       archive,
+		ArchiveDigest: archiveDigest,
+		ContentsDir:   dest,
 	}, nil
 }
 
+func fileDigest(fp string) (digest.Digest, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return digest.Canonical.FromReader(f)
+}
+
 func retryable(err *url.Error) bool {
 	// If we get any sort of operational error before an HTTP response we retry it.
 	var opError *net.OpError
@@ -108,11 +216,26 @@ func retryable(err *url.Error) bool {
 
 // downloadFile takes a file URL and local location to download it to.
 // It returns "done" (retryable or not) and an error.
-func downloadFile(ctx context.Context, log logr.Logger, c fileDownloader, fileURL, fp string) (bool, error) {
+func downloadFile(
+	ctx context.Context,
+	log logr.Logger,
+	c fileDownloader,
+	cache *Cache,
+	quota Quota,
+	fileURL, fp string,
+) (bool, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
 	if err != nil {
 		return false, err
 	}
+
+	var cachedETag string
+	if cache != nil {
+		if etag, ok := cache.ETag(fileURL); ok {
+			cachedETag = etag
+			req.Header.Set("If-None-Match", etag)
+		}
+	}
 	resp, err := c.Do(req)
 	if err != nil {
 		var urlError *url.Error
@@ -135,19 +258,38 @@ func downloadFile(ctx context.Context, log logr.Logger, c fileDownloader, fileUR
 			"url", fileURL, "file", fp, "code", resp.StatusCode,
 		)
 		return false, nil
+	case http.StatusNotModified:
+		if cachedETag != "" {
+			err = cache.Restore(fileURL, cachedETag, fp, quota)
+			if errors.Is(err, errCacheMiss) {
+				// the entry was replaced or evicted after the request was sent, the retry fetches it again
+				log.Error(err, "Cannot restore cached context, will attempt to retry", "url", fileURL)
+				return false, nil
+			}
+			if err == nil {
+				log.Info("Using cached context", "url", fileURL, "etag", cachedETag)
+			}
+
+			return true, err
+		}
+
+		return false, fmt.Errorf("file download failed with status %d", resp.StatusCode)
 	case http.StatusOK:
 	default:
 		return false, fmt.Errorf("file download failed with status %d", resp.StatusCode)
 	}
 
-	out, err := os.Create(fp)
-	if err != nil {
-		return false, err
+	if err = copyToFile(resp.Body, fp, quota); err != nil {
+		return true, err
+	}
+
+	if etag := resp.Header.Get("ETag"); cache != nil && etag != "" {
+		if err = cache.Store(fileURL, etag, fp); err != nil {
+			log.Error(err, "Cannot cache context", "url", fileURL)
+		}
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
-	return true, err
+	return true, nil
 }
 
 func getFileContentType(fp string) (ct mimeType, err error) {
@@ -170,7 +312,7 @@ func getFileContentType(fp string) (ct mimeType, err error) {
 	return mimeType(kind.MIME.Value), nil
 }
 
-func extract(fp string, ct mimeType, dst string) error {
+func extract(fp string, ct mimeType, dst string, quota Quota) error {
 	f, err := os.Open(fp)
 	if err != nil {
 		return err
@@ -215,6 +357,11 @@ func extract(fp string, ct mimeType, dst string) error {
 				return err
 			}
 		case tar.TypeReg:
+			if quota != nil {
+				if err = quota.Reserve(header.Size); err != nil {
+					return err
+				}
+			}
 			if err = copyRegularFile(target, tr, header.Mode); err != nil {
 				return err
 			}
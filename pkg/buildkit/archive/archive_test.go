@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("context"))
+	}))
+	defer srv.Close()
+
+	fp := filepath.Join(t.TempDir(), "archive")
+
+	_, err := downloadFile(context.Background(), logr.Discard(), NewClient(ClientOptions{}), nil, nil, srv.URL, fp)
+	assert.Error(t, err, "self-signed certificates must not be trusted by default")
+
+	client := NewClient(ClientOptions{RootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs})
+	done, err := downloadFile(context.Background(), logr.Discard(), client, nil, nil, srv.URL, fp)
+	require.NoError(t, err)
+	assert.True(t, done)
+
+	data, err := os.ReadFile(fp)
+	require.NoError(t, err)
+	assert.Equal(t, "context", string(data))
+}
+
+func TestNewClientProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		_, _ = w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	client := NewClient(ClientOptions{HTTPProxy: proxy.URL, NoProxy: ".invalid"})
+	fp := filepath.Join(t.TempDir(), "archive")
+
+	url := "http://artifacts.example.com/ctx.tgz"
+	done, err := downloadFile(context.Background(), logr.Discard(), client, nil, nil, url, fp)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, []string{"http://artifacts.example.com/ctx.tgz"}, proxied)
+
+	// hosts matching NO_PROXY are dialed directly, reserved names never resolve so the fetch is retried
+	done, err = downloadFile(context.Background(), logr.Discard(), client, nil, nil, "http://direct.invalid/ctx.tgz", fp)
+	require.NoError(t, err)
+	assert.False(t, done)
+	assert.Len(t, proxied, 1)
+}
+
+func TestNewClientMaxRedirects(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL+r.URL.Path+"x", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	fp := filepath.Join(t.TempDir(), "archive")
+	client := NewClient(ClientOptions{MaxRedirects: 2})
+	_, err := downloadFile(context.Background(), logr.Discard(), client, nil, nil, srv.URL, fp)
+	assert.ErrorContains(t, err, "stopped after 2 redirects")
+}
+
+type limitQuota struct {
+	limit, used int64
+}
+
+func (q *limitQuota) Reserve(n int64) error {
+	if q.used+n > q.limit {
+		return errors.New("quota exceeded")
+	}
+	q.used += n
+	return nil
+}
+
+func TestFetchAndExtractQuota(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	contents := bytes.Repeat([]byte("x"), 4096)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0644, Size: int64(len(contents))}))
+	_, err := tw.Write(contents)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	quota := &limitQuota{limit: int64(buf.Len()) + 4096}
+	ex, err := FetchAndExtract(context.Background(), logr.Discard(), srv.URL, t.TempDir(), FetchOptions{Quota: quota})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(ex.ContentsDir, "Dockerfile"))
+	assert.Equal(t, digest.FromBytes(buf.Bytes()), ex.ArchiveDigest)
+	assert.Equal(t, quota.limit, quota.used)
+
+	quota = &limitQuota{limit: int64(buf.Len()) + 1024}
+	_, err = FetchAndExtract(context.Background(), logr.Discard(), srv.URL, t.TempDir(), FetchOptions{Quota: quota})
+	assert.ErrorContains(t, err, "quota exceeded")
+}
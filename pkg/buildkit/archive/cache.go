@@ -0,0 +1,235 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheArchiveExt = ".archive"
+	cacheETagExt    = ".etag"
+)
+
+// errCacheMiss is returned by Restore when the entry was replaced or evicted after its ETag was looked up.
+var errCacheMiss = errors.New("context cache miss")
+
+// Cache stores downloaded context archives on local disk keyed by URL. Entries are only reused after the server
+// confirms with a conditional request that the ETag of the remote file has not changed.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu sync.Mutex
+}
+
+// NewCache creates the cache directory when missing. Least recently used entries are evicted once the total size of
+// the cached archives exceeds maxBytes, entries are never evicted when it is zero.
+func NewCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create context cache directory: %w", err)
+	}
+
+	return &Cache{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// ETag returns the ETag of the cached archive for the URL, if any.
+func (c *Cache) ETag(fileURL string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	base := c.base(fileURL)
+	if _, err := os.Stat(base + cacheArchiveExt); err != nil {
+		return "", false
+	}
+
+	etag, err := os.ReadFile(base + cacheETagExt)
+	if err != nil || len(etag) == 0 {
+		return "", false
+	}
+
+	return string(etag), true
+}
+
+// Restore copies the archive cached for the URL and ETag to fp, charging the quota when it is not nil.
+func (c *Cache) Restore(fileURL, etag, fp string, quota Quota) error {
+	f, err := c.open(fileURL, etag)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the open file remains readable even if the entry is replaced or evicted while it is copied
+	return copyToFile(f, fp, quota)
+}
+
+// Store adds the archive downloaded to fp with the given ETag to the cache, replacing any previous entry for the URL.
+func (c *Cache) Store(fileURL, etag, fp string) error {
+	if etag == "" {
+		return errors.New("cannot cache archive without an etag")
+	}
+
+	src, err := os.Open(fp)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(c.dir, ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, src)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot copy archive into cache: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	base := c.base(fileURL)
+	if err = os.Rename(tmp.Name(), base+cacheArchiveExt); err != nil {
+		return err
+	}
+	if err = os.WriteFile(base+cacheETagExt, []byte(etag), 0644); err != nil {
+		return err
+	}
+
+	return c.evict()
+}
+
+// open returns the cached archive for the URL when its ETag matches and marks it as recently used.
+func (c *Cache) open(fileURL, etag string) (*os.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	base := c.base(fileURL)
+	cached, err := os.ReadFile(base + cacheETagExt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCacheMiss, err)
+	}
+	if string(cached) != etag {
+		return nil, fmt.Errorf("%w: cached etag %q does not match %q", errCacheMiss, cached, etag)
+	}
+
+	f, err := os.Open(base + cacheArchiveExt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCacheMiss, err)
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(base+cacheArchiveExt, now, now)
+
+	return f, nil
+}
+
+// evict removes the least recently used entries until the cache fits within its size limit, callers must hold the
+// lock.
+func (c *Cache) evict() error {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+
+	type entry struct {
+		base    string
+		size    int64
+		modTime time.Time
+	}
+
+	var (
+		entries []entry
+		total   int64
+	)
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, cacheArchiveExt) {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, entry{
+			base:    strings.TrimSuffix(path, cacheArchiveExt),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		total += info.Size()
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(entries, func(a, b entry) int { return a.modTime.Compare(b.modTime) })
+
+	for _, e := range entries {
+		if total <= c.maxBytes {
+			break
+		}
+
+		if err = os.Remove(e.base + cacheETagExt); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err = os.Remove(e.base + cacheArchiveExt); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= e.size
+	}
+
+	return nil
+}
+
+func (c *Cache) base(fileURL string) string {
+	sum := sha256.Sum256([]byte(fileURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// copyToFile writes src to fp, charging every write against the quota when it is not nil.
+func copyToFile(src io.Reader, fp string, quota Quota) error {
+	out, err := os.Create(fp)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = out
+	if quota != nil {
+		w = &quotaWriter{w: out, quota: quota}
+	}
+
+	_, err = io.Copy(w, src)
+	if cErr := out.Close(); err == nil {
+		err = cErr
+	}
+
+	return err
+}
+
+type quotaWriter struct {
+	w     io.Writer
+	quota Quota
+}
+
+func (q *quotaWriter) Write(p []byte) (int, error) {
+	if err := q.quota.Reserve(int64(len(p))); err != nil {
+		return 0, err
+	}
+
+	return q.w.Write(p)
+}
@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadFileCache(t *testing.T) {
+	var (
+		etag   atomic.Value
+		bodies atomic.Int32
+	)
+	etag.Store(`"v1"`)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := etag.Load().(string)
+		w.Header().Set("ETag", current)
+		if r.Header.Get("If-None-Match") == current {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		bodies.Add(1)
+		_, _ = w.Write([]byte("context " + current))
+	}))
+	defer srv.Close()
+
+	cache, err := NewCache(filepath.Join(t.TempDir(), "cache"), 0)
+	require.NoError(t, err)
+
+	fetch := func() string {
+		fp := filepath.Join(t.TempDir(), "archive")
+		done, err := downloadFile(context.Background(), logr.Discard(), http.DefaultClient, cache, nil, srv.URL, fp)
+		require.NoError(t, err)
+		require.True(t, done)
+
+		data, err := os.ReadFile(fp)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, `context "v1"`, fetch())
+	assert.Equal(t, `context "v1"`, fetch())
+	assert.Equal(t, int32(1), bodies.Load(), "unchanged archive must be served from the cache")
+
+	etag.Store(`"v2"`)
+	assert.Equal(t, `context "v2"`, fetch())
+	assert.Equal(t, int32(2), bodies.Load())
+
+	cached, ok := cache.ETag(srv.URL)
+	assert.True(t, ok)
+	assert.Equal(t, `"v2"`, cached)
+}
+
+func TestCacheWithoutETag(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	fp := filepath.Join(t.TempDir(), "archive")
+	require.NoError(t, os.WriteFile(fp, []byte("context"), 0644))
+
+	assert.Error(t, cache.Store("http://artifacts/ctx.tgz", "", fp))
+	_, ok := cache.ETag("http://artifacts/ctx.tgz")
+	assert.False(t, ok)
+}
+
+func TestCacheEviction(t *testing.T) {
+	cache, err := NewCache(t.TempDir(), 12)
+	require.NoError(t, err)
+
+	fp := filepath.Join(t.TempDir(), "archive")
+	require.NoError(t, os.WriteFile(fp, []byte("123456"), 0644))
+
+	require.NoError(t, cache.Store("http://artifacts/used.tgz", `"used"`, fp))
+	require.NoError(t, cache.Store("http://artifacts/old.tgz", `"old"`, fp))
+
+	// restoring marks an entry as recently used
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(cache.base("http://artifacts/used.tgz")+cacheArchiveExt, past, past))
+	require.NoError(t, os.Chtimes(cache.base("http://artifacts/old.tgz")+cacheArchiveExt, past, past))
+	require.NoError(t, cache.Restore("http://artifacts/used.tgz", `"used"`, filepath.Join(t.TempDir(), "restored"), nil))
+
+	require.NoError(t, cache.Store("http://artifacts/new.tgz", `"new"`, fp))
+
+	_, ok := cache.ETag("http://artifacts/old.tgz")
+	assert.False(t, ok, "least recently used entry must be evicted")
+	_, ok = cache.ETag("http://artifacts/used.tgz")
+	assert.True(t, ok)
+	_, ok = cache.ETag("http://artifacts/new.tgz")
+	assert.True(t, ok)
+
+	assert.Error(t, cache.Restore("http://artifacts/new.tgz", `"stale"`, fp, nil))
+}
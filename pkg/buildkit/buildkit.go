@@ -5,27 +5,33 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/containerd/platforms"
 	"github.com/docker/cli/cli/config"
 	"github.com/go-logr/logr"
 	"github.com/google/go-containerregistry/pkg/authn"
 	bkclient "github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/cmd/buildctl/build"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/auth/authprovider"
 	"github.com/moby/buildkit/session/secrets/secretsprovider"
 	"github.com/moby/buildkit/util/progress/progressui"
+	"github.com/opencontainers/go-digest"
 	"github.com/tonistiigi/fsutil"
 	"golang.org/x/sync/errgroup"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/dominodatalab/hephaestus/pkg/buildkit/archive"
+	"github.com/dominodatalab/hephaestus/pkg/buildkit/scratch"
 	hephconfig "github.com/dominodatalab/hephaestus/pkg/config"
 )
 
@@ -36,11 +42,16 @@ var clientCheckBackoff = wait.Backoff{ // retries after 500ms 1s 2s 4s 8s 16s 32
 	Jitter:   0.1,
 }
 
+// ErrNoMatchingWorker is returned by Probe when buildkitd has no worker that satisfies the configured constraints.
+var ErrNoMatchingWorker = errors.New("no buildkitd worker matches constraints")
+
 type ClientBuilder struct {
 	addr            string
 	dockerConfigDir string
 	log             logr.Logger
 	bkOpts          []bkclient.ClientOpt
+	workerFilters   []string
+	platforms       []string
 }
 
 func NewClientBuilder(addr string) *ClientBuilder {
@@ -71,6 +82,16 @@ func (b *ClientBuilder) WithLogger(log logr.Logger) *ClientBuilder {
 	return b
 }
 
+// WithWorkerConstraints makes Probe require a buildkitd worker that matches every filter and supports every platform.
+// Filters use the buildctl debug workers syntax, e.g. `labels."org.mobyproject.buildkit.worker.executor"==oci`.
+// Solves cannot select a worker, buildkitd always runs them on its default worker, so the filters only decide whether
+// a buildkitd instance is usable.
+func (b *ClientBuilder) WithWorkerConstraints(filters, platforms []string) *ClientBuilder {
+	b.workerFilters = filters
+	b.platforms = platforms
+	return b
+}
+
 func (b *ClientBuilder) Build(ctx context.Context) (*Client, error) {
 	bk, err := bkclient.New(ctx, b.addr, b.bkOpts...)
 	if err != nil {
@@ -102,6 +123,63 @@ func (b *ClientBuilder) Build(ctx context.Context) (*Client, error) {
 	}, nil
 }
 
+// Probe makes a single ListWorkers call against buildkitd without retrying and reports whether it failed. The version
+// of buildkitd is returned on success, it is blank for daemons that do not implement the info API.
+//
+// Unlike Build, this is meant to quickly detect a wedged buildkitd behind an otherwise ready pod. When worker
+// constraints are set, an error wrapping ErrNoMatchingWorker is returned if no worker satisfies them.
+func (b *ClientBuilder) Probe(ctx context.Context) (version string, err error) {
+	bk, err := bkclient.New(ctx, b.addr, b.bkOpts...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create buildkit client: %w", err)
+	}
+	defer bk.Close()
+
+	workers, err := bk.ListWorkers(ctx, bkclient.WithFilter(b.workerFilters))
+	if err != nil {
+		return "", fmt.Errorf("buildkitd health probe failed: %w", err)
+	}
+
+	if err = matchWorkers(workers, b.workerFilters, b.platforms); err != nil {
+		return "", err
+	}
+
+	if info, err := bk.Info(ctx); err == nil {
+		version = info.BuildkitVersion.Version
+	}
+
+	return version, nil
+}
+
+// matchWorkers ensures at least one of the workers returned by a filtered ListWorkers call supports every platform.
+func matchWorkers(workers []*bkclient.WorkerInfo, filters, platformSpecs []string) error {
+	if len(filters) == 0 && len(platformSpecs) == 0 {
+		return nil
+	}
+
+	var matchers []platforms.Matcher
+	for _, spec := range platformSpecs {
+		p, err := platforms.Parse(spec)
+		if err != nil {
+			return fmt.Errorf("invalid platform %q: %w", spec, err)
+		}
+		matchers = append(matchers, platforms.Only(p))
+	}
+
+	for _, w := range workers {
+		supported := true
+		for _, m := range matchers {
+			supported = supported && slices.ContainsFunc(w.Platforms, m.Match)
+		}
+
+		if supported {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: filters %v, platforms %v", ErrNoMatchingWorker, filters, platformSpecs)
+}
+
 type BuildOptions struct {
 	Context                  string
 	ContextDir               string
@@ -114,6 +192,50 @@ type BuildOptions struct {
 	Secrets                  map[string]string
 	SecretsData              map[string][]byte
 	FetchAndExtractTimeout   time.Duration
+	Labels                   map[string]string
+	Annotations              map[string]string
+	// ExportCache refs the build cache is pushed to as registry cache, in addition to the inline cache.
+	ExportCache []string
+	// ExportCacheMode is the registry cache export mode, "min" or "max". Defaults to "max".
+	ExportCacheMode string
+	// FetchClient downloads the remote context, http.DefaultClient is used when nil.
+	FetchClient *http.Client
+	// FetchCache serves unchanged remote contexts from local disk, every context is downloaded when nil.
+	FetchCache *archive.Cache
+	// ContextSubPath is the directory of the extracted remote context used as the build root, the whole context is
+	// used when blank.
+	ContextSubPath string
+	// FetchOnWorker passes an http(s) context URL to the dockerfile frontend so the buildkit worker downloads and
+	// extracts it instead of the client. FetchClient, FetchCache and Scratch are not used for such contexts. Contexts
+	// are still fetched by the client when IgnorePatterns or a ContextSubPath are set.
+	FetchOnWorker bool
+	// IgnorePatterns are applied after the .dockerignore patterns of remote contexts, paths they match are removed
+	// from the extracted context before it is sent to buildkit.
+	IgnorePatterns []string
+	// Scratch space the remote context is fetched and extracted into, a temporary directory without quotas is used
+	// when nil.
+	Scratch *scratch.Space
+	// Platforms the image is built for, the worker default is used when empty.
+	Platforms []string
+	// ContextDigested is called with the SHA256 digests of the remote context archive and the Dockerfile before the
+	// build is solved. The archive digest is blank unless the context was fetched by the client, neither is known
+	// when FetchOnWorker applies.
+	ContextDigested func(archive, dockerfile digest.Digest)
+	// CacheImportMissed is called for every cache import ref that could not be resolved during the build.
+	CacheImportMissed func(ref, reason string)
+	// PushProgress is called once the image has been solved and its export begins, and again every time the number
+	// of pushed bytes changes. The total grows as buildkit discovers the layers that need to be pushed.
+	PushProgress func(pushed, total int64)
+	// CacheHits is called once the solve returns with the number of completed build steps and how many of them were
+	// served from the build cache.
+	CacheHits func(cached, total int)
+	// BuildGraph is called once the solve returns, successful or not, with every vertex of the build graph.
+	BuildGraph func(vertices []GraphVertex)
+	// FailureOutputLines is the number of trailing lines of step output passed to FailureOutput.
+	FailureOutputLines int
+	// FailureOutput is called when the solve fails with up to FailureOutputLines of the last step output lines,
+	// oldest first. Lines are passed as written by the build and may contain sensitive values.
+	FailureOutput func(lines []string)
 }
 
 type Buildkit interface {
@@ -150,16 +272,11 @@ func validateCompression(compression string, name string) map[string]string {
 
 func (c *Client) Build(ctx context.Context, opts BuildOptions) (string, error) {
 	// setup build directory
-	buildDir, err := os.MkdirTemp("", "hephaestus-build-")
+	buildDir, quota, release, err := c.createBuildDir(opts.Scratch)
 	if err != nil {
-		return "", fmt.Errorf("failed to create build dir: %w", err)
+		return "", err
 	}
-
-	defer func(path string) {
-		if err := os.RemoveAll(path); err != nil {
-			c.log.Error(err, "Failed to delete build context")
-		}
-	}(buildDir)
+	defer release()
 
 	dockerConfig, err := config.Load(c.dockerConfigDir)
 	if err != nil {
@@ -167,19 +284,35 @@ func (c *Client) Build(ctx context.Context, opts BuildOptions) (string, error) {
 	}
 
 	// process build context
-	var contentsDir string
+	var (
+		contentsDir, workerContext string
+		archiveDigest              digest.Digest
+	)
 	fi, err := os.Stat(opts.ContextDir)
 	switch {
 	case err == nil && fi.IsDir():
 		c.log.Info("Using context dir", "dir", opts.ContextDir)
 		contentsDir = opts.ContextDir
+	case opts.FetchOnWorker && isHTTPContext(opts.Context) && len(opts.IgnorePatterns) == 0 && opts.ContextSubPath == "":
+		// ignore patterns and sub paths can only be applied to contexts extracted by the client
+		c.log.Info("Passing remote context to buildkit worker", "url", opts.Context)
+		workerContext = strings.TrimSpace(opts.Context)
 	case strings.TrimSpace(opts.Context) != "":
 		c.log.Info("Fetching remote context", "url", opts.Context)
-		extract, extractErr := archive.FetchAndExtract(ctx, c.log, opts.Context, buildDir, opts.FetchAndExtractTimeout)
+		extract, extractErr := archive.FetchAndExtract(ctx, c.log, opts.Context, buildDir, archive.FetchOptions{
+			Client:  opts.FetchClient,
+			Cache:   opts.FetchCache,
+			Quota:   quota,
+			Timeout: opts.FetchAndExtractTimeout,
+		})
 		if extractErr != nil {
-			return "", fmt.Errorf("cannot fetch remote context: %w", err)
+			return "", fmt.Errorf("cannot fetch remote context: %w", extractErr)
+		}
+		archiveDigest = extract.ArchiveDigest
+
+		if contentsDir, err = contextSubDir(extract.ContentsDir, opts.ContextSubPath); err != nil {
+			return "", err
 		}
-		contentsDir = extract.ContentsDir
 	case strings.TrimSpace(opts.DockerfileContents) != "":
 		c.log.Info("Creating context from DockerfileContents")
 		contentsDir, err = os.MkdirTemp(buildDir, "dockerfile-contents-")
@@ -193,20 +326,37 @@ func (c *Client) Build(ctx context.Context, opts BuildOptions) (string, error) {
 	default:
 		return "", errors.New("no valid docker context provided")
 	}
-	c.log.V(1).Info("Context extracted", "dir", contentsDir)
 
-	// verify manifest is present
-	dockerfile := filepath.Join(contentsDir, "Dockerfile")
-	if _, err := os.Stat(dockerfile); errors.Is(err, os.ErrNotExist) {
-		return "", fmt.Errorf("build requires a Dockerfile inside context dir: %w", err)
-	}
+	// the worker verifies the Dockerfile is present once it has fetched the context
+	if workerContext == "" {
+		c.log.V(1).Info("Context extracted", "dir", contentsDir)
+
+		// directories provided by the caller are never modified
+		if contentsDir != opts.ContextDir {
+			removed, err := pruneContext(contentsDir, opts.IgnorePatterns)
+			if err != nil {
+				return "", err
+			}
+			if removed != 0 {
+				c.log.Info("Removed ignored paths from context", "paths", removed)
+			}
+		}
+
+		// verify manifest is present
+		dockerfile := filepath.Join(contentsDir, "Dockerfile")
+		if _, err := os.Stat(dockerfile); errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("build requires a Dockerfile inside context dir: %w", err)
+		}
 
-	if l := c.log.V(1); l.Enabled() {
 		bs, err := os.ReadFile(dockerfile)
 		if err != nil {
 			return "", fmt.Errorf("cannot read Dockerfile: %w", err)
 		}
-		l.Info("Dockerfile contents:\n" + string(bs))
+		c.log.V(1).Info("Dockerfile contents:\n" + string(bs))
+
+		if opts.ContextDigested != nil {
+			opts.ContextDigested(archiveDigest, digest.Canonical.FromBytes(bs))
+		}
 	}
 
 	// Do not cache these as the file contents can change
@@ -226,19 +376,10 @@ func (c *Client) Build(ctx context.Context, opts BuildOptions) (string, error) {
 		secrets[name] = contents
 	}
 
-	contentsFS, err := fsutil.NewFS(contentsDir)
-	if err != nil {
-		return "", fmt.Errorf("unable to create context dir: %w", err)
-	}
-
 	// build solve options
 	solveOpt := bkclient.SolveOpt{
 		Frontend:      "dockerfile.v0",
 		FrontendAttrs: map[string]string{},
-		LocalMounts: map[string]fsutil.FS{
-			"context":    contentsFS,
-			"dockerfile": contentsFS,
-		},
 		Session: []session.Attachable{
 			authprovider.NewDockerAuthProvider(dockerConfig, nil),
 			secretsprovider.FromMap(secrets),
@@ -250,23 +391,43 @@ func (c *Client) Build(ctx context.Context, opts BuildOptions) (string, error) {
 		},
 	}
 
+	if err = applyContext(&solveOpt, contentsDir, workerContext); err != nil {
+		return "", err
+	}
+
 	if opts.NoCache {
 		solveOpt.FrontendAttrs["no-cache"] = ""
 	}
 
+	if len(opts.Platforms) != 0 {
+		solveOpt.FrontendAttrs["platform"] = strings.Join(opts.Platforms, ",")
+	}
+
 	if opts.DisableInlineCacheExport {
 		solveOpt.CacheExports = nil
 	}
 
 	for _, ref := range opts.ImportCache {
-		solveOpt.CacheImports = []bkclient.CacheOptionsEntry{
-			{
-				Type: "registry",
-				Attrs: map[string]string{
-					"ref": ref,
-				},
+		solveOpt.CacheImports = append(solveOpt.CacheImports, bkclient.CacheOptionsEntry{
+			Type: "registry",
+			Attrs: map[string]string{
+				"ref": ref,
 			},
-		}
+		})
+	}
+
+	exportMode := opts.ExportCacheMode
+	if exportMode == "" {
+		exportMode = "max"
+	}
+	for _, ref := range opts.ExportCache {
+		solveOpt.CacheExports = append(solveOpt.CacheExports, bkclient.CacheOptionsEntry{
+			Type: "registry",
+			Attrs: map[string]string{
+				"ref":  ref,
+				"mode": exportMode,
+			},
+		})
 	}
 
 	if len(opts.BuildArgs) != 0 {
@@ -291,9 +452,117 @@ func (c *Client) Build(ctx context.Context, opts BuildOptions) (string, error) {
 			Attrs: bkclientattrs,
 		})
 	}
+	applyImageMetadata(&solveOpt, opts.Labels, opts.Annotations, len(opts.Platforms) > 1)
 
 	// build/push images
-	return c.runSolve(ctx, solveOpt)
+	return c.runSolve(ctx, solveOpt, opts)
+}
+
+// createBuildDir returns a build directory and a func that deletes it. Writes are charged against the scratch space
+// quotas when one is provided, the quota is nil otherwise.
+func (c *Client) createBuildDir(space *scratch.Space) (string, archive.Quota, func(), error) {
+	if space != nil {
+		dir, err := space.Create("hephaestus-build-")
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		return dir.Path, dir, func() {
+			if err := dir.Release(); err != nil {
+				c.log.Error(err, "Failed to delete build context")
+			}
+		}, nil
+	}
+
+	buildDir, err := os.MkdirTemp("", "hephaestus-build-")
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to create build dir: %w", err)
+	}
+
+	return buildDir, nil, func() {
+		if err := os.RemoveAll(buildDir); err != nil {
+			c.log.Error(err, "Failed to delete build context")
+		}
+	}, nil
+}
+
+// isHTTPContext reports whether the context is a URL the dockerfile frontend can fetch itself.
+func isHTTPContext(context string) bool {
+	context = strings.TrimSpace(context)
+	return strings.HasPrefix(context, "http://") || strings.HasPrefix(context, "https://")
+}
+
+// contextSubDir resolves the sub path of an extracted context. Symlinks are followed so the result is guaranteed to
+// stay inside the context root.
+func contextSubDir(root, subPath string) (string, error) {
+	if subPath == "" {
+		return root, nil
+	}
+
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve context dir: %w", err)
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(subPath)))
+	if err != nil {
+		return "", fmt.Errorf("context sub path %q not found: %w", subPath, err)
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("context sub path %q is outside of the context", subPath)
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("context sub path %q is not a directory", subPath)
+	}
+
+	return dir, nil
+}
+
+// applyContext mounts the local contents dir as build context and Dockerfile source, unless a worker context URL is
+// given. The dockerfile frontend then downloads the URL on the worker and unpacks it when it is an archive.
+func applyContext(solveOpt *bkclient.SolveOpt, contentsDir, workerContext string) error {
+	if workerContext != "" {
+		solveOpt.FrontendAttrs["context"] = workerContext
+		return nil
+	}
+
+	contentsFS, err := fsutil.NewFS(contentsDir)
+	if err != nil {
+		return fmt.Errorf("unable to create context dir: %w", err)
+	}
+
+	solveOpt.LocalMounts = map[string]fsutil.FS{
+		"context":    contentsFS,
+		"dockerfile": contentsFS,
+	}
+
+	return nil
+}
+
+// applyImageMetadata sets labels on the image config and adds both labels and annotations to every exported
+// manifest. Explicit annotations take precedence over mirrored labels with the same key.
+//
+// Multi-platform builds export an index which receives the same annotations. Buildkit rejects index annotations for
+// single-platform exports, so they are only added when more than one platform is built.
+func applyImageMetadata(solveOpt *bkclient.SolveOpt, labels, annotations map[string]string, multiPlatform bool) {
+	annotate := func(k, v string) {
+		for _, export := range solveOpt.Exports {
+			export.Attrs[exptypes.AnnotationManifestKey(nil, k)] = v
+			if multiPlatform {
+				export.Attrs[exptypes.AnnotationIndexKey(k)] = v
+			}
+		}
+	}
+
+	for k, v := range labels {
+		solveOpt.FrontendAttrs["label:"+k] = v
+		annotate(k, v)
+	}
+
+	for k, v := range annotations {
+		annotate(k, v)
+	}
 }
 
 func (c *Client) Cache(ctx context.Context, image string) error {
@@ -326,10 +595,50 @@ func (c *Client) Cache(ctx context.Context, image string) error {
 	})
 }
 
-func (c *Client) Prune() error {
-	c.log.Info("Prune not implemented")
+// DiskUsage returns the total size of all cache records held by buildkitd.
+func (c *Client) DiskUsage(ctx context.Context) (int64, error) {
+	records, err := c.bk.DiskUsage(ctx)
+	if err != nil {
+		return 0, err
+	}
 
-	return nil
+	var total int64
+	for _, record := range records {
+		total += record.Size
+	}
+
+	return total, nil
+}
+
+// Prune evicts cache records matching the filters until keepBytes remain and returns the number of bytes reclaimed.
+func (c *Client) Prune(ctx context.Context, keepBytes int64, filters ...string) (int64, error) {
+	opts := []bkclient.PruneOption{bkclient.WithKeepOpt(0, keepBytes)}
+	if len(filters) != 0 {
+		opts = append(opts, bkclient.WithFilter(filters))
+	}
+
+	var reclaimed int64
+	ch := make(chan bkclient.UsageInfo)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for record := range ch {
+			reclaimed += record.Size
+		}
+	}()
+
+	err := c.bk.Prune(ctx, ch, opts...)
+	close(ch)
+	<-done
+
+	c.log.Info("Pruned cache records", "keepBytes", keepBytes, "reclaimedBytes", reclaimed)
+
+	return reclaimed, err
+}
+
+// Close releases the connection to buildkitd.
+func (c *Client) Close() error {
+	return c.bk.Close()
 }
 
 func (c *Client) solveWith(ctx context.Context, modify func(buildDir string, solveOpt *bkclient.SolveOpt) error) error {
@@ -359,12 +668,17 @@ func (c *Client) solveWith(ctx context.Context, modify func(buildDir string, sol
 		return err
 	}
 
-	_, err = c.runSolve(ctx, solveOpt)
+	_, err = c.runSolve(ctx, solveOpt, BuildOptions{})
 	return err
 }
 
 func (c *Client) ResolveAuth(registryHostname string) (authn.Authenticator, error) {
-	cf, err := config.Load(c.dockerConfigDir)
+	return ResolveAuth(c.dockerConfigDir, registryHostname)
+}
+
+// ResolveAuth loads the credentials for a registry from the docker config inside configDir.
+func ResolveAuth(configDir, registryHostname string) (authn.Authenticator, error) {
+	cf, err := config.Load(configDir)
 	if err != nil {
 		return nil, err
 	}
@@ -382,9 +696,154 @@ func (c *Client) ResolveAuth(registryHostname string) (authn.Authenticator, erro
 	}), nil
 }
 
-func (c *Client) runSolve(ctx context.Context, so bkclient.SolveOpt) (string, error) {
+// cacheImportVertexPrefix prefixes the name of the vertex buildkit creates when it resolves a cache import. Registry
+// imports are named after their ref.
+const cacheImportVertexPrefix = "importing cache manifest from "
+
+// watchCacheImports forwards solve status updates while reporting every cache import vertex that failed. Buildkit
+// treats these failures as non-fatal, so the build silently proceeds without the cache otherwise.
+func watchCacheImports(
+	in <-chan *bkclient.SolveStatus,
+	out chan<- *bkclient.SolveStatus,
+	missed func(ref, reason string),
+) {
+	defer close(out)
+
+	reported := map[string]bool{}
+	for status := range in {
+		for _, v := range status.Vertexes {
+			ref, ok := strings.CutPrefix(v.Name, cacheImportVertexPrefix)
+			if !ok || v.Error == "" || reported[ref] || missed == nil {
+				continue
+			}
+
+			reported[ref] = true
+			missed(ref, v.Error)
+		}
+
+		out <- status
+	}
+}
+
+// watchCacheHits forwards solve status updates while counting the completed vertices and those that were cached. The
+// counts are reported once the solve status channel is closed.
+func watchCacheHits(
+	in <-chan *bkclient.SolveStatus,
+	out chan<- *bkclient.SolveStatus,
+	report func(cached, total int),
+) {
+	defer close(out)
+
+	completed := map[digest.Digest]bool{}
+	for status := range in {
+		for _, v := range status.Vertexes {
+			if v.Completed != nil && v.Error == "" {
+				completed[v.Digest] = v.Cached
+			}
+		}
+
+		out <- status
+	}
+
+	if report == nil {
+		return
+	}
+
+	var cached int
+	for _, hit := range completed {
+		if hit {
+			cached++
+		}
+	}
+	report(cached, len(completed))
+}
+
+// exportVertexPrefix prefixes the name of the vertex buildkit creates when it exports a solved image, e.g.
+// "exporting to image". Layers are pushed to the registry as part of that vertex.
+const exportVertexPrefix = "exporting to "
+
+// watchPush forwards solve status updates while reporting the progress of the image push. Solving and pushing happen
+// within the same solve request, so the start of the export vertex is the only indication that the build is done.
+func watchPush(
+	in <-chan *bkclient.SolveStatus,
+	out chan<- *bkclient.SolveStatus,
+	progress func(pushed, total int64),
+) {
+	defer close(out)
+
+	var export digest.Digest
+	layers := map[string]*bkclient.VertexStatus{}
+	for status := range in {
+		started := false
+		for _, v := range status.Vertexes {
+			if export == "" && v.Started != nil && strings.HasPrefix(v.Name, exportVertexPrefix) {
+				export = v.Digest
+				started = true
+			}
+		}
+
+		changed := false
+		for _, s := range status.Statuses {
+			if export == "" || s.Vertex != export || s.Total == 0 {
+				continue
+			}
+
+			if prev, ok := layers[s.ID]; !ok || prev.Current != s.Current || prev.Total != s.Total {
+				layers[s.ID] = s
+				changed = true
+			}
+		}
+
+		if (started || changed) && progress != nil {
+			var pushed, total int64
+			for _, s := range layers {
+				pushed += s.Current
+				total += s.Total
+			}
+
+			progress(pushed, total)
+		}
+
+		out <- status
+	}
+}
+
+// watchLogs writes the output of the build steps as structured events and forwards the remaining solve status updates
+// without it, so step output is not repeated by the plain progress display.
+func watchLogs(in <-chan *bkclient.SolveStatus, out chan<- *bkclient.SolveStatus, lw *LogWriter) {
+	defer close(out)
+	defer lw.Flush()
+
+	names := map[digest.Digest]string{}
+	for status := range in {
+		for _, v := range status.Vertexes {
+			names[v.Digest] = v.Name
+		}
+		for _, l := range status.Logs {
+			lw.WriteVertexLog(l, names[l.Vertex])
+		}
+
+		forwarded := *status
+		forwarded.Logs = nil
+		out <- &forwarded
+	}
+}
+
+func (c *Client) runSolve(
+	ctx context.Context,
+	so bkclient.SolveOpt,
+	opts BuildOptions,
+) (string, error) {
 	lw := &LogWriter{Logger: c.log}
+	if opts.FailureOutput != nil {
+		lw.TailLines = opts.FailureOutputLines
+	}
 	ch := make(chan *bkclient.SolveStatus)
+	hitCh := make(chan *bkclient.SolveStatus)
+	graphCh := make(chan *bkclient.SolveStatus)
+	pushCh := make(chan *bkclient.SolveStatus)
+	logCh := make(chan *bkclient.SolveStatus)
+	displayCh := make(chan *bkclient.SolveStatus)
 	eg, ctx := errgroup.WithContext(ctx)
 
 	d, err := progressui.NewDisplay(lw, progressui.PlainMode)
@@ -396,10 +855,35 @@ func (c *Client) runSolve(ctx context.Context, so bkclient.SolveOpt) (string, er
 	eg.Go(func() error {
 		// this operation should return cleanly when solve returns (either by itself or when cancelled) so there's no
 		// need to cancel it explicitly. see https://github.com/moby/buildkit/pull/1721 for details.
-		_, err = d.UpdateFrom(context.Background(), ch)
+		_, err = d.UpdateFrom(context.Background(), displayCh)
 		return err
 	})
 
+	eg.Go(func() error {
+		watchCacheImports(ch, hitCh, opts.CacheImportMissed)
+		return nil
+	})
+
+	eg.Go(func() error {
+		watchCacheHits(hitCh, graphCh, opts.CacheHits)
+		return nil
+	})
+
+	eg.Go(func() error {
+		watchGraph(graphCh, pushCh, opts.BuildGraph)
+		return nil
+	})
+
+	eg.Go(func() error {
+		watchPush(pushCh, logCh, opts.PushProgress)
+		return nil
+	})
+
+	eg.Go(func() error {
+		watchLogs(logCh, displayCh, lw)
+		return nil
+	})
+
 	var imageName string
 
 	eg.Go(func() error {
@@ -416,6 +900,9 @@ func (c *Client) runSolve(ctx context.Context, so bkclient.SolveOpt) (string, er
 
 	if err := eg.Wait(); err != nil {
 		c.log.Info(fmt.Sprintf("Build failed: %s", err.Error()))
+		if opts.FailureOutput != nil {
+			opts.FailureOutput(lw.Tail())
+		}
 		return "", fmt.Errorf("buildkit solve issue: %w", err)
 	}
 
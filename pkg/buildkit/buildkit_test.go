@@ -0,0 +1,350 @@
+package buildkit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyImageMetadata(t *testing.T) {
+	solveOpt := bkclient.SolveOpt{
+		FrontendAttrs: map[string]string{},
+		Exports: []bkclient.ExportEntry{
+			{Type: bkclient.ExporterImage, Attrs: map[string]string{"name": "registry.example.com/app:v1"}},
+		},
+	}
+
+	applyImageMetadata(
+		&solveOpt,
+		map[string]string{"cost-center": "ds-42", "team": "ml"},
+		map[string]string{"org.opencontainers.image.revision": "abc123", "team": "platform"},
+		false,
+	)
+
+	assert.Equal(t, map[string]string{"label:cost-center": "ds-42", "label:team": "ml"}, solveOpt.FrontendAttrs)
+	assert.Equal(t, map[string]string{
+		"name":                            "registry.example.com/app:v1",
+		"annotation-manifest.cost-center": "ds-42",
+		"annotation-manifest.team":        "platform",
+		"annotation-manifest.org.opencontainers.image.revision": "abc123",
+	}, solveOpt.Exports[0].Attrs)
+
+	solveOpt = bkclient.SolveOpt{
+		FrontendAttrs: map[string]string{},
+		Exports: []bkclient.ExportEntry{
+			{Type: bkclient.ExporterImage, Attrs: map[string]string{"name": "registry.example.com/app:v1"}},
+		},
+	}
+	applyImageMetadata(
+		&solveOpt,
+		map[string]string{"team": "ml"},
+		map[string]string{"org.opencontainers.image.revision": "abc123"},
+		true,
+	)
+
+	assert.Equal(t, map[string]string{
+		"name":                     "registry.example.com/app:v1",
+		"annotation-manifest.team": "ml",
+		"annotation-index.team":    "ml",
+		"annotation-manifest.org.opencontainers.image.revision": "abc123",
+		"annotation-index.org.opencontainers.image.revision":    "abc123",
+	}, solveOpt.Exports[0].Attrs)
+}
+
+func TestApplyContext(t *testing.T) {
+	solveOpt := bkclient.SolveOpt{FrontendAttrs: map[string]string{}}
+	require.NoError(t, applyContext(&solveOpt, "", "https://artifacts.example.com/ctx.tgz"))
+	assert.Equal(t, map[string]string{"context": "https://artifacts.example.com/ctx.tgz"}, solveOpt.FrontendAttrs)
+	assert.Nil(t, solveOpt.LocalMounts)
+
+	solveOpt = bkclient.SolveOpt{FrontendAttrs: map[string]string{}}
+	require.NoError(t, applyContext(&solveOpt, t.TempDir(), ""))
+	assert.Empty(t, solveOpt.FrontendAttrs)
+	assert.Contains(t, solveOpt.LocalMounts, "context")
+	assert.Contains(t, solveOpt.LocalMounts, "dockerfile")
+
+	assert.True(t, isHTTPContext(" https://artifacts.example.com/ctx.tgz"))
+	assert.False(t, isHTTPContext("s3://artifacts/ctx.tgz"))
+}
+
+func TestContextSubDir(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "services", "api"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "README.md"), nil, 0644))
+	require.NoError(t, os.Symlink(t.TempDir(), filepath.Join(root, "escape")))
+
+	dir, err := contextSubDir(root, "")
+	require.NoError(t, err)
+	assert.Equal(t, root, dir)
+
+	dir, err = contextSubDir(root, "services/api")
+	require.NoError(t, err)
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, "services", "api"))
+	require.NoError(t, err)
+	assert.Equal(t, resolved, dir)
+
+	_, err = contextSubDir(root, "missing")
+	assert.ErrorContains(t, err, "not found")
+	_, err = contextSubDir(root, "README.md")
+	assert.ErrorContains(t, err, "not a directory")
+	_, err = contextSubDir(root, "escape")
+	assert.ErrorContains(t, err, "outside of the context")
+}
+
+func TestWatchCacheImports(t *testing.T) {
+	in := make(chan *bkclient.SolveStatus)
+	out := make(chan *bkclient.SolveStatus)
+
+	var missed []string
+	go watchCacheImports(in, out, func(ref, reason string) {
+		missed = append(missed, ref+": "+reason)
+	})
+
+	statuses := []*bkclient.SolveStatus{
+		{Vertexes: []*bkclient.Vertex{{Name: "importing cache manifest from registry.example.com/cache:ok"}}},
+		{Vertexes: []*bkclient.Vertex{{Name: "importing cache manifest from registry.example.com/cache:gone", Error: "not found"}}},
+		{Vertexes: []*bkclient.Vertex{{Name: "importing cache manifest from registry.example.com/cache:gone", Error: "not found"}}},
+		{Vertexes: []*bkclient.Vertex{{Name: "[1/2] FROM docker.io/library/python:3.10", Error: "boom"}}},
+	}
+	go func() {
+		for _, status := range statuses {
+			in <- status
+		}
+		close(in)
+	}()
+
+	var forwarded int
+	for range out {
+		forwarded++
+	}
+
+	assert.Equal(t, len(statuses), forwarded)
+	assert.Equal(t, []string{"registry.example.com/cache:gone: not found"}, missed)
+}
+
+func TestWatchCacheHits(t *testing.T) {
+	in := make(chan *bkclient.SolveStatus)
+	out := make(chan *bkclient.SolveStatus)
+
+	var hits [][2]int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchCacheHits(in, out, func(cached, total int) {
+			hits = append(hits, [2]int{cached, total})
+		})
+	}()
+
+	now := time.Now()
+	from, run, copyStep, failed := digest.FromString("from"), digest.FromString("run"), digest.FromString("copy"),
+		digest.FromString("failed")
+	statuses := []*bkclient.SolveStatus{
+		{Vertexes: []*bkclient.Vertex{{Digest: from, Started: &now}, {Digest: run, Started: &now}}},
+		{Vertexes: []*bkclient.Vertex{{Digest: from, Completed: &now, Cached: true}}},
+		{Vertexes: []*bkclient.Vertex{{Digest: run, Completed: &now}, {Digest: copyStep, Completed: &now, Cached: true}}},
+		{Vertexes: []*bkclient.Vertex{{Digest: failed, Completed: &now, Error: "boom"}}},
+	}
+	go func() {
+		for _, status := range statuses {
+			in <- status
+		}
+		close(in)
+	}()
+
+	var forwarded int
+	for range out {
+		forwarded++
+	}
+	<-done
+
+	assert.Equal(t, len(statuses), forwarded)
+	assert.Equal(t, [][2]int{{2, 3}}, hits)
+}
+
+func TestWatchGraph(t *testing.T) {
+	in := make(chan *bkclient.SolveStatus)
+	out := make(chan *bkclient.SolveStatus)
+
+	var graph []GraphVertex
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchGraph(in, out, func(vertices []GraphVertex) {
+			graph = vertices
+		})
+	}()
+
+	start := time.Now()
+	end := start.Add(1500 * time.Millisecond)
+	from, run := digest.FromString("from"), digest.FromString("run")
+	statuses := []*bkclient.SolveStatus{
+		{Vertexes: []*bkclient.Vertex{{Digest: from, Name: "[1/2] FROM alpine", Started: &start}}},
+		{Vertexes: []*bkclient.Vertex{
+			{Digest: from, Name: "[1/2] FROM alpine", Started: &start, Completed: &start, Cached: true},
+			{Digest: run, Name: "[2/2] RUN make", Inputs: []digest.Digest{from}, Started: &start},
+		}},
+		{Vertexes: []*bkclient.Vertex{{Digest: run, Name: "[2/2] RUN make", Inputs: []digest.Digest{from}, Completed: &end,
+			Error: "exit code: 2"}}},
+	}
+	go func() {
+		for _, status := range statuses {
+			in <- status
+		}
+		close(in)
+	}()
+
+	var forwarded int
+	for range out {
+		forwarded++
+	}
+	<-done
+
+	assert.Equal(t, len(statuses), forwarded)
+	assert.Equal(t, []GraphVertex{
+		{Digest: from, Name: "[1/2] FROM alpine", Started: &start, Completed: &start, Cached: true},
+		{
+			Digest:          run,
+			Name:            "[2/2] RUN make",
+			Inputs:          []digest.Digest{from},
+			Started:         &start,
+			Completed:       &end,
+			DurationSeconds: 1.5,
+			Error:           "exit code: 2",
+		},
+	}, graph)
+}
+
+func TestWatchPush(t *testing.T) {
+	in := make(chan *bkclient.SolveStatus)
+	out := make(chan *bkclient.SolveStatus)
+
+	var progress [][2]int64
+	go watchPush(in, out, func(pushed, total int64) {
+		progress = append(progress, [2]int64{pushed, total})
+	})
+
+	now := time.Now()
+	solve := digest.FromString("solve")
+	export := digest.FromString("export")
+	statuses := []*bkclient.SolveStatus{
+		{
+			Vertexes: []*bkclient.Vertex{{Digest: solve, Name: "[1/1] RUN make", Started: &now}},
+			Statuses: []*bkclient.VertexStatus{{ID: "step", Vertex: solve, Current: 1, Total: 2}},
+		},
+		{Vertexes: []*bkclient.Vertex{{Digest: export, Name: "exporting to image", Started: &now}}},
+		{Statuses: []*bkclient.VertexStatus{
+			{ID: "exporting layers", Vertex: export},
+			{ID: "pushing layer a", Vertex: export, Current: 10, Total: 100},
+			{ID: "pushing layer b", Vertex: export, Current: 0, Total: 50},
+		}},
+		{Statuses: []*bkclient.VertexStatus{{ID: "pushing layer b", Vertex: export, Current: 0, Total: 50}}},
+		{Statuses: []*bkclient.VertexStatus{{ID: "pushing layer a", Vertex: export, Current: 100, Total: 100}}},
+	}
+	go func() {
+		for _, status := range statuses {
+			in <- status
+		}
+		close(in)
+	}()
+
+	var forwarded int
+	for range out {
+		forwarded++
+	}
+
+	assert.Equal(t, len(statuses), forwarded)
+	assert.Equal(t, [][2]int64{{0, 0}, {10, 150}, {100, 150}}, progress)
+}
+
+func TestWatchLogs(t *testing.T) {
+	var events []map[string]any
+	lw := &LogWriter{Logger: funcr.NewJSON(func(obj string) {
+		var event map[string]any
+		require.NoError(t, json.Unmarshal([]byte(obj), &event))
+		events = append(events, event)
+	}, funcr.Options{})}
+
+	in := make(chan *bkclient.SolveStatus)
+	out := make(chan *bkclient.SolveStatus)
+	go watchLogs(in, out, lw)
+
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 42, time.UTC)
+	step := digest.FromString("step")
+	statuses := []*bkclient.SolveStatus{
+		{
+			Vertexes: []*bkclient.Vertex{{Digest: step, Name: "[2/2] RUN make"}},
+			Logs: []*bkclient.VertexLog{
+				{Vertex: step, Stream: 1, Data: []byte("building\npart"), Timestamp: ts},
+				{Vertex: step, Stream: 2, Data: []byte("warning: deprecated\r\n"), Timestamp: ts},
+			},
+		},
+		{Logs: []*bkclient.VertexLog{{Vertex: step, Stream: 1, Data: []byte("ial line\ntrailing"), Timestamp: ts}}},
+	}
+	go func() {
+		for _, status := range statuses {
+			in <- status
+		}
+		close(in)
+	}()
+
+	var forwarded int
+	for status := range out {
+		assert.Empty(t, status.Logs, "step output must not be repeated by the display")
+		forwarded++
+	}
+	assert.Equal(t, len(statuses), forwarded)
+
+	require.Len(t, events, 4)
+	assert.Equal(t, "building", events[0]["msg"])
+	assert.Equal(t, "stdout", events[0]["stream"])
+	assert.Equal(t, step.String(), events[0]["vertex"])
+	assert.Equal(t, "[2/2] RUN make", events[0]["vertexName"])
+	assert.Equal(t, "2024-05-01T12:00:00.000000042Z", events[0]["time"])
+	assert.Equal(t, "1714564800000000042", events[0]["time_nano"])
+	assert.Equal(t, "warning: deprecated", events[1]["msg"])
+	assert.Equal(t, "stderr", events[1]["stream"])
+	assert.Equal(t, "partial line", events[2]["msg"])
+	assert.Equal(t, "trailing", events[3]["msg"], "incomplete lines are flushed once the solve ends")
+}
+
+func TestMatchWorkers(t *testing.T) {
+	workers := []*bkclient.WorkerInfo{
+		{ID: "amd64", Platforms: []ocispecs.Platform{{OS: "linux", Architecture: "amd64"}}},
+		{ID: "multi", Platforms: []ocispecs.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		}},
+	}
+	filters := []string{"id!=none"}
+
+	assert.NoError(t, matchWorkers(nil, nil, nil), "unconstrained probes must not require a worker")
+	assert.NoError(t, matchWorkers(workers, filters, nil))
+	assert.NoError(t, matchWorkers(workers, filters, []string{"linux/amd64", "linux/arm64"}))
+	assert.ErrorIs(t, matchWorkers(nil, filters, nil), ErrNoMatchingWorker)
+	assert.ErrorIs(t, matchWorkers(workers, filters, []string{"linux/s390x"}), ErrNoMatchingWorker)
+	assert.ErrorIs(t, matchWorkers(workers[:1], nil, []string{"linux/amd64", "linux/arm64"}), ErrNoMatchingWorker)
+	assert.Error(t, matchWorkers(workers, nil, []string{"not/a/real/platform"}))
+}
+
+func TestLogWriterTail(t *testing.T) {
+	lw := &LogWriter{Logger: logr.Discard(), TailLines: 2}
+	step := digest.FromString("step")
+
+	lw.WriteVertexLog(&bkclient.VertexLog{Vertex: step, Stream: 1, Data: []byte("one\ntwo\nthree\nfour")}, "RUN make")
+	assert.Equal(t, []string{"two", "three"}, lw.Tail())
+
+	lw.Flush()
+	assert.Equal(t, []string{"three", "four"}, lw.Tail())
+
+	assert.Empty(t, (&LogWriter{Logger: logr.Discard()}).Tail(), "no lines are kept without a tail size")
+}
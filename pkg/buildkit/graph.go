@@ -0,0 +1,72 @@
+package buildkit
+
+import (
+	"time"
+
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+)
+
+// GraphVertex is a step of the build graph solved by buildkit.
+type GraphVertex struct {
+	// Digest identifies the vertex, Inputs reference the digests of the vertices it depends on.
+	Digest digest.Digest   `json:"digest"`
+	Name   string          `json:"name"`
+	Inputs []digest.Digest `json:"inputs,omitempty"`
+	// Started and Completed are blank when the vertex never ran, e.g. because the solve failed before reaching it.
+	Started   *time.Time `json:"started,omitempty"`
+	Completed *time.Time `json:"completed,omitempty"`
+	// DurationSeconds between the start and completion of the vertex, zero unless both are known.
+	DurationSeconds float64 `json:"durationSeconds"`
+	Cached          bool    `json:"cached"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// watchGraph forwards solve status updates while recording the latest state of every vertex. The graph is reported
+// in the order the vertices were first seen once the solve status channel is closed, failed solves included.
+func watchGraph(
+	in <-chan *bkclient.SolveStatus,
+	out chan<- *bkclient.SolveStatus,
+	report func(vertices []GraphVertex),
+) {
+	defer close(out)
+
+	var order []digest.Digest
+	vertices := map[digest.Digest]*GraphVertex{}
+	for status := range in {
+		for _, v := range status.Vertexes {
+			gv, seen := vertices[v.Digest]
+			if !seen {
+				gv = &GraphVertex{Digest: v.Digest}
+				vertices[v.Digest] = gv
+				order = append(order, v.Digest)
+			}
+
+			// updates carry the complete vertex, timestamps are kept in case one is ever omitted
+			gv.Name, gv.Inputs, gv.Cached, gv.Error = v.Name, v.Inputs, v.Cached, v.Error
+			if v.Started != nil {
+				gv.Started = v.Started
+			}
+			if v.Completed != nil {
+				gv.Completed = v.Completed
+			}
+		}
+
+		out <- status
+	}
+
+	if report == nil {
+		return
+	}
+
+	graph := make([]GraphVertex, 0, len(order))
+	for _, dgst := range order {
+		gv := *vertices[dgst]
+		if gv.Started != nil && gv.Completed != nil {
+			gv.DurationSeconds = gv.Completed.Sub(*gv.Started).Seconds()
+		}
+
+		graph = append(graph, gv)
+	}
+	report(graph)
+}
@@ -0,0 +1,115 @@
+package buildkit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+const dockerignoreFile = ".dockerignore"
+
+// pruneContext removes the paths matched by the .dockerignore file of the context directory and the extra patterns
+// so they are never sent to buildkit. Extra patterns are evaluated after the file's, so "!" patterns re-include paths
+// the file ignores. The Dockerfile and .dockerignore are always kept, like the docker cli does.
+//
+// When extra patterns are given, the merged patterns are written back to .dockerignore so that the dockerfile frontend
+// applies the same rules. The number of removed paths is returned.
+func pruneContext(dir string, extra []string) (int, error) {
+	ignoreFile := filepath.Join(dir, dockerignoreFile)
+
+	var patterns []string
+	f, err := os.Open(ignoreFile)
+	switch {
+	case err == nil:
+		patterns, err = ignorefile.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("cannot read %s: %w", dockerignoreFile, err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return 0, fmt.Errorf("cannot open %s: %w", dockerignoreFile, err)
+	}
+
+	if len(extra) != 0 {
+		patterns = append(patterns, extra...)
+
+		contents := strings.Join(patterns, "\n") + "\n"
+		if err = os.WriteFile(ignoreFile, []byte(contents), 0644); err != nil {
+			return 0, fmt.Errorf("cannot write %s: %w", dockerignoreFile, err)
+		}
+	}
+	if len(patterns) == 0 {
+		return 0, nil
+	}
+
+	pm, err := patternmatcher.New(patterns)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ignore pattern: %w", err)
+	}
+
+	var (
+		removed     int
+		matchedDirs []string
+	)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." || rel == "Dockerfile" || rel == dockerignoreFile {
+			return nil
+		}
+
+		matched, err := pm.MatchesOrParentMatches(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !matched:
+			return nil
+		case d.IsDir() && pm.Exclusions():
+			// exclusions may re-include paths below an ignored directory, so its contents are evaluated one by one
+			matchedDirs = append(matchedDirs, path)
+			return nil
+		case d.IsDir():
+			removed++
+			if err := os.RemoveAll(path); err != nil {
+				return err
+			}
+
+			return filepath.SkipDir
+		default:
+			removed++
+			return os.Remove(path)
+		}
+	})
+	if err != nil {
+		return removed, fmt.Errorf("cannot prune context: %w", err)
+	}
+
+	// ignored directories left empty are removed deepest first, the ones holding re-included paths are kept
+	for i := len(matchedDirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(matchedDirs[i])
+		if err != nil {
+			return removed, fmt.Errorf("cannot prune context: %w", err)
+		}
+		if len(entries) == 0 {
+			if err = os.Remove(matchedDirs[i]); err != nil {
+				return removed, fmt.Errorf("cannot prune context: %w", err)
+			}
+		}
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,56 @@
+package buildkit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneContext(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":                 "FROM scratch",
+		".dockerignore":              "# comment\nnode_modules\ndata\nDockerfile\n",
+		"app.py":                     "print()",
+		"node_modules/pkg/index.js":  "",
+		"data/big.bin":               "",
+		"data/keep.csv":              "a,b",
+		"src/node_modules/nested.js": "",
+	}
+	for name, contents := range files {
+		fp := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		require.NoError(t, os.WriteFile(fp, []byte(contents), 0644))
+	}
+
+	removed, err := pruneContext(dir, []string{"!data/keep.csv"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+
+	assert.FileExists(t, filepath.Join(dir, "Dockerfile"), "the Dockerfile is always kept")
+	assert.FileExists(t, filepath.Join(dir, "app.py"))
+	assert.FileExists(t, filepath.Join(dir, "data", "keep.csv"), "extra patterns re-include ignored paths")
+	assert.FileExists(t, filepath.Join(dir, "src", "node_modules", "nested.js"), "patterns are anchored to the root")
+	assert.NoFileExists(t, filepath.Join(dir, "data", "big.bin"))
+	assert.NoDirExists(t, filepath.Join(dir, "node_modules"))
+
+	data, err := os.ReadFile(filepath.Join(dir, dockerignoreFile))
+	require.NoError(t, err)
+	assert.Equal(t, "node_modules\ndata\nDockerfile\n!data/keep.csv\n", string(data))
+}
+
+func TestPruneContextWithoutPatterns(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0644))
+
+	removed, err := pruneContext(dir, nil)
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+	assert.NoFileExists(t, filepath.Join(dir, dockerignoreFile), "no file is written without extra patterns")
+
+	_, err = pruneContext(dir, []string{"["})
+	assert.Error(t, err)
+}
@@ -0,0 +1,135 @@
+// Package scratch manages the local directories builds use to fetch and extract their contexts.
+package scratch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+// ErrQuotaExceeded is returned when a build writes more data than its own or the global quota allows.
+var ErrQuotaExceeded = errors.New("scratch space quota exceeded")
+
+// Space hands out build directories below a root directory and accounts for the data written into them. It is safe
+// for concurrent use by parallel builds.
+//
+// The root directory is owned by a single Space, anything found in it when the Space is created is left over from a
+// previous process and removed.
+type Space struct {
+	root       string
+	buildQuota int64
+	totalQuota int64
+	log        logr.Logger
+
+	mu   sync.Mutex
+	used int64
+}
+
+// New creates the root directory when missing and removes orphaned build directories from it. Quotas are in bytes,
+// zero disables a quota.
+func New(log logr.Logger, root string, buildQuota, totalQuota int64) (*Space, error) {
+	if buildQuota < 0 || totalQuota < 0 {
+		return nil, errors.New("scratch quotas cannot be negative")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create scratch directory: %w", err)
+	}
+
+	s := &Space{
+		root:       root,
+		buildQuota: buildQuota,
+		totalQuota: totalQuota,
+		log:        log,
+	}
+	if err := s.removeOrphans(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Dir is a build directory whose writes are charged against the quotas of its Space.
+type Dir struct {
+	Path string
+
+	space *Space
+	mu    sync.Mutex
+	used  int64
+}
+
+// Create returns a new, empty build directory. Callers must Release it once the build is done.
+func (s *Space) Create(prefix string) (*Dir, error) {
+	path, err := os.MkdirTemp(s.root, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build dir: %w", err)
+	}
+
+	return &Dir{Path: path, space: s}, nil
+}
+
+// Used returns the number of bytes currently charged by all build directories.
+func (s *Space) Used() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.used
+}
+
+// Reserve charges n bytes against the quotas, nothing is charged when either quota would be exceeded.
+func (d *Dir) Reserve(n int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if q := d.space.buildQuota; q > 0 && d.used+n > q {
+		return fmt.Errorf("%w: build directory limit of %d bytes", ErrQuotaExceeded, q)
+	}
+
+	d.space.mu.Lock()
+	defer d.space.mu.Unlock()
+
+	if q := d.space.totalQuota; q > 0 && d.space.used+n > q {
+		return fmt.Errorf("%w: total limit of %d bytes shared by all builds", ErrQuotaExceeded, q)
+	}
+
+	d.used += n
+	d.space.used += n
+
+	return nil
+}
+
+// Release deletes the directory and returns its charged bytes to the Space.
+func (d *Dir) Release() error {
+	err := os.RemoveAll(d.Path)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.space.mu.Lock()
+	d.space.used -= d.used
+	d.space.mu.Unlock()
+	d.used = 0
+
+	return err
+}
+
+func (s *Space) removeOrphans() error {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return fmt.Errorf("cannot read scratch directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(s.root, entry.Name())
+
+		s.log.Info("Removing orphaned build directory", "path", path)
+		if err = os.RemoveAll(path); err != nil {
+			return fmt.Errorf("cannot remove orphaned build directory: %w", err)
+		}
+	}
+
+	return nil
+}
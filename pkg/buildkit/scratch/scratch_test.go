@@ -0,0 +1,82 @@
+package scratch
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRemovesOrphans(t *testing.T) {
+	root := t.TempDir()
+	orphan := filepath.Join(root, "hephaestus-build-123")
+	require.NoError(t, os.MkdirAll(filepath.Join(orphan, "extracted"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(orphan, "archive"), []byte("data"), 0644))
+
+	_, err := New(logr.Discard(), root, 0, 0)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = New(logr.Discard(), root, -1, 0)
+	assert.Error(t, err)
+}
+
+func TestQuotas(t *testing.T) {
+	space, err := New(logr.Discard(), t.TempDir(), 10, 15)
+	require.NoError(t, err)
+
+	first, err := space.Create("build-")
+	require.NoError(t, err)
+	second, err := space.Create("build-")
+	require.NoError(t, err)
+	assert.DirExists(t, first.Path)
+
+	require.NoError(t, first.Reserve(8))
+	assert.ErrorIs(t, first.Reserve(3), ErrQuotaExceeded, "build quota")
+	require.NoError(t, second.Reserve(7))
+	assert.ErrorIs(t, second.Reserve(1), ErrQuotaExceeded, "total quota")
+	assert.Equal(t, int64(15), space.Used())
+
+	require.NoError(t, first.Release())
+	assert.NoDirExists(t, first.Path)
+	assert.Equal(t, int64(7), space.Used())
+	require.NoError(t, second.Reserve(3))
+}
+
+func TestConcurrentReserve(t *testing.T) {
+	space, err := New(logr.Discard(), t.TempDir(), 0, 100)
+	require.NoError(t, err)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for i := 0; i < 4; i++ {
+		dir, err := space.Create("build-")
+		require.NoError(t, err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if dir.Reserve(1) == nil {
+					mu.Lock()
+					reserved++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 100, reserved)
+	assert.Equal(t, int64(100), space.Used())
+}
@@ -1,9 +1,16 @@
 package buildkit
 
 import (
+	"bytes"
 	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
 )
 
 type DiscardCloser struct {
@@ -12,8 +19,21 @@ type DiscardCloser struct {
 
 func (DiscardCloser) Close() error { return nil }
 
+// LogWriter receives the plain progress output of a build. Output of the build steps is written separately as
+// structured events with WriteVertexLog.
 type LogWriter struct {
 	Logger logr.Logger
+	// TailLines is the number of trailing lines of step output returned by Tail, none are kept when zero.
+	TailLines int
+
+	mu      sync.Mutex
+	partial map[vertexStream]*bytes.Buffer
+	tail    []string
+}
+
+type vertexStream struct {
+	vertex digest.Digest
+	stream int
 }
 
 func (w *LogWriter) Read(_ []byte) (n int, err error) {
@@ -36,3 +56,91 @@ func (w *LogWriter) Write(msg []byte) (int, error) {
 	w.Logger.Info(string(msg))
 	return len(msg), nil
 }
+
+// WriteVertexLog emits one event per complete line of step output. The events carry the vertex, stream and time
+// fields of the log schema consumed from Redis so per-step output can be reconstructed. Incomplete lines are held
+// back until the rest of the line arrives or Flush is called.
+func (w *LogWriter) WriteVertexLog(vl *bkclient.VertexLog, vertexName string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.partial == nil {
+		w.partial = map[vertexStream]*bytes.Buffer{}
+	}
+
+	key := vertexStream{vertex: vl.Vertex, stream: vl.Stream}
+	buf, ok := w.partial[key]
+	if !ok {
+		buf = &bytes.Buffer{}
+		w.partial[key] = buf
+	}
+	buf.Write(vl.Data)
+
+	for {
+		line, err := buf.ReadString('\n')
+		if err != nil {
+			// put the incomplete line back for the next write
+			buf.Reset()
+			buf.WriteString(line)
+			break
+		}
+
+		w.logLine(key, vertexName, vl.Timestamp, line)
+	}
+	if buf.Len() == 0 {
+		delete(w.partial, key)
+	}
+}
+
+// Flush emits the incomplete lines that are still held back.
+func (w *LogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key, buf := range w.partial {
+		w.logLine(key, "", time.Now(), buf.String())
+	}
+	w.partial = nil
+}
+
+// Tail returns up to TailLines of the most recent step output lines, oldest first.
+func (w *LogWriter) Tail() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]string(nil), w.tail...)
+}
+
+func (w *LogWriter) logLine(key vertexStream, vertexName string, ts time.Time, line string) {
+	line = strings.TrimRight(line, "\r\n")
+
+	if w.TailLines > 0 {
+		if len(w.tail) == w.TailLines {
+			w.tail = append(w.tail[:0], w.tail[1:]...)
+		}
+		w.tail = append(w.tail, line)
+	}
+
+	kv := []any{
+		"vertex", key.vertex.String(),
+		"stream", streamName(key.stream),
+		"time", ts.UTC().Format(time.RFC3339Nano),
+		"time_nano", strconv.FormatInt(ts.UnixNano(), 10),
+	}
+	if vertexName != "" {
+		kv = append(kv, "vertexName", vertexName)
+	}
+
+	w.Logger.Info(line, kv...)
+}
+
+func streamName(stream int) string {
+	switch stream {
+	case 1:
+		return "stdout"
+	case 2:
+		return "stderr"
+	default:
+		return "stream" + strconv.Itoa(stream)
+	}
+}
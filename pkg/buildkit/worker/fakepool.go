@@ -0,0 +1,315 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeLease records a single Get call served by a FakePool.
+type FakeLease struct {
+	Owner        string
+	Addr         string
+	OnDemandOnly bool
+	// PodName the lease was pinned to, if any.
+	PodName string
+	// Platforms the lease requested, if any.
+	Platforms []string
+}
+
+// FakePool is an in-memory Pool for tests of code that leases workers. Leases are handed out deterministically from
+// Addrs in order, a Get blocks while every address is leased until one is released or its context is done.
+//
+// Latency and error fields may be set before the pool is used, or at any time through the setters.
+type FakePool struct {
+	// Addrs of the workers in the pool, a single "tcp://fake-worker-0:1234" worker is used when empty.
+	Addrs []string
+	// GetLatency is waited before every lease is fulfilled.
+	GetLatency time.Duration
+	// ReleaseLatency is waited before every release.
+	ReleaseLatency time.Duration
+	// GetErr is returned by Get instead of a lease.
+	GetErr error
+	// ReleaseErr is returned by Release, the lease is kept.
+	ReleaseErr error
+
+	mu        sync.Mutex
+	available chan struct{}
+	leased    map[string]string
+	watchers  map[string][]chan struct{}
+	leases    []FakeLease
+	released  []string
+	stopped   bool
+	cordoned  bool
+}
+
+var _ Pool = &FakePool{}
+
+// NewFakePool returns a FakePool with a worker for each address.
+func NewFakePool(addrs ...string) *FakePool {
+	return &FakePool{Addrs: addrs}
+}
+
+// Start blocks until the context is done, pending and future leases then fail.
+func (p *FakePool) Start(ctx context.Context) error {
+	<-ctx.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stopped = true
+	p.signal()
+
+	return nil
+}
+
+// Get leases the first worker that is not leased. Pinned requests lease the worker whose address hostname starts with
+// the pod name and fail immediately when it is unknown or leased.
+func (p *FakePool) Get(ctx context.Context, owner string, opts ...LeaseOption) (string, error) {
+	request := &PodRequest{owner: owner}
+	for _, opt := range opts {
+		opt(request)
+	}
+
+	p.mu.Lock()
+	latency, getErr, cordoned := p.GetLatency, p.GetErr, p.cordoned
+	p.mu.Unlock()
+
+	if err := delay(ctx, latency); err != nil {
+		return "", err
+	}
+	if getErr != nil {
+		return "", getErr
+	}
+	if cordoned {
+		return "", ErrPoolCordoned
+	}
+
+	for {
+		p.mu.Lock()
+		p.init()
+
+		if p.stopped {
+			p.mu.Unlock()
+			return "", errPoolClosed
+		}
+
+		if request.podName != "" {
+			addr, err := p.leasePinned(request)
+			p.mu.Unlock()
+
+			return addr, err
+		}
+
+		for _, addr := range p.Addrs {
+			if _, ok := p.leased[addr]; ok {
+				continue
+			}
+
+			p.leased[addr] = owner
+			p.leases = append(p.leases, FakeLease{
+				Owner:        owner,
+				Addr:         addr,
+				OnDemandOnly: request.onDemandOnly,
+				Platforms:    request.platforms,
+			})
+			p.mu.Unlock()
+
+			return addr, nil
+		}
+
+		available := p.available
+		p.mu.Unlock()
+
+		select {
+		case <-available:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// Release returns a leased worker to the pool.
+func (p *FakePool) Release(ctx context.Context, addr string) error {
+	p.mu.Lock()
+	latency, releaseErr := p.ReleaseLatency, p.ReleaseErr
+	p.mu.Unlock()
+
+	if err := delay(ctx, latency); err != nil {
+		return err
+	}
+	if releaseErr != nil {
+		return releaseErr
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+
+	if _, ok := p.leased[addr]; !ok {
+		return fmt.Errorf("addr %q is not allocated", addr)
+	}
+
+	delete(p.leased, addr)
+	p.released = append(p.released, addr)
+	p.signal()
+
+	return nil
+}
+
+// WatchEviction returns a channel that is closed when Evict is called for the address.
+func (p *FakePool) WatchEviction(_ context.Context, addr string) (<-chan struct{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+
+	if _, ok := p.leased[addr]; !ok {
+		return nil, fmt.Errorf("cannot watch worker %q: not leased", addr)
+	}
+
+	ch := make(chan struct{})
+	p.watchers[addr] = append(p.watchers[addr], ch)
+
+	return ch, nil
+}
+
+// Evict notifies every watcher of the address and drops its lease, as if the worker had been deleted.
+func (p *FakePool) Evict(addr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+
+	for _, ch := range p.watchers[addr] {
+		close(ch)
+	}
+	delete(p.watchers, addr)
+
+	if _, ok := p.leased[addr]; ok {
+		delete(p.leased, addr)
+		p.signal()
+	}
+}
+
+// Cordoned reports whether the pool was cordoned with SetCordoned.
+func (p *FakePool) Cordoned(context.Context) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.cordoned, nil
+}
+
+// SetCordoned cordons or uncordons the pool, Get fails with ErrPoolCordoned while it is cordoned.
+func (p *FakePool) SetCordoned(cordoned bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cordoned = cordoned
+}
+
+// SetGetErr changes the error returned by Get.
+func (p *FakePool) SetGetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.GetErr = err
+}
+
+// SetReleaseErr changes the error returned by Release.
+func (p *FakePool) SetReleaseErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ReleaseErr = err
+}
+
+// Leases returns every lease handed out so far in order.
+func (p *FakePool) Leases() []FakeLease {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]FakeLease(nil), p.leases...)
+}
+
+// Released returns every released address in order.
+func (p *FakePool) Released() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.released...)
+}
+
+// Leased returns the owner of the address and whether it is currently leased.
+func (p *FakePool) Leased(addr string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	owner, ok := p.leased[addr]
+	return owner, ok
+}
+
+// leasePinned leases the worker the request is pinned to, callers must hold the lock.
+func (p *FakePool) leasePinned(request *PodRequest) (string, error) {
+	for _, addr := range p.Addrs {
+		if name, err := podNameFromAddr(addr); err != nil || name != request.podName {
+			continue
+		}
+		if owner, ok := p.leased[addr]; ok {
+			return "", fmt.Errorf("pinned worker %q is leased by %q", request.podName, owner)
+		}
+
+		p.leased[addr] = request.owner
+		p.leases = append(p.leases, FakeLease{
+			Owner:        request.owner,
+			Addr:         addr,
+			OnDemandOnly: request.onDemandOnly,
+			PodName:      request.podName,
+			Platforms:    request.platforms,
+		})
+
+		return addr, nil
+	}
+
+	return "", fmt.Errorf("cannot find pinned worker %q", request.podName)
+}
+
+// init lazily sets up state so that the zero value is usable, callers must hold the lock.
+func (p *FakePool) init() {
+	if p.leased != nil {
+		return
+	}
+
+	if len(p.Addrs) == 0 {
+		p.Addrs = []string{"tcp://fake-worker-0:1234"}
+	}
+	p.available = make(chan struct{})
+	p.leased = map[string]string{}
+	p.watchers = map[string][]chan struct{}{}
+}
+
+// signal wakes up every blocked Get, callers must hold the lock.
+func (p *FakePool) signal() {
+	if p.available == nil {
+		return
+	}
+
+	close(p.available)
+	p.available = make(chan struct{})
+}
+
+// delay waits for the duration or until the context is done.
+func delay(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
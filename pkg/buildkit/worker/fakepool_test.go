@@ -0,0 +1,176 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakePoolLeases(t *testing.T) {
+	ctx := context.Background()
+	p := NewFakePool("tcp://a:1234", "tcp://b:1234")
+
+	addr, err := p.Get(ctx, "one")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://a:1234", addr)
+
+	addr, err = p.Get(ctx, "two", OnDemandOnly())
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://b:1234", addr)
+
+	owner, leased := p.Leased("tcp://b:1234")
+	assert.True(t, leased)
+	assert.Equal(t, "two", owner)
+
+	// blocks until a worker is released
+	result := make(chan string)
+	go func() {
+		addr, err := p.Get(ctx, "three")
+		assert.NoError(t, err)
+		result <- addr
+	}()
+
+	select {
+	case <-result:
+		t.Fatal("lease fulfilled while every worker was leased")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, p.Release(ctx, "tcp://a:1234"))
+	assert.Equal(t, "tcp://a:1234", <-result)
+
+	assert.Equal(t, []FakeLease{
+		{Owner: "one", Addr: "tcp://a:1234"},
+		{Owner: "two", Addr: "tcp://b:1234", OnDemandOnly: true},
+		{Owner: "three", Addr: "tcp://a:1234"},
+	}, p.Leases())
+	assert.Equal(t, []string{"tcp://a:1234"}, p.Released())
+
+	assert.Error(t, p.Release(ctx, "tcp://c:1234"))
+}
+
+func TestFakePoolPinned(t *testing.T) {
+	ctx := context.Background()
+	p := NewFakePool("tcp://buildkit-0.buildkit:1234", "tcp://buildkit-1.buildkit:1234")
+
+	addr, err := p.Get(ctx, "one", PinnedTo("buildkit-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://buildkit-1.buildkit:1234", addr)
+
+	_, err = p.Get(ctx, "two", PinnedTo("buildkit-1"))
+	assert.Error(t, err, "pinned requests do not wait for the worker")
+	_, err = p.Get(ctx, "two", PinnedTo("buildkit-2"))
+	assert.Error(t, err)
+
+	assert.Equal(t, []FakeLease{
+		{Owner: "one", Addr: "tcp://buildkit-1.buildkit:1234", PodName: "buildkit-1"},
+	}, p.Leases())
+}
+
+func TestFakePoolCordoned(t *testing.T) {
+	ctx := context.Background()
+	p := NewFakePool()
+
+	p.SetCordoned(true)
+	cordoned, err := p.Cordoned(ctx)
+	require.NoError(t, err)
+	assert.True(t, cordoned)
+
+	_, err = p.Get(ctx, "owner")
+	assert.ErrorIs(t, err, ErrPoolCordoned)
+
+	p.SetCordoned(false)
+	_, err = p.Get(ctx, "owner")
+	assert.NoError(t, err)
+}
+
+func TestFakePoolZeroValue(t *testing.T) {
+	var p FakePool
+
+	addr, err := p.Get(context.Background(), "owner")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://fake-worker-0:1234", addr)
+}
+
+func TestFakePoolFailures(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	p := &FakePool{GetErr: boom}
+	_, err := p.Get(ctx, "owner")
+	assert.ErrorIs(t, err, boom)
+
+	p.SetGetErr(nil)
+	addr, err := p.Get(ctx, "owner")
+	require.NoError(t, err)
+
+	p.SetReleaseErr(boom)
+	assert.ErrorIs(t, p.Release(ctx, addr), boom)
+	_, leased := p.Leased(addr)
+	assert.True(t, leased, "failed release must keep the lease")
+}
+
+func TestFakePoolLatency(t *testing.T) {
+	p := &FakePool{GetLatency: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := p.Get(ctx, "owner")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	p = &FakePool{GetLatency: 20 * time.Millisecond}
+	start := time.Now()
+	_, err = p.Get(context.Background(), "owner")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestFakePoolEvict(t *testing.T) {
+	ctx := context.Background()
+	p := NewFakePool()
+
+	addr, err := p.Get(ctx, "owner")
+	require.NoError(t, err)
+
+	evicted, err := p.WatchEviction(ctx, addr)
+	require.NoError(t, err)
+
+	p.Evict(addr)
+	select {
+	case <-evicted:
+	default:
+		t.Fatal("eviction was not signalled")
+	}
+
+	_, leased := p.Leased(addr)
+	assert.False(t, leased)
+
+	_, err = p.WatchEviction(ctx, addr)
+	assert.Error(t, err)
+}
+
+func TestFakePoolStart(t *testing.T) {
+	p := NewFakePool()
+
+	_, err := p.Get(context.Background(), "owner")
+	require.NoError(t, err)
+
+	pending := make(chan error)
+	go func() {
+		_, err := p.Get(context.Background(), "blocked")
+		pending <- err
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan error)
+	go func() { started <- p.Start(ctx) }()
+
+	cancel()
+	require.NoError(t, <-started)
+	assert.ErrorIs(t, <-pending, errPoolClosed)
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
@@ -19,38 +23,147 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
 	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	metav1ac "k8s.io/client-go/applyconfigurations/meta/v1"
+	policyv1ac "k8s.io/client-go/applyconfigurations/policy/v1"
 	"k8s.io/client-go/kubernetes"
 	appsv1typed "k8s.io/client-go/kubernetes/typed/apps/v1"
 	corev1typed "k8s.io/client-go/kubernetes/typed/core/v1"
 	discoveryv1typed "k8s.io/client-go/kubernetes/typed/discovery/v1"
+	policyv1typed "k8s.io/client-go/kubernetes/typed/policy/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 
+	"github.com/dominodatalab/hephaestus/pkg/buildkit"
 	"github.com/dominodatalab/hephaestus/pkg/config"
 )
 
 type Pool interface {
 	Start(ctx context.Context) error
-	Get(ctx context.Context, owner string) (workerAddr string, err error)
+	Get(ctx context.Context, owner string, opts ...LeaseOption) (workerAddr string, err error)
 	Release(ctx context.Context, workerAddr string) error
+	WatchEviction(ctx context.Context, workerAddr string) (<-chan struct{}, error)
+	Cordoned(ctx context.Context) (bool, error)
 }
 
 var (
 	newUUID          = uuid.NewUUID
 	statefulPodRegex = regexp.MustCompile(`^.*-(\d+)$`)
+
+	// exists only so it can be overridden by tests without a running buildkitd
+	probeWorker = func(
+		ctx context.Context,
+		mtls *config.BuildkitMTLS,
+		filters, platforms []string,
+		addr string,
+	) (version string, err error) {
+		bldr := buildkit.NewClientBuilder(addr).WithWorkerConstraints(filters, platforms)
+		if mtls != nil {
+			bldr.WithMTLSAuth(mtls.CACertPath, mtls.CertPath, mtls.KeyPath)
+		}
+
+		return bldr.Probe(ctx)
+	}
+)
+
+const (
+	defaultFieldManager     = "hephaestus-pod-lease-manager"
+	defaultAnnotationDomain = "hephaestus.dominodatalab.com"
+
+	// leased workers are the most expensive to delete so that scale downs and drains prefer idle ones
+	podDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+	leasedPodDeletionCost     = "1000"
+
+	// time limit for the buildkitd health probe run before a lease is fulfilled
+	workerProbeTimeout = 10 * time.Second
+
+	// leases younger than this are never considered orphaned, owners release their lease shortly after they are
+	// deleted and may lease before they are visible to the owner lookup
+	orphanedLeaseGracePeriod = 10 * time.Minute
+
+	// time limit for warming the cache of a pod restarted by a rolling upgrade, the pod is leased once it passed
+	cacheWarmupTimeout = 15 * time.Minute
+)
+
+// delays between the watches of a leased worker, so that watches failing right away do not hammer the api server
+var evictionWatchBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: 8, Cap: time.Minute}
+
+// Modes of resolving worker addresses. In the auto mode, classic Endpoints are used whenever EndpointSlices cannot be
+// listed or none exist for the buildkit service while its Endpoints do, as happens with some older or forked
+// distributions and service meshes.
+const (
+	EndpointDiscoveryAuto           = "auto"
+	EndpointDiscoveryEndpointSlices = "endpointSlices"
+	EndpointDiscoveryEndpoints      = "endpoints"
 )
 
+// Modes of addressing leased workers. Workers are dialed through the DNS names of the headless service by default, the
+// pod IP mode skips the endpoint lookup and dials ready pods directly for clusters where DNS propagation lags.
 const (
-	fieldManagerName     = "hephaestus-pod-lease-manager"
-	leasedAtAnnotation   = "hephaestus.dominodatalab.com/leased-at"
-	leasedByAnnotation   = "hephaestus.dominodatalab.com/leased-by"
-	managerIDAnnotation  = "hephaestus.dominodatalab.com/manager-identity"
-	expiryTimeAnnotation = "hephaestus.dominodatalab.com/expiry-time"
+	AddressModeDNS   = "dns"
+	AddressModePodIP = "podIP"
 )
 
 var errPoolClosed = errors.New("AutoscalingPool closed")
 
+// ErrPoolCordoned is returned for lease requests while the pool is cordoned for maintenance.
+var ErrPoolCordoned = errors.New("worker pool is cordoned")
+
+// metadataKeys are the pod annotations and labels used to track worker leases, upgrades and cache generations, as well
+// as the statefulset annotations used to cordon the pool and report worker versions.
+type metadataKeys struct {
+	leasedAt    string
+	leasedBy    string
+	managerID   string
+	expiryTime  string
+	leaseCount  string
+	leasedLabel string
+	cordoned    string
+	versions    string
+	upgrading   string
+	warming     string
+	cacheGen    string
+	spotNode    string
+}
+
+// newMetadataKeys prefixes every lease annotation and label with the given domain.
+func newMetadataKeys(domain string) metadataKeys {
+	return metadataKeys{
+		leasedAt:    domain + "/leased-at",
+		leasedBy:    domain + "/leased-by",
+		managerID:   domain + "/manager-identity",
+		expiryTime:  domain + "/expiry-time",
+		leaseCount:  domain + "/lease-count",
+		leasedLabel: domain + "/leased",
+		cordoned:    domain + "/cordoned",
+		versions:    domain + "/buildkit-versions",
+		upgrading:   domain + "/upgrading",
+		warming:     domain + "/warming",
+		cacheGen:    domain + "/cache-generation",
+		spotNode:    domain + "/spot-node",
+	}
+}
+
+// number of times a pod has been leased, invalid or missing counts are treated as zero
+func (k metadataKeys) countLeases(pod corev1.Pod) int {
+	n, _ := strconv.Atoi(pod.Annotations[k.leaseCount])
+	return n
+}
+
+// number of builds that populated the persistent cache behind a pod or claim, invalid or missing generations are
+// treated as an empty cache
+func (k metadataKeys) cacheGeneration(annotations map[string]string) int {
+	n, _ := strconv.Atoi(annotations[k.cacheGen])
+	return n
+}
+
 type AutoscalingPool struct {
 	log logr.Logger
 
@@ -63,19 +176,46 @@ type AutoscalingPool struct {
 	// worker loop routine
 	poolSyncTime    time.Duration
 	podMaxIdleTime  time.Duration
+	podMaxBuilds    int
+	rollingUpgrade  bool
 	notifyReconcile chan struct{}
 
+	// cache warm-up of pods restarted by rolling upgrades, both sets are guarded by the lease lock
+	cacheWarmup CacheWarmup
+	restarted   map[string]bool
+	warming     map[string]bool
+
+	// orphaned lease release
+	leaseOwnerExists    LeaseOwnerLookup
+	orphanCheckInterval time.Duration
+
+	// periodic state summary
+	stateLogInterval time.Duration
+	lastStateLog     time.Time
+	lastReplicas     int
+
+	// serializes leasing between the reconcile loop and pinned requests
+	leaseMu sync.Mutex
+
 	// leasing
 	uuid                string
+	fieldManager        string
+	keys                metadataKeys
 	namespace           string
 	podClient           corev1typed.PodInterface
 	nodeClient          corev1typed.NodeInterface
 	eventClient         corev1typed.EventInterface
 	endpointSliceClient discoveryv1typed.EndpointSliceInterface
+	endpointsClient     corev1typed.EndpointsInterface
+	pvcClient           corev1typed.PersistentVolumeClaimInterface
 
 	podListOptions            metav1.ListOptions
 	endpointSliceListOptions  metav1.ListOptions
 	endpointSliceWatchTimeout int64
+	endpointWatchRetries      int
+	endpointWatchBackoff      time.Duration
+	endpointDiscovery         string
+	addressMode               string
 
 	// endpoints discovery
 	serviceName string
@@ -84,6 +224,24 @@ type AutoscalingPool struct {
 	// statefulset mgmt
 	statefulSetName   string
 	statefulSetClient appsv1typed.StatefulSetInterface
+
+	// worker health probing
+	mtls          *config.BuildkitMTLS
+	workerFilters []string
+	platforms     []string
+
+	// spot/preemptible capacity
+	spotNodeSelector labels.Selector
+
+	// disruption budget mgmt
+	podLabels              map[string]string
+	manageDisruptionBudget bool
+	pdbClient              policyv1typed.PodDisruptionBudgetInterface
+
+	// buildkit versions observed by health probes, keyed by pod uid
+	versionsMu     sync.Mutex
+	workerVersions map[types.UID]string
+	recorder       record.EventRecorder
 }
 
 // NewPool creates a new worker pool that can be used to lease buildkit workers for image builds.
@@ -103,19 +261,34 @@ func NewPool(
 	esls := labels.SelectorFromSet(map[string]string{"kubernetes.io/service-name": conf.ServiceName})
 	endpointSliceListOptions := metav1.ListOptions{LabelSelector: esls.String()}
 
+	requests := NewRequestQueue()
+	if o.FairScheduling {
+		requests = NewFairRequestQueue(o.NamespaceWeights)
+	}
+
 	wp := &AutoscalingPool{
 		log:                       o.Log,
 		stopped:                   make(chan struct{}),
 		poolSyncTime:              o.SyncWaitTime,
+		stateLogInterval:          o.StateLogInterval,
+		leaseOwnerExists:          o.LeaseOwnerExists,
+		orphanCheckInterval:       o.OrphanCheckInterval,
+		lastReplicas:              -1,
 		podMaxIdleTime:            o.MaxIdleTime,
 		endpointSliceWatchTimeout: o.EndpointWatchTimeoutSeconds,
+		endpointWatchRetries:      o.EndpointWatchRetries,
+		endpointWatchBackoff:      o.EndpointWatchBackoff,
+		endpointDiscovery:         o.EndpointDiscovery,
+		addressMode:               o.AddressMode,
 		uuid:                      string(newUUID()),
-		requests:                  NewRequestQueue(),
+		requests:                  requests,
 		notifyReconcile:           make(chan struct{}, 1),
 		podClient:                 clientset.CoreV1().Pods(conf.Namespace),
 		nodeClient:                clientset.CoreV1().Nodes(),
 		eventClient:               clientset.CoreV1().Events(conf.Namespace),
 		endpointSliceClient:       clientset.DiscoveryV1().EndpointSlices(conf.Namespace),
+		endpointsClient:           clientset.CoreV1().Endpoints(conf.Namespace),
+		pvcClient:                 clientset.CoreV1().PersistentVolumeClaims(conf.Namespace),
 		podListOptions:            podListOptions,
 		endpointSliceListOptions:  endpointSliceListOptions,
 		serviceName:               conf.ServiceName,
@@ -123,6 +296,22 @@ func NewPool(
 		statefulSetName:           conf.StatefulSetName,
 		statefulSetClient:         clientset.AppsV1().StatefulSets(conf.Namespace),
 		namespace:                 conf.Namespace,
+		mtls:                      conf.MTLS,
+		workerFilters:             conf.WorkerFilters,
+		platforms:                 conf.Platforms,
+		podLabels:                 conf.PodLabels,
+		spotNodeSelector:          spotNodeSelector(conf.SpotNodeLabels),
+		manageDisruptionBudget:    o.DisruptionBudget,
+		podMaxBuilds:              o.MaxBuildsPerPod,
+		rollingUpgrade:            o.RollingUpgrade,
+		cacheWarmup:               o.CacheWarmup,
+		restarted:                 map[string]bool{},
+		warming:                   map[string]bool{},
+		fieldManager:              o.FieldManager,
+		keys:                      newMetadataKeys(o.AnnotationDomain),
+		pdbClient:                 clientset.PolicyV1().PodDisruptionBudgets(conf.Namespace),
+		workerVersions:            map[types.UID]string{},
+		recorder:                  o.EventRecorder,
 	}
 	return wp
 }
@@ -132,6 +321,14 @@ func (p *AutoscalingPool) Start(ctx context.Context) error {
 
 	ticker := time.NewTicker(p.poolSyncTime)
 
+	// the orphan check never fires without an owner lookup
+	var orphanCheck <-chan time.Time
+	if p.leaseOwnerExists != nil && p.orphanCheckInterval > 0 {
+		orphanTicker := time.NewTicker(p.orphanCheckInterval)
+		defer orphanTicker.Stop()
+		orphanCheck = orphanTicker.C
+	}
+
 	defer func() {
 		ticker.Stop()
 		p.log.Info("Shutting down worker pod monitor")
@@ -141,6 +338,12 @@ func (p *AutoscalingPool) Start(ctx context.Context) error {
 		close(p.stopped)
 	}()
 
+	if p.manageDisruptionBudget {
+		if err := p.applyDisruptionBudget(ctx); err != nil {
+			p.log.Error(err, "Failed to apply worker disruption budget")
+		}
+	}
+
 	for {
 		if err := p.reconcileWorkers(ctx); err != nil {
 			p.log.Error(err, "Failed to update worker pool")
@@ -149,9 +352,11 @@ func (p *AutoscalingPool) Start(ctx context.Context) error {
 		select {
 		// break out of the select when triggered by notification or tick, this will trigger an update
 		case <-p.notifyReconcile:
-			p.log.Info("Reconciling pool, notify triggered")
+			p.log.V(1).Info("Reconciling pool, notify triggered")
 		case <-ticker.C:
-			p.log.Info("Reconciling pool, sync triggered")
+			p.log.V(1).Info("Reconciling pool, sync triggered")
+		case <-orphanCheck:
+			p.releaseOrphanedLeases(ctx)
 		case <-ctx.Done():
 			return nil
 		}
@@ -162,11 +367,27 @@ func (p *AutoscalingPool) Start(ctx context.Context) error {
 //
 // Adds "lease"/"manager-identity" metadata and removes "expiry-time".
 // The worker will remain leased until the caller provides the address to Release().
-func (p *AutoscalingPool) Get(ctx context.Context, owner string) (string, error) {
+// Workers whose buildkitd fails a health probe are recycled and the request is served by another worker.
+// Requests pinned to a worker with PinnedTo bypass the queue and fail when that worker cannot be leased.
+// ErrPoolCordoned is returned while the pool is cordoned, see Cordoned.
+func (p *AutoscalingPool) Get(ctx context.Context, owner string, opts ...LeaseOption) (string, error) {
 	request := &PodRequest{
 		owner:  owner,
 		result: make(chan PodRequestResult, 1),
 	}
+	for _, opt := range opts {
+		opt(request)
+	}
+
+	if cordoned, err := p.Cordoned(ctx); err != nil {
+		p.log.Error(err, "Failed to check pool cordon, assuming pool is not cordoned")
+	} else if cordoned {
+		return "", ErrPoolCordoned
+	}
+
+	if request.podName != "" {
+		return p.getPinned(ctx, request)
+	}
 
 	p.log.Info("Enqueuing new pod request")
 	p.requests.Enqueue(request)
@@ -193,19 +414,96 @@ func (p *AutoscalingPool) Get(ctx context.Context, owner string) (string, error)
 	return "", errPoolClosed
 }
 
+// Cordoned reports whether the pool is in maintenance mode.
+//
+// The pool is cordoned by setting the "<annotation domain>/cordoned" annotation to "true" on the buildkit statefulset.
+// Workers that are already leased are left alone so running builds finish, while new and queued lease requests are
+// rejected with ErrPoolCordoned until the annotation is removed.
+func (p *AutoscalingPool) Cordoned(ctx context.Context) (bool, error) {
+	sts, err := p.statefulSetClient.Get(ctx, p.statefulSetName, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("cannot find buildkit statefulset: %w", err)
+	}
+
+	return sts.Annotations[p.keys.cordoned] == "true", nil
+}
+
+// leases the requested pod directly, pinned requests never wait in the queue so unavailable pods fail fast
+func (p *AutoscalingPool) getPinned(ctx context.Context, req *PodRequest) (string, error) {
+	log := p.log.WithValues("podName", req.podName)
+
+	log.Info("Attempting to lease pinned pod")
+	pod, err := p.leasePinnedPod(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info("Building endpoint URL")
+	addr, err := p.buildEndpointURL(ctx, *pod)
+	if err == nil {
+		log.Info("Probing buildkitd health", "addr", addr)
+		err = p.probePod(ctx, *pod, addr, req.platforms)
+	}
+	if err != nil {
+		// unlike queued requests the pod is never recycled, its state is what the caller wants to inspect
+		log.Error(err, "Pinned pod is unusable, releasing pod")
+		if rErr := p.releasePod(ctx, *pod); rErr != nil {
+			log.Error(rErr, "Failed to release pod")
+		}
+
+		return "", fmt.Errorf("pinned worker %q is unavailable: %w", req.podName, err)
+	}
+
+	log.Info("Pinned pod successfully leased")
+	return addr, nil
+}
+
+// verifies a pinned pod can be leased and applies the lease metadata
+func (p *AutoscalingPool) leasePinnedPod(ctx context.Context, req *PodRequest) (*corev1.Pod, error) {
+	p.leaseMu.Lock()
+	defer p.leaseMu.Unlock()
+
+	pod, err := p.podClient.Get(ctx, req.podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find pinned worker %q: %w", req.podName, err)
+	}
+
+	switch {
+	case !labels.SelectorFromSet(p.podLabels).Matches(labels.Set(pod.Labels)):
+		return nil, fmt.Errorf("pinned worker %q is not a member of the pool", req.podName)
+	case pod.Annotations[p.keys.leasedBy] != "":
+		return nil, fmt.Errorf("pinned worker %q is leased by %q", req.podName, pod.Annotations[p.keys.leasedBy])
+	case pod.Annotations[p.keys.upgrading] != "":
+		return nil, fmt.Errorf("pinned worker %q is cordoned for an upgrade", req.podName)
+	case pod.Annotations[p.keys.warming] != "" || p.restarted[req.podName]:
+		return nil, fmt.Errorf("pinned worker %q is warming its cache after an upgrade", req.podName)
+	case !podOperational(pod):
+		return nil, fmt.Errorf("pinned worker %q is not operational", req.podName)
+	}
+
+	if err = p.leasePod(ctx, *pod, req.owner); err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+// QueuedRequests lists the lease requests waiting for a worker, pinned requests are never queued.
+func (p *AutoscalingPool) QueuedRequests() []QueuedRequest {
+	return p.requests.List(time.Now())
+}
+
 // Release an address back into the worker pool.
 //
 // Adds "expiry-time" and removes "lease"/"manager-identity" metadata.
 // The underlying worker will be terminated after its expiry time has passed.
 func (p *AutoscalingPool) Release(ctx context.Context, addr string) error {
 	p.log.Info("Parsing lease addr", "addr", addr)
-	u, err := url.ParseRequestURI(addr)
-	if err != nil || u.Host == "" {
-		return errors.New("invalid address: must be an absolute URI including scheme")
+	podName, err := p.resolvePodName(ctx, addr)
+	if err != nil {
+		return err
 	}
 
-	podName := strings.Split(u.Host, ".")[0]
-
 	p.log.Info("Querying for pod", "name", podName, "namespace", p.namespace)
 	pod, err := p.podClient.Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
@@ -218,22 +516,120 @@ func (p *AutoscalingPool) Release(ctx context.Context, addr string) error {
 	return p.releasePod(ctx, *pod)
 }
 
+// WatchEviction returns a channel that is closed once the worker behind a leased address is evicted or deleted.
+//
+// The watch is stopped when the context is cancelled, callers should cancel it once the lease is no longer in use.
+func (p *AutoscalingPool) WatchEviction(ctx context.Context, addr string) (<-chan struct{}, error) {
+	podName, err := p.resolvePodName(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := p.podClient.Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch worker %q: %w", addr, err)
+	}
+
+	evicted := make(chan struct{})
+	if podEvicted(pod) {
+		close(evicted)
+		return evicted, nil
+	}
+
+	go func() {
+		// watches are terminated by the api server periodically so keep re-establishing one until the context is done
+		backoff := evictionWatchBackoff
+		resourceVersion := pod.ResourceVersion
+		for ctx.Err() == nil {
+			gone, err := p.watchEviction(ctx, podName, &resourceVersion, &backoff)
+			if err != nil {
+				// the watch failed or its resource version expired, continue from the current state of the pod
+				p.log.Info("Leased worker watch failed, retrying", "podName", podName, "error", err.Error())
+
+				current, gErr := p.podClient.Get(ctx, podName, metav1.GetOptions{})
+				switch {
+				case apierrors.IsNotFound(gErr):
+					gone = true
+				case gErr != nil:
+					p.log.Error(gErr, "Failed to look up leased worker", "podName", podName)
+				default:
+					gone = podEvicted(current)
+					resourceVersion = current.ResourceVersion
+				}
+			}
+			if gone {
+				p.log.Info("Leased worker evicted", "podName", podName)
+				close(evicted)
+
+				return
+			}
+
+			select {
+			case <-time.After(backoff.Step()):
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return evicted, nil
+}
+
+// watches a leased worker from the resource version until the watch ends and reports whether the worker was evicted.
+// The resource version follows the observed pod and the backoff is reset once the watch delivered it.
+func (p *AutoscalingPool) watchEviction(
+	ctx context.Context,
+	podName string,
+	resourceVersion *string,
+	backoff *wait.Backoff,
+) (bool, error) {
+	watcher, err := p.podClient.Watch(ctx, metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", podName).String(),
+		ResourceVersion: *resourceVersion,
+	})
+	if err != nil {
+		return false, err
+	}
+	defer watcher.Stop()
+
+	for event := range watcher.ResultChan() {
+		if event.Type == watch.Error {
+			return false, apierrors.FromObject(event.Object)
+		}
+
+		obj, ok := event.Object.(*corev1.Pod)
+		if !ok {
+			continue
+		}
+		*resourceVersion = obj.ResourceVersion
+		*backoff = evictionWatchBackoff
+
+		if event.Type == watch.Deleted || podEvicted(obj) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 // applies lease metadata to given pod
 func (p *AutoscalingPool) leasePod(ctx context.Context, pod corev1.Pod, owner string) error {
-	pac, err := corev1ac.ExtractPod(&pod, fieldManagerName)
+	pac, err := corev1ac.ExtractPod(&pod, p.fieldManager)
 	if err != nil {
 		return fmt.Errorf("cannot extract pod config: %w", err)
 	}
 
 	pac.WithAnnotations(map[string]string{
-		leasedAtAnnotation:  time.Now().Format(time.RFC3339),
-		leasedByAnnotation:  owner,
-		managerIDAnnotation: p.uuid,
+		p.keys.leasedAt:           time.Now().Format(time.RFC3339),
+		p.keys.leasedBy:           owner,
+		p.keys.managerID:          p.uuid,
+		podDeletionCostAnnotation: leasedPodDeletionCost,
+		p.keys.leaseCount:         strconv.Itoa(p.keys.countLeases(pod) + 1),
 	})
-	delete(pac.Annotations, expiryTimeAnnotation)
+	pac.WithLabels(map[string]string{p.keys.leasedLabel: "true"})
+	delete(pac.Annotations, p.keys.expiryTime)
 
 	p.log.Info("Applying pod metadata changes", "annotations", pac.Annotations)
-	if _, err = p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: fieldManagerName}); err != nil {
+	if _, err = p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: p.fieldManager}); err != nil {
 		return fmt.Errorf("cannot update pod metadata: %w", err)
 	}
 
@@ -241,52 +637,252 @@ func (p *AutoscalingPool) leasePod(ctx context.Context, pod corev1.Pod, owner st
 }
 
 // removes lease metadata from given pod and adds expiry
+//
+// Pods that have served the maximum number of builds are expired immediately and deleted so the statefulset replaces
+// them with a fresh worker. Pods with a persistent cache advance its generation on the pod and its claim.
 func (p *AutoscalingPool) releasePod(ctx context.Context, pod corev1.Pod) error {
-	pac, err := corev1ac.ExtractPod(&pod, fieldManagerName)
+	pac, err := corev1ac.ExtractPod(&pod, p.fieldManager)
 	if err != nil {
 		return fmt.Errorf("cannot extract pod config: %w", err)
 	}
 
+	exhausted := p.podMaxBuilds > 0 && p.keys.countLeases(pod) >= p.podMaxBuilds
+	expiry := time.Now().Add(p.podMaxIdleTime)
+	if exhausted {
+		expiry = time.Now()
+	}
+
 	pac.WithAnnotations(map[string]string{
-		expiryTimeAnnotation: time.Now().Add(p.podMaxIdleTime).Format(time.RFC3339),
+		p.keys.expiryTime: expiry.Format(time.RFC3339),
 	})
-	delete(pac.Annotations, leasedAtAnnotation)
-	delete(pac.Annotations, leasedByAnnotation)
-	delete(pac.Annotations, managerIDAnnotation)
+	delete(pac.Annotations, p.keys.leasedAt)
+	delete(pac.Annotations, p.keys.leasedBy)
+	delete(pac.Annotations, p.keys.managerID)
+	delete(pac.Annotations, podDeletionCostAnnotation)
+	delete(pac.Labels, p.keys.leasedLabel)
+
+	if claim := cacheClaimName(pod); claim != "" {
+		generation := strconv.Itoa(p.keys.cacheGeneration(pod.Annotations) + 1)
+		pac.WithAnnotations(map[string]string{p.keys.cacheGen: generation})
+		p.recordCacheGeneration(ctx, claim, generation)
+	}
 
 	p.log.Info("Applying pod metadata changes", "annotations", pac.Annotations)
-	if _, err = p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: fieldManagerName}); err != nil {
+	if _, err = p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: p.fieldManager}); err != nil {
 		return fmt.Errorf("cannot update pod metadata: %w", err)
 	}
 
+	if exhausted {
+		p.log.Info("Recycling pod, max builds reached", "podName", pod.Name, "maxBuilds", p.podMaxBuilds)
+		if err = p.podClient.Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("cannot recycle pod: %w", err)
+		}
+	}
+
 	p.triggerReconcile()
 
 	return nil
 }
 
+// releases the leases whose owner no longer exists so the workers become leasable again. The owners are looked up
+// without holding the lease lock, a pod is only released when it is still leased the same way afterwards.
+func (p *AutoscalingPool) releaseOrphanedLeases(ctx context.Context) {
+	podList, err := p.podClient.List(ctx, p.podListOptions)
+	if err != nil {
+		p.log.Error(err, "Failed to list pods for orphaned leases")
+		return
+	}
+
+	for _, pod := range podList.Items {
+		owner := pod.Annotations[p.keys.leasedBy]
+		if owner == "" {
+			continue
+		}
+
+		leasedAt, err := time.Parse(time.RFC3339, pod.Annotations[p.keys.leasedAt])
+		if err == nil && time.Since(leasedAt) < orphanedLeaseGracePeriod {
+			continue
+		}
+
+		log := p.log.WithValues("podName", pod.Name, "owner", owner)
+		exists, err := p.leaseOwnerExists(ctx, owner)
+		if err != nil {
+			log.Error(err, "Failed to look up lease owner")
+			continue
+		}
+		if exists {
+			continue
+		}
+
+		released, err := p.releaseOrphanedLease(ctx, pod)
+		if err != nil {
+			log.Error(err, "Failed to release orphaned lease")
+			continue
+		}
+		if !released {
+			log.V(1).Info("Lease changed while looking up its owner, skipping")
+			continue
+		}
+
+		log.Info("Released orphaned lease, owner no longer exists", "leasedAt", pod.Annotations[p.keys.leasedAt])
+		if p.recorder != nil {
+			p.recorder.Eventf(&pod, corev1.EventTypeWarning, "OrphanedLease",
+				"Released lease of %s, the owner no longer exists", owner)
+		}
+	}
+}
+
+func (p *AutoscalingPool) releaseOrphanedLease(ctx context.Context, observed corev1.Pod) (bool, error) {
+	p.leaseMu.Lock()
+	defer p.leaseMu.Unlock()
+
+	pod, err := p.podClient.Get(ctx, observed.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, key := range []string{p.keys.leasedBy, p.keys.leasedAt} {
+		if pod.Annotations[key] != observed.Annotations[key] {
+			return false, nil
+		}
+	}
+
+	return true, p.releasePod(ctx, *pod)
+}
+
+// applies a disruption budget that blocks voluntary evictions of leased workers while leaving idle workers drainable
+func (p *AutoscalingPool) applyDisruptionBudget(ctx context.Context) error {
+	sts, err := p.statefulSetClient.Get(ctx, p.statefulSetName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot find buildkit statefulset: %w", err)
+	}
+
+	selector := map[string]string{p.keys.leasedLabel: "true"}
+	for k, v := range p.podLabels {
+		selector[k] = v
+	}
+
+	pdb := policyv1ac.PodDisruptionBudget(p.statefulSetName, p.namespace).
+		WithOwnerReferences(metav1ac.OwnerReference().
+			WithAPIVersion(appsv1.SchemeGroupVersion.String()).
+			WithKind("StatefulSet").
+			WithName(sts.Name).
+			WithUID(sts.UID)).
+		WithSpec(policyv1ac.PodDisruptionBudgetSpec().
+			WithMaxUnavailable(intstr.FromInt32(0)).
+			WithSelector(metav1ac.LabelSelector().WithMatchLabels(selector)))
+
+	p.log.Info("Applying worker disruption budget", "name", p.statefulSetName, "selector", selector)
+	_, err = p.pdbClient.Apply(ctx, pdb, metav1.ApplyOptions{FieldManager: p.fieldManager, Force: true})
+	if err != nil {
+		return fmt.Errorf("cannot apply pod disruption budget: %w", err)
+	}
+
+	return nil
+}
+
 // builds routable url for buildkit pod with protocol and port
+//
+// Watches that end without an address, e.g. when the endpoint controllers lag behind, are retried with fresh watches
+// and an exponential backoff before the lease fails. All attempts share the endpoint watch timeout, and watches the
+// controller is not allowed to start are not retried.
 func (p *AutoscalingPool) buildEndpointURL(ctx context.Context, pod corev1.Pod) (string, error) {
-	p.log.Info("Watching endpoints for new pod address", "podName", pod.Name)
+	watchAddress := p.watchHostname
+	if p.addressMode == AddressModePodIP {
+		watchAddress = p.watchPodIP
+	}
+
+	watchCtx := ctx
+	if p.endpointSliceWatchTimeout > 0 {
+		var cancel context.CancelFunc
+		watchCtx, cancel = context.WithTimeout(ctx, time.Duration(p.endpointSliceWatchTimeout)*time.Second)
+		defer cancel()
+	}
+
+	// retries start from the current state of the pod instead of the revision it was leased at
+	resourceVersion := pod.ResourceVersion
+	backoff := p.endpointWatchBackoff
 
+	var host string
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		host, err = watchAddress(watchCtx, pod, resourceVersion)
+		if host != "" || attempts > p.endpointWatchRetries || apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+			break
+		}
+
+		p.log.Info("Worker address not found, retrying with a fresh watch", "podName", pod.Name,
+			"attempt", attempts, "retries", p.endpointWatchRetries, "backoff", backoff, "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-watchCtx.Done():
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if watchCtx.Err() != nil {
+			break
+		}
+		resourceVersion = ""
+		backoff *= 2
+	}
+
+	if host == "" {
+		p.diagnoseFailure(ctx, pod)
+		return "", fmt.Errorf("%w (%d attempts)", err, attempts)
+	}
+
+	u := url.URL{Scheme: "tcp", Host: net.JoinHostPort(host, strconv.Itoa(int(p.servicePort)))}
+
+	return u.String(), nil
+}
+
+// watches the endpoints of the service until they publish a hostname for the pod or the watch ends
+func (p *AutoscalingPool) watchHostname(ctx context.Context, pod corev1.Pod, _ string) (string, error) {
+	resource := "endpointslices"
+	extract := func(obj runtime.Object) string {
+		return p.extractHostname(obj.(*discoveryv1.EndpointSlice), pod.Name)
+	}
 	watchOpts := metav1.ListOptions{
 		LabelSelector:  p.endpointSliceListOptions.LabelSelector,
 		TimeoutSeconds: &p.endpointSliceWatchTimeout,
 	}
-	watcher, err := p.endpointSliceClient.Watch(ctx, watchOpts)
+	watchFn := p.endpointSliceClient.Watch
+
+	if p.useEndpoints(ctx) {
+		resource = "endpoints"
+		extract = func(obj runtime.Object) string {
+			return p.extractEndpointsHostname(obj.(*corev1.Endpoints), pod.Name)
+		}
+		watchOpts = metav1.ListOptions{
+			FieldSelector:  fields.OneTermEqualSelector("metadata.name", p.serviceName).String(),
+			TimeoutSeconds: &p.endpointSliceWatchTimeout,
+		}
+		watchFn = p.endpointsClient.Watch
+	}
+
+	p.log.Info("Watching endpoints for new pod address", "podName", pod.Name, "resource", resource)
+
+	watcher, err := watchFn(ctx, watchOpts)
 	if err != nil {
-		return "", fmt.Errorf("failed to watch endpointslices: %w", err)
+		return "", fmt.Errorf("failed to watch %s: %w", resource, err)
 	}
 	defer watcher.Stop()
 
 	var hostname string
 
 	start := time.Now()
-	for event := range watcher.ResultChan() {
-		endpointSlice := event.Object.(*discoveryv1.EndpointSlice)
-
-		if hostname = p.extractHostname(endpointSlice, pod.Name); hostname != "" {
+	for hostname == "" {
+		event, ok := nextEvent(ctx, watcher)
+		if !ok {
 			break
 		}
+		hostname = extract(event.Object)
 	}
 
 	if end := time.Since(start); end < time.Duration(p.endpointSliceWatchTimeout)*time.Second {
@@ -296,16 +892,84 @@ func (p *AutoscalingPool) buildEndpointURL(ctx context.Context, pod corev1.Pod)
 	}
 
 	if hostname == "" {
-		p.diagnoseFailure(ctx, pod)
 		return "", fmt.Errorf("failed to extract hostname after %d seconds", p.endpointSliceWatchTimeout)
 	}
 
-	u, err := url.ParseRequestURI(fmt.Sprintf("tcp://%s:%d", hostname, p.servicePort))
+	return hostname, nil
+}
+
+// watches the buildkit pod from the given resource version until it is ready and returns its ip
+func (p *AutoscalingPool) watchPodIP(ctx context.Context, pod corev1.Pod, resourceVersion string) (string, error) {
+	ip := readyPodIP(&pod)
+	if ip == "" {
+		p.log.Info("Watching pod until it is ready", "podName", pod.Name)
+
+		watcher, err := p.podClient.Watch(ctx, metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", pod.Name).String(),
+			ResourceVersion: resourceVersion,
+			TimeoutSeconds:  &p.endpointSliceWatchTimeout,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to watch pod: %w", err)
+		}
+		defer watcher.Stop()
+
+		for ip == "" {
+			event, ok := nextEvent(ctx, watcher)
+			if !ok {
+				break
+			}
+			if observed, ok := event.Object.(*corev1.Pod); ok {
+				ip = readyPodIP(observed)
+			}
+		}
+	}
+
+	if ip == "" {
+		return "", fmt.Errorf("pod was not ready after %d seconds", p.endpointSliceWatchTimeout)
+	}
+	p.log.Info("Found eligible pod address", "podName", pod.Name, "podIP", ip)
+
+	return ip, nil
+}
+
+// nextEvent receives the next event of a watch, it reports false once the watch ended or the context is done
+func nextEvent(ctx context.Context, watcher watch.Interface) (watch.Event, bool) {
+	select {
+	case event, ok := <-watcher.ResultChan():
+		return event, ok
+	case <-ctx.Done():
+		return watch.Event{}, false
+	}
+}
+
+// useEndpoints reports whether worker addresses are resolved from classic Endpoints instead of EndpointSlices.
+func (p *AutoscalingPool) useEndpoints(ctx context.Context) bool {
+	switch p.endpointDiscovery {
+	case EndpointDiscoveryEndpoints:
+		return true
+	case EndpointDiscoveryEndpointSlices:
+		return false
+	}
+
+	listOpts := p.endpointSliceListOptions
+	listOpts.Limit = 1
+
+	epSlices, err := p.endpointSliceClient.List(ctx, listOpts)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse endpoint url: %w", err)
+		p.log.Info("Cannot list endpointslices, falling back to endpoints", "error", err.Error())
+		return true
+	}
+	if len(epSlices.Items) != 0 {
+		return false
 	}
 
-	return u.String(), nil
+	if _, err = p.endpointsClient.Get(ctx, p.serviceName, metav1.GetOptions{}); err != nil {
+		return false
+	}
+	p.log.Info("No endpointslices found for service, falling back to endpoints", "service", p.serviceName)
+
+	return true
 }
 
 // generates internal hostname for pod using an endpoint slice
@@ -343,9 +1007,46 @@ func (p *AutoscalingPool) extractHostname(epSlice *discoveryv1.EndpointSlice, po
 	return
 }
 
+// generates internal hostname for pod using the classic endpoints of the service
+func (p *AutoscalingPool) extractEndpointsHostname(endpoints *corev1.Endpoints, podName string) string {
+	for _, subset := range endpoints.Subsets {
+		if !slices.ContainsFunc(subset.Ports, func(port corev1.EndpointPort) bool { return port.Port == p.servicePort }) {
+			continue
+		}
+
+		// only ready addresses are listed in addresses, pods that are not ready are found in notReadyAddresses
+		for _, address := range subset.Addresses {
+			if address.TargetRef == nil || address.TargetRef.Name != podName || address.Hostname == "" {
+				continue
+			}
+
+			hostname := strings.Join([]string{address.Hostname, p.serviceName, endpoints.Namespace}, ".")
+			p.log.Info("Found eligible endpoint address", "hostname", hostname)
+
+			return hostname
+		}
+	}
+
+	return ""
+}
+
 // reconcile pods in worker pool
 func (p *AutoscalingPool) reconcileWorkers(ctx context.Context) error {
-	p.log.Info("Querying for available buildkit pods", "namespace", p.namespace, "opts", p.podListOptions)
+	p.leaseMu.Lock()
+	defer p.leaseMu.Unlock()
+
+	sts, err := p.statefulSetClient.Get(ctx, p.statefulSetName, metav1.GetOptions{})
+	if err != nil {
+		p.log.Error(err, "Failed to get buildkit statefulset, assuming pool is not cordoned")
+		sts = nil
+	} else if sts.Annotations[p.keys.cordoned] == "true" {
+		p.log.Info("Pool is cordoned, rejecting queued pod requests", "requests", p.requests.Len())
+		for req := p.requests.Dequeue(); req != nil; req = p.requests.Dequeue() {
+			req.result <- PodRequestResult{err: ErrPoolCordoned}
+		}
+	}
+
+	p.log.V(1).Info("Querying for available buildkit pods", "namespace", p.namespace, "opts", p.podListOptions)
 	podList, err := p.podClient.List(ctx, p.podListOptions)
 	if err != nil {
 		return err
@@ -356,16 +1057,29 @@ func (p *AutoscalingPool) reconcileWorkers(ctx context.Context) error {
 		return getOrdinal(podList.Items[i].Name) < getOrdinal(podList.Items[j].Name)
 	})
 
-	arbiter := NewScaleArbiter(p.log, p.podClient, p.podMaxIdleTime)
+	if p.rollingUpgrade && sts != nil {
+		p.upgradeWorkers(ctx, sts, podList.Items)
+	}
+	p.restoreCacheGenerations(ctx, podList.Items)
+	p.recordSpotNodes(ctx, podList.Items)
+
+	arbiter := NewScaleArbiter(p.log, p.podClient, p.podMaxIdleTime, p.keys)
 
 	for _, pod := range podList.Items {
-		p.log.Info("Evaluating pod metadata and status", "podName", pod.Name)
+		p.log.V(2).Info("Evaluating pod metadata and status", "podName", pod.Name)
 		arbiter.EvaluatePod(ctx, p.uuid, pod)
 	}
+	arbiter.MarkSpot(p.isSpotPod)
 	for _, observation := range arbiter.LeasablePods() {
-		req := p.requests.Dequeue()
+		// on-demand pods are kept for on-demand only requests so they do not wait behind flexible ones
+		var req *PodRequest
+		if observation.Spot {
+			req = p.requests.DequeueMatching(func(r *PodRequest) bool { return !r.onDemandOnly })
+		} else if req = p.requests.DequeueMatching(func(r *PodRequest) bool { return r.onDemandOnly }); req == nil {
+			req = p.requests.Dequeue()
+		}
 		if req == nil {
-			break
+			continue
 		}
 
 		p.log.Info("Processing dequeued pod request with operational pod")
@@ -374,9 +1088,16 @@ func (p *AutoscalingPool) reconcileWorkers(ctx context.Context) error {
 		}
 	}
 
-	replicas := arbiter.DetermineReplicas(p.requests.Len())
+	if sts != nil {
+		p.reportVersions(ctx, sts, podList.Items)
+	}
+
+	onDemandRequests := p.requests.CountMatching(func(r *PodRequest) bool { return r.onDemandOnly })
+	replicas := arbiter.DetermineReplicas(p.requests.Len(), onDemandRequests)
+
+	p.log.V(1).Info("Using statefulset scale", "replicas", replicas)
+	p.logState(arbiter, replicas)
 
-	p.log.Info("Using statefulset scale", "replicas", replicas)
 	_, err = p.statefulSetClient.UpdateScale(
 		ctx,
 		p.statefulSetName,
@@ -387,12 +1108,249 @@ func (p *AutoscalingPool) reconcileWorkers(ctx context.Context) error {
 			},
 			Spec: autoscalingv1.ScaleSpec{Replicas: int32(replicas)},
 		},
-		metav1.UpdateOptions{FieldManager: fieldManagerName},
+		metav1.UpdateOptions{FieldManager: p.fieldManager},
 	)
 	return err
 }
 
-// attempts to lease a pod, build and endpoint url, and provide a request result
+// copies the cache generation recorded on the claim of every new pod with a persistent cache to the pod. Pods restarted
+// on a populated volume keep their cache, they are preferred for leasing and do not need to be warmed again.
+//
+// Restored pods are replaced in place, so the lease decisions of the current reconciliation keep the annotation.
+func (p *AutoscalingPool) restoreCacheGenerations(ctx context.Context, pods []corev1.Pod) {
+	for idx := range pods {
+		pod := &pods[idx]
+		if _, restored := pod.Annotations[p.keys.cacheGen]; restored || pod.DeletionTimestamp != nil {
+			continue
+		}
+		claim := cacheClaimName(*pod)
+		if claim == "" {
+			continue
+		}
+		log := p.log.WithValues("podName", pod.Name, "claimName", claim)
+
+		pvc, err := p.pvcClient.Get(ctx, claim, metav1.GetOptions{})
+		if err != nil {
+			log.Error(err, "Failed to look up cache volume claim")
+			continue
+		}
+		generation := strconv.Itoa(p.keys.cacheGeneration(pvc.Annotations))
+
+		pac, err := corev1ac.ExtractPod(pod, p.fieldManager)
+		if err != nil {
+			log.Error(err, "Cannot extract pod config")
+			continue
+		}
+		pac.WithAnnotations(map[string]string{p.keys.cacheGen: generation})
+
+		updated, err := p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: p.fieldManager})
+		if err != nil {
+			log.Error(err, "Failed to restore cache generation")
+			continue
+		}
+		if generation != "0" {
+			log.Info("Restored populated build cache, skipping cache warming", "generation", generation)
+		}
+
+		*pod = *updated
+	}
+}
+
+// persists the cache generation on the claim so that it survives pod restarts, failures only forfeit the preference
+// for the pod once it restarts
+func (p *AutoscalingPool) recordCacheGeneration(ctx context.Context, claim, generation string) {
+	pvcac := corev1ac.PersistentVolumeClaim(claim, p.namespace).
+		WithAnnotations(map[string]string{p.keys.cacheGen: generation})
+
+	if _, err := p.pvcClient.Apply(ctx, pvcac, metav1.ApplyOptions{FieldManager: p.fieldManager}); err != nil {
+		p.log.Error(err, "Failed to record cache generation", "claimName", claim, "generation", generation)
+	}
+}
+
+// name of the claim that persists the build cache of a pod, empty when the cache does not outlive the pod
+func cacheClaimName(pod corev1.Pod) string {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			return volume.PersistentVolumeClaim.ClaimName
+		}
+	}
+
+	return ""
+}
+
+// restarts the workers of an outdated statefulset revision one at a time without interrupting builds. The highest
+// outdated ordinal, preferably an unleased one, is cordoned so that it is no longer leased, it is deleted once its
+// lease finished and the next pod is only cordoned after every updated pod is operational and warmed again. The
+// statefulset must use the OnDelete update strategy so that only the pool replaces pods.
+//
+// Cordoned pods are annotated in place, so the lease decisions of the current reconciliation already exclude them.
+func (p *AutoscalingPool) upgradeWorkers(ctx context.Context, sts *appsv1.StatefulSet, pods []corev1.Pod) {
+	revision := sts.Status.UpdateRevision
+	if revision == "" {
+		return
+	}
+
+	if sts.Spec.Replicas != nil && len(pods) < int(*sts.Spec.Replicas) {
+		p.log.V(1).Info("Waiting for restarted pods to be recreated", "revision", revision)
+		return
+	}
+
+	outdated := -1
+	for idx := range pods {
+		pod := &pods[idx]
+		log := p.log.WithValues("podName", pod.Name, "revision", revision)
+
+		if _, warming := pod.Annotations[p.keys.warming]; warming {
+			if p.warming[pod.Name] {
+				log.V(1).Info("Waiting for the cache of restarted pod to be warmed")
+				return
+			}
+
+			// the warm-up ended with the previous controller, the pod is leased with the cache it has
+			log.Info("Uncordoning restarted pod whose cache warm-up was interrupted")
+			p.uncordonWarmedPod(ctx, pod)
+		}
+
+		if _, cordoned := pod.Annotations[p.keys.upgrading]; cordoned {
+			switch {
+			case pod.DeletionTimestamp != nil:
+				log.V(1).Info("Waiting for outdated pod to terminate")
+			case pod.Annotations[p.keys.leasedBy] != "":
+				log.V(1).Info("Waiting for lease of outdated pod to finish")
+			default:
+				log.Info("Restarting outdated pod")
+				if err := p.podClient.Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil &&
+					!apierrors.IsNotFound(err) {
+					log.Error(err, "Failed to restart outdated pod")
+				} else if p.cacheWarmup != nil {
+					p.restarted[pod.Name] = true
+				}
+			}
+
+			return
+		}
+
+		hash := pod.Labels[appsv1.ControllerRevisionHashLabelKey]
+		switch {
+		case hash == revision && !podOperational(pod):
+			log.V(1).Info("Waiting for updated pod to become operational")
+			return
+		case hash == revision && p.restarted[pod.Name]:
+			delete(p.restarted, pod.Name)
+			if p.keys.cacheGeneration(pod.Annotations) > 0 {
+				log.Info("Restarted pod kept its populated build cache, skipping cache warming")
+				continue
+			}
+
+			p.warmPod(ctx, pod, revision)
+			return
+		case hash != "" && hash != revision && pod.DeletionTimestamp == nil:
+			if outdated == -1 || pod.Annotations[p.keys.leasedBy] == "" ||
+				pods[outdated].Annotations[p.keys.leasedBy] != "" {
+				outdated = idx
+			}
+		}
+	}
+	if outdated == -1 {
+		return
+	}
+
+	pod := &pods[outdated]
+	p.log.Info("Cordoning outdated pod for upgrade", "podName", pod.Name, "revision", revision)
+
+	pac, err := corev1ac.ExtractPod(pod, p.fieldManager)
+	if err != nil {
+		p.log.Error(err, "Cannot extract pod config", "podName", pod.Name)
+		return
+	}
+	pac.WithAnnotations(map[string]string{p.keys.upgrading: revision})
+
+	if _, err = p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: p.fieldManager}); err != nil {
+		p.log.Error(err, "Failed to cordon outdated pod", "podName", pod.Name)
+		return
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[p.keys.upgrading] = revision
+	p.triggerReconcile()
+}
+
+// cordons a pod restarted by a rolling upgrade while its cache is warmed in the background, so its first builds do not
+// start on a cold cache. The pod is uncordoned once the warm-up ended, whether it succeeded or not.
+//
+// The pod is annotated in place, so the lease decisions of the current reconciliation already exclude it.
+func (p *AutoscalingPool) warmPod(ctx context.Context, pod *corev1.Pod, revision string) {
+	log := p.log.WithValues("podName", pod.Name, "revision", revision)
+	log.Info("Cordoning restarted pod to warm its cache")
+
+	pac, err := corev1ac.ExtractPod(pod, p.fieldManager)
+	if err != nil {
+		log.Error(err, "Cannot extract pod config")
+		return
+	}
+	pac.WithAnnotations(map[string]string{p.keys.warming: revision})
+
+	if _, err = p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: p.fieldManager}); err != nil {
+		log.Error(err, "Failed to cordon restarted pod, leasing it without warming its cache")
+		return
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[p.keys.warming] = revision
+	p.warming[pod.Name] = true
+
+	go func(podName string) {
+		warmCtx, cancel := context.WithTimeout(ctx, cacheWarmupTimeout)
+		start := time.Now()
+		err := p.cacheWarmup(warmCtx, podName)
+		cancel()
+
+		if err != nil {
+			log.Error(err, "Failed to warm cache of restarted pod, leasing it with the cache it has")
+		} else {
+			log.Info("Warmed cache of restarted pod", "duration", time.Since(start))
+		}
+
+		p.leaseMu.Lock()
+		defer p.leaseMu.Unlock()
+
+		delete(p.warming, podName)
+
+		// the pool may be stopping, the pod must not stay cordoned
+		uncordonCtx := context.WithoutCancel(ctx)
+		current, err := p.podClient.Get(uncordonCtx, podName, metav1.GetOptions{})
+		if err != nil {
+			log.Error(err, "Failed to look up warmed pod")
+			return
+		}
+		p.uncordonWarmedPod(uncordonCtx, current)
+		p.triggerReconcile()
+	}(pod.Name)
+}
+
+// removes the warm-up cordon of a pod, the pod is updated in place so it can be leased in the current reconciliation
+func (p *AutoscalingPool) uncordonWarmedPod(ctx context.Context, pod *corev1.Pod) {
+	pac, err := corev1ac.ExtractPod(pod, p.fieldManager)
+	if err != nil {
+		p.log.Error(err, "Cannot extract pod config", "podName", pod.Name)
+		return
+	}
+	delete(pac.Annotations, p.keys.warming)
+
+	if _, err = p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: p.fieldManager}); err != nil {
+		p.log.Error(err, "Failed to uncordon warmed pod", "podName", pod.Name)
+		return
+	}
+
+	delete(pod.Annotations, p.keys.warming)
+}
+
+// attempts to lease a pod and completes the request in the background, so that waiting for the address of a new pod
+// does not hold up other leases and releases
 func (p *AutoscalingPool) processPodRequest(ctx context.Context, req *PodRequest, pod corev1.Pod) (success bool) {
 	log := p.log.WithValues("podName", pod.Name)
 
@@ -404,6 +1362,16 @@ func (p *AutoscalingPool) processPodRequest(ctx context.Context, req *PodRequest
 		return
 	}
 
+	go p.completePodRequest(ctx, req, pod)
+
+	return true
+}
+
+// builds the endpoint url of a leased pod, probes it and provides the request result. Unhealthy pods are recycled and
+// the request is queued again.
+func (p *AutoscalingPool) completePodRequest(ctx context.Context, req *PodRequest, pod corev1.Pod) {
+	log := p.log.WithValues("podName", pod.Name)
+
 	log.Info("Building endpoint URL")
 	addr, err := p.buildEndpointURL(ctx, pod)
 	if err != nil {
@@ -417,10 +1385,142 @@ func (p *AutoscalingPool) processPodRequest(ctx context.Context, req *PodRequest
 		return
 	}
 
+	log.Info("Probing buildkitd health", "addr", addr)
+	err = p.probePod(ctx, pod, addr, req.platforms)
+	if errors.Is(err, buildkit.ErrNoMatchingWorker) {
+		// every pod shares the same buildkitd configuration, so recycling it would not help
+		log.Error(err, "Leased pod does not satisfy worker constraints, releasing pod")
+
+		if rErr := p.releasePod(ctx, pod); rErr != nil {
+			log.Error(rErr, "Failed to release pod")
+		}
+
+		req.result <- PodRequestResult{err: err}
+		return
+	}
+	if err != nil {
+		log.Error(err, "Leased pod is unhealthy, recycling pod and requeuing request")
+
+		if dErr := p.podClient.Delete(ctx, pod.Name, metav1.DeleteOptions{}); dErr != nil {
+			log.Error(dErr, "Failed to recycle unhealthy pod")
+		}
+
+		p.requests.Enqueue(req)
+		p.triggerReconcile()
+
+		return
+	}
+
 	log.Info("Pod successfully leased, passing address to request owner")
 	req.result <- PodRequestResult{addr: addr}
+}
 
-	return true
+// runs a bounded health probe against the buildkitd instance behind a worker address and records its version. the
+// pool platforms are required unless the request asked for others.
+func (p *AutoscalingPool) probePod(ctx context.Context, pod corev1.Pod, addr string, platforms []string) error {
+	ctx, cancel := context.WithTimeout(ctx, workerProbeTimeout)
+	defer cancel()
+
+	if len(platforms) == 0 {
+		platforms = p.platforms
+	}
+
+	version, err := probeWorker(ctx, p.mtls, p.workerFilters, platforms, addr)
+	if err != nil {
+		return err
+	}
+
+	if version != "" {
+		p.versionsMu.Lock()
+		p.workerVersions[pod.UID] = version
+		p.versionsMu.Unlock()
+	}
+
+	return nil
+}
+
+// reports the buildkit versions of the pool workers through a statefulset annotation and emits a warning event when
+// workers run different versions, mixed versions after a partial rollout have caused cache format mismatches.
+//
+// Versions are observed whenever a worker is leased, so workers that have not served a build since the controller
+// started are not accounted for.
+func (p *AutoscalingPool) reportVersions(ctx context.Context, sts *appsv1.StatefulSet, pods []corev1.Pod) {
+	counts := map[string]int{}
+
+	p.versionsMu.Lock()
+	observed := make(map[types.UID]string, len(p.workerVersions))
+	for _, pod := range pods {
+		if version, ok := p.workerVersions[pod.UID]; ok {
+			observed[pod.UID] = version
+			counts[version]++
+		}
+	}
+	p.workerVersions = observed
+	p.versionsMu.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+
+	summary := versionSummary(counts)
+	if sts.Annotations[p.keys.versions] == summary {
+		return
+	}
+
+	p.log.Info("Buildkit worker versions changed", "versions", summary)
+	sac := appsv1ac.StatefulSet(sts.Name, sts.Namespace).WithAnnotations(map[string]string{p.keys.versions: summary})
+	if _, err := p.statefulSetClient.Apply(ctx, sac, metav1.ApplyOptions{FieldManager: p.fieldManager}); err != nil {
+		p.log.Error(err, "Failed to report buildkit worker versions")
+		return
+	}
+
+	if len(counts) > 1 {
+		p.log.Info("Buildkit workers are running mixed versions", "versions", summary)
+		if p.recorder != nil {
+			p.recorder.Eventf(sts, corev1.EventTypeWarning, "BuildkitVersionSkew",
+				"Buildkit workers are running mixed versions: %s", summary)
+		}
+	}
+}
+
+// logs a summary of the pool every state log interval and whenever its scale changes, the pool is reconciled far
+// more often than its state needs to be reported.
+func (p *AutoscalingPool) logState(arbiter *ScaleArbiter, replicas int) {
+	now := time.Now()
+	if replicas == p.lastReplicas && now.Sub(p.lastStateLog) < p.stateLogInterval {
+		return
+	}
+	p.lastStateLog, p.lastReplicas = now, replicas
+
+	p.log.Info(
+		"Worker pool state",
+		"states", stateSummary(arbiter.StateCounts()),
+		"requests", p.requests.Len(),
+		"replicas", replicas,
+	)
+}
+
+// formats worker counts per state as a "state=count" list in state order
+func stateSummary(counts map[BuilderState]int) string {
+	states := make([]string, 0, len(counts))
+	for state := BuilderStateUnmanaged; state <= BuilderStateUnusable; state++ {
+		if n := counts[state]; n > 0 {
+			states = append(states, fmt.Sprintf("%s=%d", state, n))
+		}
+	}
+
+	return strings.Join(states, ",")
+}
+
+// formats worker counts per version as a sorted "version=count" list
+func versionSummary(counts map[string]int) string {
+	versions := make([]string, 0, len(counts))
+	for version, n := range counts {
+		versions = append(versions, fmt.Sprintf("%s=%d", version, n))
+	}
+	sort.Strings(versions)
+
+	return strings.Join(versions, ",")
 }
 
 // trigger a pool reconciliation
@@ -480,6 +1580,67 @@ func (p *AutoscalingPool) diagnoseEndpointSlices(ctx context.Context, podName st
 	log.Info("Unable to find endpoint for pod")
 }
 
+// records whether the node of every newly scheduled pod is a spot/preemptible node on the pod, so that nodes are only
+// inspected once per pod. Pods whose node cannot be inspected are retried on the next reconciliation.
+//
+// Recorded pods are replaced in place, so the lease decisions of the current reconciliation see the annotation.
+func (p *AutoscalingPool) recordSpotNodes(ctx context.Context, pods []corev1.Pod) {
+	if p.spotNodeSelector == nil {
+		return
+	}
+
+	for idx := range pods {
+		pod := &pods[idx]
+		if _, recorded := pod.Annotations[p.keys.spotNode]; recorded || pod.Spec.NodeName == "" ||
+			pod.DeletionTimestamp != nil {
+			continue
+		}
+		log := p.log.WithValues("podName", pod.Name, "nodeName", pod.Spec.NodeName)
+
+		node, err := p.nodeClient.Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			log.Error(err, "Failed to inspect pod node")
+			continue
+		}
+		spot := p.spotNodeSelector.Matches(labels.Set(node.Labels))
+
+		pac, err := corev1ac.ExtractPod(pod, p.fieldManager)
+		if err != nil {
+			log.Error(err, "Cannot extract pod config")
+			continue
+		}
+		pac.WithAnnotations(map[string]string{p.keys.spotNode: strconv.FormatBool(spot)})
+
+		updated, err := p.podClient.Apply(ctx, pac, metav1.ApplyOptions{FieldManager: p.fieldManager})
+		if err != nil {
+			log.Error(err, "Failed to record spot node")
+			continue
+		}
+
+		*pod = *updated
+	}
+}
+
+// reports whether a pod is running on a spot/preemptible node. Scheduled pods whose node could not be inspected are
+// assumed to be spot-backed so that on-demand only requests are never placed on preemptible capacity, whereas pods
+// that are not scheduled yet are not, they are re-evaluated once they are bound to a node.
+func (p *AutoscalingPool) isSpotPod(pod corev1.Pod) bool {
+	if p.spotNodeSelector == nil || pod.Spec.NodeName == "" {
+		return false
+	}
+
+	return pod.Annotations[p.keys.spotNode] != "false"
+}
+
+// builds a node selector from the configured spot labels, nil when spot awareness is disabled
+func spotNodeSelector(nodeLabels map[string]string) labels.Selector {
+	if len(nodeLabels) == 0 {
+		return nil
+	}
+
+	return labels.SelectorFromSet(nodeLabels)
+}
+
 // diagnose issues with pods
 func (p *AutoscalingPool) diagnosePod(ctx context.Context, podName string) {
 	log := p.log.WithName("diagnosis").WithName("pod").WithValues("podName", podName)
@@ -570,6 +1731,60 @@ func (p *AutoscalingPool) diagnoseEvents(ctx context.Context, pod corev1.Pod) {
 	}
 }
 
+// resolves the name of the pod behind a leased address, pod IP addresses are looked up among the pods of the pool
+func (p *AutoscalingPool) resolvePodName(ctx context.Context, addr string) (string, error) {
+	u, err := url.ParseRequestURI(addr)
+	if err != nil || net.ParseIP(u.Hostname()) == nil {
+		return podNameFromAddr(addr)
+	}
+
+	podList, err := p.podClient.List(ctx, p.podListOptions)
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range podList.Items {
+		if pod.Status.PodIP == u.Hostname() {
+			return pod.Name, nil
+		}
+	}
+
+	return "", apierrors.NewNotFound(corev1.Resource("pods"), u.Hostname())
+}
+
+// returns the ip of an operational pod, or an empty string when the pod is not ready
+func readyPodIP(pod *corev1.Pod) string {
+	if !podOperational(pod) {
+		return ""
+	}
+
+	return pod.Status.PodIP
+}
+
+// extracts the pod name from a routable worker address
+func podNameFromAddr(addr string) (string, error) {
+	u, err := url.ParseRequestURI(addr)
+	if err != nil || u.Host == "" {
+		return "", errors.New("invalid address: must be an absolute URI including scheme")
+	}
+
+	return strings.Split(u.Hostname(), ".")[0], nil
+}
+
+// reports whether a pod is being torn down by an eviction, node drain, preemption or delete
+func podEvicted(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodFailed || pod.Status.Reason == "Evicted" {
+		return true
+	}
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.DisruptionTarget && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
 // plucks the ordinal suffix off of a statefulset pod name
 func getOrdinal(name string) int {
 	ordinal := -1
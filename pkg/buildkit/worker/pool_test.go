@@ -4,10 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
 	"github.com/go-logr/logr/testr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,20 +21,28 @@ import (
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 
+	"github.com/dominodatalab/hephaestus/pkg/buildkit"
 	"github.com/dominodatalab/hephaestus/pkg/config"
 )
 
 func init() {
 	newUUID = func() types.UID { return "manager-id" }
+	probeWorker = func(context.Context, *config.BuildkitMTLS, []string, []string, string) (string, error) {
+		return "", nil
+	}
 }
 
 type result struct {
@@ -42,6 +55,7 @@ var (
 	namespace  = "test-namespace"
 	testLabels = map[string]string{"owned-by": "testing"}
 	testConfig = config.Buildkit{Namespace: namespace, PodLabels: testLabels, ServiceName: "buildkit", DaemonPort: 1234}
+	testKeys   = newMetadataKeys(defaultAnnotationDomain)
 )
 
 func TestPoolGet(t *testing.T) {
@@ -75,6 +89,170 @@ func TestPoolGet(t *testing.T) {
 		assert.Equal(t, expected, addr, "did not receive correct lease")
 	})
 
+	t.Run("custom_metadata", func(t *testing.T) {
+		p := validPod()
+
+		fakeClient := fake.NewSimpleClientset(p)
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(p))
+			}()
+			return true, watcher, nil
+		})
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			patchAction := action.(k8stesting.PatchActionImpl)
+			assert.Equal(t, "acme-lease-manager", patchAction.GetPatchOptions().FieldManager)
+
+			pod := corev1.Pod{}
+			require.NoError(t, json.Unmarshal(patchAction.GetPatch(), &pod))
+			assert.Equal(t, owner, pod.Annotations["builds.acme.io/leased-by"])
+			assert.Equal(t, "true", pod.Labels["builds.acme.io/leased"])
+			assert.NotContains(t, pod.Annotations, testKeys.leasedBy)
+
+			return true, p, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig,
+			SyncWaitTime(50*time.Millisecond), AnnotationDomain("builds.acme.io"), FieldManager("acme-lease-manager"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go wp.Start(ctx)
+
+		_, err := wp.Get(ctx, owner)
+		require.NoError(t, err, "could not acquire a buildkit endpoint")
+	})
+
+	t.Run("unhealthy_pod", func(t *testing.T) {
+		p := validPod()
+
+		fakeClient := fake.NewSimpleClientset(p)
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(p))
+			}()
+			return true, watcher, nil
+		})
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, p, nil
+		})
+
+		// keep the pod around so the requeued request can be fulfilled once the replacement is healthy
+		var deleted atomic.Bool
+		fakeClient.PrependReactor("delete", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			assert.Equal(t, p.Name, action.(k8stesting.DeleteAction).GetName())
+			deleted.Store(true)
+			return true, nil, nil
+		})
+
+		var probes atomic.Int32
+		defer func(orig func(context.Context, *config.BuildkitMTLS, []string, []string, string) (string, error)) {
+			probeWorker = orig
+		}(probeWorker)
+		probeWorker = func(context.Context, *config.BuildkitMTLS, []string, []string, string) (string, error) {
+			if probes.Add(1) == 1 {
+				return "", errors.New("wedged")
+			}
+			return "", nil
+		}
+
+		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go wp.Start(ctx)
+		addr, err := wp.Get(ctx, owner)
+
+		require.NoError(t, err, "could not acquire a buildkit endpoint")
+		assert.Equal(t, "tcp://buildkit-0.buildkit.test-namespace:1234", addr)
+		assert.True(t, deleted.Load(), "unhealthy pod was not recycled")
+		assert.Equal(t, int32(2), probes.Load())
+	})
+
+	t.Run("unmatched_worker_constraints", func(t *testing.T) {
+		p := validPod()
+
+		fakeClient := fake.NewSimpleClientset(p)
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(p))
+			}()
+			return true, watcher, nil
+		})
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, p, nil
+		})
+		fakeClient.PrependReactor("delete", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			t.Error("pod that does not satisfy worker constraints must not be recycled")
+			return true, nil, nil
+		})
+
+		conf := testConfig
+		conf.WorkerFilters = []string{`labels."org.mobyproject.buildkit.worker.executor"==containerd`}
+		conf.Platforms = []string{"linux/arm64"}
+
+		defer func(orig func(context.Context, *config.BuildkitMTLS, []string, []string, string) (string, error)) {
+			probeWorker = orig
+		}(probeWorker)
+		probeWorker = func(_ context.Context, _ *config.BuildkitMTLS, filters, platforms []string, _ string) (string, error) {
+			assert.Equal(t, conf.WorkerFilters, filters)
+			assert.Equal(t, conf.Platforms, platforms)
+			return "", fmt.Errorf("%w: test", buildkit.ErrNoMatchingWorker)
+		}
+
+		wp := NewPool(fakeClient, conf, SyncWaitTime(50*time.Millisecond))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go wp.Start(ctx)
+
+		_, err := wp.Get(ctx, owner)
+		assert.ErrorIs(t, err, buildkit.ErrNoMatchingWorker)
+	})
+
+	t.Run("lease_platforms", func(t *testing.T) {
+		p := validPod()
+
+		fakeClient := fake.NewSimpleClientset(p)
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(p))
+			}()
+			return true, watcher, nil
+		})
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, p, nil
+		})
+
+		conf := testConfig
+		conf.Platforms = []string{"linux/amd64"}
+
+		defer func(orig func(context.Context, *config.BuildkitMTLS, []string, []string, string) (string, error)) {
+			probeWorker = orig
+		}(probeWorker)
+		probeWorker = func(_ context.Context, _ *config.BuildkitMTLS, _, platforms []string, _ string) (string, error) {
+			assert.Equal(t, []string{"linux/arm64"}, platforms, "lease platforms replace the pool platforms")
+			return "", fmt.Errorf("%w: test", buildkit.ErrNoMatchingWorker)
+		}
+
+		wp := NewPool(fakeClient, conf, SyncWaitTime(50*time.Millisecond))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go wp.Start(ctx)
+
+		_, err := wp.Get(ctx, owner, Platforms("linux/arm64"))
+		assert.ErrorIs(t, err, buildkit.ErrNoMatchingWorker)
+	})
+
 	t.Run("non_running_pod", func(t *testing.T) {
 		// non-running phase
 		delivered := validPod()
@@ -183,7 +361,8 @@ func TestPoolGet(t *testing.T) {
 			return true, p, nil
 		})
 
-		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond))
+		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond),
+			EndpointWatchRetries(1), EndpointWatchBackoff(time.Millisecond))
 
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -191,7 +370,7 @@ func TestPoolGet(t *testing.T) {
 
 		addr, err := wp.Get(ctx, owner)
 
-		assert.EqualError(t, err, "failed to extract hostname after 180 seconds")
+		assert.EqualError(t, err, "failed to extract hostname after 180 seconds (2 attempts)")
 		assert.Empty(t, addr, "expected an empty lease address")
 	})
 
@@ -296,171 +475,1165 @@ func TestPoolGet(t *testing.T) {
 		default:
 		}
 	})
-}
+}
+
+func TestPoolGetFailedScaleUp(t *testing.T) {
+	p := validPod()
+	fakeClient := fake.NewSimpleClientset(validSts(), p)
+
+	fakeClient.PrependWatchReactor("endpointslices", func(action k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+		watcher := watch.NewFake()
+		go func() {
+			defer watcher.Stop()
+			watcher.Add(validEndpointSlice(p))
+		}()
+		return true, watcher, nil
+	})
+
+	// server-side applies not supported so mimic the results
+	leased := false
+	fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		if leased {
+			return true, validPod(), nil
+		}
+
+		leased = !leased
+		return true, leasedPod(), nil
+	})
+
+	var scaleUp atomic.Int32
+	fakeClient.PrependReactor("update", "statefulsets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		scaleUp.Add(1)
+		return true, nil, errors.New("failed scale up")
+	})
+
+	wp := NewPool(fakeClient, testConfig, SyncWaitTime(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wp.Start(ctx)
+
+	addr, err := wp.Get(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "tcp://buildkit-0.buildkit.test-namespace:1234"
+	if addr != expected {
+		t.Errorf("did not received correct lease: %s expected, %s actual", expected, addr)
+	}
+
+	if err := wp.Release(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, err = wp.Get(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != expected {
+		t.Errorf("did not received correct lease: %s expected, %s actual", expected, addr)
+	}
+
+	if a := scaleUp.Load(); a < 2 {
+		t.Errorf("Expected at least 2 scale ups: got %d", a)
+	}
+}
+
+func TestPoolGetPinned(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		p := validPod()
+		other := validPod()
+		other.Name = "buildkit-1"
+
+		fakeClient := fake.NewSimpleClientset(p, other)
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(other))
+			}()
+			return true, watcher, nil
+		})
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			assert.Equal(t, other.Name, action.(k8stesting.PatchAction).GetName())
+			assertLeasedPod(t, action, other)
+			return true, other, nil
+		})
+
+		// the pool is not started, pinned requests are never queued
+		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond))
+		addr, err := wp.Get(context.Background(), owner, PinnedTo(other.Name))
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://buildkit-1.buildkit.test-namespace:1234", addr)
+	})
+
+	for name, tc := range map[string]struct {
+		pod  *corev1.Pod
+		want string
+	}{
+		"leased": {
+			pod:  leasedPod(),
+			want: `pinned worker "buildkit-0" is leased by "test-owner"`,
+		},
+		"pending": {
+			pod:  pendingPod(),
+			want: `pinned worker "buildkit-0" is not operational`,
+		},
+		"foreign": {
+			pod: func() *corev1.Pod {
+				p := validPod()
+				p.Labels = map[string]string{"owned-by": "someone-else"}
+				return p
+			}(),
+			want: `pinned worker "buildkit-0" is not a member of the pool`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := fake.NewSimpleClientset(tc.pod)
+			fakeClient.PrependReactor("patch", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+				t.Error("unavailable pinned worker must not be leased")
+				return true, nil, nil
+			})
+
+			wp := NewPool(fakeClient, testConfig)
+			_, err := wp.Get(context.Background(), owner, PinnedTo(tc.pod.Name))
+			assert.EqualError(t, err, tc.want)
+		})
+	}
+
+	t.Run("missing_pod", func(t *testing.T) {
+		wp := NewPool(fake.NewSimpleClientset(), testConfig)
+		_, err := wp.Get(context.Background(), owner, PinnedTo("buildkit-7"))
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("unhealthy_pod", func(t *testing.T) {
+		p := validPod()
+
+		fakeClient := fake.NewSimpleClientset(p)
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(p))
+			}()
+			return true, watcher, nil
+		})
+
+		var patches int
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			if patches++; patches == 2 {
+				assertUnleasedPod(t, action)
+			}
+			return true, p, nil
+		})
+		fakeClient.PrependReactor("delete", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+			t.Error("pinned worker must not be recycled")
+			return true, nil, nil
+		})
+
+		orig := probeWorker
+		defer func() { probeWorker = orig }()
+		probeWorker = func(context.Context, *config.BuildkitMTLS, []string, []string, string) (string, error) {
+			return "", errors.New("buildkitd unavailable")
+		}
+
+		wp := NewPool(fakeClient, testConfig, MaxIdleTime(10*time.Minute))
+		_, err := wp.Get(context.Background(), owner, PinnedTo(p.Name))
+		assert.ErrorContains(t, err, "buildkitd unavailable")
+		assert.Equal(t, 2, patches, "pinned worker must be released")
+	})
+}
+
+func TestPoolCancelAndGet(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(validSts())
+	fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		return true, validPod(), nil
+	})
+	fakeClient.PrependReactor("update", "statefulsets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		return true, nil, nil
+	})
+
+	wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- wp.Start(ctx)
+	}()
+
+	cancel()
+
+	err := <-errCh
+	if err != nil {
+		t.Error(err)
+	}
+
+	addr, err := wp.Get(context.Background(), owner)
+	if err != errPoolClosed {
+		t.Errorf("unexpected error: %#v", err)
+	}
+	if addr != "" {
+		t.Errorf("acquired lease even though pool was closed")
+	}
+}
+
+func TestPoolRelease(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(leasedPod())
+		fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			assertUnleasedPod(t, action)
+			return true, nil, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond), MaxIdleTime(10*time.Minute))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go wp.Start(ctx)
+
+		assert.NoError(t, wp.Release(ctx, "tcp://buildkit-0.buildkit.default:1234"), "expected release to succeed")
+	})
+
+	t.Run("max_builds_reached", func(t *testing.T) {
+		p := leasedPod()
+		p.Annotations[testKeys.leaseCount] = "3"
+
+		fakeClient := fake.NewSimpleClientset(p)
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			pod := corev1.Pod{}
+			require.NoError(t, json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &pod))
+
+			expiry, err := time.Parse(time.RFC3339, pod.Annotations[testKeys.expiryTime])
+			require.NoError(t, err, "invalid expiry time annotation")
+			assert.False(t, expiry.After(time.Now()), "exhausted pod should expire immediately")
+
+			return true, nil, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig, MaxBuildsPerPod(3))
+		require.NoError(t, wp.Release(context.Background(), "tcp://buildkit-0.buildkit.default:1234"))
+
+		_, err := fakeClient.CoreV1().Pods(namespace).Get(context.Background(), p.Name, metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err), "exhausted pod was not recycled")
+	})
+
+	t.Run("below_max_builds", func(t *testing.T) {
+		p := leasedPod()
+		p.Annotations[testKeys.leaseCount] = "2"
+
+		fakeClient := fake.NewSimpleClientset(p)
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			assertUnleasedPod(t, action)
+			return true, nil, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig, MaxBuildsPerPod(3))
+		require.NoError(t, wp.Release(context.Background(), "tcp://buildkit-0.buildkit.default:1234"))
+
+		_, err := fakeClient.CoreV1().Pods(namespace).Get(context.Background(), p.Name, metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid_address", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(leasedPod())
+
+		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond), MaxIdleTime(10*time.Minute))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go wp.Start(ctx)
+
+		invalidAddrs := []string{
+			"buildkit-0.buildkit.default:1234",
+			"buildkit-0.buildkit.default",
+			"buildkit-0",
+			"tcp://",
+		}
+
+		for _, addr := range invalidAddrs {
+			assert.EqualErrorf(t,
+				wp.Release(ctx, addr),
+				"invalid address: must be an absolute URI including scheme",
+				"expected %s to produce an uri parse err", addr,
+			)
+		}
+	})
+
+	t.Run("missing_pod", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset()
+
+		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond), MaxIdleTime(10*time.Minute))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go wp.Start(ctx)
+
+		assert.EqualError(t,
+			wp.Release(ctx, "tcp://buildkit-0.buildkit.default:1234"),
+			`addr "tcp://buildkit-0.buildkit.default:1234" is not allocated: pods "buildkit-0" not found`,
+		)
+	})
+
+	t.Run("patch_fail", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(leasedPod())
+		fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			return true, nil, errors.New("test failure")
+		})
+
+		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond), MaxIdleTime(10*time.Minute))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go wp.Start(ctx)
+
+		assert.EqualError(t, wp.Release(ctx, "tcp://buildkit-0.buildkit.default:1234"), "cannot update pod metadata: test failure")
+	})
+}
+
+func TestPoolWatchEviction(t *testing.T) {
+	addr := "tcp://buildkit-0.buildkit.test-namespace:1234"
+
+	t.Run("evicted", func(t *testing.T) {
+		watcher := watch.NewFake()
+		fakeClient := fake.NewSimpleClientset(leasedPod())
+		fakeClient.PrependWatchReactor("pods", func(k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			return true, watcher, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		evicted, err := wp.WatchEviction(ctx, addr)
+		require.NoError(t, err)
+
+		p := leasedPod()
+		p.Status.Conditions = append(p.Status.Conditions, corev1.PodCondition{
+			Type:   corev1.DisruptionTarget,
+			Status: corev1.ConditionTrue,
+			Reason: "EvictionByEvictionAPI",
+		})
+		watcher.Modify(p)
+
+		select {
+		case <-evicted:
+		case <-time.After(time.Second):
+			t.Fatal("expected eviction to be reported")
+		}
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		watcher := watch.NewFake()
+		fakeClient := fake.NewSimpleClientset(leasedPod())
+		fakeClient.PrependWatchReactor("pods", func(k8stesting.Action) (handled bool, ret watch.Interface, err error) {
+			return true, watcher, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		evicted, err := wp.WatchEviction(ctx, addr)
+		require.NoError(t, err)
+
+		watcher.Modify(leasedPod())
+		watcher.Delete(leasedPod())
+
+		select {
+		case <-evicted:
+		case <-time.After(time.Second):
+			t.Fatal("expected deletion to be reported")
+		}
+	})
+
+	t.Run("expired_resource_version", func(t *testing.T) {
+		defer func(b wait.Backoff) { evictionWatchBackoff = b }(evictionWatchBackoff)
+		evictionWatchBackoff = wait.Backoff{Duration: time.Millisecond}
+
+		current := leasedPod()
+		current.ResourceVersion = "7"
+		fakeClient := fake.NewSimpleClientset(current)
+
+		var mu sync.Mutex
+		var resourceVersions []string
+		fakeClient.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			resourceVersions = append(resourceVersions, action.(k8stesting.WatchAction).GetWatchRestrictions().ResourceVersion)
+
+			watcher := watch.NewFake()
+			go func(attempt int) {
+				if attempt == 1 {
+					updated := current.DeepCopy()
+					updated.ResourceVersion = "9"
+					assert.NoError(t, fakeClient.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), updated, namespace))
+					watcher.Error(&apierrors.NewResourceExpired("too old resource version").ErrStatus)
+					return
+				}
+				watcher.Delete(current)
+			}(len(resourceVersions))
+			return true, watcher, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		evicted, err := wp.WatchEviction(ctx, addr)
+		require.NoError(t, err)
+
+		select {
+		case <-evicted:
+		case <-time.After(time.Second):
+			t.Fatal("expected deletion to be reported")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"7", "9"}, resourceVersions, "expired watches continue from the current pod")
+	})
+
+	t.Run("failing_watches_back_off", func(t *testing.T) {
+		defer func(b wait.Backoff) { evictionWatchBackoff = b }(evictionWatchBackoff)
+		evictionWatchBackoff = wait.Backoff{Duration: 20 * time.Millisecond, Factor: 2, Steps: 8}
+
+		fakeClient := fake.NewSimpleClientset(leasedPod())
+
+		var watches atomic.Int32
+		fakeClient.PrependWatchReactor("pods", func(k8stesting.Action) (bool, watch.Interface, error) {
+			watches.Add(1)
+
+			watcher := watch.NewFake()
+			go watcher.Error(&apierrors.NewGone("too old resource version").ErrStatus)
+			return true, watcher, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		evicted, err := wp.WatchEviction(ctx, addr)
+		require.NoError(t, err)
+
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+
+		select {
+		case <-evicted:
+			t.Fatal("watch errors are not evictions")
+		default:
+		}
+		assert.LessOrEqual(t, watches.Load(), int32(5), "watches failing with 410 Gone are retried with a backoff")
+	})
+
+	t.Run("already_terminating", func(t *testing.T) {
+		p := leasedPod()
+		p.DeletionTimestamp = ptr.To(metav1.Now())
+
+		wp := NewPool(fake.NewSimpleClientset(p), testConfig)
+		evicted, err := wp.WatchEviction(context.Background(), addr)
+		require.NoError(t, err)
+
+		_, open := <-evicted
+		assert.False(t, open)
+	})
+
+	t.Run("missing_pod", func(t *testing.T) {
+		wp := NewPool(fake.NewSimpleClientset(), testConfig)
+
+		_, err := wp.WatchEviction(context.Background(), addr)
+		assert.Error(t, err)
+	})
+}
+
+func TestPoolSpotWorkers(t *testing.T) {
+	conf := testConfig
+	conf.SpotNodeLabels = map[string]string{"capacity-type": "spot"}
+
+	spotNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "spot-node",
+		Labels: map[string]string{"capacity-type": "spot"},
+	}}
+
+	newClient := func(p *corev1.Pod) *fake.Clientset {
+		fakeClient := fake.NewSimpleClientset(p, spotNode)
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (bool, watch.Interface, error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(p))
+			}()
+			return true, watcher, nil
+		})
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			var meta metav1.PartialObjectMetadata
+			require.NoError(t, json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &meta))
+			if spot, ok := meta.Annotations[testKeys.spotNode]; ok {
+				recorded := p.DeepCopy()
+				recorded.Annotations = map[string]string{testKeys.spotNode: spot}
+				return true, recorded, nil
+			}
+
+			assertLeasedPod(t, action, p)
+			return true, p, nil
+		})
+
+		return fakeClient
+	}
+
+	t.Run("flexible_request", func(t *testing.T) {
+		p := validPod()
+		p.Spec.NodeName = spotNode.Name
+
+		wp := NewPool(newClient(p), conf, SyncWaitTime(50*time.Millisecond))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go wp.Start(ctx)
+
+		addr, err := wp.Get(ctx, owner)
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://buildkit-0.buildkit.test-namespace:1234", addr)
+	})
+
+	t.Run("on_demand_only_request", func(t *testing.T) {
+		p := validPod()
+		p.Spec.NodeName = spotNode.Name
+
+		var scaled atomic.Int32
+		fakeClient := newClient(p)
+		fakeClient.PrependReactor("update", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+			scaled.Store(scale.Spec.Replicas)
+			return true, scale, nil
+		})
+
+		wp := NewPool(fakeClient, conf, SyncWaitTime(50*time.Millisecond))
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		go wp.Start(ctx)
+
+		_, err := wp.Get(ctx, owner, OnDemandOnly())
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "spot worker should not be leased")
+		assert.Equal(t, int32(2), scaled.Load(), "expected an additional worker for the on-demand request")
+	})
+
+	t.Run("record_spot_nodes", func(t *testing.T) {
+		onDemandNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "on-demand-node"}}
+
+		spot := validPod()
+		spot.Spec.NodeName = spotNode.Name
+		onDemand := validPod()
+		onDemand.Name = "buildkit-1"
+		onDemand.Spec.NodeName = onDemandNode.Name
+		recorded := validPod()
+		recorded.Name = "buildkit-2"
+		recorded.Spec.NodeName = spotNode.Name
+		recorded.Annotations = map[string]string{testKeys.spotNode: "false"}
+		unscheduled := validPod()
+		unscheduled.Name = "buildkit-3"
+		missing := validPod()
+		missing.Name = "buildkit-4"
+		missing.Spec.NodeName = "missing-node"
+
+		fakeClient := fake.NewSimpleClientset(spotNode, onDemandNode)
+		var nodeLookups atomic.Int32
+		fakeClient.PrependReactor("get", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+			nodeLookups.Add(1)
+			return false, nil, nil
+		})
+		pods := []corev1.Pod{*spot, *onDemand, *recorded, *unscheduled, *missing}
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			var meta metav1.PartialObjectMetadata
+			require.NoError(t, json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &meta))
+			for _, pod := range []*corev1.Pod{spot, onDemand} {
+				if pod.Name == meta.Name {
+					pod = pod.DeepCopy()
+					pod.Annotations = meta.Annotations
+					return true, pod, nil
+				}
+			}
+			return true, nil, fmt.Errorf("unexpected patch of pod %q", meta.Name)
+		})
+
+		wp := NewPool(fakeClient, conf)
+		wp.recordSpotNodes(context.Background(), pods)
+
+		assert.EqualValues(t, 3, nodeLookups.Load(), "nodes are only inspected for unrecorded scheduled pods")
+		assert.Equal(t, "true", pods[0].Annotations[testKeys.spotNode])
+		assert.Equal(t, "false", pods[1].Annotations[testKeys.spotNode])
+
+		assert.True(t, wp.isSpotPod(pods[0]))
+		assert.False(t, wp.isSpotPod(pods[1]))
+		assert.False(t, wp.isSpotPod(pods[2]), "recorded verdicts are kept")
+		assert.False(t, wp.isSpotPod(pods[3]), "unscheduled pods are re-evaluated once bound")
+		assert.True(t, wp.isSpotPod(pods[4]), "pods on uninspectable nodes are assumed to be spot-backed")
+	})
+
+	t.Run("on_demand_worker_kept_for_on_demand_request", func(t *testing.T) {
+		spot := validPod()
+		spot.Name = "buildkit-1"
+		spot.Spec.NodeName = spotNode.Name
+		spot.Annotations = map[string]string{testKeys.spotNode: "true"}
+		onDemand := validPod()
+		onDemand.Spec.NodeName = "on-demand-node"
+		onDemand.Annotations = map[string]string{testKeys.spotNode: "false"}
+
+		fakeClient := fake.NewSimpleClientset(spot, onDemand)
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (bool, watch.Interface, error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(spot, onDemand))
+			}()
+			return true, watcher, nil
+		})
+		var mu sync.Mutex
+		leased := map[string]string{}
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			var meta metav1.PartialObjectMetadata
+			require.NoError(t, json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &meta))
+
+			mu.Lock()
+			defer mu.Unlock()
+			leased[action.(k8stesting.PatchAction).GetName()] = meta.Annotations[testKeys.leasedBy]
+			return true, &corev1.Pod{ObjectMeta: meta.ObjectMeta}, nil
+		})
+		fakeClient.PrependReactor("update", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, nil
+		})
+
+		wp := NewPool(fakeClient, conf)
+		flexible := &PodRequest{owner: "ns/flexible", result: make(chan PodRequestResult, 1)}
+		onDemandOnly := &PodRequest{owner: "ns/on-demand", onDemandOnly: true, result: make(chan PodRequestResult, 1)}
+		wp.requests.Enqueue(flexible)
+		wp.requests.Enqueue(onDemandOnly)
+
+		require.NoError(t, wp.reconcileWorkers(context.Background()))
+		require.NoError(t, (<-flexible.result).err)
+		require.NoError(t, (<-onDemandOnly.result).err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, map[string]string{"buildkit-0": "ns/on-demand", "buildkit-1": "ns/flexible"}, leased)
+	})
+}
+
+func TestPoolCordon(t *testing.T) {
+	conf := testConfig
+	conf.StatefulSetName = "buildkit"
+
+	cordonedSts := func() *appsv1.StatefulSet {
+		sts := validSts()
+		sts.Annotations = map[string]string{testKeys.cordoned: "true"}
+		return sts
+	}
+
+	t.Run("not_cordoned", func(t *testing.T) {
+		wp := NewPool(fake.NewSimpleClientset(validSts()), conf)
+
+		cordoned, err := wp.Cordoned(context.Background())
+		require.NoError(t, err)
+		assert.False(t, cordoned)
+	})
+
+	t.Run("rejects_leases", func(t *testing.T) {
+		wp := NewPool(fake.NewSimpleClientset(cordonedSts(), validPod()), conf)
+
+		cordoned, err := wp.Cordoned(context.Background())
+		require.NoError(t, err)
+		assert.True(t, cordoned)
+
+		_, err = wp.Get(context.Background(), owner)
+		assert.ErrorIs(t, err, ErrPoolCordoned)
+		_, err = wp.Get(context.Background(), owner, PinnedTo("buildkit-0"))
+		assert.ErrorIs(t, err, ErrPoolCordoned)
+	})
+
+	t.Run("rejects_queued_requests", func(t *testing.T) {
+		fakeClient := fake.NewSimpleClientset(cordonedSts(), validPod())
+		fakeClient.PrependReactor("patch", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+			t.Error("workers must not be leased while the pool is cordoned")
+			return true, nil, nil
+		})
+		fakeClient.PrependReactor("update", "statefulsets", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, nil
+		})
+
+		wp := NewPool(fakeClient, conf)
+		req := &PodRequest{owner: owner, result: make(chan PodRequestResult, 1)}
+		wp.requests.Enqueue(req)
+
+		require.NoError(t, wp.reconcileWorkers(context.Background()))
+		assert.ErrorIs(t, (<-req.result).err, ErrPoolCordoned)
+		assert.Zero(t, wp.requests.Len())
+	})
+
+	t.Run("missing_statefulset", func(t *testing.T) {
+		wp := NewPool(fake.NewSimpleClientset(), conf)
+
+		_, err := wp.Cordoned(context.Background())
+		assert.ErrorContains(t, err, "cannot find buildkit statefulset")
+	})
+}
+
+func TestPoolReportVersions(t *testing.T) {
+	conf := testConfig
+	conf.StatefulSetName = "buildkit"
+
+	first := validPod()
+	first.UID = "pod-0"
+	second := validPod()
+	second.Name, second.UID = "buildkit-1", "pod-1"
+	gone := validPod()
+	gone.Name, gone.UID = "buildkit-2", "pod-2"
+
+	var applied []appsv1.StatefulSet
+	fakeClient := fake.NewSimpleClientset(validSts())
+	fakeClient.PrependReactor("patch", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		var sts appsv1.StatefulSet
+		require.NoError(t, json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &sts))
+		applied = append(applied, sts)
+
+		return true, &sts, nil
+	})
+
+	recorder := record.NewFakeRecorder(10)
+	wp := NewPool(fakeClient, conf, EventRecorder(recorder))
+
+	versions := map[string]string{"buildkit-0": "v0.16.0", "buildkit-1": "v0.15.1", "buildkit-2": "v0.15.1"}
+	orig := probeWorker
+	defer func() { probeWorker = orig }()
+	probeWorker = func(_ context.Context, _ *config.BuildkitMTLS, _, _ []string, addr string) (string, error) {
+		name, err := podNameFromAddr(addr)
+		return versions[name], err
+	}
+
+	for _, pod := range []*corev1.Pod{first, second, gone} {
+		require.NoError(t, wp.probePod(context.Background(), *pod, "tcp://"+pod.Name+".buildkit:1234", nil))
+	}
+
+	sts := validSts()
+	wp.reportVersions(context.Background(), sts, []corev1.Pod{*first, *second})
+
+	require.Len(t, applied, 1)
+	assert.Equal(t, "v0.15.1=1,v0.16.0=1", applied[0].Annotations[testKeys.versions])
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "BuildkitVersionSkew")
+	assert.NotContains(t, wp.workerVersions, gone.UID, "versions of deleted workers are forgotten")
+
+	// unchanged versions are not reported again
+	sts.Annotations = applied[0].Annotations
+	wp.reportVersions(context.Background(), sts, []corev1.Pod{*first, *second})
+	assert.Len(t, applied, 1)
+
+	wp.reportVersions(context.Background(), sts, []corev1.Pod{*first})
+	require.Len(t, applied, 2)
+	assert.Equal(t, "v0.16.0=1", applied[1].Annotations[testKeys.versions])
+	assert.Empty(t, recorder.Events, "matching versions are not a skew")
+}
+
+func TestPoolLogState(t *testing.T) {
+	var summaries []string
+	log := funcr.New(func(_, args string) { summaries = append(summaries, args) }, funcr.Options{})
+
+	wp := NewPool(fake.NewSimpleClientset(), testConfig, Logger(log), StateLogInterval(time.Hour))
+	arbiter := NewScaleArbiter(log, nil, time.Minute, testKeys)
+	arbiter.observations = []*PodObservation{
+		{State: BuilderStateOperational},
+		{State: BuilderStateLeased},
+		{State: BuilderStateOperational},
+	}
+
+	wp.logState(arbiter, 3)
+	require.Len(t, summaries, 1)
+	assert.Contains(t, summaries[0], `"states"="Leased=1,Operational=2"`)
+
+	wp.logState(arbiter, 3)
+	assert.Len(t, summaries, 1, "an unchanged pool is only summarized once per interval")
+
+	wp.logState(arbiter, 4)
+	assert.Len(t, summaries, 2, "scale changes are always summarized")
+
+	wp.lastStateLog = time.Now().Add(-time.Hour)
+	wp.logState(arbiter, 4)
+	assert.Len(t, summaries, 3)
+}
+
+func TestPoolReleaseOrphanedLeases(t *testing.T) {
+	leased := func(name, owner string, age time.Duration) *corev1.Pod {
+		pod := leasedPod()
+		pod.Name = name
+		pod.Annotations[testKeys.leasedBy] = owner
+		pod.Annotations[testKeys.leasedAt] = time.Now().Add(-age).Format(time.RFC3339)
+		return pod
+	}
+	idle := validPod()
+	idle.Name = "buildkit-4"
+
+	fakeClient := fake.NewSimpleClientset(
+		leased("buildkit-0", "ns/deleted", time.Hour),
+		leased("buildkit-1", "ns/running", time.Hour),
+		leased("buildkit-2", "ns/deleted", time.Minute),
+		leased("buildkit-3", "ns/unknown", time.Hour),
+		idle,
+	)
+	var released []string
+	fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		assertUnleasedPod(t, action)
+		released = append(released, action.(k8stesting.PatchAction).GetName())
+		return true, nil, nil
+	})
+
+	lookup := func(_ context.Context, owner string) (bool, error) {
+		switch owner {
+		case "ns/running":
+			return true, nil
+		case "ns/unknown":
+			return false, errors.New("api server unavailable")
+		}
+		return false, nil
+	}
+	recorder := record.NewFakeRecorder(10)
+	wp := NewPool(fakeClient, testConfig, OrphanedLeases(lookup), EventRecorder(recorder))
+
+	wp.releaseOrphanedLeases(context.Background())
+
+	assert.Equal(t, []string{"buildkit-0"}, released, "only leases of deleted owners past the grace period are released")
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "OrphanedLease")
+}
+
+func TestPoolApplyDisruptionBudget(t *testing.T) {
+	conf := testConfig
+	conf.StatefulSetName = "buildkit"
+
+	t.Run("success", func(t *testing.T) {
+		sts := validSts()
+		sts.UID = "sts-uid"
+
+		var pdb policyv1.PodDisruptionBudget
+		fakeClient := fake.NewSimpleClientset(sts)
+		fakeClient.PrependReactor("patch", "poddisruptionbudgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			patchAction := action.(k8stesting.PatchAction)
+			assert.Equal(t, types.ApplyPatchType, patchAction.GetPatchType(), "unexpected patch type")
+			require.NoError(t, json.Unmarshal(patchAction.GetPatch(), &pdb))
+
+			return true, &pdb, nil
+		})
+
+		wp := NewPool(fakeClient, conf, DisruptionBudget(true))
+		require.NoError(t, wp.applyDisruptionBudget(context.Background()))
+
+		assert.Equal(t, "buildkit", pdb.Name)
+		assert.Equal(t, namespace, pdb.Namespace)
+		assert.Equal(t, 0, pdb.Spec.MaxUnavailable.IntValue())
+		assert.Equal(t, map[string]string{"owned-by": "testing", testKeys.leasedLabel: "true"}, pdb.Spec.Selector.MatchLabels)
+		require.Len(t, pdb.OwnerReferences, 1)
+		assert.Equal(t, types.UID("sts-uid"), pdb.OwnerReferences[0].UID)
+	})
+
+	t.Run("missing_statefulset", func(t *testing.T) {
+		wp := NewPool(fake.NewSimpleClientset(), conf, DisruptionBudget(true))
+		assert.ErrorContains(t, wp.applyDisruptionBudget(context.Background()), "cannot find buildkit statefulset")
+	})
+}
+
+func TestPoolUpgradeWorkers(t *testing.T) {
+	conf := testConfig
+	conf.StatefulSetName = "buildkit"
+
+	revisioned := func(pod *corev1.Pod, name, revision string) *corev1.Pod {
+		pod.Name = name
+		pod.Labels = map[string]string{appsv1.ControllerRevisionHashLabelKey: revision}
+		return pod
+	}
+	upgradeSts := func(replicas int32) *appsv1.StatefulSet {
+		sts := validSts()
+		sts.Spec.Replicas = ptr.To(replicas)
+		sts.Status.UpdateRevision = "rev-2"
+		return sts
+	}
+	upgrade := func(sts *appsv1.StatefulSet, pods ...*corev1.Pod) (cordoned, deleted []string) {
+		fakeClient := fake.NewSimpleClientset()
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			var pod corev1.Pod
+			require.NoError(t, json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &pod))
+			assert.Equal(t, "rev-2", pod.Annotations[testKeys.upgrading])
+			cordoned = append(cordoned, pod.Name)
+
+			return true, &pod, nil
+		})
+		fakeClient.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			deleted = append(deleted, action.(k8stesting.DeleteAction).GetName())
+			return true, nil, nil
+		})
+
+		items := make([]corev1.Pod, 0, len(pods))
+		for _, pod := range pods {
+			items = append(items, *pod)
+		}
+
+		wp := NewPool(fakeClient, conf, RollingUpgrade(true))
+		wp.upgradeWorkers(context.Background(), sts, items)
+
+		return cordoned, deleted
+	}
+
+	t.Run("cordons_unleased_outdated_pod", func(t *testing.T) {
+		cordoned, deleted := upgrade(upgradeSts(3),
+			revisioned(validPod(), "buildkit-0", "rev-2"),
+			revisioned(validPod(), "buildkit-1", "rev-1"),
+			revisioned(leasedPod(), "buildkit-2", "rev-1"),
+		)
+		assert.Equal(t, []string{"buildkit-1"}, cordoned)
+		assert.Empty(t, deleted)
+	})
 
-func TestPoolGetFailedScaleUp(t *testing.T) {
-	p := validPod()
-	fakeClient := fake.NewSimpleClientset(validSts(), p)
+	t.Run("cordons_leased_outdated_pod", func(t *testing.T) {
+		cordoned, deleted := upgrade(upgradeSts(1), revisioned(leasedPod(), "buildkit-0", "rev-1"))
+		assert.Equal(t, []string{"buildkit-0"}, cordoned)
+		assert.Empty(t, deleted)
+	})
 
-	fakeClient.PrependWatchReactor("endpointslices", func(action k8stesting.Action) (handled bool, ret watch.Interface, err error) {
-		watcher := watch.NewFake()
-		go func() {
-			defer watcher.Stop()
-			watcher.Add(validEndpointSlice(p))
-		}()
-		return true, watcher, nil
+	t.Run("restarts_cordoned_pod", func(t *testing.T) {
+		pod := revisioned(validPod(), "buildkit-1", "rev-1")
+		pod.Annotations = map[string]string{testKeys.upgrading: "rev-2"}
+
+		cordoned, deleted := upgrade(upgradeSts(3),
+			revisioned(validPod(), "buildkit-0", "rev-1"),
+			pod,
+			revisioned(validPod(), "buildkit-2", "rev-1"),
+		)
+		assert.Empty(t, cordoned, "only one pod is upgraded at a time")
+		assert.Equal(t, []string{"buildkit-1"}, deleted)
 	})
 
-	// server-side applies not supported so mimic the results
-	leased := false
-	fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-		if leased {
-			return true, validPod(), nil
-		}
+	t.Run("waits_for_lease", func(t *testing.T) {
+		pod := revisioned(leasedPod(), "buildkit-0", "rev-1")
+		pod.Annotations[testKeys.upgrading] = "rev-2"
 
-		leased = !leased
-		return true, leasedPod(), nil
+		cordoned, deleted := upgrade(upgradeSts(2), pod, revisioned(validPod(), "buildkit-1", "rev-1"))
+		assert.Empty(t, cordoned)
+		assert.Empty(t, deleted)
 	})
 
-	var scaleUp atomic.Int32
-	fakeClient.PrependReactor("update", "statefulsets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-		scaleUp.Add(1)
-		return true, nil, errors.New("failed scale up")
+	t.Run("waits_for_updated_pod", func(t *testing.T) {
+		starting := revisioned(validPod(), "buildkit-1", "rev-2")
+		starting.Status.Phase = corev1.PodPending
+
+		cordoned, deleted := upgrade(upgradeSts(2), revisioned(validPod(), "buildkit-0", "rev-1"), starting)
+		assert.Empty(t, cordoned)
+		assert.Empty(t, deleted)
+
+		cordoned, deleted = upgrade(upgradeSts(2), revisioned(validPod(), "buildkit-0", "rev-1"))
+		assert.Empty(t, cordoned, "restarted pods must be recreated first")
+		assert.Empty(t, deleted)
 	})
 
-	wp := NewPool(fakeClient, testConfig, SyncWaitTime(time.Minute))
+	t.Run("up_to_date", func(t *testing.T) {
+		cordoned, deleted := upgrade(upgradeSts(1), revisioned(validPod(), "buildkit-0", "rev-2"))
+		assert.Empty(t, cordoned)
+		assert.Empty(t, deleted)
+	})
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go wp.Start(ctx)
+func TestPoolWarmRestartedWorkers(t *testing.T) {
+	conf := testConfig
+	conf.StatefulSetName = "buildkit"
 
-	addr, err := wp.Get(ctx, owner)
-	if err != nil {
-		t.Fatal(err)
-	}
-	expected := "tcp://buildkit-0.buildkit.test-namespace:1234"
-	if addr != expected {
-		t.Errorf("did not received correct lease: %s expected, %s actual", expected, addr)
-	}
+	sts := validSts()
+	sts.Spec.Replicas = ptr.To(int32(1))
+	sts.Status.UpdateRevision = "rev-2"
 
-	if err := wp.Release(ctx, addr); err != nil {
-		t.Fatal(err)
+	restartedPod := func() *corev1.Pod {
+		pod := validPod()
+		pod.Labels = map[string]string{appsv1.ControllerRevisionHashLabelKey: "rev-2"}
+		return pod
 	}
+	// the applied annotations are read through a function, warmed pods are uncordoned in the background
+	warmPool := func(pod *corev1.Pod, warmup CacheWarmup) (*AutoscalingPool, func() []map[string]string) {
+		var mu sync.Mutex
+		var applied []map[string]string
 
-	addr, err = wp.Get(ctx, owner)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if addr != expected {
-		t.Errorf("did not received correct lease: %s expected, %s actual", expected, addr)
-	}
+		fakeClient := fake.NewSimpleClientset(pod)
+		fakeClient.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			var patched corev1.Pod
+			require.NoError(t, json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &patched))
 
-	if a := scaleUp.Load(); a < 2 {
-		t.Errorf("Expected at least 2 scale ups: got %d", a)
+			mu.Lock()
+			applied = append(applied, patched.Annotations)
+			mu.Unlock()
+
+			return true, &patched, nil
+		})
+
+		snapshot := func() []map[string]string {
+			mu.Lock()
+			defer mu.Unlock()
+			return slices.Clone(applied)
+		}
+
+		return NewPool(fakeClient, conf, RollingUpgrade(true), WarmCaches(warmup)), snapshot
 	}
-}
 
-func TestPoolCancelAndGet(t *testing.T) {
-	fakeClient := fake.NewSimpleClientset(validSts())
-	fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-		return true, validPod(), nil
-	})
-	fakeClient.PrependReactor("update", "statefulsets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-		return true, nil, nil
+	t.Run("cordons_until_warmed", func(t *testing.T) {
+		warmed := make(chan string, 1)
+		release := make(chan struct{})
+		wp, applied := warmPool(restartedPod(), func(_ context.Context, podName string) error {
+			warmed <- podName
+			<-release
+			return nil
+		})
+		wp.restarted["buildkit-0"] = true
+
+		items := []corev1.Pod{*restartedPod()}
+		wp.upgradeWorkers(context.Background(), sts, items)
+
+		assert.Equal(t, "buildkit-0", <-warmed)
+		assert.Equal(t, "rev-2", items[0].Annotations[testKeys.warming], "the pod is cordoned in place")
+
+		arbiter := NewScaleArbiter(logr.Discard(), nil, time.Minute, testKeys)
+		arbiter.EvaluatePod(context.Background(), wp.uuid, items[0])
+		assert.Empty(t, arbiter.LeasablePods(), "warming pods are not leased")
+
+		close(release)
+		assert.Eventually(t, func() bool {
+			wp.leaseMu.Lock()
+			defer wp.leaseMu.Unlock()
+			return len(wp.warming) == 0 && len(applied()) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "rev-2", applied()[0][testKeys.warming])
+		assert.NotContains(t, applied()[1], testKeys.warming, "the pod is uncordoned once warmed")
+		assert.Empty(t, wp.restarted)
 	})
 
-	wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond))
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	t.Run("skips_populated_cache", func(t *testing.T) {
+		pod := restartedPod()
+		pod.Annotations = map[string]string{testKeys.cacheGen: "3"}
+		wp, applied := warmPool(pod, func(context.Context, string) error {
+			t.Error("pods restarted on a populated cache are not warmed")
+			return nil
+		})
+		wp.restarted["buildkit-0"] = true
 
-	errCh := make(chan error)
-	go func() {
-		errCh <- wp.Start(ctx)
-	}()
+		wp.upgradeWorkers(context.Background(), sts, []corev1.Pod{*pod})
+		assert.Empty(t, applied())
+		assert.Empty(t, wp.restarted)
+	})
 
-	cancel()
+	t.Run("uncordons_interrupted_warmup", func(t *testing.T) {
+		pod := restartedPod()
+		pod.Annotations = map[string]string{testKeys.warming: "rev-2"}
+		wp, applied := warmPool(pod, func(context.Context, string) error {
+			t.Error("pods are only warmed after a restart")
+			return nil
+		})
 
-	err := <-errCh
-	if err != nil {
-		t.Error(err)
-	}
+		items := []corev1.Pod{*pod}
+		wp.upgradeWorkers(context.Background(), sts, items)
+		require.Len(t, applied(), 1)
+		assert.NotContains(t, applied()[0], testKeys.warming)
+		assert.NotContains(t, items[0].Annotations, testKeys.warming)
+	})
+}
 
-	addr, err := wp.Get(context.Background(), owner)
-	if err != errPoolClosed {
-		t.Errorf("unexpected error: %#v", err)
+func TestPoolCacheGenerations(t *testing.T) {
+	cachePod := func() *corev1.Pod {
+		pod := validPod()
+		pod.Spec.Volumes = []corev1.Volume{{
+			Name: "cache",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "cache-buildkit-0"},
+			},
+		}}
+		return pod
 	}
-	if addr != "" {
-		t.Errorf("acquired lease even though pool was closed")
+	applied := func(fakeClient *fake.Clientset, resource string) *[]map[string]string {
+		var annotations []map[string]string
+		fakeClient.PrependReactor("patch", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+			var meta metav1.PartialObjectMetadata
+			require.NoError(t, json.Unmarshal(action.(k8stesting.PatchAction).GetPatch(), &meta))
+			annotations = append(annotations, meta.Annotations)
+
+			if resource == "pods" {
+				return true, &corev1.Pod{ObjectMeta: meta.ObjectMeta}, nil
+			}
+			return true, &corev1.PersistentVolumeClaim{ObjectMeta: meta.ObjectMeta}, nil
+		})
+		return &annotations
 	}
-}
 
-func TestPoolRelease(t *testing.T) {
-	t.Run("success", func(t *testing.T) {
-		fakeClient := fake.NewSimpleClientset(leasedPod())
-		fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-			assertUnleasedPod(t, action)
-			return true, nil, nil
-		})
+	t.Run("release", func(t *testing.T) {
+		pod := cachePod()
+		pod.Annotations = leasedPod().Annotations
+		pod.Annotations[testKeys.cacheGen] = "2"
 
-		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond), MaxIdleTime(10*time.Minute))
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+		fakeClient := fake.NewSimpleClientset(pod)
+		pods, claims := applied(fakeClient, "pods"), applied(fakeClient, "persistentvolumeclaims")
 
-		go wp.Start(ctx)
+		wp := NewPool(fakeClient, testConfig)
+		require.NoError(t, wp.Release(context.Background(), "tcp://buildkit-0.buildkit.default:1234"))
 
-		assert.NoError(t, wp.Release(ctx, "tcp://buildkit-0.buildkit.default:1234"), "expected release to succeed")
+		require.Len(t, *pods, 1)
+		assert.Equal(t, "3", (*pods)[0][testKeys.cacheGen])
+		require.Len(t, *claims, 1)
+		assert.Equal(t, map[string]string{testKeys.cacheGen: "3"}, (*claims)[0])
 	})
 
-	t.Run("invalid_address", func(t *testing.T) {
+	t.Run("release_ephemeral_cache", func(t *testing.T) {
 		fakeClient := fake.NewSimpleClientset(leasedPod())
+		pods, claims := applied(fakeClient, "pods"), applied(fakeClient, "persistentvolumeclaims")
 
-		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond), MaxIdleTime(10*time.Minute))
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		go wp.Start(ctx)
-
-		invalidAddrs := []string{
-			"buildkit-0.buildkit.default:1234",
-			"buildkit-0.buildkit.default",
-			"buildkit-0",
-			"tcp://",
-		}
+		wp := NewPool(fakeClient, testConfig)
+		require.NoError(t, wp.Release(context.Background(), "tcp://buildkit-0.buildkit.default:1234"))
 
-		for _, addr := range invalidAddrs {
-			assert.EqualErrorf(t,
-				wp.Release(ctx, addr),
-				"invalid address: must be an absolute URI including scheme",
-				"expected %s to produce an uri parse err", addr,
-			)
-		}
+		require.Len(t, *pods, 1)
+		assert.NotContains(t, (*pods)[0], testKeys.cacheGen)
+		assert.Empty(t, *claims)
 	})
 
-	t.Run("missing_pod", func(t *testing.T) {
-		fakeClient := fake.NewSimpleClientset()
-
-		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond), MaxIdleTime(10*time.Minute))
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		go wp.Start(ctx)
-
-		assert.EqualError(t,
-			wp.Release(ctx, "tcp://buildkit-0.buildkit.default:1234"),
-			`addr "tcp://buildkit-0.buildkit.default:1234" is not allocated: pods "buildkit-0" not found`,
-		)
+	t.Run("restore", func(t *testing.T) {
+		claim := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+			Name:        "cache-buildkit-0",
+			Namespace:   namespace,
+			Annotations: map[string]string{testKeys.cacheGen: "4"},
+		}}
+		restored := cachePod()
+		restored.Annotations = map[string]string{testKeys.cacheGen: "1"}
+		restored.Name = "buildkit-1"
+
+		fakeClient := fake.NewSimpleClientset(claim)
+		pods := applied(fakeClient, "pods")
+
+		items := []corev1.Pod{*cachePod(), *restored, *validPod()}
+		NewPool(fakeClient, testConfig).restoreCacheGenerations(context.Background(), items)
+
+		require.Len(t, *pods, 1, "only new pods with a persistent cache are restored")
+		assert.Equal(t, "4", items[0].Annotations[testKeys.cacheGen])
+		assert.Equal(t, "1", items[1].Annotations[testKeys.cacheGen])
 	})
 
-	t.Run("patch_fail", func(t *testing.T) {
-		fakeClient := fake.NewSimpleClientset(leasedPod())
-		fakeClient.PrependReactor("patch", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-			return true, nil, errors.New("test failure")
-		})
+	t.Run("leasing_preference", func(t *testing.T) {
+		observation := func(name, generation string, spot bool) *PodObservation {
+			pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Annotations: map[string]string{testKeys.cacheGen: generation},
+			}}
+			return &PodObservation{Pod: pod, State: BuilderStateOperational, Spot: spot}
+		}
 
-		wp := NewPool(fakeClient, testConfig, SyncWaitTime(50*time.Millisecond), MaxIdleTime(10*time.Minute))
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		go wp.Start(ctx)
+		arbiter := NewScaleArbiter(logr.Discard(), nil, time.Minute, testKeys)
+		arbiter.observations = []*PodObservation{
+			observation("empty", "0", false),
+			observation("populated", "5", false),
+			observation("spot", "0", true),
+			observation("invalid", "nope", false),
+			observation("warm", "2", false),
+		}
 
-		assert.EqualError(t, wp.Release(ctx, "tcp://buildkit-0.buildkit.default:1234"), "cannot update pod metadata: test failure")
+		var names []string
+		for _, o := range arbiter.LeasablePods() {
+			names = append(names, o.Pod.Name)
+		}
+		assert.Equal(t, []string{"populated", "warm", "empty", "spot", "invalid"}, names, "spot pods are not preferred")
 	})
 }
 
@@ -518,6 +1691,16 @@ func TestPoolPodReconciliation(t *testing.T) {
 			buildRequests:    1,
 			expectedReplicas: 2,
 		},
+		{
+			name: "upgrading",
+			objects: func() []runtime.Object {
+				p := validPod()
+				p.Annotations = map[string]string{testKeys.upgrading: "rev-2"}
+				return []runtime.Object{p}
+			},
+			buildRequests:    1,
+			expectedReplicas: 2,
+		},
 		{
 			name: "pending",
 			objects: func() []runtime.Object {
@@ -588,7 +1771,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 			objects: func() []runtime.Object {
 				p := validPod()
 				p.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
 				}
 				return []runtime.Object{p}
 			},
@@ -599,7 +1782,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 			objects: func() []runtime.Object {
 				p := validPod()
 				p.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
 				}
 				return []runtime.Object{p}
 			},
@@ -611,7 +1794,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 			objects: func() []runtime.Object {
 				p := validPod()
 				p.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(-10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(-10 * time.Minute).Format(time.RFC3339),
 				}
 				return []runtime.Object{p}
 			},
@@ -622,7 +1805,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 			objects: func() []runtime.Object {
 				p := validPod()
 				p.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: "garbage",
+					testKeys.expiryTime: "garbage",
 				}
 				return []runtime.Object{p}
 			},
@@ -652,7 +1835,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 			objects: func() []runtime.Object {
 				unexpired := validPod()
 				unexpired.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
 				}
 
 				leased := leasedPod()
@@ -670,7 +1853,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 			objects: func() []runtime.Object {
 				expired := validPod()
 				expired.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(-10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(-10 * time.Minute).Format(time.RFC3339),
 				}
 
 				oldPending := pendingPod()
@@ -741,7 +1924,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 				unexpired := validPod()
 				unexpired.Name = "buildkit-1"
 				unexpired.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
 				}
 
 				fresh := validPod()
@@ -749,12 +1932,12 @@ func TestPoolPodReconciliation(t *testing.T) {
 
 				unmanaged := leasedPod()
 				unmanaged.Name = "buildkit-3"
-				unmanaged.ObjectMeta.Annotations[managerIDAnnotation] = string(uuid.NewUUID())
+				unmanaged.ObjectMeta.Annotations[testKeys.managerID] = string(uuid.NewUUID())
 
 				expired := validPod()
 				expired.Name = "buildkit-4"
 				expired.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(-20 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(-20 * time.Minute).Format(time.RFC3339),
 				}
 
 				expiredPending := validPod()
@@ -775,7 +1958,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 				unexpired := validPod()
 				unexpired.Name = "buildkit-1"
 				unexpired.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(20 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(20 * time.Minute).Format(time.RFC3339),
 				}
 
 				fresh := validPod()
@@ -783,12 +1966,12 @@ func TestPoolPodReconciliation(t *testing.T) {
 
 				unmanaged := leasedPod()
 				unmanaged.Name = "buildkit-3"
-				unmanaged.ObjectMeta.Annotations[managerIDAnnotation] = string(uuid.NewUUID())
+				unmanaged.ObjectMeta.Annotations[testKeys.managerID] = string(uuid.NewUUID())
 
 				expired := validPod()
 				expired.Name = "buildkit-4"
 				expired.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(-20 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(-20 * time.Minute).Format(time.RFC3339),
 				}
 
 				expiredPending := validPod()
@@ -810,7 +1993,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 				unexpired1 := validPod()
 				unexpired1.Name = "buildkit-1"
 				unexpired1.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(10 * time.Minute).Format(time.RFC3339),
 				}
 
 				fresh2 := validPod()
@@ -818,12 +2001,12 @@ func TestPoolPodReconciliation(t *testing.T) {
 
 				unmanaged3 := leasedPod()
 				unmanaged3.Name = "buildkit-3"
-				unmanaged3.ObjectMeta.Annotations[managerIDAnnotation] = string(uuid.NewUUID())
+				unmanaged3.ObjectMeta.Annotations[testKeys.managerID] = string(uuid.NewUUID())
 
 				expired4 := validPod()
 				expired4.Name = "buildkit-4"
 				expired4.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(-10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(-10 * time.Minute).Format(time.RFC3339),
 				}
 
 				expiredPending5 := pendingPod()
@@ -888,7 +2071,7 @@ func TestPoolPodReconciliation(t *testing.T) {
 				expired1 := validPod()
 				expired1.Name = "buildkit-1"
 				expired1.ObjectMeta.Annotations = map[string]string{
-					expiryTimeAnnotation: time.Now().Add(-10 * time.Minute).Format(time.RFC3339),
+					testKeys.expiryTime: time.Now().Add(-10 * time.Minute).Format(time.RFC3339),
 				}
 				return []runtime.Object{leased0, expired1}
 			},
@@ -959,6 +2142,256 @@ func validSts() *appsv1.StatefulSet {
 	}
 }
 
+func TestPoolBuildEndpointURL(t *testing.T) {
+	watchEndpoints := func(fakeClient *fake.Clientset, pod *corev1.Pod) *atomic.Int32 {
+		var watches atomic.Int32
+		fakeClient.PrependWatchReactor("endpoints", func(k8stesting.Action) (bool, watch.Interface, error) {
+			watches.Add(1)
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpoints(pod))
+			}()
+			return true, watcher, nil
+		})
+		fakeClient.PrependWatchReactor("endpointslices", func(k8stesting.Action) (bool, watch.Interface, error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Add(validEndpointSlice(pod))
+			}()
+			return true, watcher, nil
+		})
+		return &watches
+	}
+	expected := "tcp://buildkit-0.buildkit.test-namespace:1234"
+
+	t.Run("auto_without_endpointslices", func(t *testing.T) {
+		pod := validPod()
+		fakeClient := fake.NewSimpleClientset(pod, validEndpoints(pod))
+		watches := watchEndpoints(fakeClient, pod)
+
+		addr, err := NewPool(fakeClient, testConfig).buildEndpointURL(context.Background(), *pod)
+		require.NoError(t, err)
+		assert.Equal(t, expected, addr)
+		assert.EqualValues(t, 1, watches.Load(), "endpoints are watched when the service has no endpointslices")
+	})
+
+	t.Run("auto_with_endpointslices", func(t *testing.T) {
+		pod := validPod()
+		slice := validEndpointSlice(pod)
+		slice.Labels = map[string]string{"kubernetes.io/service-name": "buildkit"}
+		fakeClient := fake.NewSimpleClientset(pod, validEndpoints(pod), slice)
+		watches := watchEndpoints(fakeClient, pod)
+
+		addr, err := NewPool(fakeClient, testConfig).buildEndpointURL(context.Background(), *pod)
+		require.NoError(t, err)
+		assert.Equal(t, expected, addr)
+		assert.EqualValues(t, 0, watches.Load())
+	})
+
+	t.Run("auto_endpointslices_forbidden", func(t *testing.T) {
+		pod := validPod()
+		fakeClient := fake.NewSimpleClientset(pod)
+		watches := watchEndpoints(fakeClient, pod)
+		fakeClient.PrependReactor("list", "endpointslices", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(discoveryv1.Resource("endpointslices"), "", errors.New("rbac"))
+		})
+
+		addr, err := NewPool(fakeClient, testConfig).buildEndpointURL(context.Background(), *pod)
+		require.NoError(t, err)
+		assert.Equal(t, expected, addr)
+		assert.EqualValues(t, 1, watches.Load())
+	})
+
+	t.Run("endpoints", func(t *testing.T) {
+		pod := validPod()
+		slice := validEndpointSlice(pod)
+		slice.Labels = map[string]string{"kubernetes.io/service-name": "buildkit"}
+		fakeClient := fake.NewSimpleClientset(pod, slice)
+		watches := watchEndpoints(fakeClient, pod)
+
+		wp := NewPool(fakeClient, testConfig, EndpointDiscovery(EndpointDiscoveryEndpoints))
+		addr, err := wp.buildEndpointURL(context.Background(), *pod)
+		require.NoError(t, err)
+		assert.Equal(t, expected, addr)
+		assert.EqualValues(t, 1, watches.Load())
+	})
+
+	t.Run("pod_ip", func(t *testing.T) {
+		pod := validPod()
+		pod.Status.PodIP = "10.0.0.1"
+		fakeClient := fake.NewSimpleClientset(pod)
+
+		wp := NewPool(fakeClient, testConfig, AddressMode(AddressModePodIP))
+		addr, err := wp.buildEndpointURL(context.Background(), *pod)
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://10.0.0.1:1234", addr)
+
+		name, err := wp.resolvePodName(context.Background(), addr)
+		require.NoError(t, err)
+		assert.Equal(t, pod.Name, name)
+
+		_, err = wp.resolvePodName(context.Background(), "tcp://10.0.0.2:1234")
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("pod_ip_not_ready", func(t *testing.T) {
+		pod := validPod()
+		pending := pod.DeepCopy()
+		pending.Status.Conditions = nil
+		pod.Status.PodIP = "10.0.0.1"
+		fakeClient := fake.NewSimpleClientset(pending)
+		fakeClient.PrependWatchReactor("pods", func(k8stesting.Action) (bool, watch.Interface, error) {
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Modify(pending)
+				watcher.Modify(pod)
+			}()
+			return true, watcher, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig, AddressMode(AddressModePodIP))
+		addr, err := wp.buildEndpointURL(context.Background(), *pending)
+		require.NoError(t, err)
+		assert.Equal(t, "tcp://10.0.0.1:1234", addr)
+	})
+
+	t.Run("endpoints_not_ready", func(t *testing.T) {
+		pod := validPod()
+		endpoints := validEndpoints(pod)
+		endpoints.Subsets[0].NotReadyAddresses = endpoints.Subsets[0].Addresses
+		endpoints.Subsets[0].Addresses = nil
+
+		wp := NewPool(fake.NewSimpleClientset(), testConfig)
+		assert.Empty(t, wp.extractEndpointsHostname(endpoints, pod.Name))
+		assert.Equal(t, "buildkit-0.buildkit.test-namespace", wp.extractEndpointsHostname(validEndpoints(pod), pod.Name))
+	})
+
+	t.Run("retry_fresh_watch", func(t *testing.T) {
+		pod := validPod()
+		fakeClient := fake.NewSimpleClientset(pod)
+
+		var watches atomic.Int32
+		fakeClient.PrependWatchReactor("endpoints", func(k8stesting.Action) (bool, watch.Interface, error) {
+			if watches.Add(1) == 1 {
+				return true, nil, errors.New("watch refused")
+			}
+
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				if watches.Load() == 3 {
+					watcher.Add(validEndpoints(pod))
+				}
+			}()
+			return true, watcher, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig, EndpointDiscovery(EndpointDiscoveryEndpoints),
+			EndpointWatchRetries(3), EndpointWatchBackoff(time.Millisecond))
+		addr, err := wp.buildEndpointURL(context.Background(), *pod)
+		require.NoError(t, err)
+		assert.Equal(t, expected, addr)
+		assert.EqualValues(t, 3, watches.Load())
+	})
+
+	t.Run("retries_exhausted", func(t *testing.T) {
+		pod := validPod()
+		pod.ResourceVersion = "42"
+		pending := pod.DeepCopy()
+		pending.Status.Conditions = nil
+		fakeClient := fake.NewSimpleClientset(pending)
+
+		var resourceVersions []string
+		fakeClient.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+			resourceVersions = append(resourceVersions, action.(k8stesting.WatchAction).GetWatchRestrictions().ResourceVersion)
+
+			watcher := watch.NewFake()
+			go func() {
+				defer watcher.Stop()
+				watcher.Modify(pending)
+			}()
+			return true, watcher, nil
+		})
+
+		wp := NewPool(fakeClient, testConfig, AddressMode(AddressModePodIP),
+			EndpointWatchRetries(2), EndpointWatchBackoff(time.Millisecond))
+		_, err := wp.buildEndpointURL(context.Background(), *pending)
+		assert.EqualError(t, err, "pod was not ready after 180 seconds (3 attempts)")
+		assert.Equal(t, []string{"42", "", ""}, resourceVersions, "retries start from the current state")
+	})
+
+	t.Run("forbidden_not_retried", func(t *testing.T) {
+		pod := validPod()
+		fakeClient := fake.NewSimpleClientset(pod)
+
+		var watches atomic.Int32
+		fakeClient.PrependWatchReactor("endpoints", func(k8stesting.Action) (bool, watch.Interface, error) {
+			watches.Add(1)
+			return true, nil, apierrors.NewForbidden(corev1.Resource("endpoints"), "", errors.New("no access"))
+		})
+
+		wp := NewPool(fakeClient, testConfig, EndpointDiscovery(EndpointDiscoveryEndpoints),
+			EndpointWatchRetries(3), EndpointWatchBackoff(time.Millisecond))
+		_, err := wp.buildEndpointURL(context.Background(), *pod)
+		assert.True(t, apierrors.IsForbidden(err))
+		assert.EqualValues(t, 1, watches.Load())
+	})
+
+	t.Run("attempts_share_timeout", func(t *testing.T) {
+		pod := validPod()
+		pending := pod.DeepCopy()
+		pending.Status.Conditions = nil
+		fakeClient := fake.NewSimpleClientset(pending)
+
+		var watches atomic.Int32
+		fakeClient.PrependWatchReactor("pods", func(k8stesting.Action) (bool, watch.Interface, error) {
+			watches.Add(1)
+			return true, watch.NewFake(), nil
+		})
+
+		wp := NewPool(fakeClient, testConfig, AddressMode(AddressModePodIP), EndpointWatchTimeoutSeconds(1),
+			EndpointWatchRetries(3), EndpointWatchBackoff(time.Millisecond))
+
+		start := time.Now()
+		_, err := wp.buildEndpointURL(context.Background(), *pending)
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 3*time.Second)
+		assert.EqualValues(t, 1, watches.Load(), "a watch that ran out the timeout is not retried")
+	})
+
+	t.Run("retry_cancelled", func(t *testing.T) {
+		pod := validPod()
+		fakeClient := fake.NewSimpleClientset(pod)
+		fakeClient.PrependWatchReactor("endpoints", func(k8stesting.Action) (bool, watch.Interface, error) {
+			return true, nil, errors.New("watch refused")
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		wp := NewPool(fakeClient, testConfig, EndpointDiscovery(EndpointDiscoveryEndpoints), EndpointWatchBackoff(time.Hour))
+		_, err := wp.buildEndpointURL(ctx, *pod)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func validEndpoints(pod *corev1.Pod) *corev1.Endpoints {
+	return &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "buildkit", Namespace: namespace},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{
+				IP:        "10.0.0.1",
+				Hostname:  pod.Name,
+				TargetRef: &corev1.ObjectReference{Name: pod.Name, Namespace: namespace},
+			}},
+			Ports: []corev1.EndpointPort{{Name: "daemon", Port: 1234}},
+		}},
+	}
+}
+
 func validEndpointSlice(pods ...runtime.Object) *discoveryv1.EndpointSlice {
 	endpoints := make([]discoveryv1.Endpoint, 0, len(pods))
 	for i := range pods {
@@ -1033,9 +2466,9 @@ func validPod() *corev1.Pod {
 func leasedPod() *corev1.Pod {
 	leased := validPod()
 	leased.ObjectMeta.Annotations = map[string]string{
-		leasedAtAnnotation:  time.Now().Format(time.RFC3339),
-		leasedByAnnotation:  owner,
-		managerIDAnnotation: string(newUUID()),
+		testKeys.leasedAt:  time.Now().Format(time.RFC3339),
+		testKeys.leasedBy:  owner,
+		testKeys.managerID: string(newUUID()),
 	}
 
 	return leased
@@ -1043,7 +2476,7 @@ func leasedPod() *corev1.Pod {
 
 func unmanagedPod() *corev1.Pod {
 	unmanaged := leasedPod()
-	unmanaged.ObjectMeta.Annotations[managerIDAnnotation] = string(uuid.NewUUID())
+	unmanaged.ObjectMeta.Annotations[testKeys.managerID] = string(uuid.NewUUID())
 
 	return unmanaged
 }
@@ -1086,11 +2519,14 @@ func assertLeasedPod(t *testing.T, action k8stesting.Action, ret *corev1.Pod) {
 		assert.FailNowf(t, "unable to marshal patch into v1.Pod", "received invalid patch %s", patch)
 	}
 
-	assert.Contains(t, pod.Annotations, leasedByAnnotation)
-	assert.Contains(t, pod.Annotations, managerIDAnnotation)
-	assert.NotContains(t, pod.Annotations, expiryTimeAnnotation)
+	assert.Contains(t, pod.Annotations, testKeys.leasedBy)
+	assert.Contains(t, pod.Annotations, testKeys.managerID)
+	assert.NotContains(t, pod.Annotations, testKeys.expiryTime)
+	assert.Equal(t, leasedPodDeletionCost, pod.Annotations[podDeletionCostAnnotation])
+	assert.Equal(t, "true", pod.Labels[testKeys.leasedLabel])
+	assert.Equal(t, strconv.Itoa(testKeys.countLeases(*ret)+1), pod.Annotations[testKeys.leaseCount])
 
-	ts, ok := pod.Annotations[leasedAtAnnotation]
+	ts, ok := pod.Annotations[testKeys.leasedAt]
 	require.True(t, ok, "leased at annotation not found")
 
 	leasedAt, err := time.Parse(time.RFC3339, ts)
@@ -1118,11 +2554,13 @@ func assertUnleasedPod(t *testing.T, action k8stesting.Action) {
 		assert.FailNowf(t, "unable to marshal patch into v1.Pod", "received invalid patch %s", patch)
 	}
 
-	assert.NotContains(t, pp.Annotations, leasedAtAnnotation)
-	assert.NotContains(t, pp.Annotations, leasedByAnnotation)
-	assert.NotContains(t, pp.Annotations, managerIDAnnotation)
+	assert.NotContains(t, pp.Annotations, testKeys.leasedAt)
+	assert.NotContains(t, pp.Annotations, testKeys.leasedBy)
+	assert.NotContains(t, pp.Annotations, testKeys.managerID)
+	assert.NotContains(t, pp.Annotations, podDeletionCostAnnotation)
+	assert.NotContains(t, pp.Labels, testKeys.leasedLabel)
 
-	ts, ok := pp.Annotations[expiryTimeAnnotation]
+	ts, ok := pp.Annotations[testKeys.expiryTime]
 	require.True(t, ok, "expiry time annotation not found")
 
 	expiry, err := time.Parse(time.RFC3339, ts)
@@ -1,25 +1,57 @@
 package worker
 
 import (
+	"context"
 	"time"
 
 	"github.com/go-logr/logr"
+	"k8s.io/client-go/tools/record"
 )
 
 var defaultOpts = Options{
 	Log:                         logr.Discard(),
 	SyncWaitTime:                30 * time.Second,
+	StateLogInterval:            5 * time.Minute,
+	OrphanCheckInterval:         5 * time.Minute,
 	MaxIdleTime:                 10 * time.Minute,
 	EndpointWatchTimeoutSeconds: 180,
+	EndpointWatchRetries:        3,
+	EndpointWatchBackoff:        2 * time.Second,
+	EndpointDiscovery:           EndpointDiscoveryAuto,
+	AddressMode:                 AddressModeDNS,
+	AnnotationDomain:            defaultAnnotationDomain,
+	FieldManager:                defaultFieldManager,
 }
 
 type Options struct {
 	Log                         logr.Logger
 	MaxIdleTime                 time.Duration
 	SyncWaitTime                time.Duration
+	StateLogInterval            time.Duration
 	EndpointWatchTimeoutSeconds int64
+	EndpointWatchRetries        int
+	EndpointWatchBackoff        time.Duration
+	EndpointDiscovery           string
+	AddressMode                 string
+	FairScheduling              bool
+	RollingUpgrade              bool
+	CacheWarmup                 CacheWarmup
+	NamespaceWeights            map[string]int
+	DisruptionBudget            bool
+	MaxBuildsPerPod             int
+	AnnotationDomain            string
+	FieldManager                string
+	EventRecorder               record.EventRecorder
+	LeaseOwnerExists            LeaseOwnerLookup
+	OrphanCheckInterval         time.Duration
 }
 
+// LeaseOwnerLookup reports whether the owner of a lease, as passed to Get, still exists.
+type LeaseOwnerLookup func(ctx context.Context, owner string) (bool, error)
+
+// CacheWarmup populates the build cache of a worker pod, as passed by name.
+type CacheWarmup func(ctx context.Context, podName string) error
+
 type PoolOption func(o Options) Options
 
 func SyncWaitTime(d time.Duration) PoolOption {
@@ -29,6 +61,15 @@ func SyncWaitTime(d time.Duration) PoolOption {
 	}
 }
 
+// StateLogInterval is how often the pool logs a summary of its workers, a summary is also logged when its scale
+// changes. Per-pod reconciliation details are only logged at verbosity 2.
+func StateLogInterval(d time.Duration) PoolOption {
+	return func(o Options) Options {
+		o.StateLogInterval = d
+		return o
+	}
+}
+
 func MaxIdleTime(d time.Duration) PoolOption {
 	return func(o Options) Options {
 		o.MaxIdleTime = d
@@ -36,6 +77,7 @@ func MaxIdleTime(d time.Duration) PoolOption {
 	}
 }
 
+// EndpointWatchTimeoutSeconds bounds the time spent waiting for the address of a new worker across all watch retries.
 func EndpointWatchTimeoutSeconds(s int64) PoolOption {
 	return func(o Options) Options {
 		o.EndpointWatchTimeoutSeconds = s
@@ -43,9 +85,112 @@ func EndpointWatchTimeoutSeconds(s int64) PoolOption {
 	}
 }
 
+// EndpointWatchRetries is how many fresh watches are started when a watch for the address of a new worker ends without
+// one, before its lease fails.
+func EndpointWatchRetries(n int) PoolOption {
+	return func(o Options) Options {
+		o.EndpointWatchRetries = n
+		return o
+	}
+}
+
+// EndpointWatchBackoff is the delay before the first endpoint watch retry, it doubles with every further retry.
+func EndpointWatchBackoff(d time.Duration) PoolOption {
+	return func(o Options) Options {
+		o.EndpointWatchBackoff = d
+		return o
+	}
+}
+
+// EndpointDiscovery selects the API worker addresses are resolved from, see EndpointDiscoveryAuto.
+func EndpointDiscovery(mode string) PoolOption {
+	return func(o Options) Options {
+		o.EndpointDiscovery = mode
+		return o
+	}
+}
+
+// AddressMode selects how leased workers are addressed, see AddressModePodIP.
+func AddressMode(mode string) PoolOption {
+	return func(o Options) Options {
+		o.AddressMode = mode
+		return o
+	}
+}
+
+// FairScheduling serves the queued lease requests of different namespaces in a weighted round robin instead of in
+// submission order. Namespaces without a weight have a weight of 1.
+func FairScheduling(weights map[string]int) PoolOption {
+	return func(o Options) Options {
+		o.FairScheduling = true
+		o.NamespaceWeights = weights
+		return o
+	}
+}
+
+// RollingUpgrade restarts the workers of an outdated statefulset revision one at a time once their lease finished.
+func RollingUpgrade(enabled bool) PoolOption {
+	return func(o Options) Options {
+		o.RollingUpgrade = enabled
+		return o
+	}
+}
+
+// WarmCaches warms the cache of every worker restarted by a rolling upgrade before it is leased again. Workers that
+// restart on a populated persistent cache are not warmed.
+func WarmCaches(fn CacheWarmup) PoolOption {
+	return func(o Options) Options {
+		o.CacheWarmup = fn
+		return o
+	}
+}
+
+func DisruptionBudget(enabled bool) PoolOption {
+	return func(o Options) Options {
+		o.DisruptionBudget = enabled
+		return o
+	}
+}
+
+func MaxBuildsPerPod(n int) PoolOption {
+	return func(o Options) Options {
+		o.MaxBuildsPerPod = n
+		return o
+	}
+}
+
+func AnnotationDomain(domain string) PoolOption {
+	return func(o Options) Options {
+		o.AnnotationDomain = domain
+		return o
+	}
+}
+
+func FieldManager(name string) PoolOption {
+	return func(o Options) Options {
+		o.FieldManager = name
+		return o
+	}
+}
+
 func Logger(log logr.Logger) PoolOption {
 	return func(o Options) Options {
 		o.Log = log
 		return o
 	}
 }
+
+// OrphanedLeases releases leases whose owner no longer exists, e.g. after an etcd restore dropped the ImageBuild.
+func OrphanedLeases(exists LeaseOwnerLookup) PoolOption {
+	return func(o Options) Options {
+		o.LeaseOwnerExists = exists
+		return o
+	}
+}
+
+func EventRecorder(r record.EventRecorder) PoolOption {
+	return func(o Options) Options {
+		o.EventRecorder = r
+		return o
+	}
+}
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -19,12 +20,36 @@ func TestPoolOptions(t *testing.T) {
 	opts = SyncWaitTime(10 * time.Minute)(opts)
 	assert.Equal(t, 10*time.Minute, opts.SyncWaitTime)
 
+	opts = StateLogInterval(time.Minute)(opts)
+	assert.Equal(t, time.Minute, opts.StateLogInterval)
+
 	opts = MaxIdleTime(30 * time.Minute)(opts)
 	assert.Equal(t, 30*time.Minute, opts.MaxIdleTime)
 
 	opts = EndpointWatchTimeoutSeconds(300)(opts)
 	assert.Equal(t, int64(300), opts.EndpointWatchTimeoutSeconds)
 
+	opts = EndpointWatchRetries(5)(opts)
+	assert.Equal(t, 5, opts.EndpointWatchRetries)
+
+	opts = EndpointWatchBackoff(time.Second)(opts)
+	assert.Equal(t, time.Second, opts.EndpointWatchBackoff)
+
+	opts = DisruptionBudget(true)(opts)
+	assert.True(t, opts.DisruptionBudget)
+
+	opts = MaxBuildsPerPod(25)(opts)
+	assert.Equal(t, 25, opts.MaxBuildsPerPod)
+
+	opts = AnnotationDomain("builds.acme.io")(opts)
+	assert.Equal(t, "builds.acme.io", opts.AnnotationDomain)
+
+	opts = FieldManager("acme")(opts)
+	assert.Equal(t, "acme", opts.FieldManager)
+
+	opts = OrphanedLeases(func(context.Context, string) (bool, error) { return true, nil })(opts)
+	assert.NotNil(t, opts.LeaseOwnerExists)
+
 	opts = Logger(logr.Discard())(opts)
 	assert.Equal(t, logr.Discard(), opts.Log)
 }
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dominodatalab/hephaestus/pkg/logger"
+)
+
+// QueueInspector is implemented by pools that can list the lease requests waiting for a worker.
+type QueueInspector interface {
+	QueuedRequests() []QueuedRequest
+}
+
+// QueueHandler serves the lease requests queued in every pool as a JSON object of pool names and requests, listed in
+// the order they are served. Requests must carry the bearer token read from tokenFile.
+func QueueHandler(tokenFile string, pools map[string]QueueInspector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !logger.Authorized(r, tokenFile) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		queues := make(map[string][]QueuedRequest, len(pools))
+		for name, pool := range pools {
+			queues[name] = append([]QueuedRequest{}, pool.QueuedRequests()...)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(queues)
+	})
+}
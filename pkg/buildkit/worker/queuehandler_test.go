@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueHandler(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0o600))
+
+	queue := NewFairRequestQueue(map[string]int{"bulk": 2})
+	queue.Enqueue(&PodRequest{owner: "bulk/build-1", queuedAt: time.Now().Add(-time.Hour)})
+	queue.Enqueue(&PodRequest{owner: "bulk/build-2"})
+	queue.Enqueue(&PodRequest{owner: "bulk/build-3"})
+	queue.Enqueue(&PodRequest{owner: "interactive/build-1", onDemandOnly: true, platforms: []string{"linux/arm64"}})
+
+	handler := QueueHandler(tokenFile, map[string]QueueInspector{
+		"default": &AutoscalingPool{requests: queue},
+		"arm64":   &AutoscalingPool{requests: NewRequestQueue()},
+	})
+	serve := func(method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/queue", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "s3cr3t").Code)
+
+	rec := serve(http.MethodGet, "s3cr3t")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var queues map[string][]QueuedRequest
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &queues))
+	assert.Empty(t, queues["arm64"])
+	assert.NotNil(t, queues["arm64"], "empty queues are listed")
+
+	var owners []string
+	for _, req := range queues["default"] {
+		owners = append(owners, req.Owner)
+	}
+	assert.Equal(t, []string{"bulk/build-1", "bulk/build-2", "interactive/build-1", "bulk/build-3"}, owners)
+	assert.Equal(t, "1h0m0s", queues["default"][0].Age)
+	assert.Equal(t, 2, queues["default"][0].Weight)
+	assert.Equal(t, QueuedRequest{
+		Owner:        "interactive/build-1",
+		QueuedAt:     queues["default"][2].QueuedAt,
+		Age:          queues["default"][2].Age,
+		Weight:       1,
+		OnDemandOnly: true,
+		Platforms:    []string{"linux/arm64"},
+	}, queues["default"][2])
+	assert.Equal(t, 4, queue.Len(), "listing leaves the queue untouched")
+}
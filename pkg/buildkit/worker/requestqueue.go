@@ -2,19 +2,74 @@ package worker
 
 import (
 	"container/list"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
 type RequestQueue interface {
 	Enqueue(r *PodRequest)
 	Dequeue() *PodRequest
+	DequeueMatching(match func(r *PodRequest) bool) *PodRequest
 	Len() int
+	CountMatching(match func(r *PodRequest) bool) int
 	Remove(r *PodRequest) bool
+	List(now time.Time) []QueuedRequest
 }
 
 type PodRequest struct {
-	owner  string
-	result chan PodRequestResult
+	owner        string
+	onDemandOnly bool
+	podName      string
+	platforms    []string
+	queuedAt     time.Time
+	result       chan PodRequestResult
+}
+
+// LeaseOption modifies the requirements of a single lease request.
+type LeaseOption func(r *PodRequest)
+
+// OnDemandOnly restricts a lease to workers that are not running on spot/preemptible nodes.
+func OnDemandOnly() LeaseOption {
+	return func(r *PodRequest) {
+		r.onDemandOnly = true
+	}
+}
+
+// PinnedTo leases the named worker pod directly instead of queueing for the next available worker. The lease fails
+// when the pod is not an operational, unleased member of the pool.
+func PinnedTo(podName string) LeaseOption {
+	return func(r *PodRequest) {
+		r.podName = podName
+	}
+}
+
+// Platforms the leased worker must support instead of the platforms configured on the pool. Workers only support
+// foreign platforms when QEMU binfmt handlers are installed on their node, leases fail with an error wrapping
+// buildkit.ErrNoMatchingWorker otherwise.
+func Platforms(specs ...string) LeaseOption {
+	return func(r *PodRequest) {
+		r.platforms = specs
+	}
+}
+
+// namespace of the owner, owners are "<namespace>/<name>" keys of the objects leasing workers
+func (r *PodRequest) namespace() string {
+	ns, _, _ := strings.Cut(r.owner, "/")
+	return ns
+}
+
+// QueuedRequest describes a lease request waiting for a worker.
+type QueuedRequest struct {
+	// Owner of the lease, the "<namespace>/<name>" key of the object leasing a worker.
+	Owner    string    `json:"owner"`
+	QueuedAt time.Time `json:"queuedAt"`
+	Age      string    `json:"age"`
+	// Weight of the owner namespace in fair queues, which is the number of requests served per turn.
+	Weight       int      `json:"weight,omitempty"`
+	OnDemandOnly bool     `json:"onDemandOnly,omitempty"`
+	Platforms    []string `json:"platforms,omitempty"`
 }
 
 type PodRequestResult struct {
@@ -22,20 +77,45 @@ type PodRequestResult struct {
 	err  error
 }
 
+// Queue of pod requests, which are served in submission order unless the queue is fair.
+//
+// Fair queues serve the namespaces of the request owners in a weighted round robin: every namespace with queued
+// requests takes a turn in the order the namespaces were first queued, and each turn serves as many requests as the
+// weight of the namespace. Requests of the same namespace are still served in submission order.
 type Queue struct {
 	mu  sync.Mutex
 	dll *list.List
+
+	// weighted round robin state of fair queues
+	fair       bool
+	weights    map[string]int
+	namespaces []string
+	turn       int
+	served     int
 }
 
 func NewRequestQueue() *Queue {
 	return &Queue{dll: list.New()}
 }
 
+// NewFairRequestQueue returns a fair queue, namespaces without a weight have a weight of 1.
+func NewFairRequestQueue(weights map[string]int) *Queue {
+	return &Queue{dll: list.New(), fair: true, weights: weights}
+}
+
 func (q *Queue) Enqueue(req *PodRequest) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	// requeued requests keep their place in line
+	if req.queuedAt.IsZero() {
+		req.queuedAt = time.Now()
+	}
 	q.dll.PushBack(req)
+
+	if ns := req.namespace(); q.fair && !slices.Contains(q.namespaces, ns) {
+		q.namespaces = append(q.namespaces, ns)
+	}
 }
 
 func (q *Queue) Remove(req *PodRequest) bool {
@@ -44,7 +124,7 @@ func (q *Queue) Remove(req *PodRequest) bool {
 
 	for el := q.dll.Front(); el != nil; el = el.Next() {
 		if el.Value == req {
-			q.dll.Remove(el)
+			q.remove(el)
 			return true
 		}
 	}
@@ -53,16 +133,58 @@ func (q *Queue) Remove(req *PodRequest) bool {
 }
 
 func (q *Queue) Dequeue() *PodRequest {
+	return q.DequeueMatching(func(*PodRequest) bool { return true })
+}
+
+// DequeueMatching removes and returns the first request accepted by match. Fair queues return the first accepted
+// request of the namespace whose turn it is, namespaces without accepted requests are skipped.
+func (q *Queue) DequeueMatching(match func(r *PodRequest) bool) *PodRequest {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	e := q.dll.Front()
-	if e == nil {
-		return nil
+	if !q.fair {
+		el := q.front(match)
+		if el == nil {
+			return nil
+		}
+
+		return q.remove(el)
+	}
+
+	for i := range q.namespaces {
+		idx := (q.turn + i) % len(q.namespaces)
+		ns := q.namespaces[idx]
+
+		el := q.front(func(r *PodRequest) bool { return r.namespace() == ns && match(r) })
+		if el == nil {
+			continue
+		}
+
+		if idx != q.turn {
+			q.turn, q.served = idx, 0
+		}
+		if q.served++; q.served >= q.weight(ns) {
+			q.turn, q.served = (idx+1)%len(q.namespaces), 0
+		}
+
+		return q.remove(el)
 	}
 
-	q.dll.Remove(e)
-	return e.Value.(*PodRequest)
+	return nil
+}
+
+// CountMatching returns the number of queued requests accepted by match.
+func (q *Queue) CountMatching(match func(r *PodRequest) bool) (count int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for el := q.dll.Front(); el != nil; el = el.Next() {
+		if match(el.Value.(*PodRequest)) {
+			count++
+		}
+	}
+
+	return count
 }
 
 func (q *Queue) Len() int {
@@ -71,3 +193,84 @@ func (q *Queue) Len() int {
 
 	return q.dll.Len()
 }
+
+// List returns the queued requests in the order they are served when every available worker meets their requirements.
+func (q *Queue) List(now time.Time) []QueuedRequest {
+	q.mu.Lock()
+	next := &Queue{
+		dll:        list.New(),
+		fair:       q.fair,
+		weights:    q.weights,
+		namespaces: slices.Clone(q.namespaces),
+		turn:       q.turn,
+		served:     q.served,
+	}
+	for el := q.dll.Front(); el != nil; el = el.Next() {
+		next.dll.PushBack(el.Value)
+	}
+	q.mu.Unlock()
+
+	var requests []QueuedRequest
+	for req := next.Dequeue(); req != nil; req = next.Dequeue() {
+		queued := QueuedRequest{
+			Owner:        req.owner,
+			QueuedAt:     req.queuedAt,
+			Age:          now.Sub(req.queuedAt).Truncate(time.Second).String(),
+			OnDemandOnly: req.onDemandOnly,
+			Platforms:    req.platforms,
+		}
+		if q.fair {
+			queued.Weight = q.weight(req.namespace())
+		}
+		requests = append(requests, queued)
+	}
+
+	return requests
+}
+
+// returns the first element accepted by match, the caller must hold the lock
+func (q *Queue) front(match func(r *PodRequest) bool) *list.Element {
+	for el := q.dll.Front(); el != nil; el = el.Next() {
+		if match(el.Value.(*PodRequest)) {
+			return el
+		}
+	}
+
+	return nil
+}
+
+// removes the element and drops its namespace from the round robin once it has no queued requests, the caller must
+// hold the lock
+func (q *Queue) remove(el *list.Element) *PodRequest {
+	req := q.dll.Remove(el).(*PodRequest)
+	if !q.fair {
+		return req
+	}
+
+	ns := req.namespace()
+	if q.front(func(r *PodRequest) bool { return r.namespace() == ns }) != nil {
+		return req
+	}
+
+	idx := slices.Index(q.namespaces, ns)
+	q.namespaces = slices.Delete(q.namespaces, idx, idx+1)
+	switch {
+	case idx < q.turn:
+		q.turn--
+	case idx == q.turn:
+		q.served = 0
+	}
+	if q.turn >= len(q.namespaces) {
+		q.turn = 0
+	}
+
+	return req
+}
+
+func (q *Queue) weight(ns string) int {
+	if w := q.weights[ns]; w > 0 {
+		return w
+	}
+
+	return 1
+}
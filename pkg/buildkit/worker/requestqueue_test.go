@@ -27,3 +27,67 @@ func TestRequestQueue(t *testing.T) {
 	assert.True(t, queue.Remove(req1))
 	assert.Equal(t, 0, queue.Len())
 }
+
+func TestRequestQueueMatching(t *testing.T) {
+	onDemand := &PodRequest{}
+	OnDemandOnly()(onDemand)
+	flexible := &PodRequest{}
+
+	isFlexible := func(r *PodRequest) bool { return !r.onDemandOnly }
+
+	queue := NewRequestQueue()
+	assert.Nil(t, queue.DequeueMatching(isFlexible))
+
+	queue.Enqueue(onDemand)
+	queue.Enqueue(flexible)
+	assert.Equal(t, 1, queue.CountMatching(isFlexible))
+	assert.Equal(t, flexible, queue.DequeueMatching(isFlexible))
+	assert.Nil(t, queue.DequeueMatching(isFlexible))
+	assert.Equal(t, 0, queue.CountMatching(isFlexible))
+	assert.Equal(t, onDemand, queue.Dequeue())
+}
+
+func TestFairRequestQueue(t *testing.T) {
+	bulk1 := &PodRequest{owner: "bulk/build-1"}
+	bulk2 := &PodRequest{owner: "bulk/build-2"}
+	bulk3 := &PodRequest{owner: "bulk/build-3"}
+	bulk4 := &PodRequest{owner: "bulk/build-4"}
+	interactive := &PodRequest{owner: "interactive/build-1"}
+	other := &PodRequest{owner: "other/build-1"}
+
+	queue := NewFairRequestQueue(map[string]int{"bulk": 2})
+	for _, req := range []*PodRequest{bulk1, bulk2, bulk3, bulk4, interactive, other} {
+		queue.Enqueue(req)
+	}
+
+	var served []*PodRequest
+	for req := queue.Dequeue(); req != nil; req = queue.Dequeue() {
+		served = append(served, req)
+	}
+	assert.Equal(t, []*PodRequest{bulk1, bulk2, interactive, other, bulk3, bulk4}, served)
+	assert.Equal(t, 0, queue.Len())
+}
+
+func TestFairRequestQueueMatching(t *testing.T) {
+	bulk1 := &PodRequest{owner: "bulk/build-1"}
+	bulk2 := &PodRequest{owner: "bulk/build-2"}
+	onDemand := &PodRequest{owner: "interactive/build-1", onDemandOnly: true}
+	interactive := &PodRequest{owner: "interactive/build-2"}
+
+	isFlexible := func(r *PodRequest) bool { return !r.onDemandOnly }
+
+	queue := NewFairRequestQueue(nil)
+	for _, req := range []*PodRequest{bulk1, bulk2, onDemand, interactive} {
+		queue.Enqueue(req)
+	}
+
+	assert.Equal(t, bulk1, queue.DequeueMatching(isFlexible))
+	assert.Equal(t, interactive, queue.DequeueMatching(isFlexible), "unmatched requests do not block their namespace")
+	assert.Equal(t, bulk2, queue.Dequeue())
+
+	assert.True(t, queue.Remove(onDemand))
+	assert.Nil(t, queue.Dequeue())
+
+	queue.Enqueue(bulk1)
+	assert.Equal(t, bulk1, queue.Dequeue(), "namespaces rejoin the round robin")
+}
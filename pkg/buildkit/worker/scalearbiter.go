@@ -3,6 +3,7 @@ package worker
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -33,6 +34,10 @@ const (
 	BuilderStateOperationalExpired
 	// BuilderStateOperationalInvalidExpiry indicates an operational pod has bad expiry data in its annotations.
 	BuilderStateOperationalInvalidExpiry
+	// BuilderStateUpgrading indicates an unleased pod is cordoned so that it can be restarted with a new revision.
+	BuilderStateUpgrading
+	// BuilderStateWarming indicates a pod restarted by a rolling upgrade is cordoned until its cache is warmed.
+	BuilderStateWarming
 	// BuilderStateUnusable indicates a pod has an unknown phase or set of conditions.
 	BuilderStateUnusable
 )
@@ -49,6 +54,8 @@ func (bs BuilderState) String() string {
 		"Operational",
 		"OperationalExpired",
 		"OperationalInvalidExpiry",
+		"Upgrading",
+		"Warming",
 		"Unusable",
 	}[bs]
 }
@@ -57,6 +64,8 @@ func (bs BuilderState) String() string {
 type PodObservation struct {
 	Pod   corev1.Pod
 	State BuilderState
+	// Spot indicates the pod is running on a spot/preemptible node.
+	Spot bool
 }
 
 // MarkLeased should be invoked whenever the caller leases a pod that has been previously evaluated.
@@ -75,15 +84,22 @@ type ScaleArbiter struct {
 	log          logr.Logger
 	podClient    corev1typed.PodInterface
 	podExpiry    time.Duration
+	keys         metadataKeys
 	observations []*PodObservation
 }
 
 // NewScaleArbiter initializes
-func NewScaleArbiter(log logr.Logger, podClient corev1typed.PodInterface, podExpiry time.Duration) *ScaleArbiter {
+func NewScaleArbiter(
+	log logr.Logger,
+	podClient corev1typed.PodInterface,
+	podExpiry time.Duration,
+	keys metadataKeys,
+) *ScaleArbiter {
 	return &ScaleArbiter{
 		log:       log,
 		podClient: podClient,
 		podExpiry: podExpiry,
+		keys:      keys,
 	}
 }
 
@@ -92,28 +108,44 @@ func (a *ScaleArbiter) EvaluatePod(ctx context.Context, uuid string, pod corev1.
 	log := a.log.WithValues("podName", pod.Name)
 
 	// mark pods when their manager ID is different from the current one
-	if id, ok := pod.Annotations[managerIDAnnotation]; ok && id != uuid {
-		log.Info("Eligible for termination, manager id mismatch", "expected", uuid, "actual", id)
+	if id, ok := pod.Annotations[a.keys.managerID]; ok && id != uuid {
+		log.V(2).Info("Eligible for termination, manager id mismatch", "expected", uuid, "actual", id)
 		a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStateUnmanaged})
 
 		return
 	}
 
 	// mark leased pods to safeguard them from multi-leasing and termination
-	if _, hasLease := pod.Annotations[leasedByAnnotation]; hasLease {
-		log.Info("Ineligible for termination, pod is leased")
+	if _, hasLease := pod.Annotations[a.keys.leasedBy]; hasLease {
+		log.V(2).Info("Ineligible for termination, pod is leased")
 		a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStateLeased})
 
 		return
 	}
 
+	// mark pods cordoned by a rolling upgrade, they are never leased again and keep their slot until restarted
+	if _, upgrading := pod.Annotations[a.keys.upgrading]; upgrading {
+		log.V(2).Info("Ineligible for leasing, pod is cordoned for an upgrade")
+		a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStateUpgrading})
+
+		return
+	}
+
+	// mark restarted pods whose cache is being warmed, they are leased once warmed
+	if _, warming := pod.Annotations[a.keys.warming]; warming {
+		log.V(2).Info("Ineligible for leasing, cache of restarted pod is being warmed")
+		a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStateWarming})
+
+		return
+	}
+
 	// mark pending pods and observe if their ttl has expired
 	if pod.Status.Phase == corev1.PodPending {
 		if time.Since(pod.CreationTimestamp.Time) < a.podExpiry {
-			log.Info("Ineligible for termination, pending pod is not old enough")
+			log.V(2).Info("Ineligible for termination, pending pod is not old enough")
 			a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStatePending})
 		} else {
-			log.Info("Eligible for termination, pending pod is older than max idle time")
+			log.V(2).Info("Eligible for termination, pending pod is older than max idle time")
 			a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStatePendingExpired})
 		}
 
@@ -122,21 +154,21 @@ func (a *ScaleArbiter) EvaluatePod(ctx context.Context, uuid string, pod corev1.
 
 	// mark operational pods to service build requests and observe if their ttl is invalid or has expired
 	if a.isOperationalPod(ctx, log, pod.Name) {
-		log.Info("Pod is operational")
+		log.V(2).Info("Pod is operational")
 		pm := &PodObservation{Pod: pod, State: BuilderStateOperational}
 
-		if ts, ok := pod.Annotations[expiryTimeAnnotation]; ok {
+		if ts, ok := pod.Annotations[a.keys.expiryTime]; ok {
 			expiry, err := time.Parse(time.RFC3339, ts)
 
 			if err != nil {
-				log.Info("Cannot parse expiry time, assuming expired", "expiry", expiry)
+				log.V(2).Info("Cannot parse expiry time, assuming expired", "expiry", expiry)
 				pm.State = BuilderStateOperationalInvalidExpiry
 			} else if time.Now().After(expiry) {
-				log.Info("Eligible for termination, ttl has expired", "expiry", expiry)
+				log.V(2).Info("Eligible for termination, ttl has expired", "expiry", expiry)
 				pm.State = BuilderStateOperationalExpired
 			}
 		} else if time.Since(pod.CreationTimestamp.Time) > a.podExpiry {
-			log.Info("Eligible for termination, missing expiry time and pod age older than max idle time")
+			log.V(2).Info("Eligible for termination, missing expiry time and pod age older than max idle time")
 			pm.State = BuilderStateOperationalExpired
 		}
 		a.observations = append(a.observations, pm)
@@ -147,10 +179,10 @@ func (a *ScaleArbiter) EvaluatePod(ctx context.Context, uuid string, pod corev1.
 	// mark pods that are in the process of starting up and observe if their ttl has expired
 	if pod.Status.Phase == corev1.PodRunning {
 		if time.Since(pod.CreationTimestamp.Time) < a.podExpiry {
-			log.Info("Ineligible for termination, starting pod is not old enough")
+			log.V(2).Info("Ineligible for termination, starting pod is not old enough")
 			a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStateStarting})
 		} else {
-			log.Info("Eligible for termination, starting pod is older than max idle time")
+			log.V(2).Info("Eligible for termination, starting pod is older than max idle time")
 			a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStateStartingExpired})
 		}
 
@@ -158,7 +190,7 @@ func (a *ScaleArbiter) EvaluatePod(ctx context.Context, uuid string, pod corev1.
 	}
 
 	// mark abnormal pods as unusable
-	log.Info(
+	log.V(2).Info(
 		"Eligible for termination, unknown phase or incomplete startup detected",
 		"phase", pod.Status.Phase,
 		"conditions", pod.Status.Conditions,
@@ -167,7 +199,16 @@ func (a *ScaleArbiter) EvaluatePod(ctx context.Context, uuid string, pod corev1.
 	a.observations = append(a.observations, &PodObservation{Pod: pod, State: BuilderStateUnusable})
 }
 
+// MarkSpot records which of the observed pods run on spot/preemptible nodes.
+func (a *ScaleArbiter) MarkSpot(isSpot func(pod corev1.Pod) bool) {
+	for _, o := range a.observations {
+		o.Spot = isSpot(o.Pod)
+	}
+}
+
 // LeasablePods returns a list of pods that are ready to build images.
+//
+// Pods with a more populated persistent cache come first.
 func (a *ScaleArbiter) LeasablePods() (observations []*PodObservation) {
 	for _, o := range a.observations {
 		switch o.State {
@@ -176,11 +217,30 @@ func (a *ScaleArbiter) LeasablePods() (observations []*PodObservation) {
 		}
 	}
 
+	sort.SliceStable(observations, func(i, j int) bool {
+		return a.keys.cacheGeneration(observations[i].Pod.Annotations) >
+			a.keys.cacheGeneration(observations[j].Pod.Annotations)
+	})
+
 	return
 }
 
+// StateCounts returns the number of observed pods in every builder state.
+func (a *ScaleArbiter) StateCounts() map[BuilderState]int {
+	counts := map[BuilderState]int{}
+	for _, o := range a.observations {
+		counts[o.State]++
+	}
+
+	return counts
+}
+
 // DetermineReplicas calculates the number of buildkit replicas required to service the incoming requests.
-func (a *ScaleArbiter) DetermineReplicas(requests int) int {
+//
+// Spot pods cannot service on-demand only requests, which are a subset of the total requests. Pods that are not
+// scheduled yet are counted as on-demand capacity, when one lands on a spot node the next reconciliation scales up for
+// the on-demand only requests it cannot serve.
+func (a *ScaleArbiter) DetermineReplicas(requests, onDemandRequests int) int {
 	count := 0
 	hasInvalidPods := false
 
@@ -189,12 +249,20 @@ func (a *ScaleArbiter) DetermineReplicas(requests int) int {
 		output = append(output, observation.String())
 
 		switch observation.State {
-		case BuilderStateLeased:
+		case BuilderStateLeased, BuilderStateUpgrading, BuilderStateWarming:
 			count = idx + 1
 		case BuilderStatePending, BuilderStateStarting, BuilderStateOperational:
 			count = idx + 1
-			if requests > 0 {
+			switch {
+			case observation.Spot:
+				if requests > onDemandRequests {
+					requests--
+				}
+			case requests > 0:
 				requests--
+				if onDemandRequests > 0 {
+					onDemandRequests--
+				}
 			}
 		default:
 			hasInvalidPods = true
@@ -213,7 +281,7 @@ func (a *ScaleArbiter) DetermineReplicas(requests int) int {
 		desiredReplicas = count + requests
 	}
 
-	a.log.Info(
+	a.log.V(1).Info(
 		"Pod scale determination complete",
 		"requests", requests,
 		"podObservations", output,
@@ -232,6 +300,11 @@ func (a *ScaleArbiter) isOperationalPod(ctx context.Context, log logr.Logger, po
 		return false
 	}
 
+	return podOperational(pod)
+}
+
+// reports whether a pod is running and ready to serve builds
+func podOperational(pod *corev1.Pod) bool {
 	// this does not mean the pod is usable but is a good sanity check
 	if pod.Status.Phase != corev1.PodRunning {
 		return false
@@ -0,0 +1,156 @@
+// Package client provides helpers over the generated clientset for programmatic ImageBuild consumers.
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/clientset"
+)
+
+// Client wraps the generated clientset with helpers that wait for and follow ImageBuilds.
+type Client struct {
+	clientset.Interface
+}
+
+// New returns a Client backed by the clientset.
+func New(cs clientset.Interface) *Client {
+	return &Client{Interface: cs}
+}
+
+// NewForConfig returns a Client for the cluster described by the config.
+func NewForConfig(config *rest.Config) (*Client, error) {
+	cs, err := clientset.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(cs), nil
+}
+
+// IsFinished reports whether the ImageBuild has reached a terminal phase.
+func IsFinished(ib *hephv1.ImageBuild) bool {
+	return ib.Status.Phase == hephv1.PhaseSucceeded || ib.Status.Phase == hephv1.PhaseFailed
+}
+
+// CreateAndWait creates the ImageBuild and waits for it to finish. See WaitForCompletion.
+func (c *Client) CreateAndWait(
+	ctx context.Context,
+	ib *hephv1.ImageBuild,
+	timeout time.Duration,
+) (*hephv1.ImageBuild, error) {
+	created, err := c.HephaestusV1().ImageBuilds(ib.Namespace).Create(ctx, ib, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create image build: %w", err)
+	}
+
+	return c.WaitForCompletion(ctx, types.NamespacedName{Namespace: created.Namespace, Name: created.Name}, timeout)
+}
+
+// WaitForCompletion blocks until the ImageBuild succeeds or fails and returns its final state. No timeout is applied
+// when it is zero.
+//
+// An error is only returned when the build cannot be observed or does not finish in time, callers must inspect the
+// phase of the returned build to determine whether it succeeded.
+func (c *Client) WaitForCompletion(
+	ctx context.Context,
+	key types.NamespacedName,
+	timeout time.Duration,
+) (*hephv1.ImageBuild, error) {
+	ctx, cancel := watchtools.ContextWithOptionalTimeout(ctx, timeout)
+	defer cancel()
+
+	var result *hephv1.ImageBuild
+	err := c.until(ctx, key, func(ib *hephv1.ImageBuild) bool {
+		result = ib
+		return IsFinished(ib)
+	})
+	if err != nil {
+		return result, fmt.Errorf("image build %s did not finish: %w", key, err)
+	}
+
+	return result, nil
+}
+
+// StreamTransitions sends every phase transition of the ImageBuild, including those that happened before it was
+// called, on the returned channel. Transitions pruned from the status before they were observed are not sent. The
+// channel is closed once the build finishes or the context is done.
+func (c *Client) StreamTransitions(
+	ctx context.Context,
+	key types.NamespacedName,
+) (<-chan hephv1.ImageBuildTransition, error) {
+	// fail fast when the build cannot be read instead of handing back a channel that never receives
+	if _, err := c.HephaestusV1().ImageBuilds(key.Namespace).Get(ctx, key.Name, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan hephv1.ImageBuildTransition)
+	go func() {
+		defer close(ch)
+
+		// sent counts every transition of the build, including those pruned from its status
+		var sent int
+		_ = c.until(ctx, key, func(ib *hephv1.ImageBuild) bool {
+			pruned := ib.Status.PrunedTransitions
+			for i := max(sent-pruned, 0); i < len(ib.Status.Transitions); i++ {
+				select {
+				case ch <- ib.Status.Transitions[i]:
+				case <-ctx.Done():
+					return true
+				}
+				sent = pruned + i + 1
+			}
+
+			return IsFinished(ib)
+		})
+	}()
+
+	return ch, nil
+}
+
+// until invokes the condition with the latest state of the ImageBuild until it returns true. Watches that are closed
+// by the API server are transparently re-established.
+func (c *Client) until(ctx context.Context, key types.NamespacedName, condition func(*hephv1.ImageBuild) bool) error {
+	ibClient := c.HephaestusV1().ImageBuilds(key.Namespace)
+	selector := fields.OneTermEqualSelector("metadata.name", key.Name).String()
+
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.FieldSelector = selector
+			return ibClient.List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return ibClient.Watch(ctx, opts)
+		},
+	}
+
+	_, err := watchtools.UntilWithSync(ctx, lw, &hephv1.ImageBuild{}, nil, func(event watch.Event) (bool, error) {
+		switch event.Type {
+		case watch.Deleted:
+			return false, fmt.Errorf("image build %s was deleted", key)
+		case watch.Added, watch.Modified:
+			ib, ok := event.Object.(*hephv1.ImageBuild)
+			if !ok {
+				return false, fmt.Errorf("unexpected object %T", event.Object)
+			}
+
+			return condition(ib), nil
+		}
+
+		return false, nil
+	})
+
+	return err
+}
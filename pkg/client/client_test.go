@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/clientset/fake"
+)
+
+var key = types.NamespacedName{Namespace: "ns", Name: "build"}
+
+func newBuild() *hephv1.ImageBuild {
+	return &hephv1.ImageBuild{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+}
+
+// watched returns a clientset and a channel closed once the first ImageBuild watch is established. The fake clientset
+// cannot resume watches from a resource version, so updates must not be made before a watch exists.
+func watched(objects ...runtime.Object) (*fake.Clientset, <-chan struct{}) {
+	cs := fake.NewSimpleClientset(objects...)
+	ch := make(chan struct{})
+
+	var once sync.Once
+	cs.PrependWatchReactor("imagebuilds", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := cs.Tracker().Watch(hephv1.SchemeGroupVersion.WithResource("imagebuilds"), action.GetNamespace())
+		once.Do(func() { close(ch) })
+		return true, w, err
+	})
+
+	return cs, ch
+}
+
+// transition simulates the controller moving the build through the phases.
+func transition(t *testing.T, c *Client, phases ...hephv1.Phase) {
+	t.Helper()
+
+	ibClient := c.HephaestusV1().ImageBuilds(key.Namespace)
+	for _, p := range phases {
+		ib, err := ibClient.Get(context.Background(), key.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+
+		ib.Status.Transitions = append(ib.Status.Transitions, hephv1.ImageBuildTransition{
+			PreviousPhase: ib.Status.Phase,
+			Phase:         p,
+		})
+		ib.Status.Phase = p
+
+		_, err = ibClient.UpdateStatus(context.Background(), ib, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+}
+
+func TestCreateAndWait(t *testing.T) {
+	cs, watching := watched()
+	c := New(cs)
+
+	go func() {
+		<-watching
+		transition(t, c, hephv1.PhaseInitializing, hephv1.PhaseRunning, hephv1.PhaseSucceeded)
+	}()
+
+	ib, err := c.CreateAndWait(context.Background(), newBuild(), 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, hephv1.PhaseSucceeded, ib.Status.Phase)
+}
+
+func TestWaitForCompletion(t *testing.T) {
+	t.Run("already_finished", func(t *testing.T) {
+		ib := newBuild()
+		ib.Status.Phase = hephv1.PhaseFailed
+		c := New(fake.NewSimpleClientset(ib))
+
+		result, err := c.WaitForCompletion(context.Background(), key, time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, hephv1.PhaseFailed, result.Status.Phase)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		c := New(fake.NewSimpleClientset(newBuild()))
+
+		_, err := c.WaitForCompletion(context.Background(), key, 50*time.Millisecond)
+		assert.Error(t, err)
+	})
+}
+
+func TestStreamTransitions(t *testing.T) {
+	cs, watching := watched(newBuild())
+	c := New(cs)
+	transition(t, c, hephv1.PhaseInitializing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ch, err := c.StreamTransitions(ctx, key)
+	require.NoError(t, err)
+
+	go func() {
+		<-watching
+		transition(t, c, hephv1.PhaseRunning, hephv1.PhaseSucceeded)
+	}()
+
+	var phases []hephv1.Phase
+	for tr := range ch {
+		phases = append(phases, tr.Phase)
+	}
+	assert.Equal(t, []hephv1.Phase{hephv1.PhaseInitializing, hephv1.PhaseRunning, hephv1.PhaseSucceeded}, phases)
+
+	_, err = c.StreamTransitions(context.Background(), types.NamespacedName{Namespace: "ns", Name: "missing"})
+	assert.Error(t, err)
+}
+
+func TestStreamTransitionsPruned(t *testing.T) {
+	cs, watching := watched(newBuild())
+	c := New(cs)
+	transition(t, c, hephv1.PhaseInitializing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ch, err := c.StreamTransitions(ctx, key)
+	require.NoError(t, err)
+
+	go func() {
+		<-watching
+		transition(t, c, hephv1.PhaseRunning, hephv1.PhaseSucceeded)
+	}()
+
+	var phases []hephv1.Phase
+	for tr := range ch {
+		phases = append(phases, tr.Phase)
+		if tr.Phase == hephv1.PhaseInitializing {
+			// the controller prunes the initializing transition once the build is running
+			ibClient := cs.HephaestusV1().ImageBuilds(key.Namespace)
+			require.Eventually(t, func() bool {
+				ib, err := ibClient.Get(ctx, key.Name, metav1.GetOptions{})
+				require.NoError(t, err)
+				if len(ib.Status.Transitions) < 2 {
+					return false
+				}
+				ib.PruneTransitions(len(ib.Status.Transitions) - 1)
+				_, err = ibClient.UpdateStatus(ctx, ib, metav1.UpdateOptions{})
+				return err == nil
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+	}
+	assert.Equal(t, []hephv1.Phase{hephv1.PhaseInitializing, hephv1.PhaseRunning, hephv1.PhaseSucceeded}, phases)
+}
@@ -12,6 +12,10 @@ type FakeHephaestusV1 struct {
 	*testing.Fake
 }
 
+func (c *FakeHephaestusV1) ClusterImageCaches() v1.ClusterImageCacheInterface {
+	return &FakeClusterImageCaches{c}
+}
+
 func (c *FakeHephaestusV1) ImageBuilds(namespace string) v1.ImageBuildInterface {
 	return &FakeImageBuilds{c, namespace}
 }
@@ -2,6 +2,8 @@
 
 package v1
 
+type ClusterImageCacheExpansion interface{}
+
 type ImageBuildExpansion interface{}
 
 type ImageCacheExpansion interface{}
@@ -12,6 +12,7 @@ import (
 
 type HephaestusV1Interface interface {
 	RESTClient() rest.Interface
+	ClusterImageCachesGetter
 	ImageBuildsGetter
 	ImageCachesGetter
 }
@@ -21,6 +22,10 @@ type HephaestusV1Client struct {
 	restClient rest.Interface
 }
 
+func (c *HephaestusV1Client) ClusterImageCaches() ClusterImageCacheInterface {
+	return newClusterImageCaches(c)
+}
+
 func (c *HephaestusV1Client) ImageBuilds(namespace string) ImageBuildInterface {
 	return newImageBuilds(c, namespace)
 }
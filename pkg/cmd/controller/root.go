@@ -2,13 +2,19 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 	"github.com/dominodatalab/hephaestus/pkg/config"
 	"github.com/dominodatalab/hephaestus/pkg/controller"
 	"github.com/dominodatalab/hephaestus/pkg/crd"
+	"github.com/dominodatalab/hephaestus/pkg/istio"
 )
 
 var Version = "dev"
@@ -24,10 +30,13 @@ func NewCommand() *cobra.Command {
 		"hephaestus.yaml", "configuration file")
 	cmd.PersistentFlags().StringVarP(&config.CompressionMethod,
 		"compression", "d", "gzip", "Compression method options: zstd,estargz")
+	cmd.PersistentFlags().Bool("istio-sidecar", false,
+		"wait for an injected istio sidecar before running and stop it on exit")
 	cmd.AddCommand(
 		newStartCommand(),
 		newCRDApplyCommand(),
 		newCRDDeleteCommand(),
+		newSelfTestCommand(),
 		versionCommand(),
 	)
 
@@ -65,12 +74,14 @@ func newStartCommand() *cobra.Command {
 				return err
 			}
 
-			return controller.Start(cfg)
+			return withSidecar(cmd, func() error { return controller.Start(cfg) })
 		},
 	}
 }
 
 func newCRDApplyCommand() *cobra.Command {
+	var customJSON string
+
 	cmd := &cobra.Command{
 		Use:   "crd-apply",
 		Short: "Apply custom resource definitions to a cluster",
@@ -79,11 +90,25 @@ func newCRDApplyCommand() *cobra.Command {
 Apply Rules:
   - When a definition is missing, it will be created
   - If a definition is already present, then it will be updated
-  - Updating definitions that have not changed results in a no-op`,
-		RunE: func(_ *cobra.Command, _ []string) error {
-			return crd.Apply(context.Background())
+  - Updating definitions that have not changed results in a no-op
+
+Categories, short names and printer columns can be added to the definitions
+with a JSON customization, e.g.
+
+  {"categories": ["hephaestus"], "shortNames": {"imagebuilds": ["ibuild"]}}`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var custom crd.Customization
+			if customJSON != "" {
+				if err := json.Unmarshal([]byte(customJSON), &custom); err != nil {
+					return fmt.Errorf("invalid customizations: %w", err)
+				}
+			}
+
+			return withSidecar(cmd, func() error { return crd.Apply(context.Background(), custom) })
 		},
 	}
+	cmd.Flags().StringVar(&customJSON, "customizations", "",
+		"JSON document with categories, short names and printer columns added to the definitions")
 
 	return cmd
 }
@@ -96,10 +121,86 @@ func newCRDDeleteCommand() *cobra.Command {
 
 Any running builds will be decommissioned when this operation runs. This will
 only attempt to remove definitions that are already present in Kubernetes.`,
-		RunE: func(_ *cobra.Command, _ []string) error {
-			return crd.Delete(context.Background())
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return withSidecar(cmd, func() error { return crd.Delete(context.Background()) })
 		},
 	}
 
 	return cmd
 }
+
+func newSelfTestCommand() *cobra.Command {
+	var (
+		opts           controller.SelfTestOptions
+		registrySecret string
+		timeout        time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "selftest",
+		Short: "Build and push a test image through the running controller",
+		Long: `Submit an ImageBuild of a tiny "FROM scratch" image that is pushed to the
+test registry as "<registry>/hephaestus-selftest:<timestamp>", wait for it to
+finish and delete it.
+
+The build is dispatched by the running controller, so the command fails when
+the build is rejected, fails or does not finish in time. It can be used as a
+smoke test after installs and upgrades. Registry credentials are read from a
+docker config secret in the namespace of the build.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfgFile, err := cmd.Flags().GetString("config")
+			if err != nil {
+				return err
+			}
+
+			cfg, err := config.LoadFromFile(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			if err = cfg.Validate(); err != nil {
+				return err
+			}
+
+			if opts.Namespace == "" {
+				opts.Namespace = cfg.Buildkit.Namespace
+			}
+			if registrySecret != "" {
+				opts.RegistrySecret = &hephv1.SecretCredentials{Name: registrySecret, Namespace: opts.Namespace}
+			}
+
+			ctrl.SetLogger(ctrlzap.New())
+
+			return withSidecar(cmd, func() error {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+
+				return controller.SelfTest(ctx, cfg, opts)
+			})
+		},
+	}
+	cmd.Flags().StringVar(&opts.Registry, "registry", "",
+		`registry and optional path the test image is pushed to, e.g. "registry.example.com/hephaestus"`)
+	cmd.Flags().StringVar(&registrySecret, "registry-secret", "",
+		"docker config secret in the namespace of the build with the registry credentials")
+	cmd.Flags().StringVar(&opts.Namespace, "namespace", "",
+		"namespace watched by the controller the test build is created in, defaults to the buildkit namespace")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "time limit for the whole test")
+	_ = cmd.MarkFlagRequired("registry")
+
+	return cmd
+}
+
+// withSidecar runs fn within the lifecycle of an injected istio sidecar when the "istio-sidecar" flag is set.
+func withSidecar(cmd *cobra.Command, fn func() error) error {
+	enabled, err := cmd.Flags().GetBool("istio-sidecar")
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return fn()
+	}
+
+	log := ctrlzap.New(ctrlzap.UseDevMode(true)).WithName("istio")
+	return istio.RunWithSidecar(context.Background(), log, fn)
+}
@@ -0,0 +1,71 @@
+package loadgen
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	hephclient "github.com/dominodatalab/hephaestus/pkg/client"
+	"github.com/dominodatalab/hephaestus/pkg/loadgen"
+)
+
+func NewCommand() *cobra.Command {
+	var cfg loadgen.Config
+
+	cmd := &cobra.Command{
+		Use:   "hephaestus-loadgen",
+		Short: "Submit synthetic image builds and report worker pool lease latency and scale",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			restCfg, err := ctrl.GetConfig()
+			if err != nil {
+				return err
+			}
+
+			hc, err := hephclient.NewForConfig(restCfg)
+			if err != nil {
+				return err
+			}
+
+			kc, err := kubernetes.NewForConfig(restCfg)
+			if err != nil {
+				return err
+			}
+
+			log := ctrlzap.New(ctrlzap.UseDevMode(true)).WithName("loadgen")
+			report, err := loadgen.Run(ctx, log, cfg, hc, kc)
+			if report != nil {
+				if wErr := report.Write(cmd.OutOrStdout()); wErr != nil {
+					return wErr
+				}
+			}
+
+			return err
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&cfg.Namespace, "namespace", "default", "namespace where image builds are created")
+	flags.StringVar(&cfg.Repository, "repository", "docker-registry:5000/loadgen",
+		"repository the synthetic images are pushed to")
+	flags.IntVar(&cfg.Builds, "builds", 10, "total number of image builds to submit")
+	flags.IntVar(&cfg.Concurrency, "concurrency", 5, "maximum number of unfinished image builds")
+	flags.DurationVar(&cfg.Interval, "interval", time.Second, "delay between submissions")
+	flags.IntVar(&cfg.Layers, "layers", 3, "number of layers in each synthetic image")
+	flags.IntVar(&cfg.LayerSizeKB, "layer-size-kb", 1024, "kilobytes of random data written into each layer")
+	flags.DurationVar(&cfg.Timeout, "timeout", 30*time.Minute, "time limit for a single build to finish")
+	flags.StringVar(&cfg.StatefulSetName, "statefulset", "hephaestus-buildkit",
+		"buildkit statefulset whose scale is sampled, disabled when blank")
+	flags.StringVar(&cfg.StatefulSetNamespace, "statefulset-namespace", "default", "namespace of the buildkit statefulset")
+	flags.DurationVar(&cfg.SampleInterval, "sample-interval", 5*time.Second, "delay between worker scale samples")
+
+	return cmd
+}
@@ -4,20 +4,103 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
 
+	"github.com/containerd/containerd/filters"
+	"github.com/containerd/platforms"
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
 	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 )
 
 var CompressionMethod string
 
+// minMessagingTransitions is the smallest transition history that still holds every phase of a build.
+const minMessagingTransitions = 3
+
 type ImageBuild struct {
-	Concurrency  int `json:"concurrency" yaml:"concurrency"`
-	HistoryLimit int `json:"historyLimit" yaml:"historyLimit"`
+	Concurrency     int              `json:"concurrency" yaml:"concurrency"`
+	HistoryLimit    int              `json:"historyLimit" yaml:"historyLimit"`
+	TransitionHooks []TransitionHook `json:"transitionHooks,omitempty" yaml:"transitionHooks,omitempty"`
+	// ValidateSecrets enables best-effort admission checks of referenced secrets.
+	ValidateSecrets bool `json:"validateSecrets" yaml:"validateSecrets"`
+	// RedispatchInterrupted restarts builds that were running when the controller restarted instead of failing them.
+	// Builds whose images were already pushed are marked as succeeded without being rebuilt.
+	RedispatchInterrupted bool `json:"redispatchInterrupted" yaml:"redispatchInterrupted"`
+	// CacheImportTemplate renders the remote cache imports of new ImageBuilds that do not specify any. The template is
+	// executed once per image with its Image, Repository, Tag and Namespace, e.g. "{{ .Repository }}:buildcache".
+	CacheImportTemplate string `json:"cacheImportTemplate,omitempty" yaml:"cacheImportTemplate,omitempty"`
+	// Paused keeps new builds waiting with a "Paused" condition instead of dispatching them, builds that are already
+	// running finish and status messages are still published. Intended for registry maintenance windows.
+	Paused bool `json:"paused" yaml:"paused"`
+	// LogBuildGraph writes the solved build graph of every build to its log, including the name, duration and cache
+	// hit of each step, so that UIs can render build breakdowns.
+	LogBuildGraph bool `json:"logBuildGraph" yaml:"logBuildGraph"`
+	// Quota limits the builds submitted by every namespace.
+	Quota BuildQuota `json:"quota" yaml:"quota"`
+	// FailureLogLines is the number of trailing lines of build output appended to the error of failed builds, with
+	// secret values redacted, so status message consumers can show why a build failed. Disabled when zero.
+	FailureLogLines int `json:"failureLogLines" yaml:"failureLogLines"`
+	// MaxTransitions caps the status transitions kept by every ImageBuild, the oldest are pruned first so objects stay
+	// small in installs with millions of builds. Every transition is kept when zero.
+	MaxTransitions int `json:"maxTransitions" yaml:"maxTransitions"`
+	// SpecLimits caps the images, build args and registry auth of ImageBuilds admitted by the webhook.
+	SpecLimits SpecLimits `json:"specLimits" yaml:"specLimits"`
+	// KnownRegistries images are expected to be pushed to, the webhook warns about builds pushing to any other
+	// registry. No warnings are returned when empty.
+	KnownRegistries []string `json:"knownRegistries,omitempty" yaml:"knownRegistries,omitempty"`
+}
+
+// SpecLimits protect buildkit and status message consumers from pathological ImageBuild specs.
+type SpecLimits struct {
+	Images       ListLimit `json:"images" yaml:"images"`
+	BuildArgs    ListLimit `json:"buildArgs" yaml:"buildArgs"`
+	RegistryAuth ListLimit `json:"registryAuth" yaml:"registryAuth"`
+}
+
+// ListLimit caps the number of items in a list and their total size in bytes, limits are disabled when zero.
+type ListLimit struct {
+	MaxItems int `json:"maxItems" yaml:"maxItems"`
+	MaxBytes int `json:"maxBytes" yaml:"maxBytes"`
+}
+
+// BuildQuota usage is recorded in a BuildQuotaUsage object per namespace, the webhook rejects new ImageBuilds with a
+// 429 status once a limit is reached. Quotas are disabled when both limits are zero.
+type BuildQuota struct {
+	// Window over which usage is counted before the counters are reset, defaults to 1h.
+	Window time.Duration `json:"window,omitempty" yaml:"window,omitempty"`
+	// MaxBuilds is the number of ImageBuilds a namespace may submit during the window, unlimited when zero.
+	MaxBuilds int64 `json:"maxBuilds" yaml:"maxBuilds"`
+	// MaxPushedBytes is the compressed image size a namespace may push during the window, unlimited when zero.
+	MaxPushedBytes int64 `json:"maxPushedBytes" yaml:"maxPushedBytes"`
+}
+
+// Enabled reports whether any quota limit is set.
+func (q BuildQuota) Enabled() bool {
+	return q.MaxBuilds > 0 || q.MaxPushedBytes > 0
+}
+
+// TransitionHook is invoked whenever an ImageBuild changes phase. Exactly one of URL or Command must be provided.
+type TransitionHook struct {
+	// Name used to identify the hook in logs and events.
+	Name string `json:"name" yaml:"name"`
+	// URL receives an HTTP POST with a JSON payload describing the transition. The payload summarizes the build with
+	// its name, UID, images, digest and conditions, the spec is never sent.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+	// Command is executed with the JSON payload provided on stdin.
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"`
+	// Timeout applied to each invocation. All hooks of a transition share a limit of 15s.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
 }
 
 type Controller struct {
@@ -26,6 +109,8 @@ type Controller struct {
 	Buildkit  Buildkit  `json:"buildkit" yaml:"buildkit"`
 	Messaging Messaging `json:"messaging" yaml:"messaging"`
 	NewRelic  NewRelic  `json:"newRelic" yaml:"newRelic"`
+	Audit     Audit     `json:"audit" yaml:"audit"`
+	CloudAuth CloudAuth `json:"cloudAuth" yaml:"cloudAuth"`
 }
 
 func (c Controller) Validate() error {
@@ -34,6 +119,39 @@ func (c Controller) Validate() error {
 	if c.Manager.ImageBuild.Concurrency < 1 {
 		errs = append(errs, "manager.imageBuild.concurrency must be greater than or equal to 1")
 	}
+	for i, hook := range c.Manager.ImageBuild.TransitionHooks {
+		if hook.Name == "" {
+			errs = append(errs, fmt.Sprintf("manager.imageBuild.transitionHooks[%d].name cannot be blank", i))
+		}
+		if (hook.URL == "") == (len(hook.Command) == 0) {
+			errs = append(errs, fmt.Sprintf(
+				"manager.imageBuild.transitionHooks[%d] must define exactly one of url or command", i,
+			))
+		}
+	}
+	if tmpl := c.Manager.ImageBuild.CacheImportTemplate; tmpl != "" {
+		if _, err := template.New("cacheImport").Parse(tmpl); err != nil {
+			errs = append(errs, fmt.Sprintf("manager.imageBuild.cacheImportTemplate is invalid: %s", err.Error()))
+		}
+	}
+	if q := c.Manager.ImageBuild.Quota; q.Window < 0 || q.MaxBuilds < 0 || q.MaxPushedBytes < 0 {
+		errs = append(errs, "manager.imageBuild.quota values cannot be negative")
+	}
+	if l := c.Manager.ImageBuild.SpecLimits; min(l.Images.MaxItems, l.Images.MaxBytes, l.BuildArgs.MaxItems,
+		l.BuildArgs.MaxBytes, l.RegistryAuth.MaxItems, l.RegistryAuth.MaxBytes) < 0 {
+		errs = append(errs, "manager.imageBuild.specLimits values cannot be negative")
+	}
+	if c.Manager.ImageBuild.FailureLogLines < 0 {
+		errs = append(errs, "manager.imageBuild.failureLogLines cannot be negative")
+	}
+	// the messenger only publishes the transitions present when it reconciles
+	if n := c.Manager.ImageBuild.MaxTransitions; n < 0 {
+		errs = append(errs, "manager.imageBuild.maxTransitions cannot be negative")
+	} else if c.Messaging.Enabled && n > 0 && n < minMessagingTransitions {
+		errs = append(errs, fmt.Sprintf(
+			"manager.imageBuild.maxTransitions must be at least %d when messaging is enabled", minMessagingTransitions,
+		))
+	}
 	if c.Manager.HealthProbeAddr == "" {
 		errs = append(errs, "manager.healthProbeAddr cannot be blank")
 	}
@@ -43,6 +161,11 @@ func (c Controller) Validate() error {
 	if err := validatePort(c.Manager.WebhookPort); err != nil {
 		errs = append(errs, fmt.Sprintf("manager.webhookPort is invalid: %s", err.Error()))
 	}
+	if domain := c.Manager.AnnotationDomain; domain != "" {
+		if msgs := validation.IsDNS1123Subdomain(domain); len(msgs) != 0 {
+			errs = append(errs, fmt.Sprintf("manager.annotationDomain is invalid: %s", strings.Join(msgs, ", ")))
+		}
+	}
 
 	if c.Buildkit.PodLabels == nil {
 		errs = append(errs, "buildkit.podLabels cannot be nil")
@@ -53,6 +176,146 @@ func (c Controller) Validate() error {
 	if err := validatePort(int(c.Buildkit.DaemonPort)); err != nil {
 		errs = append(errs, fmt.Sprintf("buildkit.daemonPort is invalid: %s", err.Error()))
 	}
+	switch c.Buildkit.PoolEndpointDiscovery {
+	case "", "auto", "endpointSlices", "endpoints":
+	default:
+		errs = append(errs, "buildkit.poolEndpointDiscovery must be one of auto, endpointSlices or endpoints")
+	}
+	switch c.Buildkit.PoolAddressMode {
+	case "", "dns":
+	case "podIP":
+		// buildkitd certificates are issued for the service DNS names
+		if c.Buildkit.MTLS != nil {
+			errs = append(errs, "buildkit.poolAddressMode podIP cannot be used with buildkit.mtls")
+		}
+	default:
+		errs = append(errs, "buildkit.poolAddressMode must be one of dns or podIP")
+	}
+	for ns, weight := range c.Buildkit.PoolFairScheduling.NamespaceWeights {
+		if weight < 1 {
+			errs = append(errs, fmt.Sprintf("buildkit.poolFairScheduling.namespaceWeights[%s] must be positive", ns))
+		}
+	}
+	if r := c.Buildkit.PoolEndpointWatchRetries; r != nil && *r < 0 {
+		errs = append(errs, "buildkit.poolEndpointWatchRetries cannot be negative")
+	}
+	if b := c.Buildkit.PoolEndpointWatchBackoff; b != nil && *b < 0 {
+		errs = append(errs, "buildkit.poolEndpointWatchBackoff cannot be negative")
+	}
+	if c.Buildkit.PoolLeaseTimeout < 0 {
+		errs = append(errs, "buildkit.poolLeaseTimeout cannot be negative")
+	}
+	if c.Buildkit.PoolMaxBuildsPerPod < 0 {
+		errs = append(errs, "buildkit.poolMaxBuildsPerPod cannot be negative")
+	}
+	if c.Buildkit.WorkerEvictionRetries < 0 {
+		errs = append(errs, "buildkit.workerEvictionRetries cannot be negative")
+	}
+	for registry, opts := range c.Buildkit.Registries {
+		if ref := opts.CABundleSecretRef; ref != nil && strings.TrimSpace(ref.Name) == "" {
+			errs = append(errs, fmt.Sprintf("buildkit.registries[%s].caBundleSecretRef.name cannot be blank", registry))
+		}
+		if opts.MaxConcurrentBuilds < 0 {
+			errs = append(errs, fmt.Sprintf("buildkit.registries[%s].maxConcurrentBuilds cannot be negative", registry))
+		}
+		if opts.Quota != nil {
+			errs = append(errs, opts.Quota.validate(registry)...)
+		}
+		if robot := opts.HarborRobot; robot != nil {
+			if strings.TrimSpace(robot.AdminSecretName) == "" {
+				errs = append(errs, fmt.Sprintf("buildkit.registries[%s].harborRobot.adminSecretName cannot be blank",
+					registry))
+			}
+			if robot.ExpiryDays < 0 {
+				errs = append(errs, fmt.Sprintf("buildkit.registries[%s].harborRobot.expiryDays cannot be negative",
+					registry))
+			}
+		}
+	}
+	if ref := c.Buildkit.ContextFetch.CABundleSecretRef; ref != nil && strings.TrimSpace(ref.Name) == "" {
+		errs = append(errs, "buildkit.contextFetch.caBundleSecretRef.name cannot be blank")
+	}
+	errs = append(errs, c.Buildkit.ContextFetch.validate()...)
+	errs = append(errs, c.Buildkit.CacheRegistry.validate()...)
+	errs = append(errs, c.Buildkit.ARM64Pool.validate("arm64Pool")...)
+	if c.Buildkit.Scratch.BuildQuotaBytes < 0 || c.Buildkit.Scratch.TotalQuotaBytes < 0 {
+		errs = append(errs, "buildkit.scratch quotas cannot be negative")
+	}
+	for i, filter := range c.Buildkit.WorkerFilters {
+		if _, err := filters.Parse(filter); err != nil {
+			errs = append(errs, fmt.Sprintf("buildkit.workerFilters[%d] is invalid: %s", i, err.Error()))
+		}
+	}
+	for i, platform := range c.Buildkit.Platforms {
+		if _, err := platforms.Parse(platform); err != nil {
+			errs = append(errs, fmt.Sprintf("buildkit.platforms[%d] is invalid: %s", i, err.Error()))
+		}
+	}
+
+	if lf := c.Logging.Logfile; lf.MaxSizeMB < 0 || lf.MaxBackups < 0 || lf.MaxAgeDays < 0 {
+		errs = append(errs, "logging.logfile rotation settings cannot be negative")
+	}
+	if c.Manager.QueueEndpoint.Enabled && c.Manager.QueueEndpoint.TokenFile == "" {
+		errs = append(errs, "manager.queueEndpoint.tokenFile cannot be blank")
+	}
+	if c.Logging.LevelEndpoint.Enabled && c.Logging.LevelEndpoint.TokenFile == "" {
+		errs = append(errs, "logging.levelEndpoint.tokenFile cannot be blank")
+	}
+	if c.Logging.Redis != nil {
+		errs = append(errs, c.Logging.Redis.validate()...)
+	}
+
+	if amqp := c.Messaging.AMQP; amqp != nil {
+		if amqp.PoolSize < 0 {
+			errs = append(errs, "messaging.amqp.poolSize cannot be negative")
+		}
+		if hc := amqp.HealthCheck; hc.Interval < 0 || hc.Timeout < 0 {
+			errs = append(errs, "messaging.amqp.healthCheck interval and timeout cannot be negative")
+		}
+		if hc := amqp.HealthCheck; hc.Readiness && hc.Interval == 0 {
+			errs = append(errs, "messaging.amqp.healthCheck.readiness requires an interval")
+		}
+		if t := amqp.ExchangeType; t != "" && t != AMQPExchangeDirect && t != AMQPExchangeTopic {
+			errs = append(errs, "messaging.amqp.exchangeType must be one of direct or topic")
+		}
+		if tmpl := amqp.RoutingKeyTemplate; tmpl != "" {
+			if _, err := template.New("routingKey").Parse(tmpl); err != nil {
+				errs = append(errs, fmt.Sprintf("messaging.amqp.routingKeyTemplate is invalid: %s", err.Error()))
+			}
+		}
+	}
+	if aws := c.Messaging.AWS; aws != nil {
+		if c.Messaging.AMQP != nil {
+			errs = append(errs, "messaging.amqp and messaging.aws cannot both be set")
+		}
+		if aws.TopicARN == "" && aws.QueueURL == "" {
+			errs = append(errs, "messaging.aws requires a topicARN or queueURL")
+		}
+	}
+	if v := c.Messaging.SchemaVersion; v != "" && v != MessageSchemaLegacy && v != MessageSchemaV2 {
+		errs = append(errs, "messaging.schemaVersion must be one of legacy or v2")
+	}
+	if c.Messaging.OffloadTransitions && !c.Messaging.Enabled {
+		errs = append(errs, "messaging.offloadTransitions requires messaging to be enabled")
+	}
+
+	if c.Audit.Enabled && c.Audit.Filepath == "" && c.Audit.URL == "" {
+		errs = append(errs, "audit requires a filepath or url when enabled")
+	}
+
+	if c.CloudAuth.Timeout < 0 {
+		errs = append(errs, "cloudAuth.timeout cannot be negative")
+	}
+	for name, provider := range c.CloudAuth.Providers {
+		if !slices.Contains(hephv1.CloudProviders, name) {
+			errs = append(errs, fmt.Sprintf(
+				"cloudAuth.providers.%s is invalid: must be one of %s", name, strings.Join(hephv1.CloudProviders, ", "),
+			))
+		}
+		if provider.Timeout < 0 {
+			errs = append(errs, fmt.Sprintf("cloudAuth.providers.%s.timeout cannot be negative", name))
+		}
+	}
 
 	if c.NewRelic.Enabled && c.NewRelic.LicenseKey == "" {
 		errs = append(errs, "newRelic.licenseKey cannot be blank")
@@ -74,6 +337,14 @@ type LogfileLogging struct {
 	Enabled  bool   `json:"enabled" yaml:"enabled"`
 	Filepath string `json:"filepath" yaml:"filepath"`
 	LogLevel string `json:"level" yaml:"level"`
+	// MaxSizeMB rotates the logfile once it grows past this size, defaults to 100.
+	MaxSizeMB int `json:"maxSizeMB,omitempty" yaml:"maxSizeMB,omitempty"`
+	// MaxBackups is the number of rotated logfiles kept next to the logfile, defaults to 1.
+	MaxBackups int `json:"maxBackups,omitempty" yaml:"maxBackups,omitempty"`
+	// MaxAgeDays removes rotated logfiles older than this many days, they are only limited by MaxBackups when zero.
+	MaxAgeDays int `json:"maxAgeDays,omitempty" yaml:"maxAgeDays,omitempty"`
+	// Compress rotated logfiles with gzip.
+	Compress bool `json:"compress,omitempty" yaml:"compress,omitempty"`
 }
 
 type Logging struct {
@@ -81,6 +352,88 @@ type Logging struct {
 
 	Container ContainerLogging `json:"container" yaml:"container"`
 	Logfile   LogfileLogging   `json:"logfile" yaml:"logfile"`
+	Redis     *RedisLogging    `json:"redis,omitempty" yaml:"redis,omitempty"`
+	// AdmissionAudit records every admission decision of the webhooks.
+	AdmissionAudit AdmissionAuditLogging `json:"admissionAudit" yaml:"admissionAudit"`
+	// LevelEndpoint changes the level of named loggers at runtime.
+	LevelEndpoint LevelEndpoint `json:"levelEndpoint" yaml:"levelEndpoint"`
+}
+
+// LevelEndpoint serves "/loglevel" on the metrics server to override the level of named loggers without a restart,
+// e.g. "PUT /loglevel?logger=worker-pool&level=debug". Requests are authenticated with a bearer token.
+type LevelEndpoint struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// TokenFile holds the bearer token, it is read on every request so that the token can be rotated.
+	TokenFile string `json:"tokenFile,omitempty" yaml:"tokenFile,omitempty"`
+}
+
+// AdmissionAuditLogging writes one JSON record per webhook admission decision, including the requesting user, whether
+// the request was allowed and the field errors of denied requests.
+type AdmissionAuditLogging struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Filepath the records are appended to, they are written to stdout when blank.
+	Filepath string `json:"filepath,omitempty" yaml:"filepath,omitempty"`
+}
+
+// RedisLogging forwards the logs of every ImageBuild to a Redis list keyed by its logKey.
+type RedisLogging struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Address of the Redis server in "host:port" form.
+	Address  string `json:"address" yaml:"address"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	DB       int    `json:"db,omitempty" yaml:"db,omitempty"`
+	// KeyTemplate renders the list key of a log event, it is executed with the LogKey of the build. Defaults to
+	// "{{ .LogKey }}".
+	KeyTemplate string `json:"keyTemplate,omitempty" yaml:"keyTemplate,omitempty"`
+	// TTL expires a list once no events were added to it for that long. Lists never expire when zero.
+	TTL time.Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	// MaxEntries kept per list, older entries are trimmed once exceeded. Lists are unbounded when zero.
+	MaxEntries int64 `json:"maxEntries,omitempty" yaml:"maxEntries,omitempty"`
+	// MaxEntryBytes truncates longer log messages. Messages are never truncated when zero.
+	MaxEntryBytes int `json:"maxEntryBytes,omitempty" yaml:"maxEntryBytes,omitempty"`
+	// LogLevel of the forwarded events, defaults to "info".
+	LogLevel string `json:"level,omitempty" yaml:"level,omitempty"`
+}
+
+func (r *RedisLogging) MarshalJSON() ([]byte, error) {
+	type redisLogging RedisLogging
+
+	redacted := redisLogging(*r)
+	if redacted.Password != "" {
+		redacted.Password = "xxxxx"
+	}
+
+	return json.Marshal(redacted)
+}
+
+func (r *RedisLogging) validate() (errs []string) {
+	if !r.Enabled {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(r.Address); err != nil {
+		errs = append(errs, fmt.Sprintf("logging.redis.address is invalid: %s", err.Error()))
+	}
+	if r.KeyTemplate != "" {
+		if _, err := template.New("redisKey").Parse(r.KeyTemplate); err != nil {
+			errs = append(errs, fmt.Sprintf("logging.redis.keyTemplate is invalid: %s", err.Error()))
+		}
+	}
+	if r.DB < 0 {
+		errs = append(errs, "logging.redis.db cannot be negative")
+	}
+	if r.TTL < 0 {
+		errs = append(errs, "logging.redis.ttl cannot be negative")
+	}
+	if r.MaxEntries < 0 {
+		errs = append(errs, "logging.redis.maxEntries cannot be negative")
+	}
+	if r.MaxEntryBytes < 0 {
+		errs = append(errs, "logging.redis.maxEntryBytes cannot be negative")
+	}
+
+	return errs
 }
 
 type Manager struct {
@@ -90,6 +443,23 @@ type Manager struct {
 	WatchNamespaces      []string   `json:"watchNamespaces" yaml:"watchNamespaces,omitempty"`
 	EnableLeaderElection bool       `json:"enableLeaderElection" yaml:"enableLeaderElection"`
 	ImageBuild           ImageBuild `json:"imageBuild" yaml:"imageBuild"`
+	// AnnotationDomain prefixes every annotation, label and finalizer written by the controller. Defaults to
+	// "hephaestus.dominodatalab.com" when blank.
+	AnnotationDomain string `json:"annotationDomain,omitempty" yaml:"annotationDomain,omitempty"`
+	// FieldManager identifies the controller in the managed fields of the objects it writes. The worker pool uses
+	// "<fieldManager>-pod-lease-manager". Defaults to the controller binary name when blank.
+	FieldManager string `json:"fieldManager,omitempty" yaml:"fieldManager,omitempty"`
+	// QueueEndpoint lists the builds waiting for a buildkit worker.
+	QueueEndpoint QueueEndpoint `json:"queueEndpoint" yaml:"queueEndpoint"`
+}
+
+// QueueEndpoint serves "/queue" on the metrics server, listing the lease requests waiting in every worker pool with
+// their owner and age so that operators can tell why a build is still initializing. Requests are authenticated with a
+// bearer token.
+type QueueEndpoint struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// TokenFile holds the bearer token, it is read on every request so that the token can be rotated.
+	TokenFile string `json:"tokenFile,omitempty" yaml:"tokenFile,omitempty"`
 }
 
 // Buildkit communication and discovery configuration.
@@ -108,17 +478,160 @@ type Buildkit struct {
 	PoolSyncWaitTime *time.Duration `json:"poolSyncWaitTime" yaml:"poolSyncWaitTime"`
 	// PoolMaxIdleTime controls how long a pod will be allowed to remain unleased before it's terminated.
 	PoolMaxIdleTime *time.Duration `json:"poolMaxIdleTime" yaml:"poolMaxIdleTime"`
-	// PoolEndpointWatchTimeout is the time limit used when waiting for new pods to become "ready" for traffic.
+	// PoolEndpointWatchTimeout is the time limit used when waiting for new pods to become "ready" for traffic. It bounds
+	// all endpoint watch retries together.
 	PoolEndpointWatchTimeout *int64 `json:"poolEndpointWatchTimeout" yaml:"poolEndpointWatchTimeout"`
+	// PoolEndpointWatchRetries is the number of fresh watches started when no address was found for a new pod before
+	// the build fails.
+	PoolEndpointWatchRetries *int `json:"poolEndpointWatchRetries" yaml:"poolEndpointWatchRetries"`
+	// PoolEndpointWatchBackoff is the delay before the first endpoint watch retry, it doubles with every retry.
+	PoolEndpointWatchBackoff *time.Duration `json:"poolEndpointWatchBackoff" yaml:"poolEndpointWatchBackoff"`
+	// PoolLeaseTimeout fails builds when no worker becomes available within the duration, builds wait indefinitely
+	// when zero.
+	PoolLeaseTimeout time.Duration `json:"poolLeaseTimeout,omitempty" yaml:"poolLeaseTimeout,omitempty"`
+	// PoolFairScheduling controls the order builds waiting for a worker are served in.
+	PoolFairScheduling FairScheduling `json:"poolFairScheduling" yaml:"poolFairScheduling"`
+	// PoolEndpointDiscovery selects the API new pod addresses are resolved from: "endpointSlices", "endpoints" or
+	// "auto", which falls back to classic Endpoints when EndpointSlices are unavailable. Defaults to "auto".
+	PoolEndpointDiscovery string `json:"poolEndpointDiscovery,omitempty" yaml:"poolEndpointDiscovery,omitempty"`
+	// PoolAddressMode selects how new pods are dialed: "dns" uses the hostname published by the headless service,
+	// "podIP" dials the IP of ready pods directly for clusters where service DNS propagation lags. Defaults to "dns".
+	PoolAddressMode string `json:"poolAddressMode,omitempty" yaml:"poolAddressMode,omitempty"`
+	// PoolStateLogInterval controls how often a summary of the worker states is logged, per-pod reconciliation
+	// details are only logged at verbosity 2.
+	PoolStateLogInterval *time.Duration `json:"poolStateLogInterval,omitempty" yaml:"poolStateLogInterval,omitempty"`
+	// SpotNodeLabels identify spot/preemptible nodes. Workers scheduled onto matching nodes are never leased for
+	// on-demand only builds and have their caches warmed first.
+	SpotNodeLabels map[string]string `json:"spotNodeLabels,omitempty" yaml:"spotNodeLabels,omitempty"`
+	// PoolMaxBuildsPerPod is the number of builds a worker serves before it is recycled. Workers are never recycled
+	// when zero.
+	PoolMaxBuildsPerPod int `json:"poolMaxBuildsPerPod" yaml:"poolMaxBuildsPerPod"`
+	// PoolRollingUpgrade restarts workers running an outdated StatefulSet revision one at a time once their builds are
+	// done, instead of letting the StatefulSet controller replace pods mid-build. Restarted workers are only leased
+	// again once the images of every ImageCache and ClusterImageCache are warmed into their cache. The StatefulSet must
+	// use the OnDelete update strategy.
+	PoolRollingUpgrade bool `json:"poolRollingUpgrade" yaml:"poolRollingUpgrade"`
+	// PoolDisruptionBudget enables a PodDisruptionBudget that blocks voluntary evictions of leased workers.
+	PoolDisruptionBudget bool `json:"poolDisruptionBudget" yaml:"poolDisruptionBudget"`
+	// WorkerFilters a buildkitd worker must match before a pod is leased, e.g.
+	// `labels."org.mobyproject.buildkit.worker.executor"==containerd`. Builds fail when no worker matches. The filters
+	// only gate leasing, buildkitd still runs solves on its default worker.
+	WorkerFilters []string `json:"workerFilters,omitempty" yaml:"workerFilters,omitempty"`
+	// Platforms images are built for, e.g. "linux/arm64". The leased worker must support all of them.
+	Platforms []string `json:"platforms,omitempty" yaml:"platforms,omitempty"`
 	// MTLS parameters.
 	MTLS *BuildkitMTLS `json:"mtls,omitempty" yaml:"mtls,omitempty"`
 	// Global secrets provided to buildkitd during the build process for all image builds.
 	Secrets map[string]string `json:"secrets" yaml:"secrets,omitempty"`
+	// SecretsServiceAccount is impersonated inside each ImageBuild's or ImageCache's namespace when reading its build,
+	// registry auth and Artifactory secrets, ClusterImageCaches impersonate the account in Namespace. Secrets are read
+	// with the controller's credentials when blank.
+	SecretsServiceAccount string `json:"secretsServiceAccount,omitempty" yaml:"secretsServiceAccount,omitempty"`
 	// Registries parameters.
 	Registries map[string]RegistryConfig `json:"registries,omitempty" yaml:"registries,omitempty"`
 	// FetchAndExtractTimeout used when processing the remote Docker context tarball.
 	// Fetch retries have a hard timeout limit of 4.25 mins because, come on, don't be ridiculous.
 	FetchAndExtractTimeout time.Duration `json:"fetchAndExtractTimeout" yaml:"fetchAndExtractTimeout"`
+	// ContextFetch customizes the HTTP client used to download the remote Docker context tarball.
+	ContextFetch ContextFetch `json:"contextFetch" yaml:"contextFetch"`
+	// Scratch limits the local disk used to fetch and extract remote Docker contexts.
+	Scratch Scratch `json:"scratch" yaml:"scratch"`
+	// WorkerEvictionRetries is the number of times a build is restarted on a new worker after its leased worker has
+	// been evicted. Evictions fail the build when zero.
+	WorkerEvictionRetries int `json:"workerEvictionRetries" yaml:"workerEvictionRetries"`
+	// CacheRegistry every build exports its build cache to and imports it from.
+	CacheRegistry CacheRegistry `json:"cacheRegistry" yaml:"cacheRegistry"`
+	// ARM64Pool of native arm64 workers that builds only targeting arm64 platforms are leased from, so they are not
+	// emulated on the default workers.
+	ARM64Pool WorkerPool `json:"arm64Pool" yaml:"arm64Pool"`
+}
+
+// FairScheduling serves the builds of different namespaces waiting for a worker in a weighted round robin, so that
+// namespaces queueing many builds cannot starve the others. Builds are served in submission order when disabled.
+type FairScheduling struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// NamespaceWeights is the number of builds served per turn of a namespace, namespaces default to 1.
+	NamespaceWeights map[string]int `json:"namespaceWeights,omitempty" yaml:"namespaceWeights,omitempty"`
+}
+
+// WorkerPool identifies an additional buildkit StatefulSet deployed next to the default one. Every other pool option
+// is shared with the default pool.
+type WorkerPool struct {
+	// StatefulSetName for the supervising workload. The pool is not used when blank.
+	StatefulSetName string `json:"statefulSetName,omitempty" yaml:"statefulSetName,omitempty"`
+	// ServiceName for the headless service.
+	ServiceName string `json:"serviceName,omitempty" yaml:"serviceName,omitempty"`
+	// PodLabels assigned to pods by the StatefulSet. They must not select the pods of the default pool.
+	PodLabels map[string]string `json:"podLabels,omitempty" yaml:"podLabels,omitempty"`
+}
+
+// Enabled reports whether the pool is configured.
+func (p WorkerPool) Enabled() bool {
+	return p.StatefulSetName != ""
+}
+
+// ARM64Config returns the options of the arm64 pool, which shares every option with the default pool except for the
+// workload it manages.
+func (c Buildkit) ARM64Config() Buildkit {
+	arm64Cfg := c
+	arm64Cfg.StatefulSetName = c.ARM64Pool.StatefulSetName
+	arm64Cfg.ServiceName = c.ARM64Pool.ServiceName
+	arm64Cfg.PodLabels = c.ARM64Pool.PodLabels
+	arm64Cfg.Platforms = []string{"linux/arm64"}
+
+	return arm64Cfg
+}
+
+// PoolConfigs returns the options of every configured worker pool, starting with the default pool.
+func (c Buildkit) PoolConfigs() []Buildkit {
+	pools := []Buildkit{c}
+	if c.ARM64Pool.Enabled() {
+		pools = append(pools, c.ARM64Config())
+	}
+
+	return pools
+}
+
+// validate returns every problem with the pool options, name is the config key of the pool.
+func (p WorkerPool) validate(name string) (errs []string) {
+	if !p.Enabled() {
+		return nil
+	}
+
+	if p.ServiceName == "" {
+		errs = append(errs, fmt.Sprintf("buildkit.%s.serviceName cannot be blank", name))
+	}
+	if len(p.PodLabels) == 0 {
+		errs = append(errs, fmt.Sprintf("buildkit.%s.podLabels cannot be empty", name))
+	}
+
+	return errs
+}
+
+// CacheRegistry holds the build cache of every image as "<registry>/<namespace>/<repository>:cache", so clients do
+// not need to manage remote cache imports themselves.
+type CacheRegistry struct {
+	// Registry host optionally followed by a path prefix, e.g. "cache-registry.hephaestus:5000/cache". The cache
+	// registry is not used when blank.
+	Registry string `json:"registry,omitempty" yaml:"registry,omitempty"`
+	// Mode "min" only exports the cache of the layers in the final image, "max" exports every intermediate step.
+	// Defaults to "max".
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+}
+
+// validate returns every problem with the cache registry options.
+func (r CacheRegistry) validate() (errs []string) {
+	if r.Registry != "" {
+		if _, err := reference.ParseNormalizedNamed(r.Registry + "/namespace/repository"); err != nil ||
+			strings.Contains(r.Registry, "://") {
+			errs = append(errs, "buildkit.cacheRegistry.registry must be a registry host with an optional path")
+		}
+	}
+	if r.Mode != "" && r.Mode != "min" && r.Mode != "max" {
+		errs = append(errs, "buildkit.cacheRegistry.mode must be one of min or max")
+	}
+
+	return errs
 }
 
 // RegistryConfig options used to relax registry push/pull restrictions.
@@ -127,6 +640,119 @@ type RegistryConfig struct {
 	Insecure bool `json:"insecure,omitempty" yaml:"insecure,omitempty"`
 	// HTTP will allow non-TLS connections.
 	HTTP bool `json:"http,omitempty" yaml:"http,omitempty"`
+	// ReadOnly registries can be pulled from but ImageBuilds pushing to them are rejected.
+	ReadOnly bool `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+	// CABundleSecretRef adds trusted CAs used when the controller talks to the registry.
+	CABundleSecretRef *SecretKeyRef `json:"caBundleSecretRef,omitempty" yaml:"caBundleSecretRef,omitempty"`
+	// MaxConcurrentBuilds limits the builds pushing to the registry that run at the same time, for registries that
+	// throttle concurrent uploads. Buildkit pushes as part of the build, so the whole build counts against the limit,
+	// not only its push. Additional builds wait with a "Queued" condition, there is no limit when zero.
+	MaxConcurrentBuilds int `json:"maxConcurrentBuilds,omitempty" yaml:"maxConcurrentBuilds,omitempty"`
+	// Quota checks the storage quota of the registry before builds run so that builds which cannot push fail early
+	// with a "RegistryQuotaExceeded" condition.
+	Quota *RegistryQuota `json:"quota,omitempty" yaml:"quota,omitempty"`
+	// HarborRobot pushes with a Harbor robot account minted for every build instead of static credentials.
+	HarborRobot *HarborRobot `json:"harborRobot,omitempty" yaml:"harborRobot,omitempty"`
+}
+
+// HarborRobot mints a robot account scoped to the projects a build pushes to, it replaces the credentials of the build
+// for the registry and is deleted once the build finishes.
+type HarborRobot struct {
+	// URL of the Harbor API, defaults to the registry host.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+	// AdminSecretName of a "kubernetes.io/basic-auth" secret in the buildkit namespace holding the credentials of a
+	// Harbor user allowed to create robot accounts in the projects.
+	AdminSecretName string `json:"adminSecretName" yaml:"adminSecretName"`
+	// ExpiryDays after which Harbor disables robot accounts that were not deleted, e.g. because the controller
+	// restarted during the build. Defaults to 1, the shortest expiry supported by Harbor.
+	ExpiryDays int `json:"expiryDays,omitempty" yaml:"expiryDays,omitempty"`
+}
+
+// Registry management APIs the storage quota can be queried from.
+const (
+	RegistryQuotaHarbor      = "harbor"
+	RegistryQuotaArtifactory = "artifactory"
+)
+
+// RegistryQuota queries the storage quota of a registry through its management API.
+type RegistryQuota struct {
+	// Provider of the management API, either "harbor" or "artifactory". Harbor checks the quota of the project the
+	// image is pushed to, Artifactory checks the storage of the whole instance.
+	Provider string `json:"provider" yaml:"provider"`
+	// URL of the management API, defaults to the registry host for Harbor and its "/artifactory" path for
+	// Artifactory.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+	// MinFreeBytes that must remain below the quota for builds to run, e.g. the size of a typical image.
+	MinFreeBytes int64 `json:"minFreeBytes,omitempty" yaml:"minFreeBytes,omitempty"`
+	// MaxUsedPercent of the Artifactory storage after which uploads are rejected, matching the storage quota of the
+	// instance. Defaults to 95.
+	MaxUsedPercent int `json:"maxUsedPercent,omitempty" yaml:"maxUsedPercent,omitempty"`
+}
+
+func (q RegistryQuota) validate(registry string) []string {
+	var errs []string
+	switch q.Provider {
+	case RegistryQuotaHarbor, RegistryQuotaArtifactory:
+	default:
+		errs = append(errs, fmt.Sprintf("buildkit.registries[%s].quota.provider must be %q or %q", registry,
+			RegistryQuotaHarbor, RegistryQuotaArtifactory))
+	}
+	if q.MinFreeBytes < 0 {
+		errs = append(errs, fmt.Sprintf("buildkit.registries[%s].quota.minFreeBytes cannot be negative", registry))
+	}
+	if q.MaxUsedPercent < 0 || q.MaxUsedPercent > 100 {
+		errs = append(errs, fmt.Sprintf("buildkit.registries[%s].quota.maxUsedPercent must be between 0 and 100",
+			registry))
+	}
+
+	return errs
+}
+
+// ContextFetch options used when downloading remote Docker contexts.
+type ContextFetch struct {
+	// OnWorker passes remote context URLs to the buildkit frontend so workers download and extract contexts
+	// themselves. The remaining options only apply to fetches made by the controller and cannot be combined with it,
+	// workers use their own proxy and CA configuration.
+	OnWorker bool `json:"onWorker,omitempty" yaml:"onWorker,omitempty"`
+	// CABundleSecretRef adds trusted CAs used to verify artifact server certificates.
+	CABundleSecretRef *SecretKeyRef `json:"caBundleSecretRef,omitempty" yaml:"caBundleSecretRef,omitempty"`
+	// HTTPProxy used for http context URLs. When all proxy fields are blank, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// environment variables are used instead.
+	HTTPProxy string `json:"httpProxy,omitempty" yaml:"httpProxy,omitempty"`
+	// HTTPSProxy used for https context URLs.
+	HTTPSProxy string `json:"httpsProxy,omitempty" yaml:"httpsProxy,omitempty"`
+	// NoProxy is a comma-separated list of hosts, domains and CIDRs that are fetched without a proxy.
+	NoProxy string `json:"noProxy,omitempty" yaml:"noProxy,omitempty"`
+	// DialTimeout limits how long establishing a connection may take, defaults to 30s.
+	DialTimeout time.Duration `json:"dialTimeout,omitempty" yaml:"dialTimeout,omitempty"`
+	// ResponseHeaderTimeout limits how long to wait for response headers once the request is sent. There is no limit
+	// when zero.
+	ResponseHeaderTimeout time.Duration `json:"responseHeaderTimeout,omitempty" yaml:"responseHeaderTimeout,omitempty"`
+	// MaxRedirects followed before a fetch fails, defaults to 10.
+	MaxRedirects int `json:"maxRedirects,omitempty" yaml:"maxRedirects,omitempty"`
+	// CacheDir stores downloaded contexts keyed by URL so unchanged archives are not downloaded again. Servers must
+	// return an ETag for archives to be cached. Caching is disabled when blank.
+	CacheDir string `json:"cacheDir,omitempty" yaml:"cacheDir,omitempty"`
+	// CacheMaxBytes evicts the least recently used contexts once exceeded. The cache is unbounded when zero.
+	CacheMaxBytes int64 `json:"cacheMaxBytes,omitempty" yaml:"cacheMaxBytes,omitempty"`
+}
+
+// Scratch space used by builds on the controller.
+type Scratch struct {
+	// Dir holding build directories, a directory below the system temp dir is used when blank. Anything found in it
+	// on start is deleted, so it must not be shared with other processes.
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// BuildQuotaBytes limits the data a single build may write. There is no limit when zero.
+	BuildQuotaBytes int64 `json:"buildQuotaBytes,omitempty" yaml:"buildQuotaBytes,omitempty"`
+	// TotalQuotaBytes limits the data written by all concurrent builds. There is no limit when zero.
+	TotalQuotaBytes int64 `json:"totalQuotaBytes,omitempty" yaml:"totalQuotaBytes,omitempty"`
+}
+
+// SecretKeyRef selects a key of a secret in the buildkit namespace.
+type SecretKeyRef struct {
+	Name string `json:"name" yaml:"name"`
+	// Key holding the data, defaults to "ca.crt".
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
 }
 
 // BuildkitMTLS server configuration.
@@ -136,16 +762,64 @@ type BuildkitMTLS struct {
 	KeyPath    string `json:"keyPath" yaml:"keyPath"`
 }
 
+// AMQP exchange types messages can be published to.
+const (
+	// AMQPExchangeDirect routes messages to the queues bound with exactly the routing key of the message.
+	AMQPExchangeDirect = "direct"
+	// AMQPExchangeTopic routes messages to the queues whose binding pattern matches the routing key, e.g. "ns.#".
+	AMQPExchangeTopic = "topic"
+)
+
+// Message schema versions that can be published.
+const (
+	// MessageSchemaLegacy messages have no schema version and only carry the fields consumers relied on before the
+	// schema was versioned.
+	MessageSchemaLegacy = "legacy"
+	// MessageSchemaV2 messages are marked with schemaVersion "v2" and include the build timings and worker address.
+	MessageSchemaV2 = "v2"
+)
+
 type Messaging struct {
 	Enabled bool            `json:"enabled" yaml:"enabled"`
 	AMQP    *AMQPMessaging  `json:"amqp" yaml:"amqp"`
 	Kafka   *KafkaMessaging `json:"kafka" yaml:"kafka"`
+	// AWS publishes messages to SNS and/or SQS instead of an AMQP broker.
+	AWS *AWSMessaging `json:"aws,omitempty" yaml:"aws,omitempty"`
+	// SchemaVersion of the published messages, "legacy" or "v2". Defaults to "legacy" so existing consumers keep
+	// working until they are upgraded.
+	SchemaVersion string `json:"schemaVersion" yaml:"schemaVersion"`
+	// OffloadTransitions records the complete transition history of every build in its ImageBuildMessage, so that
+	// ImageBuilds can keep a short history with imageBuild.maxTransitions.
+	OffloadTransitions bool `json:"offloadTransitions" yaml:"offloadTransitions"`
 }
 
 type AMQPMessaging struct {
 	URL      string `json:"url" yaml:"url"`
 	Exchange string `json:"exchange" yaml:"exchange"`
 	Queue    string `json:"queue" yaml:"queue"`
+	// ExchangeType of the exchange declared when it does not exist, "direct" or "topic". Defaults to "direct".
+	ExchangeType string `json:"exchangeType,omitempty" yaml:"exchangeType,omitempty"`
+	// RoutingKeyTemplate renders the routing key of messages from the Namespace and Name of the ImageBuild, e.g.
+	// "hephaestus.{{ .Namespace }}" so tenants can bind queues to the transitions of their own namespace on a topic
+	// exchange. The queue name is used when blank.
+	RoutingKeyTemplate string `json:"routingKeyTemplate,omitempty" yaml:"routingKeyTemplate,omitempty"`
+	// PoolSize is the number of long-lived publisher channels shared by all builds, each with its own broker
+	// connection. It also limits the number of messages published at the same time. Defaults to 1.
+	PoolSize int `json:"poolSize,omitempty" yaml:"poolSize,omitempty"`
+	// HealthCheck probes the connectivity to the broker so degraded messaging is visible before messages go missing.
+	HealthCheck AMQPHealthCheck `json:"healthCheck,omitempty" yaml:"healthCheck,omitempty"`
+}
+
+// AMQPHealthCheck dials the broker periodically and reports the outcome of the last probe with the
+// hephaestus_messaging_broker_up metric.
+type AMQPHealthCheck struct {
+	// Interval between probes, the broker is not probed when zero.
+	Interval time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Timeout of every probe. Defaults to 5s.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Readiness adds an "amqp" readiness check that fails while the broker is unreachable. Unready controllers stop
+	// serving admission webhooks, so new builds are rejected until the broker recovers.
+	Readiness bool `json:"readiness,omitempty" yaml:"readiness,omitempty"`
 }
 
 func (m *AMQPMessaging) MarshalJSON() ([]byte, error) {
@@ -159,6 +833,16 @@ func (m *AMQPMessaging) MarshalJSON() ([]byte, error) {
 	return json.Marshal(amqpMessaging)
 }
 
+// AWSMessaging publishes every message to the SNS topic and the SQS queue that are set. Messages carry "namespace",
+// "name" and "phase" attributes so subscriptions can filter them. Credentials are resolved from the environment like
+// the other AWS integrations, e.g. with IAM roles for service accounts.
+type AWSMessaging struct {
+	// Region of the topic and queue, resolved from the environment or instance metadata when blank.
+	Region   string `json:"region,omitempty" yaml:"region,omitempty"`
+	TopicARN string `json:"topicARN,omitempty" yaml:"topicARN,omitempty"`
+	QueueURL string `json:"queueURL,omitempty" yaml:"queueURL,omitempty"`
+}
+
 type KafkaMessaging struct {
 	Servers   []string `json:"servers" yaml:"servers"`
 	Topic     string   `json:"topic" yaml:"topic"`
@@ -170,6 +854,58 @@ type NewRelic struct {
 	AppName    string            `json:"appName" yaml:"appName"`
 	Labels     map[string]string `json:"labels" yaml:"labels,omitempty"`
 	LicenseKey string            `json:"licenseKey" yaml:"licenseKey"`
+	// AttributeLabels lists the ImageBuild labels added as "label.<key>" attributes to reconcile transactions.
+	AttributeLabels []string `json:"attributeLabels,omitempty" yaml:"attributeLabels,omitempty"`
+	// AttributeAnnotations lists the ImageBuild annotations added as "annotation.<key>" attributes to reconcile
+	// transactions.
+	AttributeAnnotations []string `json:"attributeAnnotations,omitempty" yaml:"attributeAnnotations,omitempty"`
+	// BuildEvents records an "ImageBuildCompleted" custom event for every successful build.
+	BuildEvents bool `json:"buildEvents,omitempty" yaml:"buildEvents,omitempty"`
+}
+
+// Audit stream configuration. Records are written when ImageBuilds reach a terminal phase.
+type Audit struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Filepath receives JSON lines audit records.
+	Filepath string `json:"filepath,omitempty" yaml:"filepath,omitempty"`
+	// URL receives an HTTP POST with each JSON audit record.
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// DefaultCloudAuthTimeout bounds the registration of cloud auth providers without a configured timeout.
+const DefaultCloudAuthTimeout = 30 * time.Second
+
+// CloudAuth configures the cloud providers registry credentials are retrieved from.
+type CloudAuth struct {
+	// Timeout bounds the registration of providers without their own timeout, defaults to DefaultCloudAuthTimeout.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Providers are keyed by name ("acr", "ecr", "gcp" or "ghcr"), providers that are not listed are enabled.
+	Providers map[string]CloudAuthProvider `json:"providers,omitempty" yaml:"providers,omitempty"`
+}
+
+type CloudAuthProvider struct {
+	// Enabled defaults to true. Disabling providers keeps air-gapped installs from probing cloud metadata services.
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Timeout bounds the registration of the provider.
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ProviderEnabled reports whether the named provider should be registered.
+func (c CloudAuth) ProviderEnabled(name string) bool {
+	enabled := c.Providers[name].Enabled
+	return enabled == nil || *enabled
+}
+
+// ProviderTimeout returns how long the registration of the named provider may take.
+func (c CloudAuth) ProviderTimeout(name string) time.Duration {
+	switch {
+	case c.Providers[name].Timeout > 0:
+		return c.Providers[name].Timeout
+	case c.Timeout > 0:
+		return c.Timeout
+	default:
+		return DefaultCloudAuthTimeout
+	}
 }
 
 func LoadFromFile(filename string) (Controller, error) {
@@ -186,7 +922,7 @@ func LoadFromFile(filename string) (Controller, error) {
 		decoder.KnownFields(true)
 		for {
 			if err = decoder.Decode(&cfg); err == io.EOF {
-				return cfg, nil
+				return cfg, cfg.Buildkit.normalizeRegistries()
 			} else if err != nil {
 				return Controller{}, err
 			}
@@ -196,7 +932,7 @@ func LoadFromFile(filename string) (Controller, error) {
 		decoder.DisallowUnknownFields()
 		for {
 			if err = decoder.Decode(&cfg); err == io.EOF {
-				return cfg, nil
+				return cfg, cfg.Buildkit.normalizeRegistries()
 			} else if err != nil {
 				return Controller{}, err
 			}
@@ -206,6 +942,67 @@ func LoadFromFile(filename string) (Controller, error) {
 	}
 }
 
+// NormalizeRegistry returns the name go-containerregistry reports for a registry, Docker Hub is reported as
+// "index.docker.io" although it is usually referred to as "docker.io".
+func NormalizeRegistry(registry string) string {
+	if strings.EqualFold(registry, "docker.io") {
+		return name.DefaultRegistry
+	}
+
+	return registry
+}
+
+// normalizeRegistries keys the registry options by their normalized name, so that lookups using the registry of a
+// parsed image reference find them.
+func (b *Buildkit) normalizeRegistries() error {
+	normalized := make(map[string]RegistryConfig, len(b.Registries))
+	for registry, opts := range b.Registries {
+		key := NormalizeRegistry(registry)
+		if _, ok := normalized[key]; ok {
+			return fmt.Errorf("buildkit.registries[%s] duplicates the options of registry %q", registry, key)
+		}
+		normalized[key] = opts
+	}
+	if b.Registries != nil {
+		b.Registries = normalized
+	}
+
+	return nil
+}
+
+// validate returns every problem with the context fetch options.
+func (f ContextFetch) validate() (errs []string) {
+	for _, proxy := range []struct{ field, value string }{
+		{"httpProxy", f.HTTPProxy},
+		{"httpsProxy", f.HTTPSProxy},
+	} {
+		if proxy.value == "" {
+			continue
+		}
+		if u, err := url.Parse(proxy.value); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("buildkit.contextFetch.%s must be an absolute url", proxy.field))
+		}
+	}
+	if f.DialTimeout < 0 {
+		errs = append(errs, "buildkit.contextFetch.dialTimeout cannot be negative")
+	}
+	if f.ResponseHeaderTimeout < 0 {
+		errs = append(errs, "buildkit.contextFetch.responseHeaderTimeout cannot be negative")
+	}
+	if f.MaxRedirects < 0 {
+		errs = append(errs, "buildkit.contextFetch.maxRedirects cannot be negative")
+	}
+	if f.CacheMaxBytes < 0 {
+		errs = append(errs, "buildkit.contextFetch.cacheMaxBytes cannot be negative")
+	}
+	if f.OnWorker && (f.CABundleSecretRef != nil || f.HTTPProxy != "" || f.HTTPSProxy != "" || f.NoProxy != "" ||
+		f.CacheDir != "") {
+		errs = append(errs, "buildkit.contextFetch.onWorker cannot be combined with controller fetch options")
+	}
+
+	return errs
+}
+
 func validatePort(port int) error {
 	if port < 1024 || port > 65535 {
 		return fmt.Errorf("port %d must be between 1024 and 65535", port)
@@ -1,39 +1,46 @@
 package component
 
 import (
-	"github.com/dominodatalab/controller-util/core"
+	"context"
+
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 )
 
-type DeleteBroadcastComponent struct {
+// DeleteBroadcastReconciler broadcasts the keys of deleted builds so running builds are cancelled. Builds held back
+// by a finalizer are broadcast once they are marked for deletion, which the component reconciler never passes to its
+// components.
+type DeleteBroadcastReconciler struct {
+	client client.Client
 	delete chan<- client.ObjectKey
 }
 
-func DeleteBroadcaster(ch chan<- client.ObjectKey) *DeleteBroadcastComponent {
-	return &DeleteBroadcastComponent{
+func DeleteBroadcaster(c client.Client, ch chan<- client.ObjectKey) *DeleteBroadcastReconciler {
+	return &DeleteBroadcastReconciler{
+		client: c,
 		delete: ch,
 	}
 }
 
-func (c *DeleteBroadcastComponent) Reconcile(ctx *core.Context) (ctrl.Result, error) {
-	log := ctx.Log
-	obj := ctx.Object.(*hephv1.ImageBuild)
-	err := ctx.Client.Get(ctx, obj.ObjectKey(), &hephv1.ImageBuild{})
+func (r *DeleteBroadcastReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
 
-	if err == nil {
+	obj := &hephv1.ImageBuild{}
+	err := r.client.Get(ctx, req.NamespacedName, obj)
+	if err == nil && obj.DeletionTimestamp.IsZero() {
 		return ctrl.Result{}, nil
 	}
 
-	if !apierrors.IsNotFound(err) {
+	if err != nil && !apierrors.IsNotFound(err) {
 		return ctrl.Result{}, err
 	}
 
 	log.Info("Broadcasting delete message")
-	c.delete <- obj.ObjectKey()
+	r.delete <- req.NamespacedName
 
 	return ctrl.Result{}, nil
 }
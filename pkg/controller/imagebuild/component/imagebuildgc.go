@@ -8,6 +8,7 @@ import (
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -18,10 +19,23 @@ var (
 	ErrInvalidNamespace  = errors.New("invalid namespace name")
 )
 
+// phaseField is the ImageBuild field selectable on API servers that support CRD selectable fields.
+const phaseField = "status.phase"
+
 type ImageBuildGC struct {
 	HistoryLimit int
 	Client       client.Client
 	Namespaces   []string
+	// Reader lists ImageBuilds instead of the Client, e.g. to paginate against the API server instead of reading
+	// from the cache.
+	Reader client.Reader
+	// PageSize limits the number of ImageBuilds returned by every list call, all builds are listed at once when zero.
+	PageSize int64
+	// PhaseSelector lists finished builds only with a "status.phase" field selector. Every build is listed instead
+	// once the API server rejects the selector, e.g. when the field is not selectable in the cluster.
+	PhaseSelector bool
+
+	phaseSelectorUnsupported bool
 }
 
 func (gc *ImageBuildGC) Start(ctx context.Context) error {
@@ -75,27 +89,17 @@ func (gc *ImageBuildGC) gc(ctx context.Context, namespace string) error {
 	logger.Info("Image Build GC starting")
 	defer logger.Info("Image Build GC finished")
 
-	imageBuilds := &hephv1.ImageBuildList{}
-	err := gc.Client.List(ctx, imageBuilds, client.InNamespace(namespace))
+	builds, err := gc.listFinished(ctx, namespace)
 	if err != nil {
 		logger.Error(err, "ImageBuilds.List failed")
 		return err
 	}
 
-	listLen := len(imageBuilds.Items)
-	if listLen == 0 {
-		logger.Info("No ImageBuilds found")
+	if len(builds) == 0 {
+		logger.Info("No finished ImageBuilds found")
 		return nil
 	}
 
-	var builds []hephv1.ImageBuild
-	for _, ib := range imageBuilds.Items {
-		state := ib.Status.Phase
-		if state == hephv1.PhaseFailed || state == hephv1.PhaseSucceeded {
-			builds = append(builds, ib)
-		}
-	}
-
 	if len(builds) <= gc.HistoryLimit {
 		return nil
 	}
@@ -131,3 +135,75 @@ func (gc *ImageBuildGC) gc(ctx context.Context, namespace string) error {
 
 	return errors.Join(errList...)
 }
+
+// listFinished returns the succeeded and failed builds of the namespace, stripped down to the metadata used to order
+// and delete them.
+func (gc *ImageBuildGC) listFinished(ctx context.Context, namespace string) ([]hephv1.ImageBuild, error) {
+	var builds []hephv1.ImageBuild
+	keep := func(ib *hephv1.ImageBuild) {
+		builds = append(builds, hephv1.ImageBuild{ObjectMeta: metav1.ObjectMeta{
+			Name:              ib.Name,
+			Namespace:         ib.Namespace,
+			CreationTimestamp: ib.CreationTimestamp,
+		}})
+	}
+
+	if gc.PhaseSelector && !gc.phaseSelectorUnsupported {
+		err := gc.list(ctx, namespace, client.MatchingFields{phaseField: string(hephv1.PhaseSucceeded)}, keep)
+		if err == nil {
+			err = gc.list(ctx, namespace, client.MatchingFields{phaseField: string(hephv1.PhaseFailed)}, keep)
+		}
+		if !apierrors.IsBadRequest(err) {
+			return builds, err
+		}
+
+		log.FromContext(ctx).Info("ImageBuild phase field selector is not supported, listing every build", "error", err)
+		gc.phaseSelectorUnsupported = true
+		builds = nil
+	}
+
+	err := gc.list(ctx, namespace, nil, func(ib *hephv1.ImageBuild) {
+		if ib.Status.Phase == hephv1.PhaseFailed || ib.Status.Phase == hephv1.PhaseSucceeded {
+			keep(ib)
+		}
+	})
+
+	return builds, err
+}
+
+// list invokes fn with every ImageBuild of the namespace, one page at a time.
+func (gc *ImageBuildGC) list(
+	ctx context.Context,
+	namespace string,
+	fields client.MatchingFields,
+	fn func(*hephv1.ImageBuild),
+) error {
+	reader := gc.Reader
+	if reader == nil {
+		reader = gc.Client
+	}
+
+	opts := []client.ListOption{client.InNamespace(namespace)}
+	if fields != nil {
+		opts = append(opts, fields)
+	}
+	if gc.PageSize > 0 {
+		opts = append(opts, client.Limit(gc.PageSize))
+	}
+
+	var token string
+	for {
+		imageBuilds := &hephv1.ImageBuildList{}
+		if err := reader.List(ctx, imageBuilds, append(opts, client.Continue(token))...); err != nil {
+			return err
+		}
+
+		for i := range imageBuilds.Items {
+			fn(&imageBuilds.Items[i])
+		}
+
+		if token = imageBuilds.Continue; token == "" {
+			return nil
+		}
+	}
+}
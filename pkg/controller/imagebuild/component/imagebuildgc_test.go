@@ -3,12 +3,18 @@ package component
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	hephv1testing "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -220,6 +226,116 @@ func TestGCNoIBs(t *testing.T) {
 	checkInvokes(t, expected, recorder.invokes)
 }
 
+func TestGCPhaseSelector(t *testing.T) {
+	now := time.Now()
+
+	succeeded := ib("succeeded", "aloha", now.Add(-time.Minute))
+	failed := ib("failed", "aloha", now)
+	failed.Status.Phase = hephv1.PhaseFailed
+	running := ib("running", "aloha", now.Add(-time.Hour))
+	running.Status.Phase = hephv1.PhaseRunning
+
+	phaseIndex := func(obj client.Object) []string {
+		return []string{string(obj.(*hephv1.ImageBuild).Status.Phase)}
+	}
+
+	t.Run("supported", func(t *testing.T) {
+		fakeClient := fake.NewClientBuilder().WithScheme(scheme()).
+			WithObjects(&succeeded, &failed, &running).
+			WithIndex(&hephv1.ImageBuild{}, phaseField, phaseIndex).
+			Build()
+		recorder := newRecorder(fakeClient)
+
+		gc := &ImageBuildGC{Client: recorder.client, Namespaces: []string{"aloha"}, PhaseSelector: true}
+		require.NoError(t, gc.GC(context.Background()))
+
+		checkInvokes(t, []invocation{
+			invokeList("aloha"),
+			invokeList("aloha"),
+			invokeDelete(succeeded),
+			invokeDelete(failed),
+		}, recorder.invokes)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		fakeClient := fake.NewClientBuilder().WithScheme(scheme()).WithObjects(&succeeded, &failed, &running).Build()
+		var selected int
+		reader := interceptor.NewClient(fakeClient, interceptor.Funcs{
+			List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				if (&client.ListOptions{}).ApplyOptions(opts).FieldSelector != nil {
+					selected++
+					return apierrors.NewBadRequest(`field label not supported: status.phase`)
+				}
+				return cl.List(ctx, list, opts...)
+			},
+		})
+		recorder := newRecorder(fakeClient)
+
+		gc := &ImageBuildGC{
+			Client:        recorder.client,
+			Reader:        reader,
+			Namespaces:    []string{"aloha"},
+			PhaseSelector: true,
+		}
+		require.NoError(t, gc.GC(context.Background()))
+		checkInvokes(t, []invocation{invokeDelete(succeeded), invokeDelete(failed)}, recorder.invokes)
+
+		require.NoError(t, gc.GC(context.Background()))
+		assert.Equal(t, 1, selected, "the selector is not retried once rejected")
+	})
+}
+
+func TestGCPagination(t *testing.T) {
+	now := time.Now()
+
+	var objs []client.Object
+	for i := 0; i < 5; i++ {
+		build := ib(fmt.Sprintf("build-%d", i), "aloha", now.Add(time.Duration(i)*time.Minute))
+		objs = append(objs, &build)
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme()).WithObjects(objs...).Build()
+
+	// the fake client does not paginate, pages are served from a complete list instead
+	var tokens []string
+	reader := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			options := (&client.ListOptions{}).ApplyOptions(opts)
+			tokens = append(tokens, options.Continue)
+
+			all := &hephv1.ImageBuildList{}
+			if err := cl.List(ctx, all, client.InNamespace(options.Namespace)); err != nil {
+				return err
+			}
+			start, _ := strconv.Atoi(options.Continue)
+			end := min(start+int(options.Limit), len(all.Items))
+
+			page := list.(*hephv1.ImageBuildList)
+			page.Items = all.Items[start:end]
+			if end < len(all.Items) {
+				page.Continue = strconv.Itoa(end)
+			}
+			return nil
+		},
+	})
+	recorder := newRecorder(fakeClient)
+
+	gc := &ImageBuildGC{
+		HistoryLimit: 2,
+		Client:       recorder.client,
+		Reader:       reader,
+		PageSize:     2,
+		Namespaces:   []string{"aloha"},
+	}
+	require.NoError(t, gc.GC(context.Background()))
+
+	assert.Equal(t, []string{"", "2", "4"}, tokens)
+	checkInvokes(t, []invocation{
+		invokeDelete(*objs[0].(*hephv1.ImageBuild)),
+		invokeDelete(*objs[1].(*hephv1.ImageBuild)),
+		invokeDelete(*objs[2].(*hephv1.ImageBuild)),
+	}, recorder.invokes)
+}
+
 func checkInvokes(t *testing.T, expected []invocation, actual []invocation) {
 	t.Helper()
 	if e, a := len(expected), len(actual); e != a {
@@ -283,17 +399,10 @@ func (r *recorder) Delete(ctx context.Context, cl client.WithWatch, obj client.O
 }
 
 func ib(name, ns string, creation time.Time) hephv1.ImageBuild {
-	return hephv1.ImageBuild{
-		Status: hephv1.ImageBuildStatus{
-			Phase: hephv1.PhaseSucceeded,
-		},
-		TypeMeta: metav1.TypeMeta{Kind: ibGVK.Kind, APIVersion: hephv1.SchemeGroupVersion.String()},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:              name,
-			Namespace:         ns,
-			CreationTimestamp: metav1.NewTime(creation),
-		},
-	}
+	return *hephv1testing.NewImageBuild(name, ns,
+		hephv1testing.WithCreationTimestamp(creation),
+		hephv1testing.Succeeded(creation),
+	)
 }
 
 func invokeList(ns string) invocation {
@@ -0,0 +1,249 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/buildkit"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials"
+)
+
+// imageCleanupTimeout bounds how long the deletion of pushed images is retried before the build is released without
+// them being deleted, so unreachable registries or revoked credentials cannot block the removal of builds forever.
+const imageCleanupTimeout = 10 * time.Minute
+
+// imageCleanupRetryInterval is how often the finalizer checks whether a deleted build that is still running has
+// finished, so images pushed right before its cancellation are deleted too.
+const imageCleanupRetryInterval = 5 * time.Second
+
+var errDeleteUnsupported = errors.New("registry does not support image deletion")
+
+// ImageCleanupReconciler deletes the images pushed by a build from their registries once the build is deleted, when
+// the build requests it with spec.deleteImagesOnCleanup.
+//
+// It runs as its own controller and only adds its finalizer to builds that opt in, so builds being dispatched do not
+// delay the cleanup and the deletion of every other build is not held up by a finalizer.
+type ImageCleanupReconciler struct {
+	cfg      config.Buildkit
+	client   client.Client
+	restCfg  *rest.Config
+	recorder record.EventRecorder
+}
+
+func ImageCleanup(
+	cfg config.Buildkit,
+	c client.Client,
+	restCfg *rest.Config,
+	recorder record.EventRecorder,
+) *ImageCleanupReconciler {
+	return &ImageCleanupReconciler{cfg: cfg, client: c, restCfg: restCfg, recorder: recorder}
+}
+
+func (r *ImageCleanupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	obj := &hephv1.ImageBuild{}
+	if err := r.client.Get(ctx, req.NamespacedName, obj); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if obj.DeletionTimestamp.IsZero() {
+		if !obj.Spec.DeleteImagesOnCleanup || controllerutil.ContainsFinalizer(obj, hephv1.ImageCleanupFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, r.patchFinalizer(ctx, obj, controllerutil.AddFinalizer)
+	}
+
+	if !controllerutil.ContainsFinalizer(obj, hephv1.ImageCleanupFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	res, done, err := r.finalize(ctx, obj)
+	if !done {
+		return res, err
+	}
+
+	return ctrl.Result{}, client.IgnoreNotFound(r.patchFinalizer(ctx, obj, controllerutil.RemoveFinalizer))
+}
+
+func (r *ImageCleanupReconciler) finalize(ctx context.Context, obj *hephv1.ImageBuild) (ctrl.Result, bool, error) {
+	log := ctrllog.FromContext(ctx)
+	expired := time.Since(obj.DeletionTimestamp.Time) >= imageCleanupTimeout
+
+	// deleted builds are cancelled, wait for the dispatcher to record whether the images were pushed regardless
+	if (obj.Status.Phase == "" || obj.Status.Phase == hephv1.PhaseInitializing ||
+		obj.Status.Phase == hephv1.PhaseRunning) && !expired {
+		return ctrl.Result{RequeueAfter: imageCleanupRetryInterval}, false, nil
+	}
+
+	// skipped builds reference images pushed by someone else
+	if !obj.Spec.DeleteImagesOnCleanup || obj.Status.Phase != hephv1.PhaseSucceeded || obj.Status.Digest == "" ||
+		meta.IsStatusConditionTrue(obj.Status.Conditions, buildSkippedCondition) {
+		return ctrl.Result{}, true, nil
+	}
+
+	log = log.WithValues("digest", obj.Status.Digest)
+	err := r.deleteImages(ctx, log, obj)
+	if err == nil {
+		log.Info("Deleted pushed images", "images", obj.Spec.Images)
+		return ctrl.Result{}, true, nil
+	}
+
+	if !errors.Is(err, errDeleteUnsupported) && !expired {
+		return ctrl.Result{}, false, err
+	}
+
+	msg := fmt.Sprintf("Pushed images were not deleted: %s", err)
+	log.Error(err, "Giving up on deleting pushed images", "images", obj.Spec.Images)
+	r.recorder.Event(obj, corev1.EventTypeWarning, "ImageCleanupFailed", msg)
+
+	return ctrl.Result{}, true, nil
+}
+
+func (r *ImageCleanupReconciler) patchFinalizer(
+	ctx context.Context,
+	obj *hephv1.ImageBuild,
+	update func(client.Object, string) bool,
+) error {
+	patch := client.MergeFromWithOptions(obj.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	update(obj, hephv1.ImageCleanupFinalizer)
+
+	return r.client.Patch(ctx, obj, patch)
+}
+
+func (r *ImageCleanupReconciler) deleteImages(ctx context.Context, log logr.Logger, obj *hephv1.ImageBuild) error {
+	scope := credentials.NewScope(obj.Namespace, r.cfg)
+	configDir, sources, err := credentials.Persist(ctx, log, r.restCfg, scope, obj.Spec.RegistryAuth)
+	if err != nil {
+		return fmt.Errorf("registry credentials processing failed: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(configDir); err != nil {
+			log.Error(err, "Failed to delete registry credentials")
+		}
+		if err := sources.Revoke(context.WithoutCancel(ctx)); err != nil {
+			log.Error(err, "Failed to revoke registry access tokens")
+		}
+	}()
+
+	caBundles, err := credentials.ReadCABundles(ctx, r.restCfg, r.cfg)
+	if err != nil {
+		return err
+	}
+	registries, err := newRegistryAccess(r.cfg, caBundles)
+	if err != nil {
+		return err
+	}
+
+	inUse, err := r.repositoriesInUse(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	resolveAuth := func(registry string) (authn.Authenticator, error) {
+		return buildkit.ResolveAuth(configDir, registry)
+	}
+
+	return deleteImages(ctx, log, resolveAuth, obj.Spec.Images, obj.Status.Digest, inUse, registries)
+}
+
+// repositoriesInUse returns the repositories where other builds that are not being deleted recorded the digest of
+// the build. Deleting a manifest removes every tag that points at it, so it is kept while any of them still uses it.
+func (r *ImageCleanupReconciler) repositoriesInUse(
+	ctx context.Context,
+	obj *hephv1.ImageBuild,
+) (map[string]bool, error) {
+	var builds hephv1.ImageBuildList
+	if err := r.client.List(ctx, &builds); err != nil {
+		return nil, fmt.Errorf("cannot list image builds: %w", err)
+	}
+
+	inUse := map[string]bool{}
+	for _, build := range builds.Items {
+		if build.UID == obj.UID || !build.DeletionTimestamp.IsZero() || build.Status.Digest != obj.Status.Digest {
+			continue
+		}
+
+		for _, imageName := range build.Spec.Images {
+			ref, err := name.ParseReference(imageName)
+			if err != nil {
+				continue
+			}
+			inUse[ref.Context().Name()] = true
+		}
+	}
+
+	return inUse, nil
+}
+
+// deleteImages deletes the manifest with the digest from the repository of every image, except from the repositories
+// in use by other builds. Manifests that no longer exist are considered deleted.
+func deleteImages(
+	ctx context.Context,
+	log logr.Logger,
+	resolveAuth func(registry string) (authn.Authenticator, error),
+	images []string,
+	digest string,
+	inUse map[string]bool,
+	registries registryAccess,
+) error {
+	var errs []error
+	deleted := map[string]bool{}
+	for _, imageName := range images {
+		ref, opts, err := remoteReference(ctx, resolveAuth, imageName, registries)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot delete %q: %w", imageName, err))
+			continue
+		}
+
+		repo := ref.Context()
+		if deleted[repo.String()] {
+			continue
+		}
+		if inUse[repo.Name()] {
+			log.Info("Image is still used by another build, not deleting it", "imageName", imageName)
+			deleted[repo.String()] = true
+			continue
+		}
+
+		err = remote.Delete(repo.Digest(digest), opts...)
+
+		var terr *transport.Error
+		if errors.As(err, &terr) {
+			switch terr.StatusCode {
+			case http.StatusNotFound:
+				log.Info("Image already deleted", "imageName", imageName)
+				err = nil
+			case http.StatusMethodNotAllowed:
+				err = fmt.Errorf("%w: %w", errDeleteUnsupported, err)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot delete %q: %w", imageName, err))
+			continue
+		}
+
+		deleted[repo.String()] = true
+	}
+
+	return errors.Join(errs...)
+}
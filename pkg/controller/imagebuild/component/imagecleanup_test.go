@@ -0,0 +1,163 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func TestDeleteImages(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	anonymous := func(string) (authn.Authenticator, error) { return authn.Anonymous, nil }
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	digest, err := img.Digest()
+	require.NoError(t, err)
+
+	images := []string{
+		fmt.Sprintf("%s/cleanup:v1", host),
+		fmt.Sprintf("%s/cleanup:latest", host),
+		fmt.Sprintf("%s/mirror:v1", host),
+	}
+	for _, image := range images {
+		ref, err := name.ParseReference(image)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img))
+	}
+
+	shared := fmt.Sprintf("%s/shared:v1", host)
+	sharedRef, err := name.ParseReference(shared)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(sharedRef, img))
+	inUse := map[string]bool{sharedRef.Context().Name(): true}
+
+	err = deleteImages(context.Background(), logr.Discard(), anonymous, append(images, shared), digest.String(), inUse,
+		registryAccess{})
+	require.NoError(t, err)
+
+	_, err = remote.Head(sharedRef)
+	assert.NoError(t, err, "images other builds still use are kept")
+
+	for _, image := range images {
+		ref, err := name.ParseReference(image)
+		require.NoError(t, err)
+		_, err = remote.Head(ref.Context().Digest(digest.String()))
+		assert.Error(t, err, "the manifest of %q is deleted", image)
+	}
+
+	err = deleteImages(context.Background(), logr.Discard(), anonymous, images, digest.String(), nil, registryAccess{})
+	assert.NoError(t, err, "images that no longer exist are considered deleted")
+
+	err = deleteImages(context.Background(), logr.Discard(), anonymous, []string{"not a valid ref"}, digest.String(), nil,
+		registryAccess{})
+	assert.Error(t, err)
+}
+
+func TestImageCleanupFinalizer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, hephv1.AddToScheme(scheme))
+
+	optIn := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{Name: "opt-in", Namespace: "team-a"},
+		Spec:       hephv1.ImageBuildSpec{DeleteImagesOnCleanup: true},
+		Status:     hephv1.ImageBuildStatus{Phase: hephv1.PhaseRunning},
+	}
+	optOut := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{Name: "opt-out", Namespace: "team-a"},
+		Status:     hephv1.ImageBuildStatus{Phase: hephv1.PhaseRunning},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(optIn, optOut).
+		WithStatusSubresource(&hephv1.ImageBuild{}).
+		Build()
+
+	ctx := context.Background()
+	r := ImageCleanup(config.Buildkit{}, c, nil, record.NewFakeRecorder(10))
+	reconcile := func(obj client.Object) ctrl.Result {
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)})
+		require.NoError(t, err)
+		return res
+	}
+
+	reconcile(optIn)
+	reconcile(optOut)
+
+	var ib hephv1.ImageBuild
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(optOut), &ib))
+	assert.Empty(t, ib.Finalizers, "builds that do not opt in are deleted without a finalizer")
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(optIn), &ib))
+	assert.True(t, controllerutil.ContainsFinalizer(&ib, hephv1.ImageCleanupFinalizer))
+
+	require.NoError(t, c.Delete(ctx, &ib))
+	res := reconcile(optIn)
+	assert.Equal(t, imageCleanupRetryInterval, res.RequeueAfter, "running builds are cleaned up once they finish")
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(optIn), &ib))
+
+	ib.Status.Phase = hephv1.PhaseFailed
+	require.NoError(t, c.Status().Update(ctx, &ib))
+	reconcile(optIn)
+
+	err := c.Get(ctx, client.ObjectKeyFromObject(optIn), &ib)
+	assert.True(t, apierrors.IsNotFound(err), "failed builds are released without deleting images")
+}
+
+func TestRepositoriesInUse(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, hephv1.AddToScheme(scheme))
+
+	build := func(name, digest string, images ...string) *hephv1.ImageBuild {
+		return &hephv1.ImageBuild{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a", UID: types.UID(name)},
+			Spec:       hephv1.ImageBuildSpec{Images: images},
+			Status:     hephv1.ImageBuildStatus{Digest: digest},
+		}
+	}
+	obj := build("deleted", "sha256:aaa", "registry.example.com/app:v1")
+	deleting := build("deleting", "sha256:aaa", "registry.example.com/deleting:v1")
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleting.Finalizers = []string{hephv1.ImageCleanupFinalizer}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			obj,
+			deleting,
+			build("same-content", "sha256:aaa", "registry.example.com/app:v2", "mirror.example.com/app:v2"),
+			build("other-content", "sha256:bbb", "registry.example.com/other:v1"),
+		).
+		Build()
+
+	r := ImageCleanup(config.Buildkit{}, c, nil, record.NewFakeRecorder(10))
+	inUse, err := r.repositoriesInUse(context.Background(), obj)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"registry.example.com/app": true, "mirror.example.com/app": true}, inUse)
+}
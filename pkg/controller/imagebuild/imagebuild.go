@@ -13,19 +13,110 @@ import (
 	"github.com/dominodatalab/hephaestus/pkg/config"
 	"github.com/dominodatalab/hephaestus/pkg/controller/imagebuild/component"
 	"github.com/dominodatalab/hephaestus/pkg/controller/imagebuild/predicate"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/audit"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/phase"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/quota"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/secrets"
+	"github.com/dominodatalab/hephaestus/pkg/webhook"
 )
 
+// number of ImageBuilds fetched by every list call of the garbage collector
+const gcPageSize = 500
+
 func Register(mgr ctrl.Manager,
 	cfg config.Controller,
 	pool worker.Pool,
+	arm64Pool worker.Pool,
 	nr *newrelic.Application,
 	deleteChan chan client.ObjectKey,
 ) error {
+	whCfg := webhook.ImageBuildConfig{}
+	if cfg.Manager.ImageBuild.ValidateSecrets {
+		whCfg.SecretReader = func(string) (client.Reader, error) { return mgr.GetAPIReader(), nil }
+
+		// secrets are checked with the access of the service account the build reads them with
+		if sa := cfg.Buildkit.SecretsServiceAccount; sa != "" {
+			whCfg.SecretReader = func(namespace string) (client.Reader, error) {
+				return client.New(secrets.ImpersonatedConfig(mgr.GetConfig(), namespace, sa), client.Options{
+					Scheme: mgr.GetScheme(),
+					Mapper: mgr.GetRESTMapper(),
+				})
+			}
+		}
+	}
+
+	whCfg.KnownRegistries = cfg.Manager.ImageBuild.KnownRegistries
+	for registry, opts := range cfg.Buildkit.Registries {
+		if opts.ReadOnly {
+			whCfg.ReadOnlyRegistries = append(whCfg.ReadOnlyRegistries, registry)
+		}
+	}
+
+	limits := cfg.Manager.ImageBuild.SpecLimits
+	whCfg.SpecLimits = webhook.SpecLimits{
+		Images:       webhook.ListLimit(limits.Images),
+		BuildArgs:    webhook.ListLimit(limits.BuildArgs),
+		RegistryAuth: webhook.ListLimit(limits.RegistryAuth),
+	}
+
+	if q := cfg.Manager.ImageBuild.Quota; q.Enabled() {
+		window := q.Window
+		if window <= 0 {
+			window = quota.DefaultWindow
+		}
+		whCfg.QuotaReader = mgr.GetAPIReader()
+		whCfg.Quota = webhook.BuildQuota{
+			Window:         window,
+			MaxBuilds:      q.MaxBuilds,
+			MaxPushedBytes: q.MaxPushedBytes,
+		}
+	}
+
+	hooks := phase.NewTransitionHooks(cfg.Manager.ImageBuild.TransitionHooks)
+	if cfg.Audit.Enabled {
+		auditHook, err := audit.NewHook(cfg.Audit)
+		if err != nil {
+			return err
+		}
+		hooks = append(hooks, auditHook)
+	}
+
+	dispatcher := component.BuildDispatcher(
+		cfg.Buildkit, cfg.Manager.ImageBuild, pool, arm64Pool, nr, cfg.NewRelic, deleteChan, hooks,
+	)
+	// the dispatcher limits concurrent builds itself, the spare reconcile keeps queued and finished builds moving while
+	// every build slot is taken
 	err := core.NewReconciler(mgr).
 		For(&hephv1.ImageBuild{}).
-		Component("build-dispatcher", component.BuildDispatcher(cfg.Buildkit, pool, nr, deleteChan)).
-		WithControllerOptions(controller.Options{MaxConcurrentReconciles: cfg.Manager.ImageBuild.Concurrency}).
-		WithWebhooks().
+		Component("build-dispatcher", dispatcher).
+		WithControllerOptions(controller.Options{MaxConcurrentReconciles: cfg.Manager.ImageBuild.Concurrency + 1}).
+		Complete()
+	if err != nil {
+		return err
+	}
+
+	// builds are dispatched by a blocking reconcile, so deleting the images of finished builds runs in its own
+	// controller and only builds that opt in carry its finalizer
+	err = ctrl.NewControllerManagedBy(mgr).
+		For(&hephv1.ImageBuild{}, builder.WithPredicates(predicate.ImageCleanupPredicate())).
+		Named("imagecleanup").
+		Complete(component.ImageCleanup(
+			cfg.Buildkit, mgr.GetClient(), mgr.GetConfig(), mgr.GetEventRecorderFor("imagecleanup"),
+		))
+	if err != nil {
+		return err
+	}
+
+	// the webhooks are configured by the controller config, so they cannot use the registration built into the
+	// reconciler
+	defaulter, err := webhook.NewImageBuildDefaulter(cfg.Manager.ImageBuild.CacheImportTemplate)
+	if err != nil {
+		return err
+	}
+	err = ctrl.NewWebhookManagedBy(mgr).
+		For(&hephv1.ImageBuild{}).
+		WithDefaulter(defaulter).
+		WithValidator(webhook.NewImageBuildValidator(whCfg)).
 		Complete()
 	if err != nil {
 		return err
@@ -35,18 +126,22 @@ func Register(mgr ctrl.Manager,
 	if len(namespaces) == 0 {
 		namespaces = []string{""}
 	}
+	// builds are listed from the API server in pages, the cache cannot paginate and namespaces may hold 100k builds
 	return mgr.Add(&component.ImageBuildGC{
-		HistoryLimit: cfg.Manager.ImageBuild.HistoryLimit,
-		Client:       mgr.GetClient(),
-		Namespaces:   namespaces,
+		HistoryLimit:  cfg.Manager.ImageBuild.HistoryLimit,
+		Client:        mgr.GetClient(),
+		Namespaces:    namespaces,
+		Reader:        mgr.GetAPIReader(),
+		PageSize:      gcPageSize,
+		PhaseSelector: true,
 	})
 }
 
 func RegisterImageBuildDelete(mgr ctrl.Manager, deleteChan chan client.ObjectKey) error {
-	return core.NewReconciler(mgr).
-		For(&hephv1.ImageBuild{}, builder.WithPredicates(predicate.BlindDeletePredicate{})).
+	// the component reconciler skips its components for objects marked for deletion, which cancel builds held back by
+	// the image cleanup finalizer
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&hephv1.ImageBuild{}, builder.WithPredicates(predicate.DeletionPredicate{})).
 		Named("imagebuilddelete").
-		Component("delete-broadcaster", component.DeleteBroadcaster(deleteChan)).
-		ReconcileNotFound().
-		Complete()
+		Complete(component.DeleteBroadcaster(mgr.GetClient(), deleteChan))
 }
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+const (
+	namespace = "hephaestus"
+	subsystem = "imagebuild"
+)
+
+// durationBuckets spans 1s to ~68m which covers everything from a cache hit to a large data science image.
+var durationBuckets = prometheus.ExponentialBuckets(1, 2, 13)
+
+var (
+	queueDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "queue_duration_seconds",
+			Help:      "Time between ImageBuild creation and the start of build processing.",
+			Buckets:   durationBuckets,
+		},
+		[]string{"namespace"},
+	)
+	allocationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "allocation_duration_seconds",
+			Help:      "Time spent leasing a buildkit worker.",
+			Buckets:   durationBuckets,
+		},
+		[]string{"namespace"},
+	)
+	buildDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "build_duration_seconds",
+			Help:      "Time spent building and pushing images with buildkit.",
+			Buckets:   durationBuckets,
+		},
+		[]string{"namespace"},
+	)
+	pushDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "push_duration_seconds",
+			Help:      "Time spent pushing solved images to the registry.",
+			Buckets:   durationBuckets,
+		},
+		[]string{"namespace"},
+	)
+	completions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "completions_total",
+			Help:      "Number of ImageBuilds that reached a terminal phase.",
+		},
+		[]string{"namespace", "phase", "reason"},
+	)
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(queueDuration, allocationDuration, buildDuration, pushDuration, completions)
+}
+
+// ObserveQueued records the time an ImageBuild waited before it was initialized.
+//
+// The duration is derived from the creation timestamp and the most recent Initializing transition.
+func ObserveQueued(ib *hephv1.ImageBuild) {
+	if d := ib.QueueTime(); d != nil {
+		queueDuration.WithLabelValues(ib.Namespace).Observe(d.Seconds())
+	}
+}
+
+// ObserveAllocation records the time spent leasing a buildkit worker.
+func ObserveAllocation(ib *hephv1.ImageBuild, d time.Duration) {
+	allocationDuration.WithLabelValues(ib.Namespace).Observe(d.Seconds())
+}
+
+// ObserveBuild records the time spent inside buildkit.
+func ObserveBuild(ib *hephv1.ImageBuild, d time.Duration) {
+	buildDuration.WithLabelValues(ib.Namespace).Observe(d.Seconds())
+}
+
+// ObservePush records the time between the start of the image export and the end of the build.
+func ObservePush(ib *hephv1.ImageBuild, d time.Duration) {
+	pushDuration.WithLabelValues(ib.Namespace).Observe(d.Seconds())
+}
+
+// RecordSuccess increments the completion counter for a successful build.
+func RecordSuccess(ib *hephv1.ImageBuild) {
+	completions.WithLabelValues(ib.Namespace, string(hephv1.PhaseSucceeded), "").Inc()
+}
+
+// RecordFailure increments the completion counter for a failed build using a short, low-cardinality reason.
+func RecordFailure(ib *hephv1.ImageBuild, reason string) {
+	completions.WithLabelValues(ib.Namespace, string(hephv1.PhaseFailed), reason).Inc()
+}
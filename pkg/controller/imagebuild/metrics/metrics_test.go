@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+func TestObserveQueued(t *testing.T) {
+	created := time.Now().Add(-time.Minute)
+	ib := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "queued",
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Status: hephv1.ImageBuildStatus{
+			Transitions: []hephv1.ImageBuildTransition{
+				{Phase: hephv1.PhaseInitializing, OccurredAt: metav1.NewTime(created.Add(30 * time.Second))},
+			},
+		},
+	}
+
+	ObserveQueued(ib)
+	assert.Equal(t, 1, testutil.CollectAndCount(queueDuration, "hephaestus_imagebuild_queue_duration_seconds"))
+
+	ObserveQueued(&hephv1.ImageBuild{ObjectMeta: metav1.ObjectMeta{Namespace: "never-initialized"}})
+	assert.Equal(t, 1, testutil.CollectAndCount(queueDuration, "hephaestus_imagebuild_queue_duration_seconds"))
+}
+
+func TestCompletions(t *testing.T) {
+	ib := &hephv1.ImageBuild{ObjectMeta: metav1.ObjectMeta{Namespace: "completions"}}
+
+	RecordSuccess(ib)
+	RecordSuccess(ib)
+	RecordFailure(ib, "ImageBuildError")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(completions.WithLabelValues("completions", "Succeeded", "")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(completions.WithLabelValues("completions", "Failed", "ImageBuildError")))
+}
+
+func TestObservePush(t *testing.T) {
+	ObservePush(&hephv1.ImageBuild{ObjectMeta: metav1.ObjectMeta{Namespace: "pushed"}}, 30*time.Second)
+	assert.Equal(t, 1, testutil.CollectAndCount(pushDuration, "hephaestus_imagebuild_push_duration_seconds"))
+}
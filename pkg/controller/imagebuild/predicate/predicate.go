@@ -1,18 +1,37 @@
 package predicate
 
 import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 )
 
-var _ predicate.Predicate = BlindDeletePredicate{}
+var _ predicate.Predicate = DeletionPredicate{}
 
-// BlindDeletePredicate implements a deleted predicate function that always returns true.
+// DeletionPredicate implements a predicate that passes every delete event and the updates that mark an object for
+// deletion, i.e. objects held back by a finalizer.
 //
 // All other events are ignored.
-type BlindDeletePredicate struct{}
+type DeletionPredicate struct{}
+
+func (p DeletionPredicate) Create(event.CreateEvent) bool { return false }
+func (p DeletionPredicate) Delete(event.DeleteEvent) bool { return true }
+func (p DeletionPredicate) Update(e event.UpdateEvent) bool {
+	return e.ObjectOld.GetDeletionTimestamp().IsZero() && !e.ObjectNew.GetDeletionTimestamp().IsZero()
+}
+func (p DeletionPredicate) Generic(event.GenericEvent) bool { return false }
+
+// ImageCleanupPredicate passes the events of ImageBuilds that opt in to image cleanup or still carry its finalizer.
+func ImageCleanupPredicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(o client.Object) bool {
+		obj, ok := o.(*hephv1.ImageBuild)
+		if !ok {
+			return false
+		}
 
-func (p BlindDeletePredicate) Create(event.CreateEvent) bool   { return false }
-func (p BlindDeletePredicate) Delete(event.DeleteEvent) bool   { return true }
-func (p BlindDeletePredicate) Update(event.UpdateEvent) bool   { return false }
-func (p BlindDeletePredicate) Generic(event.GenericEvent) bool { return false }
+		return obj.Spec.DeleteImagesOnCleanup || controllerutil.ContainsFinalizer(obj, hephv1.ImageCleanupFinalizer)
+	})
+}
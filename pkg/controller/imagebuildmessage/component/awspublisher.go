@@ -0,0 +1,122 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/go-logr/logr"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+type snsClient interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+type sqsClient interface {
+	SendMessage(
+		ctx context.Context,
+		params *sqs.SendMessageInput,
+		optFns ...func(*sqs.Options),
+	) (*sqs.SendMessageOutput, error)
+}
+
+// AWSPublisher publishes messages to an SNS topic and/or an SQS queue so installs on AWS do not need a broker. The
+// message attributes allow SNS subscription filter policies, e.g. to deliver the messages of one namespace only.
+type AWSPublisher struct {
+	log      logr.Logger
+	topicARN string
+	queueURL string
+	sns      snsClient
+	sqs      sqsClient
+}
+
+// NewAWSPublisher resolves the AWS credentials from the environment. The region is resolved from the environment or
+// the instance metadata unless it is set in the configuration.
+func NewAWSPublisher(ctx context.Context, log logr.Logger, cfg config.AWSMessaging) (*AWSPublisher, error) {
+	opt := awsconfig.WithEC2IMDSRegion()
+	if cfg.Region != "" {
+		opt = awsconfig.WithRegion(cfg.Region)
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load aws configuration: %w", err)
+	}
+
+	return &AWSPublisher{
+		log:      log,
+		topicARN: cfg.TopicARN,
+		queueURL: cfg.QueueURL,
+		sns:      sns.NewFromConfig(awsCfg),
+		sqs:      sqs.NewFromConfig(awsCfg),
+	}, nil
+}
+
+// Publish sends the message body to the topic and then the queue. FIFO topics and queues receive messages grouped by
+// ImageBuild so the transitions of a build are delivered in order.
+func (p *AWSPublisher) Publish(ctx context.Context, msg outboundMessage) error {
+	groupID, dedupID := fifoIDs(msg)
+
+	if p.topicARN != "" {
+		input := &sns.PublishInput{
+			TopicArn:          aws.String(p.topicARN),
+			Message:           aws.String(string(msg.Body)),
+			MessageAttributes: map[string]snstypes.MessageAttributeValue{},
+		}
+		for k, v := range msg.Attributes {
+			input.MessageAttributes[k] = snstypes.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(v),
+			}
+		}
+		if strings.HasSuffix(p.topicARN, ".fifo") {
+			input.MessageGroupId = aws.String(groupID)
+			input.MessageDeduplicationId = aws.String(dedupID)
+		}
+
+		p.log.Info("Publishing message to SNS", "topicARN", p.topicARN)
+		if _, err := p.sns.Publish(ctx, input); err != nil {
+			return fmt.Errorf("sns publishing failed: %w", err)
+		}
+	}
+
+	if p.queueURL != "" {
+		input := &sqs.SendMessageInput{
+			QueueUrl:          aws.String(p.queueURL),
+			MessageBody:       aws.String(string(msg.Body)),
+			MessageAttributes: map[string]sqstypes.MessageAttributeValue{},
+		}
+		for k, v := range msg.Attributes {
+			input.MessageAttributes[k] = sqstypes.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(v),
+			}
+		}
+		if strings.HasSuffix(p.queueURL, ".fifo") {
+			input.MessageGroupId = aws.String(groupID)
+			input.MessageDeduplicationId = aws.String(dedupID)
+		}
+
+		p.log.Info("Sending message to SQS", "queueURL", p.queueURL)
+		if _, err := p.sqs.SendMessage(ctx, input); err != nil {
+			return fmt.Errorf("sqs publishing failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// fifoIDs returns the FIFO message group of the build and a deduplication id unique to the transition, so a message
+// published again after a failed status update is dropped.
+func fifoIDs(msg outboundMessage) (groupID, dedupID string) {
+	groupID = msg.Attributes["namespace"] + "/" + msg.Attributes["name"]
+	return groupID, groupID + "/" + msg.Attributes["phase"]
+}
@@ -0,0 +1,92 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSNS struct {
+	inputs []*sns.PublishInput
+	err    error
+}
+
+func (f *fakeSNS) Publish(_ context.Context, in *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &sns.PublishOutput{}, f.err
+}
+
+type fakeSQS struct {
+	inputs []*sqs.SendMessageInput
+}
+
+func (f *fakeSQS) SendMessage(
+	_ context.Context,
+	in *sqs.SendMessageInput,
+	_ ...func(*sqs.Options),
+) (*sqs.SendMessageOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestAWSPublisher(t *testing.T) {
+	msg := outboundMessage{
+		Body:       []byte(`{"name":"build"}`),
+		Attributes: map[string]string{"namespace": "team-a", "name": "build", "phase": "Running"},
+	}
+
+	t.Run("topic_and_queue", func(t *testing.T) {
+		snsc, sqsc := &fakeSNS{}, &fakeSQS{}
+		p := &AWSPublisher{
+			log:      logr.Discard(),
+			topicARN: "arn:aws:sns:us-west-2:123456789012:builds",
+			queueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/builds",
+			sns:      snsc,
+			sqs:      sqsc,
+		}
+		require.NoError(t, p.Publish(context.Background(), msg))
+
+		require.Len(t, snsc.inputs, 1)
+		assert.Equal(t, `{"name":"build"}`, aws.ToString(snsc.inputs[0].Message))
+		assert.Equal(t, "team-a", aws.ToString(snsc.inputs[0].MessageAttributes["namespace"].StringValue))
+		assert.Nil(t, snsc.inputs[0].MessageGroupId, "standard topics do not take a message group")
+
+		require.Len(t, sqsc.inputs, 1)
+		assert.Equal(t, `{"name":"build"}`, aws.ToString(sqsc.inputs[0].MessageBody))
+		assert.Equal(t, "Running", aws.ToString(sqsc.inputs[0].MessageAttributes["phase"].StringValue))
+	})
+
+	t.Run("fifo", func(t *testing.T) {
+		sqsc := &fakeSQS{}
+		p := &AWSPublisher{
+			log:      logr.Discard(),
+			queueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/builds.fifo",
+			sqs:      sqsc,
+		}
+		require.NoError(t, p.Publish(context.Background(), msg))
+
+		require.Len(t, sqsc.inputs, 1)
+		assert.Equal(t, "team-a/build", aws.ToString(sqsc.inputs[0].MessageGroupId))
+		assert.Equal(t, "team-a/build/Running", aws.ToString(sqsc.inputs[0].MessageDeduplicationId))
+	})
+
+	t.Run("topic_error", func(t *testing.T) {
+		snsc, sqsc := &fakeSNS{err: errors.New("throttled")}, &fakeSQS{}
+		p := &AWSPublisher{
+			log:      logr.Discard(),
+			topicARN: "arn:aws:sns:us-west-2:123456789012:builds",
+			queueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/builds",
+			sns:      snsc,
+			sqs:      sqsc,
+		}
+		assert.ErrorContains(t, p.Publish(context.Background(), msg), "throttled")
+		assert.Empty(t, sqsc.inputs, "the queue is not sent to once publishing to the topic failed")
+	})
+}
@@ -0,0 +1,140 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	amqpclient "github.com/dominodatalab/amqp-client"
+	"github.com/go-logr/logr"
+	"github.com/rabbitmq/amqp091-go"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+// queueArgs match the queues declared by the amqp client so queues declared by either are interchangeable.
+var queueArgs = amqp091.Table{"x-single-active-consumer": true}
+
+// bindingKey is the key the queue is bound to the exchange with. Queues of topic exchanges receive every message
+// published to the exchange, tenants bind their own queues to narrower patterns.
+func (m outboundMessage) bindingKey() string {
+	if m.ExchangeType == config.AMQPExchangeTopic {
+		return "#"
+	}
+
+	return m.RoutingKey
+}
+
+// brokerChannel publishes on a connection managed by the amqp client. The client itself only publishes to direct
+// exchanges with the queue name as routing key, which does not allow tenants to subscribe to a subset of messages.
+type brokerChannel struct {
+	log     logr.Logger
+	manager *amqpclient.ConnectionManager
+}
+
+func newBrokerChannel(log logr.Logger, url string) (*brokerChannel, error) {
+	manager, err := amqpclient.NewConnectionManager(log, url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create connection manager: %w", err)
+	}
+
+	return &brokerChannel{log: log.WithName("broker-channel"), manager: manager}, nil
+}
+
+func (c *brokerChannel) Publish(ctx context.Context, msg outboundMessage) error {
+	if err := c.ensureExchange(msg); err != nil {
+		return err
+	}
+	if err := c.ensureQueue(msg); err != nil {
+		return err
+	}
+
+	headers := amqp091.Table{}
+	for k, v := range msg.Attributes {
+		headers[k] = v
+	}
+
+	publishing := amqp091.Publishing{
+		Headers:      headers,
+		Timestamp:    time.Now(),
+		DeliveryMode: amqp091.Persistent,
+		ContentType:  msg.ContentType,
+		Body:         msg.Body,
+	}
+
+	c.log.Info("Sending message to server", "exchange", msg.Exchange, "queue", msg.Queue, "routingKey", msg.RoutingKey)
+	err := c.manager.WithChannelAndConfirmation(func(ch *amqp091.Channel) error {
+		return ch.PublishWithContext(ctx, msg.Exchange, msg.RoutingKey, true, false, publishing)
+	})
+	if err != nil {
+		return fmt.Errorf("message publishing failed: %w", err)
+	}
+
+	return nil
+}
+
+func (c *brokerChannel) Close() error {
+	return c.manager.Close()
+}
+
+func (c *brokerChannel) ensureExchange(msg outboundMessage) error {
+	if msg.Exchange == "" {
+		return nil
+	}
+
+	err := c.manager.WithChannel(func(ch *amqp091.Channel) error {
+		return ch.ExchangeDeclarePassive(msg.Exchange, msg.ExchangeType, true, false, false, false, nil)
+	})
+	if isNotFound(err) {
+		err = c.manager.WithChannel(func(ch *amqp091.Channel) error {
+			return ch.ExchangeDeclare(msg.Exchange, msg.ExchangeType, true, false, false, false, nil)
+		})
+		if err != nil {
+			return fmt.Errorf("cannot declare exchange: %w", err)
+		}
+	}
+
+	return err
+}
+
+func (c *brokerChannel) ensureQueue(msg outboundMessage) error {
+	if msg.Queue == "" {
+		return nil
+	}
+
+	err := c.manager.WithChannel(func(ch *amqp091.Channel) error {
+		_, err := ch.QueueInspect(msg.Queue)
+		return err
+	})
+	if !isNotFound(err) {
+		return err
+	}
+
+	err = c.manager.WithChannel(func(ch *amqp091.Channel) error {
+		_, err := ch.QueueDeclare(msg.Queue, true, false, false, false, queueArgs)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot declare queue: %w", err)
+	}
+
+	if msg.Exchange == "" {
+		return nil
+	}
+
+	err = c.manager.WithChannel(func(ch *amqp091.Channel) error {
+		return ch.QueueBind(msg.Queue, msg.bindingKey(), msg.Exchange, false, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot bind queue to exchange: %w", err)
+	}
+
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var ae *amqp091.Error
+	return errors.As(err, &ae) && strings.HasPrefix(ae.Reason, "NOT_FOUND")
+}
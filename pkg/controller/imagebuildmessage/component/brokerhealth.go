@@ -0,0 +1,131 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+const defaultBrokerProbeTimeout = 5 * time.Second
+
+var brokerUp = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "hephaestus",
+	Subsystem: "messaging",
+	Name:      "broker_up",
+	Help:      "Whether the last connectivity probe of the AMQP broker succeeded.",
+})
+
+// the gauge is only registered once a probe is created so that it is not exported as down when probing is disabled
+var registerBrokerUp sync.Once
+
+// BrokerHealth dials the AMQP broker periodically, independently of the publisher channels which are only opened
+// once a message is published. The outcome of the last probe is reported by the broker_up metric and by Check.
+type BrokerHealth struct {
+	log      logr.Logger
+	url      string
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.RWMutex
+	lastErr error
+}
+
+// NewBrokerHealth returns a health check for the broker at url.
+func NewBrokerHealth(log logr.Logger, url string, cfg config.AMQPHealthCheck) *BrokerHealth {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultBrokerProbeTimeout
+	}
+
+	registerBrokerUp.Do(func() { ctrlmetrics.Registry.MustRegister(brokerUp) })
+
+	return &BrokerHealth{log: log, url: url, interval: cfg.Interval, timeout: timeout}
+}
+
+// NeedLeaderElection is false so that every replica reports its own connectivity.
+func (h *BrokerHealth) NeedLeaderElection() bool {
+	return false
+}
+
+// Start probes the broker right away and then once per interval until the context is cancelled.
+func (h *BrokerHealth) Start(ctx context.Context) error {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.probe()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check returns the error of the last probe, it can be added as a health or readiness check of the manager. It
+// succeeds until the first probe finished.
+func (h *BrokerHealth) Check(*http.Request) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.lastErr
+}
+
+func (h *BrokerHealth) probe() {
+	err := h.dial()
+
+	h.mu.Lock()
+	recovered := err == nil && h.lastErr != nil
+	h.lastErr = err
+	h.mu.Unlock()
+
+	redacted := h.url
+	if u, pErr := url.Parse(h.url); pErr == nil {
+		redacted = u.Redacted()
+	}
+
+	switch {
+	case err != nil:
+		brokerUp.Set(0)
+		h.log.Error(err, "AMQP broker is unreachable", "url", redacted)
+	case recovered:
+		brokerUp.Set(1)
+		h.log.Info("AMQP broker is reachable again", "url", redacted)
+	default:
+		brokerUp.Set(1)
+	}
+}
+
+// dial opens a channel the same way the publisher does and closes it again. The wait is bounded by the probe timeout,
+// a dial that completes afterwards closes its channel in the background.
+func (h *BrokerHealth) dial() error {
+	dial := dialChannel
+	result := make(chan error, 1)
+	go func() {
+		ch, err := dial(h.log, h.url)
+		if err == nil {
+			err = ch.Close()
+		}
+		result <- err
+	}()
+
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("amqp dial timed out after %s", h.timeout)
+	}
+}
@@ -0,0 +1,169 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+var errPublisherClosed = errors.New("amqp publisher is closed")
+
+// Publisher delivers transition messages to the configured messaging backend.
+type Publisher interface {
+	Publish(ctx context.Context, msg outboundMessage) error
+}
+
+// outboundMessage is a transition message and its destination. AMQP messages are published to an exchange with a
+// routing key, the exchange and queue are declared when they do not exist and the queue is bound to the exchange when
+// it is declared. Only the body and attributes are used by other backends.
+type outboundMessage struct {
+	Exchange     string
+	ExchangeType string
+	Queue        string
+	RoutingKey   string
+	ContentType  string
+	Body         []byte
+	// Attributes identify the build and phase of the message so subscribers can filter messages.
+	Attributes map[string]string
+}
+
+// amqpChannel publishes confirmed messages, each one owns a connection that is re-established after failures.
+type amqpChannel interface {
+	Publish(ctx context.Context, msg outboundMessage) error
+	Close() error
+}
+
+// exists only so it can be overridden by tests without a running broker
+var dialChannel = func(log logr.Logger, url string) (amqpChannel, error) {
+	return newBrokerChannel(log, url)
+}
+
+// AMQPPublisher shares long-lived broker channels between reconciles instead of dialing the broker for every build.
+// Channels are opened lazily, up to the pool size, and are reconnected by the amqp client when the broker connection
+// drops. A failed dial is retried by the next publish.
+//
+// Publishes wait for an idle channel once every channel is in use. Channels are closed when the manager stops.
+type AMQPPublisher struct {
+	log  logr.Logger
+	url  string
+	size int
+
+	mu     sync.Mutex
+	idle   chan amqpChannel
+	open   int
+	closed bool
+}
+
+// NewAMQPPublisher returns a publisher with up to size channels to the broker at url, one when size is not positive.
+func NewAMQPPublisher(log logr.Logger, url string, size int) *AMQPPublisher {
+	if size < 1 {
+		size = 1
+	}
+
+	return &AMQPPublisher{
+		log:  log,
+		url:  url,
+		size: size,
+		idle: make(chan amqpChannel, size),
+	}
+}
+
+// NeedLeaderElection is false because channels are only opened once a message is published.
+func (p *AMQPPublisher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start blocks until the context is cancelled and closes every channel afterwards. Channels in use are closed once
+// their publish returns.
+func (p *AMQPPublisher) Start(ctx context.Context) error {
+	<-ctx.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for {
+		select {
+		case ch := <-p.idle:
+			p.closeChannel(ch)
+		default:
+			return nil
+		}
+	}
+}
+
+// Publish sends the message on an idle channel and waits for the broker to confirm it.
+func (p *AMQPPublisher) Publish(ctx context.Context, msg outboundMessage) error {
+	ch, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.release(ch)
+
+	return ch.Publish(ctx, msg)
+}
+
+// acquire returns an idle channel, opening a new one while the pool is not full.
+func (p *AMQPPublisher) acquire(ctx context.Context) (amqpChannel, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPublisherClosed
+	}
+
+	select {
+	case ch := <-p.idle:
+		p.mu.Unlock()
+		return ch, nil
+	default:
+	}
+
+	if p.open < p.size {
+		p.open++
+		p.mu.Unlock()
+
+		p.log.Info("Opening AMQP channel", "open", p.open, "poolSize", p.size)
+		ch, err := dialChannel(p.log, p.url)
+		if err != nil {
+			p.mu.Lock()
+			p.open--
+			p.mu.Unlock()
+
+			return nil, fmt.Errorf("cannot connect to amqp broker: %w", err)
+		}
+
+		return ch, nil
+	}
+	p.mu.Unlock()
+
+	select {
+	case ch := <-p.idle:
+		return ch, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release returns the channel to the pool, it is closed instead when the publisher has been stopped.
+func (p *AMQPPublisher) release(ch amqpChannel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		p.closeChannel(ch)
+		return
+	}
+
+	p.idle <- ch
+}
+
+// closeChannel closes a channel, callers must hold the lock.
+func (p *AMQPPublisher) closeChannel(ch amqpChannel) {
+	p.open--
+	if err := ch.Close(); err != nil {
+		p.log.Error(err, "Failed to close AMQP channel")
+	}
+}
@@ -0,0 +1,109 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeChannel struct {
+	mu        sync.Mutex
+	published []outboundMessage
+	block     chan struct{}
+	closed    bool
+}
+
+func (c *fakeChannel) Publish(_ context.Context, msg outboundMessage) error {
+	if c.block != nil {
+		<-c.block
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.published = append(c.published, msg)
+	return nil
+}
+
+func (c *fakeChannel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	return nil
+}
+
+func noIdleChannels(p *AMQPPublisher) func() bool {
+	return func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		return len(p.idle) == 0
+	}
+}
+
+func TestAMQPPublisher(t *testing.T) {
+	var (
+		dialErr  error
+		channels []*fakeChannel
+	)
+	defer func(orig func(logr.Logger, string) (amqpChannel, error)) { dialChannel = orig }(dialChannel)
+	dialChannel = func(logr.Logger, string) (amqpChannel, error) {
+		if dialErr != nil {
+			return nil, dialErr
+		}
+
+		ch := &fakeChannel{}
+		channels = append(channels, ch)
+		return ch, nil
+	}
+
+	p := NewAMQPPublisher(logr.Discard(), "amqp://rabbitmq:5672", 2)
+	ctx := context.Background()
+	msg := outboundMessage{Queue: "builds", Body: []byte("{}")}
+
+	dialErr = errors.New("connection refused")
+	assert.ErrorIs(t, p.Publish(ctx, msg), dialErr)
+	assert.Empty(t, channels, "nothing is dialed until a publish succeeds")
+
+	dialErr = nil
+	require.NoError(t, p.Publish(ctx, msg), "failed dials are retried by the next publish")
+	require.NoError(t, p.Publish(ctx, msg))
+	require.Len(t, channels, 1, "idle channels are reused")
+	assert.Len(t, channels[0].published, 2)
+
+	// a busy channel makes the next publish open a second one, the pool size caps further channels
+	channels[0].block = make(chan struct{})
+	done := make(chan error)
+	go func() { done <- p.Publish(ctx, msg) }()
+	require.Eventually(t, noIdleChannels(p), time.Second, 10*time.Millisecond)
+
+	require.NoError(t, p.Publish(ctx, msg))
+	require.Len(t, channels, 2)
+
+	channels[1].block = make(chan struct{})
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	go func() { done <- p.Publish(ctx, msg) }()
+	require.Eventually(t, noIdleChannels(p), time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, p.Publish(waitCtx, msg), context.DeadlineExceeded, "publishes wait while every channel is busy")
+	assert.Len(t, channels, 2)
+
+	close(channels[0].block)
+	close(channels[1].block)
+	require.NoError(t, <-done)
+	require.NoError(t, <-done)
+
+	stopCtx, stop := context.WithCancel(ctx)
+	stop()
+	require.NoError(t, p.Start(stopCtx))
+	assert.True(t, channels[0].closed)
+	assert.True(t, channels[1].closed)
+	assert.ErrorIs(t, p.Publish(ctx, msg), errPublisherClosed)
+}
@@ -2,15 +2,18 @@ package component
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/distribution/reference"
-	amqpclient "github.com/dominodatalab/amqp-client"
 	"github.com/dominodatalab/controller-util/core"
+	"github.com/go-logr/logr"
 	"github.com/newrelic/go-agent/v3/newrelic"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -26,6 +29,7 @@ import (
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/apm"
 )
 
 const (
@@ -33,19 +37,28 @@ const (
 	compressedImageSizeBytesAnnotation = "imagebuilder.dominodatalab.com/compressed-image-size-bytes"
 )
 
-type AMQPMessengerComponent struct {
-	cfg      config.Messaging
-	newRelic *newrelic.Application
+type StatusMessengerComponent struct {
+	cfg       config.Messaging
+	publisher Publisher
+	newRelic  *newrelic.Application
+	nrCfg     config.NewRelic
 }
 
-func StatusMessenger(cfg config.Messaging, nr *newrelic.Application) *AMQPMessengerComponent {
-	return &AMQPMessengerComponent{
-		cfg:      cfg,
-		newRelic: nr,
+func StatusMessenger(
+	cfg config.Messaging,
+	publisher Publisher,
+	nr *newrelic.Application,
+	nrCfg config.NewRelic,
+) *StatusMessengerComponent {
+	return &StatusMessengerComponent{
+		cfg:       cfg,
+		publisher: publisher,
+		newRelic:  nr,
+		nrCfg:     nrCfg,
 	}
 }
 
-func (c *AMQPMessengerComponent) Initialize(_ *core.Context, bldr *ctrl.Builder) error {
+func (c *StatusMessengerComponent) Initialize(_ *core.Context, bldr *ctrl.Builder) error {
 	bldr.Watches(
 		&hephv1.ImageBuild{},
 		&handler.EnqueueRequestForObject{},
@@ -61,14 +74,13 @@ func (c *AMQPMessengerComponent) Initialize(_ *core.Context, bldr *ctrl.Builder)
 }
 
 //nolint:maintidx,funlen
-func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, error) {
+func (c *StatusMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, error) {
 	log := ctx.Log
 	obj := ctx.Object
 	objKey := client.ObjectKey{Name: obj.GetName(), Namespace: obj.GetNamespace()}
 
 	txn := c.newRelic.StartTransaction("StatusMessengerComponent.Reconcile")
 	txn.AddAttribute("imagebuild", objKey.String())
-	txn.AddAttribute("url", c.cfg.AMQP.URL)
 	defer txn.End()
 
 	ib := &hephv1.ImageBuild{}
@@ -83,25 +95,31 @@ func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, erro
 		return ctrl.Result{}, err
 	}
 
-	amqpMsg := amqpclient.SimpleMessage{
-		ExchangeName: c.cfg.AMQP.Exchange,
-		QueueName:    c.cfg.AMQP.Queue,
-		ContentType:  publishContentType,
-	}
+	amqpMsg := outboundMessage{ContentType: publishContentType}
+	var spec hephv1.ImageBuildMessageSpec
 
-	if ov := ib.Spec.AMQPOverrides; ov != nil {
-		if ov.ExchangeName != "" {
-			log.Info("Overriding target AMQP Exchange", "name", ov.ExchangeName)
-			amqpMsg.ExchangeName = ov.ExchangeName
+	if aws := c.cfg.AWS; aws != nil {
+		txn.AddAttribute("topicARN", aws.TopicARN)
+		txn.AddAttribute("queueURL", aws.QueueURL)
+		spec.AWS = &hephv1.ImageBuildMessageAWSDestination{TopicARN: aws.TopicARN, QueueURL: aws.QueueURL}
+	} else if c.cfg.AMQP != nil {
+		if err := c.resolveAMQPDestination(log, ib, &amqpMsg); err != nil {
+			return ctrl.Result{}, err
 		}
+		txn.AddAttribute("url", c.cfg.AMQP.URL)
+		txn.AddAttribute("queue", amqpMsg.Queue)
+		txn.AddAttribute("exchange", amqpMsg.Exchange)
+		txn.AddAttribute("routingKey", amqpMsg.RoutingKey)
 
-		if ov.QueueName != "" {
-			log.Info("Overriding target AMQP Queue", "name", ov.QueueName)
-			amqpMsg.QueueName = ov.QueueName
+		u, _ := url.Parse(c.cfg.AMQP.URL)
+		spec.AMQP = hephv1.ImageBuildMessageAMQPConnection{
+			URI:        u.Redacted(),
+			Queue:      amqpMsg.Queue,
+			Exchange:   amqpMsg.Exchange,
+			RoutingKey: amqpMsg.RoutingKey,
 		}
 	}
-	txn.AddAttribute("queue", amqpMsg.QueueName)
-	txn.AddAttribute("exchange", amqpMsg.ExchangeName)
+	apm.AddObjectAttributes(txn, c.nrCfg, ib)
 
 	var ibm hephv1.ImageBuildMessage
 	if err := ctx.Client.Get(ctx, objKey, &ibm); err != nil {
@@ -110,19 +128,12 @@ func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, erro
 		}
 
 		log.Info("Creating resource, ImageBuildMessage does not exist")
-		u, _ := url.Parse(c.cfg.AMQP.URL)
 		ibm = hephv1.ImageBuildMessage{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      ib.Name,
 				Namespace: ib.Namespace,
 			},
-			Spec: hephv1.ImageBuildMessageSpec{
-				AMQP: hephv1.ImageBuildMessageAMQPConnection{
-					URI:      u.Redacted(),
-					Queue:    amqpMsg.QueueName,
-					Exchange: amqpMsg.ExchangeName,
-				},
-			},
+			Spec: spec,
 		}
 
 		if err = controllerutil.SetOwnerReference(ib, &ibm, ctx.Scheme); err != nil {
@@ -134,26 +145,15 @@ func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, erro
 		}
 	}
 
-	log.Info("Creating AMQP message publisher")
-	connectSeg := txn.StartSegment("broker-connect")
-	amqpClient, err := amqpclient.NewSimpleClient(log, c.cfg.AMQP.URL)
-	if err != nil {
-		txn.NoticeError(newrelic.Error{
-			Message: err.Error(),
-			Class:   "BrokerConnectError",
-		})
-		return ctrl.Result{}, err
-	}
-	connectSeg.End()
-
-	defer func() {
-		log.V(1).Info("Closing message publisher")
-		if err := amqpClient.Close(); err != nil {
-			log.Error(err, "Failed to close message publisher")
+	if c.cfg.OffloadTransitions {
+		if history, changed := mergeTransitions(ibm.Status.Transitions, ib.Status.Transitions); changed {
+			log.V(1).Info("Offloading transition history", "transitions", len(history))
+			ibm.Status.Transitions = history
+			if err := ctx.Client.Status().Update(ctx, &ibm); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
-
-		log.V(1).Info("Message publisher closed")
-	}()
+	}
 
 	recordMap := make(map[hephv1.Phase]hephv1.ImageBuildMessageRecord)
 	for _, record := range ibm.Status.AMQPSentMessages {
@@ -181,12 +181,16 @@ func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, erro
 		}
 
 		message := hephv1.ImageBuildStatusTransitionMessage{
-			Name:          ib.Name,
-			Annotations:   ib.Annotations,
-			ObjectLink:    objLink,
-			PreviousPhase: trans.PreviousPhase,
-			CurrentPhase:  trans.Phase,
-			OccurredAt:    trans.OccurredAt,
+			SchemaVersion:  config.MessageSchemaV2,
+			Name:           ib.Name,
+			Annotations:    ib.Annotations,
+			ObjectLink:     objLink,
+			PreviousPhase:  trans.PreviousPhase,
+			CurrentPhase:   trans.Phase,
+			OccurredAt:     trans.OccurredAt,
+			QueueTime:      ib.QueueTime(),
+			AllocationTime: ib.Status.AllocationTime,
+			BuilderAddr:    ib.Status.BuilderAddr,
 		}
 
 		switch trans.Phase {
@@ -208,7 +212,9 @@ func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, erro
 			if message.Annotations == nil {
 				message.Annotations = map[string]string{}
 			}
-			message.Annotations[compressedImageSizeBytesAnnotation] = ib.Status.CompressedImageSizeBytes
+			if size := ib.Status.CompressedImageSizeBytes; size != nil {
+				message.Annotations[compressedImageSizeBytesAnnotation] = strconv.FormatInt(size.Value(), 10)
+			}
 			for key, value := range ib.Status.Labels {
 				message.Annotations[key] = value
 			}
@@ -224,6 +230,10 @@ func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, erro
 			}
 		}
 
+		if c.cfg.SchemaVersion != config.MessageSchemaV2 {
+			message = legacyMessage(message)
+		}
+
 		log.V(1).Info("Marshalling ImageBuildStatusTransitionMessage into JSON", "message", message)
 		content, err := json.Marshal(message)
 		if err != nil {
@@ -234,9 +244,14 @@ func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, erro
 			return ctrl.Result{}, err
 		}
 		amqpMsg.Body = content
+		amqpMsg.Attributes = map[string]string{
+			"namespace": ib.Namespace,
+			"name":      ib.Name,
+			"phase":     string(trans.Phase),
+		}
 
 		log.Info("Publishing transition message")
-		if err = amqpClient.Publish(ctx, amqpMsg); err != nil {
+		if err = c.publisher.Publish(ctx, amqpMsg); err != nil {
 			txn.NoticeError(newrelic.Error{
 				Message: err.Error(),
 				Class:   "MessagePublishError",
@@ -264,6 +279,80 @@ func (c *AMQPMessengerComponent) Reconcile(ctx *core.Context) (ctrl.Result, erro
 	return ctrl.Result{}, nil
 }
 
+// mergeTransitions appends the transitions missing from the history, the ImageBuild may already have pruned the
+// oldest transitions that the history holds.
+func mergeTransitions(
+	history, transitions []hephv1.ImageBuildTransition,
+) ([]hephv1.ImageBuildTransition, bool) {
+	// transition times are serialized with second precision
+	type key struct {
+		from, to hephv1.Phase
+		at       int64
+	}
+	recorded := make(map[key]bool, len(history))
+	for _, trans := range history {
+		recorded[key{trans.PreviousPhase, trans.Phase, trans.OccurredAt.Unix()}] = true
+	}
+
+	changed := false
+	for _, trans := range transitions {
+		if !recorded[key{trans.PreviousPhase, trans.Phase, trans.OccurredAt.Unix()}] {
+			history = append(history, trans)
+			changed = true
+		}
+	}
+
+	return history, changed
+}
+
+// resolveAMQPDestination sets the exchange, queue and routing key of the message from the controller configuration and
+// the overrides of the ImageBuild.
+func (c *StatusMessengerComponent) resolveAMQPDestination(
+	log logr.Logger,
+	ib *hephv1.ImageBuild,
+	msg *outboundMessage,
+) error {
+	if c.cfg.AMQP == nil {
+		return errors.New("amqp messaging is not configured")
+	}
+
+	msg.Exchange = c.cfg.AMQP.Exchange
+	msg.ExchangeType = c.cfg.AMQP.ExchangeType
+	msg.Queue = c.cfg.AMQP.Queue
+	if msg.ExchangeType == "" {
+		msg.ExchangeType = config.AMQPExchangeDirect
+	}
+
+	if ov := ib.Spec.AMQPOverrides; ov != nil {
+		if ov.ExchangeName != "" {
+			log.Info("Overriding target AMQP Exchange", "name", ov.ExchangeName)
+			msg.Exchange = ov.ExchangeName
+		}
+
+		if ov.QueueName != "" {
+			log.Info("Overriding target AMQP Queue", "name", ov.QueueName)
+			msg.Queue = ov.QueueName
+		}
+
+		if ov.RoutingKey != "" {
+			log.Info("Overriding AMQP routing key", "routingKey", ov.RoutingKey)
+			msg.RoutingKey = ov.RoutingKey
+		}
+	}
+	if msg.RoutingKey == "" {
+		key, err := routingKey(c.cfg.AMQP.RoutingKeyTemplate, ib)
+		if err != nil {
+			return err
+		}
+		msg.RoutingKey = key
+	}
+	if msg.RoutingKey == "" {
+		msg.RoutingKey = msg.Queue
+	}
+
+	return nil
+}
+
 func BuildObjectLink(obj client.Object, scheme *runtime.Scheme) (string, error) {
 	gvk, err := apiutil.GVKForObject(obj, scheme)
 	if err != nil {
@@ -280,3 +369,34 @@ func BuildObjectLink(obj client.Object, scheme *runtime.Scheme) (string, error)
 	)
 	return link, nil
 }
+
+// routingKey renders the routing key template with the Namespace and Name of the ImageBuild, the key is blank when the
+// template is.
+func routingKey(tmpl string, ib *hephv1.ImageBuild) (string, error) {
+	if tmpl == "" {
+		return "", nil
+	}
+
+	t, err := template.New("routingKey").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid routing key template: %w", err)
+	}
+
+	var sb strings.Builder
+	if err = t.Execute(&sb, struct{ Namespace, Name string }{ib.Namespace, ib.Name}); err != nil {
+		return "", fmt.Errorf("cannot render routing key: %w", err)
+	}
+
+	return sb.String(), nil
+}
+
+// legacyMessage strips the schema version and every field added with schema version v2, consumers written against
+// the unversioned messages may reject unknown fields.
+func legacyMessage(message hephv1.ImageBuildStatusTransitionMessage) hephv1.ImageBuildStatusTransitionMessage {
+	message.SchemaVersion = ""
+	message.QueueTime = nil
+	message.AllocationTime = nil
+	message.BuilderAddr = ""
+
+	return message
+}
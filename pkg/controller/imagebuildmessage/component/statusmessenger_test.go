@@ -0,0 +1,142 @@
+package component
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dominodatalab/controller-util/core"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+type recordingPublisher struct {
+	messages []outboundMessage
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, msg outboundMessage) error {
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func TestStatusMessengerAWS(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, hephv1.AddToScheme(scheme))
+
+	ib := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "team-a"},
+		Status: hephv1.ImageBuildStatus{
+			Phase: hephv1.PhaseRunning,
+			Transitions: []hephv1.ImageBuildTransition{
+				{Phase: hephv1.PhaseInitializing, OccurredAt: metav1.Now()},
+				{PreviousPhase: hephv1.PhaseInitializing, Phase: hephv1.PhaseRunning, OccurredAt: metav1.Now()},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(ib).
+		WithStatusSubresource(&hephv1.ImageBuildMessage{}).
+		Build()
+
+	// an AWS-only configuration leaves the AMQP options nil
+	cfg := config.Messaging{
+		Enabled: true,
+		AWS:     &config.AWSMessaging{TopicARN: "arn:aws:sns:us-west-2:123456789012:builds"},
+	}
+	publisher := &recordingPublisher{}
+	messenger := StatusMessenger(cfg, publisher, nil, config.NewRelic{})
+
+	ctx := &core.Context{
+		Context: context.Background(),
+		Object:  &hephv1.ImageBuildMessage{ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "team-a"}},
+		Client:  c,
+		Scheme:  scheme,
+		Log:     logr.Discard(),
+	}
+	_, err := messenger.Reconcile(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, publisher.messages, 2)
+	assert.Empty(t, publisher.messages[0].Exchange)
+	assert.Equal(t, map[string]string{"namespace": "team-a", "name": "build", "phase": "Initializing"},
+		publisher.messages[0].Attributes)
+
+	var ibm hephv1.ImageBuildMessage
+	require.NoError(t, c.Get(context.Background(), client.ObjectKeyFromObject(ib), &ibm))
+	assert.Equal(t, cfg.AWS.TopicARN, ibm.Spec.AWS.TopicARN)
+	assert.Len(t, ibm.Status.AMQPSentMessages, 2)
+}
+
+func TestLegacyMessage(t *testing.T) {
+	message := hephv1.ImageBuildStatusTransitionMessage{
+		SchemaVersion:  config.MessageSchemaV2,
+		Name:           "build",
+		ObjectLink:     "/apis/hephaestus.dominodatalab.com/v1/namespaces/ns/imagebuild/build",
+		PreviousPhase:  hephv1.PhaseRunning,
+		CurrentPhase:   hephv1.PhaseSucceeded,
+		QueueTime:      &metav1.Duration{Duration: time.Second},
+		AllocationTime: &metav1.Duration{Duration: time.Minute},
+		BuilderAddr:    "tcp://buildkit-0.buildkit:1234",
+	}
+
+	assert.Equal(t, hephv1.ImageBuildStatusTransitionMessage{
+		Name:          "build",
+		ObjectLink:    "/apis/hephaestus.dominodatalab.com/v1/namespaces/ns/imagebuild/build",
+		PreviousPhase: hephv1.PhaseRunning,
+		CurrentPhase:  hephv1.PhaseSucceeded,
+	}, legacyMessage(message))
+	assert.Equal(t, config.MessageSchemaV2, message.SchemaVersion, "the original message is not modified")
+}
+
+func TestRoutingKey(t *testing.T) {
+	ib := &hephv1.ImageBuild{ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "team-a"}}
+
+	key, err := routingKey("", ib)
+	assert.NoError(t, err)
+	assert.Empty(t, key)
+
+	key, err = routingKey("hephaestus.{{ .Namespace }}.{{ .Name }}", ib)
+	assert.NoError(t, err)
+	assert.Equal(t, "hephaestus.team-a.build", key)
+
+	_, err = routingKey("{{ .Phase }}", ib)
+	assert.Error(t, err)
+}
+
+func TestBindingKey(t *testing.T) {
+	assert.Equal(t, "builds", outboundMessage{ExchangeType: config.AMQPExchangeDirect, RoutingKey: "builds"}.bindingKey())
+	assert.Equal(t, "#", outboundMessage{ExchangeType: config.AMQPExchangeTopic, RoutingKey: "team-a"}.bindingKey())
+}
+
+func TestMergeTransitions(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	trans := func(from, to hephv1.Phase, offset time.Duration) hephv1.ImageBuildTransition {
+		return hephv1.ImageBuildTransition{PreviousPhase: from, Phase: to, OccurredAt: metav1.NewTime(at.Add(offset))}
+	}
+	initializing := trans("", hephv1.PhaseInitializing, 0)
+	running := trans(hephv1.PhaseInitializing, hephv1.PhaseRunning, time.Second)
+	succeeded := trans(hephv1.PhaseRunning, hephv1.PhaseSucceeded, time.Minute)
+
+	history, changed := mergeTransitions(nil, []hephv1.ImageBuildTransition{initializing, running})
+	assert.True(t, changed)
+	assert.Equal(t, []hephv1.ImageBuildTransition{initializing, running}, history)
+
+	// the ImageBuild pruned its initializing transition
+	history, changed = mergeTransitions(history, []hephv1.ImageBuildTransition{running, succeeded})
+	assert.True(t, changed)
+	assert.Equal(t, []hephv1.ImageBuildTransition{initializing, running, succeeded}, history)
+
+	reloaded := succeeded
+	reloaded.OccurredAt = metav1.NewTime(succeeded.OccurredAt.Local())
+	_, changed = mergeTransitions(history, []hephv1.ImageBuildTransition{reloaded})
+	assert.False(t, changed, "recorded transitions are not appended again")
+}
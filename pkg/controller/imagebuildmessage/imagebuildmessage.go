@@ -1,9 +1,12 @@
 package imagebuildmessage
 
 import (
+	"context"
+
 	"github.com/dominodatalab/controller-util/core"
 	"github.com/newrelic/go-agent/v3/newrelic"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 	"github.com/dominodatalab/hephaestus/pkg/config"
@@ -18,9 +21,43 @@ func Register(mgr ctrl.Manager, cfg config.Controller, nr *newrelic.Application)
 		return nil
 	}
 
+	var (
+		publisher   component.Publisher
+		concurrency = 1
+	)
+	if aws := cfg.Messaging.AWS; aws != nil {
+		p, err := component.NewAWSPublisher(context.Background(), ctrl.Log.WithName("aws-publisher"), *aws)
+		if err != nil {
+			return err
+		}
+		publisher = p
+	} else {
+		// the publisher outlives reconciles so builds share broker connections instead of dialing for every message
+		poolSize := cfg.Messaging.AMQP.PoolSize
+		p := component.NewAMQPPublisher(ctrl.Log.WithName("amqp-publisher"), cfg.Messaging.AMQP.URL, poolSize)
+		if err := mgr.Add(p); err != nil {
+			return err
+		}
+		publisher = p
+		concurrency = max(poolSize, 1)
+
+		if hc := cfg.Messaging.AMQP.HealthCheck; hc.Interval > 0 {
+			health := component.NewBrokerHealth(ctrl.Log.WithName("amqp-health"), cfg.Messaging.AMQP.URL, hc)
+			if err := mgr.Add(health); err != nil {
+				return err
+			}
+			if hc.Readiness {
+				if err := mgr.AddReadyzCheck("amqp", health.Check); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	return core.NewReconciler(mgr).
 		For(&hephv1.ImageBuildMessage{}).
-		Component("amqp-messenger", component.StatusMessenger(cfg.Messaging, nr)).
+		Component("status-messenger", component.StatusMessenger(cfg.Messaging, publisher, nr, cfg.NewRelic)).
 		ReconcileNotFound().
+		WithControllerOptions(controller.Options{MaxConcurrentReconciles: concurrency}).
 		Complete()
 }
@@ -2,11 +2,16 @@ package component
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"slices"
 	"time"
 
 	"github.com/dominodatalab/controller-util/core"
 	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -17,15 +22,19 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/buildkit"
 	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials"
 	"github.com/dominodatalab/hephaestus/pkg/controller/support/phase"
 )
 
 type CacheWarmerComponent struct {
-	cfg        config.Buildkit
+	cfg config.Buildkit
+	// cluster is set when the component reconciles ClusterImageCaches instead of ImageCaches.
+	cluster bool
+
 	log        logr.Logger
 	client     client.Client
-	config     config.Buildkit
 	timeWindow time.Duration
 	phase      *phase.TransitionHelper
 }
@@ -36,6 +45,14 @@ func CacheWarmer(cfg config.Buildkit) *CacheWarmerComponent {
 	}
 }
 
+// ClusterCacheWarmer warms builder caches for ClusterImageCaches.
+func ClusterCacheWarmer(cfg config.Buildkit) *CacheWarmerComponent {
+	return &CacheWarmerComponent{
+		cfg:     cfg,
+		cluster: true,
+	}
+}
+
 func (c *CacheWarmerComponent) GetReadyCondition() string {
 	return "BuilderCacheReady"
 }
@@ -58,12 +75,6 @@ func (c *CacheWarmerComponent) Initialize(ctx *core.Context, bldr *ctrl.Builder)
 		&corev1.Pod{},
 		handler.EnqueueRequestsFromMapFunc(c.mapBuildkitPodChanges),
 		builder.WithPredicates(predicate.Funcs{CreateFunc: func(event.CreateEvent) bool { return true }}),
-		// &eventhandler.PodMonitor{
-		// 	Log:        ctx.Log,
-		// 	Client:     ctx.Client,
-		// 	Config:     ctx.Data["config"].(config.Buildkit),
-		// 	TimeWindow: 10 * time.Minute,
-		// },
 	)
 
 	return nil
@@ -73,148 +84,129 @@ func (c *CacheWarmerComponent) Initialize(ctx *core.Context, bldr *ctrl.Builder)
 
 func (c *CacheWarmerComponent) Reconcile(ctx *core.Context) (ctrl.Result, error) {
 	log := ctx.Log
-	// obj := ctx.Object.(*hephv1.ImageCache)
-
-	log.Info("Component disabled until modified to work with new buildkit worker pool")
-	return ctrl.Result{}, nil
-
-	// /*
-	// 	1. Determine if a cache run is required
-	// */
-	// synced := true
-	//
-	// var podList corev1.PodList
-	// listOpts := []client.ListOption{
-	// 	client.InNamespace(c.cfg.Namespace),
-	// 	client.MatchingLabels(c.cfg.Labels),
-	// }
-	//
-	// log.Info("Querying for buildkit pods", "labels", c.cfg.Labels, "namespace", c.cfg.Namespace)
-	// if err := ctx.Client.List(ctx, &podList, listOpts...); err != nil {
-	// 	return ctrl.Result{}, fmt.Errorf("buildkit pod lookup failed: %w", err)
-	// }
-	// if len(podList.Items) == 0 {
-	// 	return ctrl.Result{}, errors.New("no buildkit pods found")
-	// }
-	//
-	// var podNames []string
-	// for _, pod := range podList.Items {
-	// 	podNames = append(podNames, pod.Name)
-	// }
-	// log.Info("Found buildkit pods", "pods", podNames)
-	//
-	// if !reflect.DeepEqual(podNames, obj.Status.BuildkitPods) {
-	// 	synced = false
-	// }
-	// if !reflect.DeepEqual(obj.Spec.Images, obj.Status.CachedImages) {
-	// 	synced = false
-	// }
-	//
-	// if synced {
-	// 	log.Info("Resource synced, quitting reconciliation")
-	// 	return ctrl.Result{}, nil
-	// }
-	//
-	// /*
-	// 	2. Load external data required for building
-	// */
-	// c.phase.SetInitializing(ctx, obj)
-	//
-	// log.Info("Querying for buildkit endpoints")
-	// endpoints, err := discovery.BuildkitEndpoints(ctx, c.cfg)
-	// if err != nil {
-	// 	return ctrl.Result{}, c.phase.SetFailed(ctx, obj, fmt.Errorf("buildkit worker lookup failed: %w", err))
-	// }
-	//
-	// if len(endpoints) < len(podNames) {
-	// 	log.Info("Not all buildkit pods ready, requeuing event", "pods", podNames, "endpoints", endpoints)
-	// 	ctx.Conditions.SetFalse(
-	// 		c.GetReadyCondition(),
-	// 		"EndpointsMissing",
-	// 		fmt.Sprintf("Buildkitd workers %v missing endpoints %v", podNames, endpoints),
-	// 	)
-	//
-	// 	return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
-	// }
-	//
-	// log.Info("Processing registry credentials")
-	// configDir, err := credentials.Persist(ctx, ctx.Config, obj.Spec.RegistryAuth)
-	// if err != nil {
-	// 	return ctrl.Result{}, c.phase.SetFailed(ctx, obj, fmt.Errorf("registry credentials processing failed: %w", err))
-	// }
-	// defer os.RemoveAll(configDir)
-	//
-	// /*
-	// 	3. Dispatch concurrent cache operations
-	// */
-	// c.phase.SetRunning(ctx, obj)
-	//
-	// log.Info("Launching cache operation", "endpoints", endpoints, "images", obj.Spec.Images)
-	// eg, _ := errgroup.WithContext(ctx)
-	// for idx, addr := range endpoints {
-	// 	for _, image := range obj.Spec.Images {
-	// 		// close over variables
-	// 		idx := idx
-	// 		addr := addr
-	// 		image := image
-	//
-	// 		eg.Go(func() error {
-	// 			log := log.WithValues("addr", addr, "image", image)
-	//
-	// 			log.Info("Building new buildkit client")
-	// 			bk, err := buildkit.
-	// 				ClientBuilder(ctx, addr).
-	// 				WithLogger(ctx.Log.WithName("buildkit").WithValues("addr", addr, "image", image)).
-	// 				WithMTLSAuth(c.cfg.CACertPath, c.cfg.CertPath, c.cfg.KeyPath).
-	// 				WithDockerAuthConfig(configDir).
-	// 				Build()
-	// 			if err != nil {
-	// 				return err
-	// 			}
-	//
-	// 			builderCondition := fmt.Sprintf("BuildkitdPod-%d", idx)
-	//
-	// 			log.Info("Launching cache export")
-	// 			ctx.Conditions.SetUnknown(builderCondition, "LaunchingCacheRun", "")
-	//
-	// 			if err = bk.Cache(image); err != nil {
-	// 				ctx.Conditions.SetFalse(builderCondition, "CacheRunFailed", err.Error())
-	// 				return err
-	// 			}
-	//
-	// 			log.Info("Cache export complete")
-	// 			ctx.Conditions.SetTrue(builderCondition, "CacheRunSucceeded", "")
-	//
-	// 			return nil
-	// 		})
-	// 	}
-	// }
-	//
-	// if err = eg.Wait(); err != nil {
-	// 	return ctrl.Result{}, c.phase.SetFailed(ctx, obj, fmt.Errorf("caching operation failed: %w", err))
-	// }
-	//
-	// /*
-	// 	4. Record build metadata and report success
-	// */
-	// obj.Status.BuildkitPods = podNames
-	// obj.Status.CachedImages = obj.Spec.Images
-	// c.phase.SetSucceeded(ctx, obj)
-	//
-	// log.Info("Reconciliation complete")
-	// return ctrl.Result{}, nil
+	obj := ctx.Object.(phase.PhasedObject)
+	spec, status := cacheParts(obj)
+
+	var result ctrl.Result
+	if limit := spec.MaxCacheSizeBytes; limit != nil {
+		// builder caches keep growing after they are warmed, so they are checked against the limit periodically
+		result.RequeueAfter = evictionInterval
+
+		maxBytes, err := effectiveCacheLimit(ctx, ctx.Client, *limit)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		var reclaimed int64
+		for _, pool := range c.cfg.PoolConfigs() {
+			var n int64
+			n, err = evictCache(ctx, log, ctx.Client, pool, maxBytes, spec.PruneFilters)
+			if reclaimed += n; err != nil {
+				break
+			}
+		}
+		if reclaimed > 0 {
+			status.ReclaimedBytes += reclaimed
+			if uErr := ctx.Client.Status().Update(ctx, obj); uErr != nil {
+				log.Error(uErr, "Failed to record reclaimed bytes", "reclaimedBytes", reclaimed)
+			}
+		}
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("cache eviction failed: %w", err)
+		}
+	}
+
+	// the builders of every pool are warmed, e.g. arm64 builders as well as the default ones
+	pools := c.cfg.PoolConfigs()
+	poolPods := make([][]string, len(pools))
+	var podNames []string
+	for i, pool := range pools {
+		pods, err := readyBuilders(ctx, ctx.Client, pool)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		poolPods[i] = pods
+		podNames = append(podNames, pods...)
+	}
+	slices.Sort(podNames)
+
+	log.Info("Processing registry credentials")
+	// cluster-scoped caches have no namespace and may read secrets from any
+	scope := credentials.NewScope(obj.GetNamespace(), c.cfg)
+	configDir, sources, err := credentials.Persist(ctx, log, ctx.Config, scope, spec.RegistryAuth)
+	if err != nil {
+		return ctrl.Result{}, c.phase.SetFailed(ctx, obj, fmt.Errorf("registry credentials processing failed: %w", err))
+	}
+	defer func(path string) {
+		if err := os.RemoveAll(path); err != nil {
+			log.Error(err, "Failed to delete registry credentials")
+		}
+		if err := sources.Revoke(context.WithoutCancel(ctx)); err != nil {
+			log.Error(err, "Failed to revoke registry access tokens")
+		}
+	}(configDir)
+
+	caBundles, err := credentials.ReadCABundles(ctx, ctx.Config, c.cfg)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	registries, err := newRegistryAccess(c.cfg, caBundles, func(registry string) (authn.Authenticator, error) {
+		return buildkit.ResolveAuth(configDir, registry)
+	})
+	if err != nil {
+		return ctrl.Result{}, c.phase.SetFailed(ctx, obj, err)
+	}
+
+	digests, err := resolveDigests(ctx, spec.Images, registries)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("image digest resolution failed: %w", err)
+	}
+
+	// re-warm only when the digest behind one of the requested images changes or new builders come up
+	if !digestsChanged(status.ResolvedDigests, digests) &&
+		slices.Equal(podNames, status.BuildkitPods) &&
+		slices.Equal(spec.Images, status.CachedImages) {
+		log.Info("Resource synced, skipping cache warming")
+		return result, nil
+	}
+	if len(podNames) == 0 {
+		// builders that start later enqueue this resource through the pod watch
+		log.Info("No ready buildkit pods found, skipping cache warming")
+		return result, nil
+	}
+
+	c.phase.SetInitializing(ctx, obj)
+	c.phase.SetRunning(ctx, obj)
+
+	// spot builders lose their cache whenever they are preempted, so they are warmed before the on-demand ones
+	spotPods, onDemandPods := make([][]string, len(pools)), make([][]string, len(pools))
+	for i, pool := range pools {
+		spotPods[i], onDemandPods[i] = partitionSpotBuilders(ctx, ctx.Client, pool, poolPods[i])
+	}
+	log.Info("Launching cache operation", "spotPods", spotPods, "pods", onDemandPods, "images", spec.Images)
+	for _, podsByPool := range [][][]string{spotPods, onDemandPods} {
+		for i, pool := range pools {
+			if err = warmBuilders(ctx, log, pool, configDir, podsByPool[i], spec.Images); err != nil {
+				return ctrl.Result{}, c.phase.SetFailed(ctx, obj, fmt.Errorf("caching operation failed: %w", err))
+			}
+		}
+	}
+
+	status.BuildkitPods = podNames
+	status.CachedImages = spec.Images
+	status.ResolvedDigests = digests
+	c.phase.SetSucceeded(ctx, obj)
+
+	log.Info("Reconciliation complete")
+	return result, nil
 }
 
 func (c *CacheWarmerComponent) mapBuildkitPodChanges(ctx context.Context, obj client.Object,
 ) (requests []reconcile.Request) {
-	if len(c.config.PodLabels) > len(obj.GetLabels()) {
+	if !slices.ContainsFunc(c.cfg.PoolConfigs(), func(pool config.Buildkit) bool {
+		return labels.SelectorFromSet(pool.PodLabels).Matches(labels.Set(obj.GetLabels()))
+	}) {
 		return
 	}
-	for k, v := range c.config.PodLabels {
-		if ov, found := obj.GetLabels()[k]; !found || ov != v {
-			return
-		}
-	}
 
 	// NOTE: work through the permutations
 	ageLimit := time.Now().Add(-c.timeWindow)
@@ -222,20 +214,38 @@ func (c *CacheWarmerComponent) mapBuildkitPodChanges(ctx context.Context, obj cl
 		return
 	}
 
-	cacheList := &hephv1.ImageCacheList{}
-	err := c.client.List(ctx, cacheList)
-	if err != nil {
-		c.log.Error(err, "cannot list image cache objects")
+	var keys []types.NamespacedName
+	if c.cluster {
+		cacheList := &hephv1.ClusterImageCacheList{}
+		if err := c.client.List(ctx, cacheList); err != nil {
+			c.log.Error(err, "cannot list cluster image cache objects")
+		}
+		for _, cic := range cacheList.Items {
+			keys = append(keys, types.NamespacedName{Name: cic.Name})
+		}
+	} else {
+		cacheList := &hephv1.ImageCacheList{}
+		if err := c.client.List(ctx, cacheList); err != nil {
+			c.log.Error(err, "cannot list image cache objects")
+		}
+		for _, ic := range cacheList.Items {
+			keys = append(keys, types.NamespacedName{Name: ic.Name, Namespace: ic.Namespace})
+		}
 	}
 
-	requests = make([]reconcile.Request, len(cacheList.Items))
-	for idx, ic := range cacheList.Items {
-		requests[idx] = reconcile.Request{
-			NamespacedName: types.NamespacedName{
-				Name:      ic.Name,
-				Namespace: ic.Namespace,
-			},
-		}
+	requests = make([]reconcile.Request, len(keys))
+	for idx, key := range keys {
+		requests[idx] = reconcile.Request{NamespacedName: key}
 	}
 	return
 }
+
+// cacheParts returns the spec and status shared by namespaced and cluster-scoped image caches.
+func cacheParts(obj client.Object) (*hephv1.ImageCacheSpec, *hephv1.ImageCacheStatus) {
+	if cic, ok := obj.(*hephv1.ClusterImageCache); ok {
+		return &cic.Spec, &cic.Status
+	}
+
+	ic := obj.(*hephv1.ImageCache)
+	return &ic.Spec, &ic.Status
+}
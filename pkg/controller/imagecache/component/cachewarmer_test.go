@@ -0,0 +1,92 @@
+package component
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func TestMapBuildkitPodChanges(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, kubescheme.AddToScheme(scheme))
+	require.NoError(t, hephv1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&hephv1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "team"}},
+		&hephv1.ClusterImageCache{ObjectMeta: metav1.ObjectMeta{Name: "base"}},
+	).Build()
+	cfg := config.Buildkit{
+		PodLabels: map[string]string{"app": "buildkit"},
+		ARM64Pool: config.WorkerPool{
+			StatefulSetName: "buildkit-arm64",
+			PodLabels:       map[string]string{"app": "buildkit-arm64"},
+		},
+	}
+
+	pod := func(labels map[string]string, age time.Duration) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              "buildkit-0",
+			Namespace:         "buildkit",
+			Labels:            labels,
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		}}
+	}
+
+	for _, tc := range []struct {
+		name string
+		comp *CacheWarmerComponent
+		pod  *corev1.Pod
+		want []reconcile.Request
+	}{
+		{
+			name: "namespaced",
+			comp: CacheWarmer(cfg),
+			pod:  pod(cfg.PodLabels, time.Minute),
+			want: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "base", Namespace: "team"}}},
+		},
+		{
+			name: "cluster",
+			comp: ClusterCacheWarmer(cfg),
+			pod:  pod(cfg.PodLabels, time.Minute),
+			want: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "base"}}},
+		},
+		{
+			name: "arm64_pool",
+			comp: CacheWarmer(cfg),
+			pod:  pod(cfg.ARM64Pool.PodLabels, time.Minute),
+			want: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "base", Namespace: "team"}}},
+		},
+		{
+			name: "other_pod",
+			comp: CacheWarmer(cfg),
+			pod:  pod(map[string]string{"app": "other"}, time.Minute),
+		},
+		{
+			name: "old_pod",
+			comp: CacheWarmer(cfg),
+			pod:  pod(cfg.PodLabels, time.Hour),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.comp.log = logr.Discard()
+			tc.comp.client = c
+			tc.comp.timeWindow = 10 * time.Minute
+
+			assert.Equal(t, tc.want, tc.comp.mapBuildkitPodChanges(context.Background(), tc.pod))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package component
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials"
+)
+
+// registryAccess holds everything needed to reach the registries of the cached images.
+type registryAccess struct {
+	// insecure registries skip TLS verification or use plain HTTP.
+	insecure []string
+	// rootCAs trusted per registry host in addition to the system pool.
+	rootCAs map[string]*x509.CertPool
+	// resolveAuth returns the credentials persisted for a registry.
+	resolveAuth func(registry string) (authn.Authenticator, error)
+}
+
+func newRegistryAccess(
+	cfg config.Buildkit,
+	caBundles *credentials.CABundles,
+	resolveAuth func(registry string) (authn.Authenticator, error),
+) (registryAccess, error) {
+	registries := registryAccess{rootCAs: map[string]*x509.CertPool{}, resolveAuth: resolveAuth}
+	for reg, opts := range cfg.Registries {
+		if opts.Insecure || opts.HTTP {
+			registries.insecure = append(registries.insecure, reg)
+		}
+	}
+
+	var err error
+	for reg, bundle := range caBundles.Registries {
+		if registries.rootCAs[reg], err = credentials.CertPool(bundle); err != nil {
+			return registryAccess{}, fmt.Errorf("invalid CA bundle for %q: %w", reg, err)
+		}
+	}
+
+	return registries, nil
+}
+
+// transport trusts the CAs of the registry in addition to the system pool.
+func (r registryAccess) transport(registry string) http.RoundTripper {
+	pool, ok := r.rootCAs[registry]
+	if !ok {
+		return remote.DefaultTransport
+	}
+
+	transport := remote.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+
+	return transport
+}
+
+// remoteReference parses the image name and returns the options used to access its registry.
+func (r registryAccess) remoteReference(ctx context.Context, image string) (name.Reference, []remote.Option, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, nil, err
+	}
+	registryName := ref.Context().RegistryStr()
+
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithTransport(r.transport(registryName))}
+	if slices.Contains(r.insecure, registryName) {
+		if ref, err = name.ParseReference(image, name.Insecure); err != nil {
+			return nil, nil, err
+		}
+		registryName = ref.Context().RegistryStr()
+	}
+
+	auth, err := r.resolveAuth(registryName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ref, append(opts, remote.WithAuth(auth)), nil
+}
+
+// resolveDigests maps every image to the digest it currently references.
+//
+// Digest-pinned images resolve to their pinned digest without contacting the registry, tags are resolved with a HEAD
+// request against the manifest.
+func resolveDigests(ctx context.Context, images []string, registries registryAccess) (map[string]string, error) {
+	digests := make(map[string]string, len(images))
+	for _, image := range images {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse image %q: %w", image, err)
+		}
+
+		if d, ok := ref.(name.Digest); ok {
+			digests[image] = d.DigestStr()
+			continue
+		}
+
+		ref, opts, err := registries.remoteReference(ctx, image)
+		if err != nil {
+			return nil, fmt.Errorf("cannot access registry of image %q: %w", image, err)
+		}
+		desc, err := remote.Head(ref, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve digest for image %q: %w", image, err)
+		}
+		digests[image] = desc.Digest.String()
+	}
+
+	return digests, nil
+}
+
+// digestsChanged reports whether the resolved digests differ from the ones recorded after the last warming run.
+func digestsChanged(recorded, resolved map[string]string) bool {
+	if len(recorded) != len(resolved) {
+		return true
+	}
+
+	for image, digest := range resolved {
+		if recorded[image] != digest {
+			return true
+		}
+	}
+
+	return false
+}
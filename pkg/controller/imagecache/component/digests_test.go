@@ -0,0 +1,107 @@
+package component
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dominodatalab/hephaestus/pkg/buildkit"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials"
+)
+
+func TestResolveDigests(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	tagged := fmt.Sprintf("%s/repo:latest", host)
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(tagged)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	digest, err := img.Digest()
+	require.NoError(t, err)
+
+	anonymous := registryAccess{resolveAuth: func(string) (authn.Authenticator, error) { return authn.Anonymous, nil }}
+
+	pinned := fmt.Sprintf("%s/other@%s", host, digest)
+	actual, err := resolveDigests(context.Background(), []string{tagged, pinned}, anonymous)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{tagged: digest.String(), pinned: digest.String()}, actual)
+
+	_, err = resolveDigests(context.Background(), []string{fmt.Sprintf("%s/missing:latest", host)}, anonymous)
+	assert.Error(t, err)
+}
+
+func TestResolveDigestsWithAuth(t *testing.T) {
+	reg := registry.New()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "steve" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	tagged := fmt.Sprintf("%s/repo:latest", host)
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(tagged)
+	require.NoError(t, err)
+	basic := &authn.Basic{Username: "steve", Password: "secret"}
+	require.NoError(t, remote.Write(ref, img, remote.WithAuth(basic)))
+
+	digest, err := img.Digest()
+	require.NoError(t, err)
+
+	configDir := t.TempDir()
+	dockerCfg := fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, host,
+		base64.StdEncoding.EncodeToString([]byte("steve:secret")))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.json"), []byte(dockerCfg), 0600))
+
+	registries, err := newRegistryAccess(config.Buildkit{}, &credentials.CABundles{},
+		func(registry string) (authn.Authenticator, error) {
+			return buildkit.ResolveAuth(configDir, registry)
+		})
+	require.NoError(t, err)
+
+	actual, err := resolveDigests(context.Background(), []string{tagged}, registries)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{tagged: digest.String()}, actual)
+
+	anonymous := registryAccess{resolveAuth: func(string) (authn.Authenticator, error) { return authn.Anonymous, nil }}
+	_, err = resolveDigests(context.Background(), []string{tagged}, anonymous)
+	assert.Error(t, err)
+}
+
+func TestDigestsChanged(t *testing.T) {
+	recorded := map[string]string{"repo:latest": "sha256:a"}
+
+	assert.False(t, digestsChanged(recorded, map[string]string{"repo:latest": "sha256:a"}))
+	assert.True(t, digestsChanged(recorded, map[string]string{"repo:latest": "sha256:b"}))
+	assert.True(t, digestsChanged(recorded, map[string]string{"repo:latest": "sha256:a", "other:latest": "sha256:c"}))
+	assert.True(t, digestsChanged(nil, map[string]string{"repo:latest": "sha256:a"}))
+}
@@ -0,0 +1,155 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/buildkit"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+// evictionInterval controls how often caches with a size limit check whether the builder caches grew beyond it.
+const evictionInterval = 10 * time.Minute
+
+// cacheEvictor prunes builder caches that have grown beyond a size limit.
+type cacheEvictor interface {
+	DiskUsage(ctx context.Context) (int64, error)
+	Prune(ctx context.Context, keepBytes int64, filters ...string) (int64, error)
+	Close() error
+}
+
+// exists only so it can be overridden by tests with a fake buildkit client
+var newCacheEvictor = func(
+	ctx context.Context,
+	log logr.Logger,
+	cfg config.Buildkit,
+	addr string,
+) (cacheEvictor, error) {
+	bldr := buildkit.NewClientBuilder(addr).WithLogger(log.WithName("buildkit").WithValues("addr", addr))
+	if mtls := cfg.MTLS; mtls != nil {
+		bldr.WithMTLSAuth(mtls.CACertPath, mtls.CertPath, mtls.KeyPath)
+	}
+
+	bk, err := bldr.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return bk, nil
+}
+
+// effectiveCacheLimit returns the smallest size limit across maxBytes and every ImageCache and ClusterImageCache.
+// Builders are shared by all caches, so they are pruned against a single limit instead of the limit of whichever
+// cache happens to reconcile.
+func effectiveCacheLimit(ctx context.Context, c client.Client, maxBytes int64) (int64, error) {
+	var caches hephv1.ImageCacheList
+	if err := c.List(ctx, &caches); err != nil {
+		return 0, fmt.Errorf("image cache lookup failed: %w", err)
+	}
+	var clusterCaches hephv1.ClusterImageCacheList
+	if err := c.List(ctx, &clusterCaches); err != nil {
+		return 0, fmt.Errorf("cluster image cache lookup failed: %w", err)
+	}
+
+	specs := make([]hephv1.ImageCacheSpec, 0, len(caches.Items)+len(clusterCaches.Items))
+	for _, ic := range caches.Items {
+		if ic.DeletionTimestamp == nil {
+			specs = append(specs, ic.Spec)
+		}
+	}
+	for _, cic := range clusterCaches.Items {
+		if cic.DeletionTimestamp == nil {
+			specs = append(specs, cic.Spec)
+		}
+	}
+
+	for _, spec := range specs {
+		if limit := spec.MaxCacheSizeBytes; limit != nil && *limit < maxBytes {
+			maxBytes = *limit
+		}
+	}
+
+	return maxBytes, nil
+}
+
+// evictCache prunes every running builder whose cache exceeds maxBytes and returns the total bytes reclaimed.
+func evictCache(
+	ctx context.Context,
+	log logr.Logger,
+	c client.Client,
+	cfg config.Buildkit,
+	maxBytes int64,
+	filters []string,
+) (int64, error) {
+	var pods corev1.PodList
+	if err := c.List(ctx, &pods, client.InNamespace(cfg.Namespace), client.MatchingLabels(cfg.PodLabels)); err != nil {
+		return 0, fmt.Errorf("buildkit pod lookup failed: %w", err)
+	}
+
+	var reclaimed int64
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		n, err := evictBuilder(ctx, log, cfg, pod.Name, maxBytes, filters)
+		reclaimed += n
+		if err != nil {
+			return reclaimed, err
+		}
+	}
+
+	return reclaimed, nil
+}
+
+// evictBuilder prunes the cache of a single builder when it exceeds maxBytes and returns the bytes reclaimed.
+func evictBuilder(
+	ctx context.Context,
+	log logr.Logger,
+	cfg config.Buildkit,
+	podName string,
+	maxBytes int64,
+	filters []string,
+) (int64, error) {
+	addr := builderAddr(cfg, podName)
+	log = log.WithValues("pod", podName, "addr", addr)
+
+	bk, err := newCacheEvictor(ctx, log, cfg, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := bk.Close(); err != nil {
+			log.Error(err, "Failed to close buildkit client")
+		}
+	}()
+
+	usage, err := bk.DiskUsage(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("disk usage query failed for pod %q: %w", podName, err)
+	}
+	if usage <= maxBytes {
+		log.V(1).Info("Builder cache is within limits", "usageBytes", usage, "maxBytes", maxBytes)
+		return 0, nil
+	}
+
+	log.Info("Evicting builder cache", "usageBytes", usage, "maxBytes", maxBytes, "filters", filters)
+	n, err := bk.Prune(ctx, maxBytes, filters...)
+	if err != nil {
+		return n, fmt.Errorf("cache prune failed for pod %q: %w", podName, err)
+	}
+
+	return n, nil
+}
+
+// builderAddr returns the address of a builder pod, statefulset pods are addressable through the headless service
+// using their name as a hostname.
+func builderAddr(cfg config.Buildkit, podName string) string {
+	return fmt.Sprintf("tcp://%s.%s.%s:%d", podName, cfg.ServiceName, cfg.Namespace, cfg.DaemonPort)
+}
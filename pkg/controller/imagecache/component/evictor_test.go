@@ -0,0 +1,111 @@
+package component
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+type fakeEvictor struct {
+	usage  int64
+	pruned *[]string
+	closed *[]string
+	addr   string
+}
+
+func (f *fakeEvictor) DiskUsage(context.Context) (int64, error) {
+	return f.usage, nil
+}
+
+func (f *fakeEvictor) Prune(_ context.Context, keepBytes int64, _ ...string) (int64, error) {
+	*f.pruned = append(*f.pruned, f.addr)
+
+	return f.usage - keepBytes, nil
+}
+
+func (f *fakeEvictor) Close() error {
+	*f.closed = append(*f.closed, f.addr)
+
+	return nil
+}
+
+func TestEvictCache(t *testing.T) {
+	cfg := config.Buildkit{
+		Namespace:   "buildkit",
+		PodLabels:   map[string]string{"app": "buildkit"},
+		ServiceName: "buildkit",
+		DaemonPort:  1234,
+	}
+
+	pod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "buildkit", Labels: cfg.PodLabels},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	c := fake.NewClientBuilder().WithObjects(
+		pod("buildkit-0", corev1.PodRunning),
+		pod("buildkit-1", corev1.PodRunning),
+		pod("buildkit-2", corev1.PodPending),
+	).Build()
+
+	usage := map[string]int64{
+		"tcp://buildkit-0.buildkit.buildkit:1234": 500,
+		"tcp://buildkit-1.buildkit.buildkit:1234": 50,
+	}
+
+	var pruned, closed []string
+	original := newCacheEvictor
+	defer func() { newCacheEvictor = original }()
+	newCacheEvictor = func(_ context.Context, _ logr.Logger, _ config.Buildkit, addr string) (cacheEvictor, error) {
+		return &fakeEvictor{usage: usage[addr], pruned: &pruned, closed: &closed, addr: addr}, nil
+	}
+
+	reclaimed, err := evictCache(context.Background(), logr.Discard(), c, cfg, 100, []string{"type==regular"})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(400), reclaimed)
+	assert.Equal(t, []string{"tcp://buildkit-0.buildkit.buildkit:1234"}, pruned)
+	assert.ElementsMatch(t, []string{
+		"tcp://buildkit-0.buildkit.buildkit:1234",
+		"tcp://buildkit-1.buildkit.buildkit:1234",
+	}, closed)
+}
+
+func TestEffectiveCacheLimit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, hephv1.AddToScheme(scheme))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&hephv1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlimited", Namespace: "team"},
+		},
+		&hephv1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "large", Namespace: "team"},
+			Spec:       hephv1.ImageCacheSpec{MaxCacheSizeBytes: ptr.To[int64](500)},
+		},
+		&hephv1.ClusterImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "small"},
+			Spec:       hephv1.ImageCacheSpec{MaxCacheSizeBytes: ptr.To[int64](200)},
+		},
+	).Build()
+
+	limit, err := effectiveCacheLimit(context.Background(), c, 500)
+	require.NoError(t, err)
+	assert.Equal(t, int64(200), limit, "the smallest limit of every cache applies")
+
+	limit, err = effectiveCacheLimit(context.Background(), c, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), limit)
+}
@@ -0,0 +1,217 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/buildkit"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials"
+)
+
+// cacheWarmer exports image layers into the cache of a builder.
+type cacheWarmer interface {
+	Cache(ctx context.Context, image string) error
+	Close() error
+}
+
+// exists only so it can be overridden by tests with a fake buildkit client
+var newCacheWarmer = func(
+	ctx context.Context,
+	log logr.Logger,
+	cfg config.Buildkit,
+	addr string,
+	dockerConfigDir string,
+) (cacheWarmer, error) {
+	bldr := buildkit.NewClientBuilder(addr).
+		WithLogger(log.WithName("buildkit").WithValues("addr", addr)).
+		WithDockerConfigDir(dockerConfigDir)
+	if mtls := cfg.MTLS; mtls != nil {
+		bldr.WithMTLSAuth(mtls.CACertPath, mtls.CertPath, mtls.KeyPath)
+	}
+
+	bk, err := bldr.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return bk, nil
+}
+
+// readyBuilders returns the sorted names of the builder pods that are running and ready to accept solves.
+func readyBuilders(ctx context.Context, c client.Client, cfg config.Buildkit) ([]string, error) {
+	var pods corev1.PodList
+	if err := c.List(ctx, &pods, client.InNamespace(cfg.Namespace), client.MatchingLabels(cfg.PodLabels)); err != nil {
+		return nil, fmt.Errorf("buildkit pod lookup failed: %w", err)
+	}
+
+	var names []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodReady && cond.Status == corev1.ConditionTrue {
+				names = append(names, pod.Name)
+				break
+			}
+		}
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+// partitionSpotBuilders splits the builders into the ones running on spot/preemptible nodes and the others. Nodes are
+// read through the cached client, builders whose node cannot be inspected are treated as on-demand capacity.
+func partitionSpotBuilders(
+	ctx context.Context,
+	c client.Client,
+	cfg config.Buildkit,
+	podNames []string,
+) (spot, onDemand []string) {
+	if len(cfg.SpotNodeLabels) == 0 {
+		return nil, podNames
+	}
+	selector := labels.SelectorFromSet(cfg.SpotNodeLabels)
+
+	for _, podName := range podNames {
+		var pod corev1.Pod
+		var node corev1.Node
+		if err := c.Get(ctx, client.ObjectKey{Namespace: cfg.Namespace, Name: podName}, &pod); err == nil &&
+			pod.Spec.NodeName != "" &&
+			c.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, &node) == nil &&
+			selector.Matches(labels.Set(node.Labels)) {
+			spot = append(spot, podName)
+			continue
+		}
+
+		onDemand = append(onDemand, podName)
+	}
+
+	return spot, onDemand
+}
+
+// warmBuilders exports every image into the cache of every builder, builders are warmed concurrently.
+func warmBuilders(
+	ctx context.Context,
+	log logr.Logger,
+	cfg config.Buildkit,
+	dockerConfigDir string,
+	podNames []string,
+	images []string,
+) error {
+	eg, egCtx := errgroup.WithContext(ctx)
+	for _, podName := range podNames {
+		eg.Go(func() error {
+			return warmBuilder(egCtx, log, cfg, dockerConfigDir, podName, images)
+		})
+	}
+
+	return eg.Wait()
+}
+
+// warmBuilder exports every image into the cache of a single builder.
+func warmBuilder(
+	ctx context.Context,
+	log logr.Logger,
+	cfg config.Buildkit,
+	dockerConfigDir string,
+	podName string,
+	images []string,
+) error {
+	addr := builderAddr(cfg, podName)
+	log = log.WithValues("pod", podName, "addr", addr)
+
+	bk, err := newCacheWarmer(ctx, log, cfg, addr, dockerConfigDir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := bk.Close(); err != nil {
+			log.Error(err, "Failed to close buildkit client")
+		}
+	}()
+
+	for _, image := range images {
+		log.Info("Launching cache export", "image", image)
+		if err := bk.Cache(ctx, image); err != nil {
+			return fmt.Errorf("cache export of image %q failed for pod %q: %w", image, podName, err)
+		}
+	}
+
+	return nil
+}
+
+// BuilderWarmup returns a function exporting the images of every ImageCache and ClusterImageCache into the cache of a
+// single builder, e.g. once a rolling upgrade restarted it. Every cache is warmed even when another one fails.
+func BuilderWarmup(
+	c client.Client,
+	restCfg *rest.Config,
+	log logr.Logger,
+	cfg config.Buildkit,
+) func(ctx context.Context, podName string) error {
+	return func(ctx context.Context, podName string) error {
+		var caches hephv1.ImageCacheList
+		if err := c.List(ctx, &caches); err != nil {
+			return fmt.Errorf("image cache lookup failed: %w", err)
+		}
+		var clusterCaches hephv1.ClusterImageCacheList
+		if err := c.List(ctx, &clusterCaches); err != nil {
+			return fmt.Errorf("cluster image cache lookup failed: %w", err)
+		}
+
+		var errs []error
+		for _, ic := range caches.Items {
+			errs = append(errs, warmCache(ctx, log, restCfg, cfg, ic.Namespace, ic.Spec, podName))
+		}
+		for _, cic := range clusterCaches.Items {
+			errs = append(errs, warmCache(ctx, log, restCfg, cfg, "", cic.Spec, podName))
+		}
+
+		return errors.Join(errs...)
+	}
+}
+
+// warmCache exports the images of a single cache into the cache of a builder with the credentials of the cache.
+func warmCache(
+	ctx context.Context,
+	log logr.Logger,
+	restCfg *rest.Config,
+	cfg config.Buildkit,
+	namespace string,
+	spec hephv1.ImageCacheSpec,
+	podName string,
+) error {
+	if len(spec.Images) == 0 {
+		return nil
+	}
+
+	configDir, sources, err := credentials.Persist(ctx, log, restCfg, credentials.NewScope(namespace, cfg),
+		spec.RegistryAuth)
+	if err != nil {
+		return fmt.Errorf("registry credentials processing failed: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(configDir); err != nil {
+			log.Error(err, "Failed to delete registry credentials")
+		}
+		if err := sources.Revoke(context.WithoutCancel(ctx)); err != nil {
+			log.Error(err, "Failed to revoke registry access tokens")
+		}
+	}()
+
+	return warmBuilder(ctx, log, cfg, configDir, podName, spec.Images)
+}
@@ -0,0 +1,176 @@
+package component
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+type fakeWarmer struct {
+	mu     *sync.Mutex
+	cached *[]string
+	closed *[]string
+	addr   string
+	err    error
+}
+
+func (f *fakeWarmer) Cache(_ context.Context, image string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	*f.cached = append(*f.cached, f.addr+" "+image)
+
+	return f.err
+}
+
+func (f *fakeWarmer) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	*f.closed = append(*f.closed, f.addr)
+
+	return nil
+}
+
+func TestReadyBuilders(t *testing.T) {
+	cfg := config.Buildkit{Namespace: "buildkit", PodLabels: map[string]string{"app": "buildkit"}}
+
+	pod := func(name string, phase corev1.PodPhase, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "buildkit", Labels: cfg.PodLabels},
+			Status: corev1.PodStatus{
+				Phase:      phase,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+			},
+		}
+	}
+	c := fake.NewClientBuilder().WithObjects(
+		pod("buildkit-2", corev1.PodRunning, corev1.ConditionTrue),
+		pod("buildkit-0", corev1.PodRunning, corev1.ConditionTrue),
+		pod("buildkit-1", corev1.PodRunning, corev1.ConditionFalse),
+		pod("buildkit-3", corev1.PodPending, corev1.ConditionFalse),
+	).Build()
+
+	names, err := readyBuilders(context.Background(), c, cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"buildkit-0", "buildkit-2"}, names)
+}
+
+func TestPartitionSpotBuilders(t *testing.T) {
+	cfg := config.Buildkit{Namespace: "buildkit", SpotNodeLabels: map[string]string{"capacity-type": "spot"}}
+
+	pod := func(name, nodeName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "buildkit"},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+		}
+	}
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "spot", Labels: cfg.SpotNodeLabels}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "on-demand"}},
+		pod("buildkit-0", "on-demand"),
+		pod("buildkit-1", "spot"),
+		pod("buildkit-2", "missing"),
+	).Build()
+	names := []string{"buildkit-0", "buildkit-1", "buildkit-2"}
+
+	spot, onDemand := partitionSpotBuilders(context.Background(), c, cfg, names)
+	assert.Equal(t, []string{"buildkit-1"}, spot)
+	assert.Equal(t, []string{"buildkit-0", "buildkit-2"}, onDemand, "uninspectable nodes are treated as on-demand")
+
+	spot, onDemand = partitionSpotBuilders(context.Background(), c, config.Buildkit{Namespace: "buildkit"}, names)
+	assert.Empty(t, spot)
+	assert.Equal(t, names, onDemand)
+}
+
+func TestWarmBuilders(t *testing.T) {
+	cfg := config.Buildkit{Namespace: "buildkit", ServiceName: "buildkit", DaemonPort: 1234}
+
+	var mu sync.Mutex
+	var cached, closed []string
+	var cacheErr error
+
+	original := newCacheWarmer
+	defer func() { newCacheWarmer = original }()
+	newCacheWarmer = func(_ context.Context, _ logr.Logger, _ config.Buildkit, addr, _ string) (cacheWarmer, error) {
+		return &fakeWarmer{mu: &mu, cached: &cached, closed: &closed, addr: addr, err: cacheErr}, nil
+	}
+
+	t.Run("success", func(t *testing.T) {
+		cached, closed = nil, nil
+
+		err := warmBuilders(context.Background(), logr.Discard(), cfg, "", []string{"buildkit-0", "buildkit-1"},
+			[]string{"alpine:3", "golang:1"})
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, []string{
+			"tcp://buildkit-0.buildkit.buildkit:1234 alpine:3",
+			"tcp://buildkit-0.buildkit.buildkit:1234 golang:1",
+			"tcp://buildkit-1.buildkit.buildkit:1234 alpine:3",
+			"tcp://buildkit-1.buildkit.buildkit:1234 golang:1",
+		}, cached)
+		assert.ElementsMatch(t, []string{
+			"tcp://buildkit-0.buildkit.buildkit:1234",
+			"tcp://buildkit-1.buildkit.buildkit:1234",
+		}, closed)
+	})
+
+	t.Run("cache_error", func(t *testing.T) {
+		cached, closed = nil, nil
+		cacheErr = errors.New("solve failed")
+		defer func() { cacheErr = nil }()
+
+		err := warmBuilders(context.Background(), logr.Discard(), cfg, "", []string{"buildkit-0"},
+			[]string{"alpine:3", "golang:1"})
+		assert.ErrorContains(t, err, `cache export of image "alpine:3" failed for pod "buildkit-0"`)
+
+		assert.Equal(t, []string{"tcp://buildkit-0.buildkit.buildkit:1234 alpine:3"}, cached)
+		assert.Equal(t, []string{"tcp://buildkit-0.buildkit.buildkit:1234"}, closed)
+	})
+}
+
+func TestBuilderWarmup(t *testing.T) {
+	cfg := config.Buildkit{Namespace: "buildkit", ServiceName: "buildkit", DaemonPort: 1234}
+
+	var mu sync.Mutex
+	var cached, closed []string
+
+	original := newCacheWarmer
+	defer func() { newCacheWarmer = original }()
+	newCacheWarmer = func(_ context.Context, _ logr.Logger, _ config.Buildkit, addr, _ string) (cacheWarmer, error) {
+		return &fakeWarmer{mu: &mu, cached: &cached, closed: &closed, addr: addr}, nil
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, hephv1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&hephv1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "team", Namespace: "team-a"},
+			Spec:       hephv1.ImageCacheSpec{Images: []string{"alpine:3"}},
+		},
+		&hephv1.ClusterImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+			Spec:       hephv1.ImageCacheSpec{Images: []string{"golang:1"}},
+		},
+	).Build()
+
+	warmup := BuilderWarmup(c, nil, logr.Discard(), cfg)
+	require.NoError(t, warmup(context.Background(), "buildkit-1"))
+
+	assert.ElementsMatch(t, []string{
+		"tcp://buildkit-1.buildkit.buildkit:1234 alpine:3",
+		"tcp://buildkit-1.buildkit.buildkit:1234 golang:1",
+	}, cached)
+	assert.Len(t, closed, 2)
+}
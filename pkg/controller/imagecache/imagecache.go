@@ -1,20 +1,49 @@
 package imagecache
 
 import (
+	"github.com/dominodatalab/controller-util/core"
+	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/buildkit/worker"
 	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/imagecache/component"
+	"github.com/dominodatalab/hephaestus/pkg/webhook"
 )
 
-func Register(_ ctrl.Manager, _ config.Controller) error {
-	ctrl.Log.WithName("controller").WithName("imagecache").Info(
-		"Aborting registration, requires rework after other changes",
-	)
+func Register(mgr ctrl.Manager, cfg config.Controller) error {
+	err := core.NewReconciler(mgr).
+		For(&hephv1.ImageCache{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Component("cache-warmer", component.CacheWarmer(cfg.Buildkit)).
+		Complete()
+	if err != nil {
+		return err
+	}
+
+	err = core.NewReconciler(mgr).
+		For(&hephv1.ClusterImageCache{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Component("cache-warmer", component.ClusterCacheWarmer(cfg.Buildkit)).
+		Complete()
+	if err != nil {
+		return err
+	}
+
+	// both cache kinds share a validator, so they cannot use the registration built into the reconciler
+	for _, obj := range []runtime.Object{&hephv1.ImageCache{}, &hephv1.ClusterImageCache{}} {
+		if err = ctrl.NewWebhookManagedBy(mgr).For(obj).WithValidator(&webhook.ImageCacheValidator{}).Complete(); err != nil {
+			return err
+		}
+	}
+
 	return nil
+}
 
-	// return core.NewReconciler(mgr).
-	// 	For(&hephv1.ImageCache{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
-	// 	Component("cache-warmer", component.CacheWarmer(cfg.Buildkit)).
-	// 	WithWebhooks().
-	// 	Complete()
+// BuilderWarmup warms the cache of a single builder of the worker pool configured by cfg with the images of every
+// ImageCache and ClusterImageCache.
+func BuilderWarmup(mgr ctrl.Manager, cfg config.Buildkit) worker.CacheWarmup {
+	log := ctrl.Log.WithName("controller").WithName("imagecache").WithName("warmup")
+	return component.BuilderWarmup(mgr.GetClient(), mgr.GetConfig(), log, cfg)
 }
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	hephclient "github.com/dominodatalab/hephaestus/pkg/client"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/kubernetes"
+)
+
+// selfTestDockerfile has no base image or layers, so the build only exercises the worker and the registry push.
+const selfTestDockerfile = `FROM scratch
+LABEL com.dominodatalab.hephaestus.selftest="true"
+`
+
+// SelfTestOptions configure the image built by SelfTest.
+type SelfTestOptions struct {
+	// Registry the test image is pushed to as "<registry>/hephaestus-selftest:<timestamp>".
+	Registry string
+	// RegistrySecret is a docker config secret holding the registry credentials, the push is anonymous when nil.
+	RegistrySecret *hephv1.SecretCredentials
+	// Namespace the test ImageBuild is created in, it must be watched by the controller.
+	Namespace string
+}
+
+// SelfTest submits an ImageBuild that builds and pushes a tiny image, waits for it to finish and deletes it. The build
+// is dispatched by the running controller through its own worker pool, so it is run after installs and upgrades to
+// verify builds are admitted, leased, solved and pushed to a registry end to end.
+func SelfTest(ctx context.Context, cfg config.Controller, opts SelfTestOptions) error {
+	log := ctrl.Log.WithName("selftest")
+
+	restCfg, err := kubernetes.RestConfig()
+	if err != nil {
+		return err
+	}
+	hc, err := hephclient.NewForConfig(restCfg)
+	if err != nil {
+		return err
+	}
+
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = cfg.Buildkit.Namespace
+	}
+	image := fmt.Sprintf("%s/hephaestus-selftest:%d", strings.TrimSuffix(opts.Registry, "/"), time.Now().Unix())
+
+	ib := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "hephaestus-selftest-",
+			Namespace:    namespace,
+		},
+		Spec: hephv1.ImageBuildSpec{
+			DockerfileContents: selfTestDockerfile,
+			Images:             []string{image},
+			LogKey:             "hephaestus-selftest",
+		},
+	}
+	if opts.RegistrySecret != nil {
+		ib.Spec.RegistryAuth = []hephv1.RegistryCredentials{{Secret: opts.RegistrySecret}}
+	}
+
+	log.Info("Submitting test build", "image", image, "namespace", namespace)
+	start := time.Now()
+
+	builds := hc.HephaestusV1().ImageBuilds(namespace)
+	created, err := builds.Create(ctx, ib, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot create test build: %w", err)
+	}
+	defer func() {
+		// deleting an unfinished build cancels it, so the build is removed even when the test ran out of time
+		log.Info("Deleting test build", "name", created.Name)
+		if err := builds.Delete(context.Background(), created.Name, metav1.DeleteOptions{}); err != nil {
+			log.Error(err, "Failed to delete test build", "name", created.Name)
+		}
+	}()
+
+	// the deadline of the context limits the wait
+	result, err := hc.WaitForCompletion(ctx, types.NamespacedName{Namespace: namespace, Name: created.Name}, 0)
+	if err != nil {
+		return err
+	}
+	if result.Status.Phase == hephv1.PhaseFailed {
+		reason := "unknown error"
+		if cond := meta.FindStatusCondition(result.Status.Conditions, "ImageReady"); cond != nil {
+			reason = cond.Message
+		}
+
+		return fmt.Errorf("test build %s failed: %s", created.Name, reason)
+	}
+
+	log.Info("Self-test passed", "name", created.Name, "image", image, "digest", result.Status.Digest,
+		"duration", time.Since(start).Truncate(time.Millisecond))
+	return nil
+}
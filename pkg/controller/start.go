@@ -2,7 +2,9 @@ package controller
 
 import (
 	"context"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -10,9 +12,13 @@ import (
 	"github.com/newrelic/go-agent/v3/integrations/nrzap"
 	"github.com/newrelic/go-agent/v3/newrelic"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -32,24 +38,32 @@ import (
 	// +kubebuilder:scaffold:imports
 )
 
-var cloudAuthRegistrationTimeout = 30 * time.Second
-
-func init() {
-	if cloudAuthRegTimeoutEnv := os.Getenv("CLOUD_AUTH_REGISTRATION_TIMEOUT"); cloudAuthRegTimeoutEnv != "" {
-		if duration, err := time.ParseDuration(cloudAuthRegTimeoutEnv); err == nil {
-			cloudAuthRegistrationTimeout = duration
-		}
-	}
-}
+// cloudAuthTimeoutEnv bounded the registration of cloud auth providers before cloudAuth.timeout was configurable.
+//
+// Deprecated: remove once a release has warned about it, cloudAuth.timeout replaces it.
+const cloudAuthTimeoutEnv = "CLOUD_AUTH_REGISTRATION_TIMEOUT"
 
 // Start creates a new controller manager, registers controllers, and starts
 // their control loops for resource reconciliation.
 func Start(cfg config.Controller) error {
-	zapLogger, err := logger.NewZap(cfg.Logging)
+	levels := logger.NewLevels()
+	zapLogger, err := logger.NewZap(cfg.Logging, levels)
 	if err != nil {
 		return err
 	}
 
+	var forwarder *logger.RedisForwarder
+	if redisCfg := cfg.Logging.Redis; redisCfg != nil && redisCfg.Enabled {
+		forwarder, err = logger.NewRedisForwarder(ctrl.Log.WithName("redis-forwarder"), *redisCfg)
+		if err != nil {
+			return err
+		}
+
+		zapLogger = zapLogger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, forwarder.Core())
+		}))
+	}
+
 	ctrl.SetLogger(zapr.NewLogger(zapLogger))
 
 	log := ctrl.Log.WithName("setup")
@@ -62,28 +76,57 @@ func Start(cfg config.Controller) error {
 	}
 	defer nr.Shutdown(5 * time.Second)
 
-	mgr, err := createManager(log, cfg.Manager)
+	// pools are added once they are created, the endpoint only serves requests after the manager is started
+	queues := map[string]worker.QueueInspector{}
+	mgr, err := createManager(log, cfg.Manager, cfg.Buildkit, cfg.Logging, levels, queues)
 	if err != nil {
 		return err
 	}
 
-	pool, err := createWorkerPool(log, mgr, cfg.Buildkit)
+	if domain := cfg.Manager.AnnotationDomain; domain != "" {
+		log.Info("Using custom annotation domain", "domain", domain)
+		hephv1.SetAnnotationDomain(domain)
+	}
+
+	pool, err := createWorkerPool(log, mgr, cfg.Buildkit, cfg.Manager, "worker-pool")
 	if err != nil {
 		return err
 	}
 	if err = mgr.Add(pool); err != nil {
 		return err
 	}
+	if inspector, ok := pool.(worker.QueueInspector); ok {
+		queues["default"] = inspector
+	}
 
-	if err = registerControllers(log, mgr, pool, nr, cfg); err != nil {
-		return err
+	var arm64Pool worker.Pool
+	if cfg.Buildkit.ARM64Pool.Enabled() {
+		arm64Cfg := cfg.Buildkit.ARM64Config()
+		if arm64Pool, err = createWorkerPool(log, mgr, arm64Cfg, cfg.Manager, "arm64-worker-pool"); err != nil {
+			return err
+		}
+		if err = mgr.Add(arm64Pool); err != nil {
+			return err
+		}
+		if inspector, ok := arm64Pool.(worker.QueueInspector); ok {
+			queues["arm64"] = inspector
+		}
+	}
+
+	if forwarder != nil {
+		log.Info("Forwarding build logs to redis", "address", cfg.Logging.Redis.Address)
+		if err = mgr.Add(forwarder); err != nil {
+			return err
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), cloudAuthRegistrationTimeout)
-	defer cancel()
+	if err = registerControllers(log, mgr, pool, arm64Pool, nr, cfg); err != nil {
+		return err
+	}
 
-	log.Info("Registering cloud auth providers", "timeout", cloudAuthRegistrationTimeout)
-	if err = credentials.LoadCloudProviders(ctx, log); err != nil {
+	log.Info("Registering cloud auth providers")
+	cfg.CloudAuth = applyCloudAuthTimeoutEnv(log, cfg.CloudAuth)
+	if err = credentials.LoadCloudProviders(context.Background(), log, cfg.CloudAuth); err != nil {
 		return err
 	}
 
@@ -93,6 +136,32 @@ func Start(cfg config.Controller) error {
 	return mgr.Start(ctrl.SetupSignalHandler())
 }
 
+// applyCloudAuthTimeoutEnv maps the deprecated cloud auth timeout environment variable onto cloudAuth.timeout unless
+// the config sets one.
+func applyCloudAuthTimeoutEnv(log logr.Logger, cfg config.CloudAuth) config.CloudAuth {
+	value := os.Getenv(cloudAuthTimeoutEnv)
+	if value == "" {
+		return cfg
+	}
+
+	if cfg.Timeout != 0 {
+		log.Info("Ignoring deprecated environment variable, cloudAuth.timeout is configured", "env", cloudAuthTimeoutEnv)
+		return cfg
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		log.Info("Ignoring invalid deprecated environment variable", "env", cloudAuthTimeoutEnv, "value", value)
+		return cfg
+	}
+
+	log.Info("Environment variable is deprecated and will be removed in the next release, use cloudAuth.timeout "+
+		"instead", "env", cloudAuthTimeoutEnv, "timeout", timeout)
+	cfg.Timeout = timeout
+
+	return cfg
+}
+
 func configureNewRelic(log *zap.Logger, cfg config.NewRelic) (*newrelic.Application, error) {
 	return newrelic.NewApplication(
 		newrelic.ConfigEnabled(cfg.Enabled),
@@ -105,7 +174,14 @@ func configureNewRelic(log *zap.Logger, cfg config.NewRelic) (*newrelic.Applicat
 	)
 }
 
-func createManager(log logr.Logger, cfg config.Manager) (ctrl.Manager, error) {
+func createManager(
+	log logr.Logger,
+	cfg config.Manager,
+	bkCfg config.Buildkit,
+	logCfg config.Logging,
+	levels *logger.Levels,
+	queues map[string]worker.QueueInspector,
+) (ctrl.Manager, error) {
 	log.Info("Adding API types to runtime scheme")
 	scheme := runtime.NewScheme()
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
@@ -113,15 +189,37 @@ func createManager(log logr.Logger, cfg config.Manager) (ctrl.Manager, error) {
 
 	// +kubebuilder:scaffold:scheme
 
+	metricsOpts := server.Options{BindAddress: cfg.MetricsAddr, ExtraHandlers: map[string]http.Handler{}}
+	if endpoint := logCfg.LevelEndpoint; endpoint.Enabled {
+		log.Info("Serving log level overrides", "path", "/loglevel", "addr", cfg.MetricsAddr)
+		metricsOpts.ExtraHandlers["/loglevel"] = levels.Handler(endpoint.TokenFile)
+	}
+	if endpoint := cfg.QueueEndpoint; endpoint.Enabled {
+		log.Info("Serving worker pool queues", "path", "/queue", "addr", cfg.MetricsAddr)
+		metricsOpts.ExtraHandlers["/queue"] = worker.QueueHandler(endpoint.TokenFile, queues)
+	}
+
 	opts := ctrl.Options{
 		Scheme:                 scheme,
-		Metrics:                server.Options{BindAddress: cfg.MetricsAddr},
+		Metrics:                metricsOpts,
 		HealthProbeBindAddress: cfg.HealthProbeAddr,
 		LeaderElection:         cfg.EnableLeaderElection,
 		LeaderElectionID:       "hephaestus-controller-lock",
 	}
 	webhookOpts := webhook.Options{Port: cfg.WebhookPort}
 
+	if owner := cfg.FieldManager; owner != "" {
+		log.Info("Using custom field manager", "name", owner)
+		opts.NewClient = func(config *rest.Config, options client.Options) (client.Client, error) {
+			c, err := client.New(config, options)
+			if err != nil {
+				return nil, err
+			}
+
+			return client.WithFieldOwner(c, owner), nil
+		}
+	}
+
 	if certDir := os.Getenv("WEBHOOK_SERVER_CERT_DIR"); certDir != "" {
 		log.Info("Overriding webhook server certificate directory", "value", certDir)
 		webhookOpts.CertDir = certDir
@@ -137,7 +235,19 @@ func createManager(log logr.Logger, cfg config.Manager) (ctrl.Manager, error) {
 	} else {
 		log.Info("Watching all namespaces")
 	}
+	// the image cache controllers only watch builder pods, which all live in the buildkit namespace
+	opts.Cache.ByObject = map[client.Object]cache.ByObject{
+		&corev1.Pod{}: {Namespaces: map[string]cache.Config{bkCfg.Namespace: {}}},
+	}
 	opts.WebhookServer = webhook.NewServer(webhookOpts)
+	if auditCfg := logCfg.AdmissionAudit; auditCfg.Enabled {
+		log.Info("Recording webhook admission decisions", "filepath", auditCfg.Filepath)
+		auditor, err := logger.NewAdmissionAuditor(ctrl.Log.WithName("admission-audit"), auditCfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.WebhookServer = auditor.Server(opts.WebhookServer)
+	}
 
 	log.Info("Creating new controller manager")
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), opts)
@@ -158,12 +268,49 @@ func createWorkerPool(
 	log logr.Logger,
 	mgr ctrl.Manager,
 	cfg config.Buildkit,
+	mgrCfg config.Manager,
+	name string,
 ) (worker.Pool, error) {
-	log.Info("Initializing buildkit worker pool")
-	poolOpts := []worker.PoolOption{
-		worker.Logger(ctrl.Log.WithName("buildkit.worker-pool")),
+	log.Info("Initializing buildkit worker pool", "statefulSet", cfg.StatefulSetName)
+	poolOpts := append(workerPoolOptions(cfg, mgrCfg),
+		worker.Logger(ctrl.Log.WithName("buildkit."+name)),
+		worker.EventRecorder(mgr.GetEventRecorderFor("buildkit-"+name)),
+		worker.OrphanedLeases(imageBuildExists(mgr.GetAPIReader())),
+	)
+	if cfg.PoolRollingUpgrade {
+		poolOpts = append(poolOpts, worker.WarmCaches(imagecache.BuilderWarmup(mgr, cfg)))
 	}
 
+	clientset, err := kubernetes.Clientset(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	return worker.NewPool(clientset, cfg, poolOpts...), nil
+}
+
+// imageBuildExists looks up the ImageBuild that owns a worker lease. Owners that are not an ImageBuild key are assumed
+// to exist.
+func imageBuildExists(reader client.Reader) worker.LeaseOwnerLookup {
+	return func(ctx context.Context, owner string) (bool, error) {
+		namespace, name, ok := strings.Cut(owner, "/")
+		if !ok {
+			return true, nil
+		}
+
+		err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &hephv1.ImageBuild{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return err == nil, err
+	}
+}
+
+// workerPoolOptions returns the pool options derived from the controller configuration.
+func workerPoolOptions(cfg config.Buildkit, mgrCfg config.Manager) []worker.PoolOption {
+	var poolOpts []worker.PoolOption
+
 	if mit := cfg.PoolMaxIdleTime; mit != nil {
 		poolOpts = append(poolOpts, worker.MaxIdleTime(*mit))
 	}
@@ -172,29 +319,69 @@ func createWorkerPool(
 		poolOpts = append(poolOpts, worker.SyncWaitTime(*swt))
 	}
 
+	if sli := cfg.PoolStateLogInterval; sli != nil {
+		poolOpts = append(poolOpts, worker.StateLogInterval(*sli))
+	}
+
 	if wt := cfg.PoolEndpointWatchTimeout; wt != nil {
 		poolOpts = append(poolOpts, worker.EndpointWatchTimeoutSeconds(*wt))
 	}
 
-	clientset, err := kubernetes.Clientset(mgr.GetConfig())
-	if err != nil {
-		return nil, err
+	if wr := cfg.PoolEndpointWatchRetries; wr != nil {
+		poolOpts = append(poolOpts, worker.EndpointWatchRetries(*wr))
 	}
 
-	return worker.NewPool(clientset, cfg, poolOpts...), nil
+	if wb := cfg.PoolEndpointWatchBackoff; wb != nil {
+		poolOpts = append(poolOpts, worker.EndpointWatchBackoff(*wb))
+	}
+
+	if ed := cfg.PoolEndpointDiscovery; ed != "" {
+		poolOpts = append(poolOpts, worker.EndpointDiscovery(ed))
+	}
+
+	if fs := cfg.PoolFairScheduling; fs.Enabled {
+		poolOpts = append(poolOpts, worker.FairScheduling(fs.NamespaceWeights))
+	}
+
+	if am := cfg.PoolAddressMode; am != "" {
+		poolOpts = append(poolOpts, worker.AddressMode(am))
+	}
+
+	if domain := mgrCfg.AnnotationDomain; domain != "" {
+		poolOpts = append(poolOpts, worker.AnnotationDomain(domain))
+	}
+
+	if owner := mgrCfg.FieldManager; owner != "" {
+		poolOpts = append(poolOpts, worker.FieldManager(owner+"-pod-lease-manager"))
+	}
+
+	if cfg.PoolMaxBuildsPerPod > 0 {
+		poolOpts = append(poolOpts, worker.MaxBuildsPerPod(cfg.PoolMaxBuildsPerPod))
+	}
+
+	if cfg.PoolRollingUpgrade {
+		poolOpts = append(poolOpts, worker.RollingUpgrade(true))
+	}
+
+	if cfg.PoolDisruptionBudget {
+		poolOpts = append(poolOpts, worker.DisruptionBudget(true))
+	}
+
+	return poolOpts
 }
 
 func registerControllers(
 	log logr.Logger,
 	mgr ctrl.Manager,
 	pool worker.Pool,
+	arm64Pool worker.Pool,
 	nr *newrelic.Application,
 	cfg config.Controller,
 ) error {
 	deleteCh := make(chan client.ObjectKey, 10)
 
 	log.Info("Registering ImageBuild controller")
-	if err := imagebuild.Register(mgr, cfg, pool, nr, deleteCh); err != nil {
+	if err := imagebuild.Register(mgr, cfg, pool, arm64Pool, nr, deleteCh); err != nil {
 		return err
 	}
 
@@ -0,0 +1,34 @@
+// Package apm adds ImageBuild metadata to New Relic transactions and records build custom events.
+package apm
+
+import (
+	"github.com/newrelic/go-agent/v3/newrelic"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+// ObjectAttributes returns the configured labels and annotations present on the object, keyed by their attribute
+// name.
+func ObjectAttributes(cfg config.NewRelic, obj metav1.Object) map[string]string {
+	attrs := map[string]string{}
+	for _, key := range cfg.AttributeLabels {
+		if v, ok := obj.GetLabels()[key]; ok {
+			attrs["label."+key] = v
+		}
+	}
+	for _, key := range cfg.AttributeAnnotations {
+		if v, ok := obj.GetAnnotations()[key]; ok {
+			attrs["annotation."+key] = v
+		}
+	}
+
+	return attrs
+}
+
+// AddObjectAttributes adds the ObjectAttributes of obj to the transaction.
+func AddObjectAttributes(txn *newrelic.Transaction, cfg config.NewRelic, obj metav1.Object) {
+	for k, v := range ObjectAttributes(cfg, obj) {
+		txn.AddAttribute(k, v)
+	}
+}
@@ -0,0 +1,67 @@
+package apm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func TestObjectAttributes(t *testing.T) {
+	ib := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      map[string]string{"team": "ml", "tier": "gold"},
+			Annotations: map[string]string{"example.com/project": "churn", "example.com/owner": "jdoe"},
+		},
+	}
+	cfg := config.NewRelic{
+		AttributeLabels:      []string{"team", "missing"},
+		AttributeAnnotations: []string{"example.com/project"},
+	}
+
+	assert.Equal(t, map[string]string{
+		"label.team":                     "ml",
+		"annotation.example.com/project": "churn",
+	}, ObjectAttributes(cfg, ib))
+	assert.Empty(t, ObjectAttributes(config.NewRelic{}, ib))
+
+	// transactions are nil when New Relic is disabled
+	AddObjectAttributes(nil, cfg, ib)
+}
+
+func TestBuildEventAttributes(t *testing.T) {
+	ib := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "build-1",
+			Namespace: "ns",
+			Labels:    map[string]string{"team": "ml"},
+		},
+		Status: hephv1.ImageBuildStatus{
+			BuildTime:                &metav1.Duration{Duration: 90 * time.Second},
+			CompressedImageSizeBytes: resource.NewQuantity(1024, resource.BinarySI),
+		},
+	}
+	cfg := config.NewRelic{AttributeLabels: []string{"team"}, BuildEvents: true}
+
+	assert.Equal(t, map[string]any{
+		"imagebuild":     "build-1",
+		"namespace":      "ns",
+		"cachedSteps":    3,
+		"totalSteps":     4,
+		"cacheHitRatio":  0.75,
+		"buildSeconds":   90.0,
+		"imageSizeBytes": int64(1024),
+		"label.team":     "ml",
+	}, BuildEventAttributes(cfg, ib, CacheHits{Cached: 3, Total: 4}))
+
+	attrs := BuildEventAttributes(config.NewRelic{}, &hephv1.ImageBuild{}, CacheHits{})
+	assert.NotContains(t, attrs, "cacheHitRatio", "ratio is undefined without completed steps")
+
+	// applications are nil when New Relic is disabled
+	RecordBuildEvent(nil, cfg, ib, CacheHits{})
+}
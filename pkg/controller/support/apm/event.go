@@ -0,0 +1,54 @@
+package apm
+
+import (
+	"github.com/newrelic/go-agent/v3/newrelic"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+// BuildEventType is the custom event recorded for every successful ImageBuild.
+const BuildEventType = "ImageBuildCompleted"
+
+// CacheHits counts the completed build steps and how many of them were served from the build cache.
+type CacheHits struct {
+	Cached int
+	Total  int
+}
+
+// BuildEventAttributes returns the attributes of the custom event recorded for a successful build. Measurements that
+// are missing from the build status are omitted.
+func BuildEventAttributes(cfg config.NewRelic, obj *hephv1.ImageBuild, hits CacheHits) map[string]any {
+	attrs := map[string]any{
+		"imagebuild":  obj.Name,
+		"namespace":   obj.Namespace,
+		"cachedSteps": hits.Cached,
+		"totalSteps":  hits.Total,
+	}
+	if hits.Total > 0 {
+		attrs["cacheHitRatio"] = float64(hits.Cached) / float64(hits.Total)
+	}
+	if d := obj.Status.BuildTime; d != nil {
+		attrs["buildSeconds"] = d.Seconds()
+	}
+	if d := obj.Status.AllocationTime; d != nil {
+		attrs["allocationSeconds"] = d.Seconds()
+	}
+	if size := obj.Status.CompressedImageSizeBytes; size != nil {
+		attrs["imageSizeBytes"] = size.Value()
+	}
+	for k, v := range ObjectAttributes(cfg, obj) {
+		attrs[k] = v
+	}
+
+	return attrs
+}
+
+// RecordBuildEvent records a BuildEventType custom event for the build when build events are enabled.
+func RecordBuildEvent(app *newrelic.Application, cfg config.NewRelic, obj *hephv1.ImageBuild, hits CacheHits) {
+	if !cfg.BuildEvents {
+		return
+	}
+
+	app.RecordCustomEvent(BuildEventType, BuildEventAttributes(cfg, obj, hits))
+}
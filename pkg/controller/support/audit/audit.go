@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/phase"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Record describes the outcome of a single ImageBuild for audit purposes.
+type Record struct {
+	Timestamp   time.Time    `json:"timestamp"`
+	Namespace   string       `json:"namespace"`
+	Name        string       `json:"name"`
+	UID         string       `json:"uid"`
+	Phase       hephv1.Phase `json:"phase"`
+	User        string       `json:"user,omitempty"`
+	Groups      []string     `json:"groups,omitempty"`
+	Managers    []string     `json:"managers,omitempty"`
+	BuilderAddr string       `json:"builderAddr,omitempty"`
+	Images      []string     `json:"images,omitempty"`
+	Digest      string       `json:"digest,omitempty"`
+	Message     string       `json:"message,omitempty"`
+}
+
+// NewRecord builds an audit record from the current state of an ImageBuild.
+func NewRecord(ib *hephv1.ImageBuild, ts time.Time) Record {
+	rec := Record{
+		Timestamp:   ts,
+		Namespace:   ib.Namespace,
+		Name:        ib.Name,
+		UID:         string(ib.UID),
+		Phase:       ib.Status.Phase,
+		User:        ib.Annotations[hephv1.RequestedByAnnotation],
+		Managers:    managers(ib.ManagedFields),
+		BuilderAddr: ib.Status.BuilderAddr,
+		Images:      ib.Spec.Images,
+		Digest:      ib.Status.Digest,
+	}
+
+	if groups := ib.Annotations[hephv1.RequestedByGroupsAnnotation]; groups != "" {
+		rec.Groups = strings.Split(groups, ",")
+	}
+
+	if ib.Status.Phase == hephv1.PhaseFailed {
+		for _, cond := range ib.Status.Conditions {
+			if cond.Status == metav1.ConditionFalse {
+				rec.Message = cond.Message
+			}
+		}
+	}
+
+	return rec
+}
+
+// managers returns the field managers that wrote the ImageBuild spec, in the order recorded by the API server.
+func managers(entries []metav1.ManagedFieldsEntry) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Subresource != "" || entry.Manager == "" || seen[entry.Manager] {
+			continue
+		}
+
+		seen[entry.Manager] = true
+		names = append(names, entry.Manager)
+	}
+
+	return names
+}
+
+// Hook writes an audit record whenever an ImageBuild reaches a terminal phase.
+type Hook struct {
+	mu  sync.Mutex
+	out io.Writer
+	url string
+	hc  *http.Client
+}
+
+var _ phase.TransitionHook = &Hook{}
+
+// NewHook creates an audit hook that writes JSON lines to a file and/or POSTs each record to a URL.
+func NewHook(cfg config.Audit) (*Hook, error) {
+	h := &Hook{url: cfg.URL, hc: &http.Client{Timeout: webhookTimeout}}
+
+	if cfg.Filepath != "" {
+		f, err := os.OpenFile(cfg.Filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open audit log: %w", err)
+		}
+		h.out = f
+	}
+
+	return h, nil
+}
+
+func (h *Hook) Name() string {
+	return "audit"
+}
+
+func (h *Hook) OnTransition(ctx context.Context, event phase.TransitionEvent) error {
+	ib, ok := event.Object.(*hephv1.ImageBuild)
+	if !ok || (event.Phase != hephv1.PhaseSucceeded && event.Phase != hephv1.PhaseFailed) {
+		return nil
+	}
+
+	line, err := json.Marshal(NewRecord(ib, event.OccurredAt))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if h.out != nil {
+		h.mu.Lock()
+		_, err = h.out.Write(append(line, '\n'))
+		h.mu.Unlock()
+
+		errs = append(errs, err)
+	}
+	if h.url != "" {
+		errs = append(errs, h.post(ctx, line))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (h *Hook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook returned unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/phase"
+)
+
+func testBuild(p hephv1.Phase) *hephv1.ImageBuild {
+	return &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "build",
+			Namespace: "ns",
+			UID:       "abc-123",
+			Annotations: map[string]string{
+				hephv1.RequestedByAnnotation:       "jane",
+				hephv1.RequestedByGroupsAnnotation: "system:authenticated,data-science",
+			},
+			ManagedFields: []metav1.ManagedFieldsEntry{
+				{Manager: "kubectl-client-side-apply"},
+				{Manager: "hephaestus", Subresource: "status"},
+				{Manager: "kubectl-client-side-apply"},
+				{Manager: "nucleus"},
+			},
+		},
+		Spec: hephv1.ImageBuildSpec{Images: []string{"registry.example.com/app:v1"}},
+		Status: hephv1.ImageBuildStatus{
+			Phase:       p,
+			BuilderAddr: "tcp://hephaestus-buildkit-0.hephaestus-buildkit.default:1234",
+			Digest:      "sha256:deadbeef",
+			Conditions: []metav1.Condition{
+				{Type: "ImageReady", Status: metav1.ConditionFalse, Message: "build failed"},
+			},
+		},
+	}
+}
+
+func TestNewRecord(t *testing.T) {
+	ts := time.Now()
+
+	rec := NewRecord(testBuild(hephv1.PhaseSucceeded), ts)
+	assert.Equal(t, Record{
+		Timestamp:   ts,
+		Namespace:   "ns",
+		Name:        "build",
+		UID:         "abc-123",
+		Phase:       hephv1.PhaseSucceeded,
+		User:        "jane",
+		Groups:      []string{"system:authenticated", "data-science"},
+		Managers:    []string{"kubectl-client-side-apply", "nucleus"},
+		BuilderAddr: "tcp://hephaestus-buildkit-0.hephaestus-buildkit.default:1234",
+		Images:      []string{"registry.example.com/app:v1"},
+		Digest:      "sha256:deadbeef",
+	}, rec)
+
+	rec = NewRecord(testBuild(hephv1.PhaseFailed), ts)
+	assert.Equal(t, "build failed", rec.Message)
+}
+
+func TestHookFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	hook, err := NewHook(config.Audit{Enabled: true, Filepath: path})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for _, p := range []hephv1.Phase{hephv1.PhaseRunning, hephv1.PhaseSucceeded, hephv1.PhaseFailed} {
+		require.NoError(t, hook.OnTransition(ctx, phase.TransitionEvent{Phase: p, Object: testBuild(p)}))
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	require.Len(t, lines, 2, "non-terminal transitions are not recorded")
+
+	var rec Record
+	require.NoError(t, json.Unmarshal(lines[1], &rec))
+	assert.Equal(t, hephv1.PhaseFailed, rec.Phase)
+}
+
+func TestHookURL(t *testing.T) {
+	var received Record
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer srv.Close()
+
+	hook, err := NewHook(config.Audit{Enabled: true, URL: srv.URL})
+	require.NoError(t, err)
+
+	event := phase.TransitionEvent{Phase: hephv1.PhaseSucceeded, Object: testBuild(hephv1.PhaseSucceeded)}
+	require.NoError(t, hook.OnTransition(context.Background(), event))
+	assert.Equal(t, "abc-123", received.UID)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	hook.url = failing.URL
+	assert.Error(t, hook.OnTransition(context.Background(), event))
+}
@@ -0,0 +1,143 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	typesregistry "github.com/docker/docker/api/types/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+const (
+	// artifactoryTokenKey holds the token allowed to issue access tokens in the referenced secret.
+	artifactoryTokenKey = "token"
+	// artifactoryTokenExpiry outlives the longest builds, access tokens are revoked once the build finishes and only
+	// expire on their own when the controller exits before.
+	artifactoryTokenExpiry = 6 * time.Hour
+)
+
+var artifactoryClient = &http.Client{Timeout: 30 * time.Second}
+
+type artifactoryTokenResponse struct {
+	TokenID     string `json:"token_id"`
+	AccessToken string `json:"access_token"`
+}
+
+// artifactoryToken is an access token issued for a build, which is revoked with the token it was exchanged for.
+type artifactoryToken struct {
+	endpoint  string
+	id        string
+	authToken string
+}
+
+// exchangeArtifactoryToken issues an access token for the subject, authorized by the token stored in the secret.
+//
+// The secret must be stored in the namespace of the scope and the token endpoint served by one of its registries, so
+// builds can neither read the tokens of other namespaces nor send them to hosts of their choosing.
+func exchangeArtifactoryToken(
+	ctx context.Context,
+	cfg *rest.Config,
+	scope Scope,
+	creds *hephv1.ArtifactoryTokenCredentials,
+) (typesregistry.AuthConfig, *artifactoryToken, error) {
+	if creds.Secret == nil {
+		return typesregistry.AuthConfig{}, nil, errors.New("artifactory credentials require a secret")
+	}
+	if scope.Namespace != "" && creds.Secret.Namespace != scope.Namespace {
+		return typesregistry.AuthConfig{}, nil, fmt.Errorf("secret %q must be in namespace %q", creds.Secret.Name,
+			scope.Namespace)
+	}
+	if err := scope.allowEndpoint(creds.TokenEndpoint); err != nil {
+		return typesregistry.AuthConfig{}, nil, err
+	}
+
+	clientset, err := clientsetFunc(scope.secretsConfig(cfg))
+	if err != nil {
+		return typesregistry.AuthConfig{}, nil, err
+	}
+	secret, err := clientset.CoreV1().Secrets(creds.Secret.Namespace).Get(ctx, creds.Secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return typesregistry.AuthConfig{}, nil, err
+	}
+	token := strings.TrimSpace(string(secret.Data[artifactoryTokenKey]))
+	if token == "" {
+		return typesregistry.AuthConfig{}, nil, fmt.Errorf("secret %q has no key %q", creds.Secret.Name, artifactoryTokenKey)
+	}
+
+	form := url.Values{
+		"username":   {creds.Subject},
+		"scope":      {"applied-permissions/user"},
+		"expires_in": {strconv.Itoa(int(artifactoryTokenExpiry.Seconds()))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, creds.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return typesregistry.AuthConfig{}, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := artifactoryClient.Do(req)
+	if err != nil {
+		return typesregistry.AuthConfig{}, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return typesregistry.AuthConfig{}, nil, fmt.Errorf("token exchange returned status %d: %s", resp.StatusCode,
+			bytes.TrimSpace(msg))
+	}
+
+	var issued artifactoryTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		return typesregistry.AuthConfig{}, nil, fmt.Errorf("invalid token exchange response: %w", err)
+	}
+	if issued.AccessToken == "" {
+		return typesregistry.AuthConfig{}, nil, errors.New("token exchange returned no access token")
+	}
+
+	issuedToken := &artifactoryToken{endpoint: creds.TokenEndpoint, id: issued.TokenID, authToken: token}
+
+	return typesregistry.AuthConfig{Username: creds.Subject, Password: issued.AccessToken}, issuedToken, nil
+}
+
+// revokeArtifactoryToken revokes an issued access token. Tokens that no longer exist, e.g. because they expired, are
+// considered revoked.
+func revokeArtifactoryToken(ctx context.Context, issued *artifactoryToken) error {
+	if issued.id == "" {
+		return errors.New("token exchange returned no token id, the access token expires on its own")
+	}
+
+	endpoint := strings.TrimSuffix(issued.endpoint, "/") + "/" + url.PathEscape(issued.id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+issued.authToken)
+
+	resp, err := artifactoryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent &&
+		resp.StatusCode != http.StatusNotFound {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("token revocation returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
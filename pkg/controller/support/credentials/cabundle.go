@@ -0,0 +1,134 @@
+package credentials
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/docker/docker/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+const defaultCABundleKey = "ca.crt"
+
+var (
+	// registry certificates are read from a process-wide directory by the docker registry client, so bundles are
+	// written below a directory owned by the controller and it is only swapped in once a bundle is configured
+	certsDir     = filepath.Join(os.TempDir(), "hephaestus-certs.d")
+	certsDirOnce sync.Once
+)
+
+// CABundles holds PEM encoded certificate authorities trusted in addition to the system pool.
+type CABundles struct {
+	// Registries maps a registry host to its bundle.
+	Registries map[string][]byte
+	// Context bundle used when downloading remote Docker contexts.
+	Context []byte
+}
+
+// ReadCABundles reads every CA bundle secret referenced by the buildkit configuration from its namespace.
+func ReadCABundles(ctx context.Context, cfg *rest.Config, conf config.Buildkit) (*CABundles, error) {
+	bundles := &CABundles{Registries: map[string][]byte{}}
+
+	read := func(ref *config.SecretKeyRef) ([]byte, error) {
+		clientset, err := clientsetFunc(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		secret, err := clientset.CoreV1().Secrets(conf.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		key := ref.Key
+		if key == "" {
+			key = defaultCABundleKey
+		}
+
+		data, ok := secret.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("secret %q has no key %q", ref.Name, key)
+		}
+
+		return data, nil
+	}
+
+	for host, opts := range conf.Registries {
+		if opts.CABundleSecretRef == nil {
+			continue
+		}
+
+		data, err := read(opts.CABundleSecretRef)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle for registry %q: %w", host, err)
+		}
+		bundles.Registries[host] = data
+	}
+
+	if ref := conf.ContextFetch.CABundleSecretRef; ref != nil {
+		data, err := read(ref)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA bundle for context fetches: %w", err)
+		}
+		bundles.Context = data
+	}
+
+	return bundles, nil
+}
+
+// CertPool returns the system cert pool extended with the PEM encoded bundle.
+func CertPool(bundle []byte) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, errors.New("CA bundle contains no PEM encoded certificates")
+	}
+
+	return pool, nil
+}
+
+// writeRegistryCerts installs the bundles where the docker registry client looks for per-host certificate authorities.
+func writeRegistryCerts(bundles map[string][]byte) error {
+	if len(bundles) == 0 {
+		return nil
+	}
+
+	certsDirOnce.Do(func() { registry.SetCertsDir(certsDir) })
+
+	for host, bundle := range bundles {
+		dir := filepath.Join(certsDir, host)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		// concurrent builds write the same bundle, so it is swapped in atomically
+		f, err := os.CreateTemp(dir, ".ca-")
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(bundle)
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), filepath.Join(dir, defaultCABundleKey))
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return fmt.Errorf("cannot write CA bundle for registry %q: %w", host, err)
+		}
+	}
+
+	return nil
+}
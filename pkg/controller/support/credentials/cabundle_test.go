@@ -0,0 +1,101 @@
+package credentials
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func testCABundle(t *testing.T) []byte {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+}
+
+func TestReadCABundles(t *testing.T) {
+	bundle := testCABundle(t)
+
+	clientsetFunc = func(*rest.Config) (kubernetes.Interface, error) {
+		return fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "internal-ca", Namespace: "buildkit"},
+			Data:       map[string][]byte{"ca.crt": bundle, "bundle.pem": bundle},
+		}), nil
+	}
+
+	conf := config.Buildkit{
+		Namespace: "buildkit",
+		Registries: map[string]config.RegistryConfig{
+			"registry.internal": {CABundleSecretRef: &config.SecretKeyRef{Name: "internal-ca"}},
+			"public.registry":   {},
+		},
+		ContextFetch: config.ContextFetch{
+			CABundleSecretRef: &config.SecretKeyRef{Name: "internal-ca", Key: "bundle.pem"},
+		},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		bundles, err := ReadCABundles(context.Background(), nil, conf)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string][]byte{"registry.internal": bundle}, bundles.Registries)
+		assert.Equal(t, bundle, bundles.Context)
+	})
+
+	t.Run("missing_key", func(t *testing.T) {
+		conf := conf
+		conf.ContextFetch.CABundleSecretRef = &config.SecretKeyRef{Name: "internal-ca", Key: "missing"}
+
+		_, err := ReadCABundles(context.Background(), nil, conf)
+		assert.ErrorContains(t, err, `no key "missing"`)
+	})
+
+	t.Run("missing_secret", func(t *testing.T) {
+		conf := conf
+		conf.Namespace = "elsewhere"
+
+		_, err := ReadCABundles(context.Background(), nil, conf)
+		assert.Error(t, err)
+	})
+}
+
+func TestCertPool(t *testing.T) {
+	pool, err := CertPool(testCABundle(t))
+	require.NoError(t, err)
+	assert.NotNil(t, pool)
+
+	_, err = CertPool([]byte("not a certificate"))
+	assert.Error(t, err)
+}
+
+func TestWriteRegistryCerts(t *testing.T) {
+	defer func(orig string) { certsDir = orig }(certsDir)
+	certsDir = t.TempDir()
+
+	require.NoError(t, writeRegistryCerts(nil))
+
+	bundle := testCABundle(t)
+	require.NoError(t, writeRegistryCerts(map[string][]byte{"registry.internal:5000": bundle}))
+	require.NoError(t, writeRegistryCerts(map[string][]byte{"registry.internal:5000": bundle}))
+
+	entries, err := os.ReadDir(filepath.Join(certsDir, "registry.internal:5000"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary files must not be left behind")
+
+	data, err := os.ReadFile(filepath.Join(certsDir, "registry.internal:5000", "ca.crt"))
+	require.NoError(t, err)
+	assert.Equal(t, bundle, data)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/docker/docker/api/types/registry"
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth"
 	"github.com/go-logr/logr"
 )
@@ -58,7 +59,7 @@ func Register(ctx context.Context, logger logr.Logger, registry *cloudauth.Regis
 		return fmt.Errorf("failed to create authentication provider: %w", err)
 	}
 
-	registry.Register(acrRegex, provider.authenticate)
+	registry.Register(hephv1.CloudProviderACR, acrRegex, provider.authenticate)
 	logger.Info("ACR authentication provider registered")
 
 	return nil
@@ -3,6 +3,7 @@ package cloudauth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"regexp"
 
 	"github.com/docker/docker/api/types/registry"
@@ -13,8 +14,14 @@ var ErrNoLoader = errors.New("no loader found")
 
 type AuthLoader func(ctx context.Context, logger logr.Logger, server string) (*registry.AuthConfig, error)
 
+type providerLoader struct {
+	provider string
+	re       *regexp.Regexp
+	load     AuthLoader
+}
+
 type Registry struct {
-	loaders map[*regexp.Regexp]AuthLoader
+	loaders []providerLoader
 }
 
 // RetrieveAuthorization will multiplex registered auth loaders based on url pattern and use the appropriate one to
@@ -24,18 +31,48 @@ func (r *Registry) RetrieveAuthorization(
 	logger logr.Logger,
 	server string,
 ) (*registry.AuthConfig, error) {
-	for r, loader := range r.loaders {
-		if r.MatchString(server) {
-			return loader(ctx, logger, server)
+	return r.RetrieveProviderAuthorization(ctx, logger, "", server)
+}
+
+// RetrieveProviderAuthorization only uses the loader of the named provider, every provider is considered when the name
+// is blank. Loaders are tried in registration order until one succeeds, the errors of all matching loaders are
+// returned otherwise. ErrNoLoader is returned when no loader matches the server.
+func (r *Registry) RetrieveProviderAuthorization(
+	ctx context.Context,
+	logger logr.Logger,
+	provider string,
+	server string,
+) (*registry.AuthConfig, error) {
+	var errs []error
+	for _, l := range r.loaders {
+		if (provider != "" && l.provider != provider) || !l.re.MatchString(server) {
+			continue
 		}
+
+		auth, err := l.load(ctx, logger, server)
+		if err == nil {
+			return auth, nil
+		}
+		errs = append(errs, fmt.Errorf("%s provider: %w", l.provider, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrNoLoader
 	}
-	return nil, ErrNoLoader
+	return nil, errors.Join(errs...)
 }
 
-// Register will create a new url regex -> authorization loader scheme.
-func (r *Registry) Register(re *regexp.Regexp, loader AuthLoader) {
-	if r.loaders == nil {
-		r.loaders = map[*regexp.Regexp]AuthLoader{}
+// Providers returns the names of the registered providers in registration order.
+func (r *Registry) Providers() []string {
+	var names []string
+	for _, l := range r.loaders {
+		names = append(names, l.provider)
 	}
-	r.loaders[re] = loader
+
+	return names
+}
+
+// Register will create a new url regex -> authorization loader scheme for the named provider.
+func (r *Registry) Register(provider string, re *regexp.Regexp, loader AuthLoader) {
+	r.loaders = append(r.loaders, providerLoader{provider: provider, re: re, load: loader})
 }
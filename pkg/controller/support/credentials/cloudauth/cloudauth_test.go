@@ -2,7 +2,9 @@ package cloudauth
 
 import (
 	"context"
+	"errors"
 	"regexp"
+	"slices"
 	"testing"
 
 	"github.com/docker/docker/api/types/registry"
@@ -15,7 +17,7 @@ func TestRegistry_RetrieveAuthorization(t *testing.T) {
 		Password: "test-pass",
 	}
 	r := &Registry{}
-	r.Register(regexp.MustCompile(`^my.cloud`), func(context.Context, logr.Logger, string) (*registry.AuthConfig, error) {
+	r.Register("my", regexp.MustCompile(`^my.cloud`), func(context.Context, logr.Logger, string) (*registry.AuthConfig, error) {
 		return expected, nil
 	})
 
@@ -38,3 +40,36 @@ func TestRegistry_RetrieveAuthorization(t *testing.T) {
 		t.Errorf("unexpected auth: got %v", auth)
 	}
 }
+
+func TestRegistry_RetrieveProviderAuthorization(t *testing.T) {
+	expected := &registry.AuthConfig{Username: "fallback"}
+	r := &Registry{}
+	r.Register("broken", regexp.MustCompile(`^my.cloud`), func(context.Context, logr.Logger, string) (*registry.AuthConfig, error) {
+		return nil, errors.New("no metadata service")
+	})
+	r.Register("working", regexp.MustCompile(`^my.cloud`), func(context.Context, logr.Logger, string) (*registry.AuthConfig, error) {
+		return expected, nil
+	})
+
+	testLog := logr.Discard()
+	ctx := context.Background()
+
+	if providers := r.Providers(); !slices.Equal(providers, []string{"broken", "working"}) {
+		t.Errorf("wrong providers: got %v", providers)
+	}
+
+	auth, err := r.RetrieveProviderAuthorization(ctx, testLog, "", "my.cloud")
+	if err != nil || auth != expected {
+		t.Errorf("expected fallback to the next matching provider: got %v, %v", auth, err)
+	}
+
+	_, err = r.RetrieveProviderAuthorization(ctx, testLog, "broken", "my.cloud")
+	if err == nil || err.Error() != "broken provider: no metadata service" {
+		t.Errorf("wrong err: got %v", err)
+	}
+
+	_, err = r.RetrieveProviderAuthorization(ctx, testLog, "other", "my.cloud")
+	if err != ErrNoLoader {
+		t.Errorf("wrong err: got %v, want %v", err, ErrNoLoader)
+	}
+}
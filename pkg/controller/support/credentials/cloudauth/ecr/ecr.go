@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
 	"github.com/aws/smithy-go/logging"
 	"github.com/docker/docker/api/types/registry"
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth"
 	"github.com/go-logr/logr"
 )
@@ -70,7 +71,7 @@ func Register(ctx context.Context, logger logr.Logger, registry *cloudauth.Regis
 		return nil
 	}
 
-	registry.Register(urlRegex, authenticate)
+	registry.Register(hephv1.CloudProviderECR, urlRegex, authenticate)
 	logger.Info("ECR registered")
 	return nil
 }
@@ -17,6 +17,7 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth"
 )
 
@@ -57,7 +58,7 @@ func Register(ctx context.Context, logger logr.Logger, registry *cloudauth.Regis
 		return err
 	}
 
-	registry.Register(gcrRegex, provider.authenticate)
+	registry.Register(hephv1.CloudProviderGCP, gcrRegex, provider.authenticate)
 	logger.Info("GCR registered")
 	return nil
 }
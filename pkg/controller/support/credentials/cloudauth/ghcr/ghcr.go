@@ -0,0 +1,167 @@
+package ghcr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/go-logr/logr"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth"
+)
+
+// The token exchange follows the Security Token Service protocol of https://github.com/octo-sts/app: the projected
+// service account token is presented as bearer token and a GitHub token is returned for the scope and identity.
+const (
+	exchangeURLEnv  = "GHCR_TOKEN_EXCHANGE_URL"
+	scopeEnv        = "GHCR_TOKEN_EXCHANGE_SCOPE"
+	identityEnv     = "GHCR_TOKEN_EXCHANGE_IDENTITY"
+	tokenFileEnv    = "GHCR_OIDC_TOKEN_FILE"
+	defaultTokenDir = "/var/run/secrets/hephaestus/ghcr"
+
+	// GHCR accepts any username alongside GitHub App installation tokens.
+	ghcrUsername = "x-access-token"
+	// installation tokens expire after an hour, they are exchanged again well before that
+	tokenLifetime = 45 * time.Minute
+)
+
+var (
+	ghcrRegex     = regexp.MustCompile(`^(?:https?://)?ghcr\.io(?:/|$)`)
+	defaultClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+type exchangeResponse struct {
+	Token string `json:"token"`
+}
+
+type ghcrProvider struct {
+	exchangeURL string
+	scope       string
+	identity    string
+	tokenFile   string
+	client      *http.Client
+	now         func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// Register will instantiate a new authentication provider whenever the GHCR_TOKEN_EXCHANGE_URL envvar is present,
+// otherwise it will result in a no-op. An error will be returned whenever the envvar settings are invalid.
+func Register(_ context.Context, logger logr.Logger, registry *cloudauth.Registry) error {
+	exchangeURL, ok := os.LookupEnv(exchangeURLEnv)
+	if !ok {
+		logger.Info(fmt.Sprintf("GHCR authentication provider not registered, %s is absent", exchangeURLEnv))
+		return nil
+	}
+
+	provider, err := newProvider(exchangeURL, os.Getenv(scopeEnv), os.Getenv(identityEnv), os.Getenv(tokenFileEnv))
+	if err != nil {
+		return fmt.Errorf("failed to create authentication provider: %w", err)
+	}
+
+	registry.Register(hephv1.CloudProviderGHCR, ghcrRegex, provider.authenticate)
+	logger.Info("GHCR authentication provider registered", "scope", provider.scope, "identity", provider.identity)
+
+	return nil
+}
+
+func newProvider(exchangeURL, scope, identity, tokenFile string) (*ghcrProvider, error) {
+	if u, err := url.Parse(exchangeURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%s must be an https URL", exchangeURLEnv)
+	}
+	if scope == "" || identity == "" {
+		return nil, fmt.Errorf("%s and %s are required", scopeEnv, identityEnv)
+	}
+	if tokenFile == "" {
+		tokenFile = defaultTokenDir + "/token"
+	}
+
+	return &ghcrProvider{
+		exchangeURL: exchangeURL,
+		scope:       scope,
+		identity:    identity,
+		tokenFile:   tokenFile,
+		client:      defaultClient,
+		now:         time.Now,
+	}, nil
+}
+
+func (g *ghcrProvider) authenticate(
+	ctx context.Context,
+	logger logr.Logger,
+	server string,
+) (*registry.AuthConfig, error) {
+	logger = logger.WithName("ghcr-auth-provider")
+
+	token, err := g.githubToken(ctx)
+	if err != nil {
+		err = fmt.Errorf("GHCR token exchange failed: %w", err)
+		logger.Info(err.Error(), "server", server)
+
+		return nil, err
+	}
+
+	return &registry.AuthConfig{Username: ghcrUsername, Password: token}, nil
+}
+
+// githubToken returns the cached GitHub token or exchanges the service account token for a new one.
+func (g *ghcrProvider) githubToken(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.token != "" && g.now().Before(g.expiresAt) {
+		return g.token, nil
+	}
+
+	// projected tokens are rotated by the kubelet, so the file is read for every exchange
+	saToken, err := os.ReadFile(g.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read service account token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.exchangeURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.URL.RawQuery = url.Values{"scope": {g.scope}, "identity": {g.identity}}.Encode()
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(saToken)))
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response code %d: %q", resp.StatusCode, content)
+	}
+
+	var exchanged exchangeResponse
+	if err := json.Unmarshal(content, &exchanged); err != nil {
+		return "", fmt.Errorf("invalid response: %w", err)
+	}
+	if exchanged.Token == "" {
+		return "", errors.New("no token in response")
+	}
+
+	g.token, g.expiresAt = exchanged.Token, g.now().Add(tokenLifetime)
+
+	return g.token, nil
+}
@@ -0,0 +1,81 @@
+package ghcr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth"
+)
+
+func TestAuthenticate(t *testing.T) {
+	exchanges := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Header.Get("Authorization") != "Bearer sa-token" || q.Get("scope") != "acme" ||
+			q.Get("identity") != "hephaestus" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("denied"))
+			return
+		}
+		exchanges++
+		_, _ = w.Write([]byte(`{"token":"ghs_installation"}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("sa-token\n"), 0o600))
+
+	provider, err := newProvider(ts.URL+"/sts/exchange", "acme", "hephaestus", tokenFile)
+	require.NoError(t, err)
+	provider.client = ts.Client()
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+
+	auth, err := provider.authenticate(context.Background(), logr.Discard(), "ghcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, "x-access-token", auth.Username)
+	assert.Equal(t, "ghs_installation", auth.Password)
+
+	_, err = provider.authenticate(context.Background(), logr.Discard(), "ghcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, 1, exchanges, "tokens are cached until they near expiry")
+
+	now = now.Add(tokenLifetime)
+	_, err = provider.authenticate(context.Background(), logr.Discard(), "ghcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, 2, exchanges)
+
+	now = now.Add(tokenLifetime)
+	provider.identity = "other"
+	_, err = provider.authenticate(context.Background(), logr.Discard(), "ghcr.io")
+	assert.ErrorContains(t, err, "unexpected response code 403")
+}
+
+func TestRegister(t *testing.T) {
+	registry := &cloudauth.Registry{}
+	require.NoError(t, Register(context.Background(), logr.Discard(), registry))
+	_, err := registry.RetrieveAuthorization(context.Background(), logr.Discard(), "ghcr.io")
+	assert.ErrorIs(t, err, cloudauth.ErrNoLoader, "nothing is registered without an exchange URL")
+
+	t.Setenv(exchangeURLEnv, "http://sts.example.com/sts/exchange")
+	assert.Error(t, Register(context.Background(), logr.Discard(), registry))
+
+	t.Setenv(exchangeURLEnv, "https://sts.example.com/sts/exchange")
+	assert.Error(t, Register(context.Background(), logr.Discard(), registry), "scope and identity are required")
+
+	t.Setenv(scopeEnv, "acme")
+	t.Setenv(identityEnv, "hephaestus")
+	require.NoError(t, Register(context.Background(), logr.Discard(), registry))
+	assert.True(t, ghcrRegex.MatchString("ghcr.io"))
+	assert.True(t, ghcrRegex.MatchString("https://ghcr.io/acme"))
+	assert.False(t, ghcrRegex.MatchString("ghcr.io.example.com"))
+}
@@ -1,11 +1,16 @@
 package credentials
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -21,14 +26,20 @@ import (
 	"k8s.io/client-go/rest"
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
 	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth"
 	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth/acr"
 	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth/ecr"
 	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth/gcr"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/credentials/cloudauth/ghcr"
+	"github.com/dominodatalab/hephaestus/pkg/controller/support/secrets"
 )
 
 var CloudAuthRegistry = &cloudauth.Registry{}
 
+// ErrNoProviderMatched is returned when no registered cloud provider handles the server of cloud provided credentials.
+var ErrNoProviderMatched = errors.New("no provider matched host")
+
 var clientsetFunc = func(config *rest.Config) (kubernetes.Interface, error) {
 	return kubernetes.NewForConfig(config)
 }
@@ -47,57 +58,197 @@ var defaultBackoff = wait.Backoff{ // retries after 1s 2s 4s 8s 16s
 	Steps:    6,
 }
 
+// Sources describes where persisted registry credentials came from.
+type Sources struct {
+	// Help describes every credential source in use, so failed authentications can point to where the credentials
+	// came from. Servers cannot always be traced back to a single entry of the computed docker config.
+	Help []string
+	// Servers maps every registry in the docker config to the type of its credential source.
+	Servers map[string]string
+
+	// secretVersions maps the "namespace/name" of every secret the credentials were read from to its resource version.
+	secretVersions map[string]string
+	// scope the secrets were read in.
+	scope Scope
+	// artifactoryTokens are the access tokens issued for the credentials.
+	artifactoryTokens []*artifactoryToken
+}
+
+// Revoke revokes the access tokens issued for the credentials, which are no longer needed once the build finished.
+func (s Sources) Revoke(ctx context.Context) error {
+	var errs []error
+	for _, issued := range s.artifactoryTokens {
+		if err := revokeArtifactoryToken(ctx, issued); err != nil {
+			errs = append(errs, fmt.Errorf("revoking artifactory token for %s failed: %w", issued.endpoint, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Scope limits where the credentials of a resource may be read from.
+type Scope struct {
+	// Namespace of the resource, the secrets of artifactory credentials must be stored in it. Cluster-scoped resources
+	// leave it blank to read secrets from any namespace.
+	Namespace string
+	// Registries that may serve artifactory token endpoints.
+	Registries []string
+	// ServiceAccount impersonated inside Namespace when reading secrets, secrets are read with the controller's
+	// credentials when blank.
+	ServiceAccount string
+	// ServiceAccountNamespace holds the impersonated service account of cluster-scoped resources.
+	ServiceAccountNamespace string
+}
+
+// NewScope limits credentials to the namespace and the registries configured for buildkit. Secrets are read while
+// impersonating the configured secrets service account, cluster-scoped resources impersonate the account in the
+// buildkit namespace.
+func NewScope(namespace string, cfg config.Buildkit) Scope {
+	return Scope{
+		Namespace:               namespace,
+		Registries:              slices.Sorted(maps.Keys(cfg.Registries)),
+		ServiceAccount:          cfg.SecretsServiceAccount,
+		ServiceAccountNamespace: cmp.Or(namespace, cfg.Namespace),
+	}
+}
+
+// secretsConfig returns the client configuration used to read the secrets of the scope.
+func (s Scope) secretsConfig(cfg *rest.Config) *rest.Config {
+	return secrets.ImpersonatedConfig(cfg, s.ServiceAccountNamespace, s.ServiceAccount)
+}
+
+func (s Scope) allowEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	host := config.NormalizeRegistry(u.Host)
+	for _, registry := range s.Registries {
+		registry = config.NormalizeRegistry(registry)
+		if registry == host || registry == u.Hostname() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("token endpoint host %q is not a configured registry", u.Host)
+}
+
+// Rotated reports whether a secret the credentials were read from changed since they were persisted.
+func (s Sources) Rotated(ctx context.Context, cfg *rest.Config) (bool, error) {
+	if len(s.secretVersions) == 0 {
+		return false, nil
+	}
+
+	clientset, err := clientsetFunc(s.scope.secretsConfig(cfg))
+	if err != nil {
+		return false, err
+	}
+
+	for key, version := range s.secretVersions {
+		namespace, name, _ := strings.Cut(key, "/")
+
+		secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if secret.ResourceVersion != version {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 func Persist(
 	ctx context.Context,
 	logger logr.Logger,
 	cfg *rest.Config,
+	scope Scope,
 	credentials []hephv1.RegistryCredentials,
-) (string, []string, error) {
+) (string, Sources, error) {
 	dir, err := os.MkdirTemp("", "docker-config-")
 	if err != nil {
-		return "", nil, err
+		return "", Sources{}, err
+	}
+
+	sources, err := Refresh(ctx, logger, cfg, scope, dir, credentials)
+	if err != nil {
+		return "", sources, err
+	}
+
+	return dir, sources, nil
+}
+
+// Refresh reads the credentials again and replaces the docker config in dir with them. The access tokens issued before
+// an error are revoked again.
+func Refresh(
+	ctx context.Context,
+	logger logr.Logger,
+	cfg *rest.Config,
+	scope Scope,
+	dir string,
+	credentials []hephv1.RegistryCredentials,
+) (Sources, error) {
+	sources, err := refresh(ctx, logger, cfg, scope, dir, credentials)
+	if err != nil {
+		if rerr := sources.Revoke(context.WithoutCancel(ctx)); rerr != nil {
+			logger.Error(rerr, "Failed to revoke registry access tokens")
+		}
 	}
 
+	return sources, err
+}
+
+func refresh(
+	ctx context.Context,
+	logger logr.Logger,
+	cfg *rest.Config,
+	scope Scope,
+	dir string,
+	credentials []hephv1.RegistryCredentials,
+) (Sources, error) {
+	sources := Sources{Servers: map[string]string{}, secretVersions: map[string]string{}, scope: scope}
+
+	var err error
 	auths := AuthConfigs{}
-	// as we can't establish a 1:1 correlation between the server field
-	// and the computed docker config.json in downstream authentication
-	// helpMessage stores general meta-information about the creds
-	// in use that can be supplied to any error message(s) that surface
-	// for more easily debugging the source of a failed auth.
-	var helpMessage []string
 	for _, cred := range credentials {
 		var ac typesregistry.AuthConfig
+		var source string
 
 		switch {
 		case cred.Secret != nil:
-			clientset, err := clientsetFunc(cfg)
+			clientset, err := clientsetFunc(scope.secretsConfig(cfg))
 			if err != nil {
-				return "", nil, err
+				return sources, err
 			}
 			client := clientset.CoreV1().Secrets(cred.Secret.Namespace)
 
 			secret, err := client.Get(ctx, cred.Secret.Name, metav1.GetOptions{})
 			if err != nil {
-				return "", nil, err
+				return sources, err
 			}
 
 			if secret.Type != corev1.SecretTypeDockerConfigJson {
-				return "", nil, fmt.Errorf("invalid secret")
+				return sources, fmt.Errorf("invalid secret")
 			}
 
 			var conf DockerConfigJSON
 			if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &conf); err != nil {
-				return "", nil, err
+				return sources, err
 			}
 
+			sources.secretVersions[cred.Secret.Namespace+"/"+cred.Secret.Name] = secret.ResourceVersion
+
 			var servers []string
 			for server, config := range conf.Auths {
 				auths[server] = config
 				servers = append(servers, server)
+				sources.Servers[server] = hephv1.RegistryAuthSourceSecret
 			}
 
 			//nolint:lll
-			helpMessage = append(helpMessage, fmt.Sprintf("secret %q in namespace %q (credentials for servers: %s)", cred.Secret.Name, cred.Secret.Namespace, strings.Join(servers, ", ")))
+			sources.Help = append(sources.Help, fmt.Sprintf("secret %q in namespace %q (credentials for servers: %s)", cred.Secret.Name, cred.Secret.Namespace, strings.Join(servers, ", ")))
 			continue
 		case cred.BasicAuth != nil:
 			ac = typesregistry.AuthConfig{
@@ -105,56 +256,113 @@ func Persist(
 				Password: cred.BasicAuth.Password,
 			}
 
-			helpMessage = append(helpMessage, "basic authentication username and password")
+			source = hephv1.RegistryAuthSourceBasic
+			sources.Help = append(sources.Help, "basic authentication username and password")
+		case cred.Artifactory != nil:
+			var issued *artifactoryToken
+			if ac, issued, err = exchangeArtifactoryToken(ctx, cfg, scope, cred.Artifactory); err != nil {
+				return sources, fmt.Errorf("artifactory token exchange failed: %w", err)
+			}
+			sources.artifactoryTokens = append(sources.artifactoryTokens, issued)
+
+			source = hephv1.RegistryAuthSourceArtifactory
+			sources.Help = append(sources.Help, fmt.Sprintf("artifactory access token (subject: %s, endpoint: %s)",
+				cred.Artifactory.Subject, cred.Artifactory.TokenEndpoint))
 		default:
-			pac, err := CloudAuthRegistry.RetrieveAuthorization(ctx, logger, cred.Server)
+			pac, err := CloudAuthRegistry.RetrieveProviderAuthorization(ctx, logger, cred.Provider, cred.Server)
+			if errors.Is(err, cloudauth.ErrNoLoader) {
+				return sources, fmt.Errorf("%w %s (provider: %s, registered: %v), credentials may be misconfigured",
+					ErrNoProviderMatched, cred.Server, cmp.Or(cred.Provider, "any"), CloudAuthRegistry.Providers())
+			}
 			if err != nil {
-				if err != cloudauth.ErrNoLoader {
-					return "", nil, fmt.Errorf("registry authorization failed: %w", err)
-				}
-				return "", nil, fmt.Errorf("failed to authorize server %s, credentials may be misconfigured", cred.Server)
+				return sources, fmt.Errorf("registry authorization failed for server %s: %w", cred.Server, err)
 			}
 
 			ac = *pac
-			helpMessage = append(helpMessage, fmt.Sprintf("cloud provider access configuration (server: %s)", cred.Server))
+			source = hephv1.RegistryAuthSourceCloud
+			sources.Help = append(sources.Help, fmt.Sprintf("cloud provider access configuration (server: %s, provider: %s)",
+				cred.Server, cmp.Or(cred.Provider, "any")))
 		}
 
 		auths[cred.Server] = ac
+		sources.Servers[cred.Server] = source
 	}
 	dockerCfg := DockerConfigJSON{Auths: auths}
 
 	configJSON, err := json.Marshal(dockerCfg)
 	if err != nil {
-		return "", nil, err
+		return sources, err
 	}
 
 	filename := filepath.Join(dir, "config.json")
 	if err = os.WriteFile(filename, configJSON, 0644); err != nil {
-		return "", nil, err
+		return sources, err
+	}
+
+	return sources, err
+}
+
+// SecretValues returns the passwords and tokens of every registry in the docker config, so they can be redacted from
+// build output.
+func SecretValues(configDir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	configJSON := DockerConfigJSON{}
+	if err = json.Unmarshal(data, &configJSON); err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, auth := range configJSON.Auths {
+		for _, value := range []string{auth.Password, auth.Auth, auth.IdentityToken, auth.RegistryToken} {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
 	}
 
-	return dir, helpMessage, err
+	return values, nil
 }
 
-func Verify(ctx context.Context, configDir string, insecureRegistries []string, helpMessage []string) error {
+// Verify authenticates against every registry in the docker config and returns the result for each of them, ordered by
+// server. Registries listed in insecureRegistries skip TLS verification, while caBundles adds trusted certificate
+// authorities per registry host.
+func Verify(
+	ctx context.Context,
+	configDir string,
+	insecureRegistries []string,
+	caBundles map[string][]byte,
+	sources Sources,
+) ([]hephv1.RegistryAuthResult, error) {
+	if err := writeRegistryCerts(caBundles); err != nil {
+		return nil, err
+	}
+
 	filename := filepath.Join(configDir, "config.json")
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	configJSON := DockerConfigJSON{}
 	if err = json.Unmarshal(data, &configJSON); err != nil {
-		return err
+		return nil, err
 	}
 
 	svc, err := registry.NewService(registry.ServiceOptions{InsecureRegistries: insecureRegistries})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	servers := slices.Sorted(maps.Keys(configJSON.Auths))
+	results := make([]hephv1.RegistryAuthResult, 0, len(servers))
+
 	var errs []error
-	for server, auth := range configJSON.Auths {
+	for _, server := range servers {
+		auth := configJSON.Auths[server]
 		auth.ServerAddress = server
 
 		err := wait.ExponentialBackoffWithContext(ctx, defaultBackoff, func(ctx context.Context) (bool, error) {
@@ -167,29 +375,52 @@ func Verify(ctx context.Context, configDir string, insecureRegistries []string,
 
 			return true, nil
 		})
+		result := hephv1.RegistryAuthResult{Server: server, Source: sources.Servers[server], Verified: err == nil}
 		if err != nil {
+			result.Message = err.Error()
+
 			//nolint:lll
-			detailedErr := fmt.Errorf("client credentials are invalid for registry %q.\nMake sure the following sources of credentials are correct: %s.\nUnderlying error: %w", server, strings.Join(helpMessage, ", "), err)
+			detailedErr := fmt.Errorf("client credentials are invalid for registry %q.\nMake sure the following sources of credentials are correct: %s.\nUnderlying error: %w", server, strings.Join(sources.Help, ", "), err)
 			errs = append(errs, detailedErr)
 		}
+		results = append(results, result)
 	}
 	if len(errs) != 0 {
-		return multierr.Combine(errs...)
+		return results, multierr.Combine(errs...)
 	}
 
-	return nil
+	return results, nil
 }
 
-// LoadCloudProviders adds all cloud authentication providers to the CloudAuthRegistry.
-func LoadCloudProviders(ctx context.Context, log logr.Logger) error {
-	if err := acr.Register(ctx, log, CloudAuthRegistry); err != nil {
-		return fmt.Errorf("ACR registration failed: %w", err)
+// LoadCloudProviders adds the enabled cloud authentication providers to the CloudAuthRegistry. The registration of
+// each provider is bounded by its configured timeout.
+func LoadCloudProviders(ctx context.Context, log logr.Logger, cfg config.CloudAuth) error {
+	providers := []struct {
+		name     string
+		register func(context.Context, logr.Logger, *cloudauth.Registry) error
+	}{
+		{hephv1.CloudProviderACR, acr.Register},
+		{hephv1.CloudProviderECR, ecr.Register},
+		{hephv1.CloudProviderGCP, gcr.Register},
+		{hephv1.CloudProviderGHCR, ghcr.Register},
 	}
-	if err := ecr.Register(ctx, log, CloudAuthRegistry); err != nil {
-		return fmt.Errorf("ECR registration failed: %w", err)
-	}
-	if err := gcr.Register(ctx, log, CloudAuthRegistry); err != nil {
-		return fmt.Errorf("GCR registration failed: %w", err)
+
+	for _, provider := range providers {
+		if !cfg.ProviderEnabled(provider.name) {
+			log.Info("Cloud auth provider disabled", "provider", provider.name)
+			continue
+		}
+
+		timeout := cfg.ProviderTimeout(provider.name)
+		log.Info("Registering cloud auth provider", "provider", provider.name, "timeout", timeout)
+
+		regCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := provider.register(regCtx, log, CloudAuthRegistry)
+		cancel()
+
+		if err != nil {
+			return fmt.Errorf("%s registration failed: %w", strings.ToUpper(provider.name), err)
+		}
 	}
 
 	return nil
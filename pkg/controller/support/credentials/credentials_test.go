@@ -3,8 +3,11 @@ package credentials
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/docker/docker/api/types/registry"
@@ -13,11 +16,13 @@ import (
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
 )
 
 func TestPersist(t *testing.T) {
@@ -58,7 +63,7 @@ func TestPersist(t *testing.T) {
 			},
 		}
 
-		configPath, helpMessage, err := Persist(context.Background(), logr.Discard(), nil, credentials)
+		configPath, sources, err := Persist(context.Background(), logr.Discard(), nil, Scope{}, credentials)
 		require.NoError(t, err)
 		t.Cleanup(func() {
 			os.RemoveAll(configPath)
@@ -68,7 +73,217 @@ func TestPersist(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, expected, actual)
-		assert.Equal(t, len(helpMessage), 1)
-		assert.Contains(t, helpMessage[0], "secret \"test-creds\" in namespace \"test-ns\"")
+		assert.Equal(t, len(sources.Help), 1)
+		assert.Contains(t, sources.Help[0], "secret \"test-creds\" in namespace \"test-ns\"")
 	})
+
+	t.Run("impersonated_secret_reads", func(t *testing.T) {
+		var users []string
+		clientsetFunc = func(cfg *rest.Config) (kubernetes.Interface, error) {
+			users = append(users, cfg.Impersonate.UserName)
+			return fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-creds", Namespace: "test-ns"},
+				Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+				Type:       corev1.SecretTypeDockerConfigJson,
+			}), nil
+		}
+
+		credentials := []hephv1.RegistryCredentials{
+			{Secret: &hephv1.SecretCredentials{Name: "test-creds", Namespace: "test-ns"}},
+		}
+		scope := NewScope("test-ns", config.Buildkit{Namespace: "hephaestus", SecretsServiceAccount: "builds"})
+
+		configPath, sources, err := Persist(context.Background(), logr.Discard(), &rest.Config{}, scope, credentials)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			os.RemoveAll(configPath)
+		})
+
+		rotated, err := sources.Rotated(context.Background(), &rest.Config{})
+		require.NoError(t, err)
+		assert.False(t, rotated)
+		assert.Equal(t, []string{
+			"system:serviceaccount:test-ns:builds",
+			"system:serviceaccount:test-ns:builds",
+		}, users, "secrets are read and checked for rotation as the namespace's service account")
+
+		cluster := NewScope("", config.Buildkit{Namespace: "hephaestus", SecretsServiceAccount: "builds"})
+		assert.Equal(t, "system:serviceaccount:hephaestus:builds",
+			cluster.secretsConfig(&rest.Config{}).Impersonate.UserName)
+	})
+
+	t.Run("artifactory_token", func(t *testing.T) {
+		var revoked []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer exchange-me" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Method == http.MethodDelete {
+				revoked = append(revoked, r.URL.Path)
+				return
+			}
+			require.NoError(t, r.ParseForm())
+			if r.Form.Get("username") != "svc-builds" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"token_id":"issued","access_token":"short-lived","expires_in":21600}`))
+		}))
+		defer srv.Close()
+
+		clientsetFunc = func(*rest.Config) (kubernetes.Interface, error) {
+			return fake.NewSimpleClientset(
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "artifactory-token", Namespace: "test-ns"},
+					Data:       map[string][]byte{"token": []byte("exchange-me\n")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "artifactory-token", Namespace: "other-ns"},
+					Data:       map[string][]byte{"token": []byte("exchange-me\n")},
+				},
+			), nil
+		}
+
+		creds := &hephv1.ArtifactoryTokenCredentials{
+			TokenEndpoint: srv.URL + "/access/api/v1/tokens",
+			Subject:       "svc-builds",
+			Secret:        &hephv1.SecretCredentials{Name: "artifactory-token", Namespace: "test-ns"},
+		}
+		credentials := []hephv1.RegistryCredentials{{Server: "artifactory.example.com", Artifactory: creds}}
+		scope := Scope{Namespace: "test-ns", Registries: []string{strings.TrimPrefix(srv.URL, "http://")}}
+
+		configPath, sources, err := Persist(context.Background(), logr.Discard(), nil, scope, credentials)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			os.RemoveAll(configPath)
+		})
+
+		data, err := os.ReadFile(filepath.Join(configPath, "config.json"))
+		require.NoError(t, err)
+
+		var actual DockerConfigJSON
+		require.NoError(t, json.Unmarshal(data, &actual))
+		assert.Equal(t, "svc-builds", actual.Auths["artifactory.example.com"].Username)
+		assert.Equal(t, "short-lived", actual.Auths["artifactory.example.com"].Password)
+		assert.Contains(t, sources.Help[0], "artifactory access token (subject: svc-builds")
+		assert.Equal(t, hephv1.RegistryAuthSourceArtifactory, sources.Servers["artifactory.example.com"])
+
+		require.NoError(t, sources.Revoke(context.Background()))
+		assert.Equal(t, []string{"/access/api/v1/tokens/issued"}, revoked)
+
+		_, _, err = Persist(context.Background(), logr.Discard(), nil, Scope{Namespace: "test-ns"}, credentials)
+		assert.ErrorContains(t, err, "is not a configured registry")
+
+		creds.Secret.Namespace = "other-ns"
+		_, _, err = Persist(context.Background(), logr.Discard(), nil, scope, credentials)
+		assert.ErrorContains(t, err, `must be in namespace "test-ns"`)
+
+		creds.Secret.Namespace = "test-ns"
+		creds.Subject = "someone-else"
+		_, _, err = Persist(context.Background(), logr.Discard(), nil, scope, credentials)
+		assert.ErrorContains(t, err, "status 401")
+	})
+	t.Run("no_provider_matched", func(t *testing.T) {
+		credentials := []hephv1.RegistryCredentials{{Server: "registry.example.com", Provider: hephv1.CloudProviderECR}}
+
+		_, _, err := Persist(context.Background(), logr.Discard(), nil, Scope{}, credentials)
+		assert.ErrorIs(t, err, ErrNoProviderMatched)
+		assert.ErrorContains(t, err, "registry.example.com (provider: ecr")
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-creds", Namespace: "test-ns", ResourceVersion: "1"},
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"registry1.com":{"password":"old"}}}`)},
+		Type:       corev1.SecretTypeDockerConfigJson,
+	}
+	clientset := fake.NewSimpleClientset(secret)
+	clientsetFunc = func(*rest.Config) (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+
+	credentials := []hephv1.RegistryCredentials{
+		{Secret: &hephv1.SecretCredentials{Name: "test-creds", Namespace: "test-ns"}},
+	}
+	configPath, sources, err := Persist(context.Background(), logr.Discard(), nil, Scope{}, credentials)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(configPath)
+	})
+
+	rotated, err := sources.Rotated(context.Background(), nil)
+	require.NoError(t, err)
+	assert.False(t, rotated)
+
+	secret.ResourceVersion = "2"
+	secret.Data[corev1.DockerConfigJsonKey] = []byte(`{"auths":{"registry1.com":{"password":"new"}}}`)
+	_, err = clientset.CoreV1().Secrets("test-ns").Update(context.Background(), secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	rotated, err = sources.Rotated(context.Background(), nil)
+	require.NoError(t, err)
+	assert.True(t, rotated)
+
+	sources, err = Refresh(context.Background(), logr.Discard(), nil, Scope{}, configPath, credentials)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(configPath, "config.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"password":"new"`)
+
+	rotated, err = sources.Rotated(context.Background(), nil)
+	require.NoError(t, err)
+	assert.False(t, rotated)
+}
+
+func TestVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, _ := r.BasicAuth(); user != "happy" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	server := strings.TrimPrefix(srv.URL, "http://")
+
+	credentials := []hephv1.RegistryCredentials{{Server: server, BasicAuth: &hephv1.BasicAuthCredentials{
+		Username: "happy",
+		Password: "path",
+	}}}
+	configPath, sources, err := Persist(context.Background(), logr.Discard(), nil, Scope{}, credentials)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(configPath)
+	})
+
+	results, err := Verify(context.Background(), configPath, []string{server}, nil, sources)
+	require.NoError(t, err)
+	assert.Equal(t, []hephv1.RegistryAuthResult{
+		{Server: server, Source: hephv1.RegistryAuthSourceBasic, Verified: true},
+	}, results)
+
+	// failed logins are not reported as unauthorized errors and would be retried for half a minute
+	backoff := defaultBackoff
+	defaultBackoff = wait.Backoff{Steps: 1}
+	t.Cleanup(func() {
+		defaultBackoff = backoff
+	})
+
+	credentials[0].BasicAuth.Username = "sad"
+	configPath, sources, err = Persist(context.Background(), logr.Discard(), nil, Scope{}, credentials)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(configPath)
+	})
+
+	results, err = Verify(context.Background(), configPath, []string{server}, nil, sources)
+	assert.ErrorContains(t, err, "Make sure the following sources of credentials are correct: basic authentication")
+	if assert.Len(t, results, 1) {
+		assert.False(t, results[0].Verified)
+		assert.NotEmpty(t, results[0].Message)
+	}
 }
@@ -0,0 +1,244 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+// harborRequestTimeout limits how long a single request to the Harbor API may take.
+const harborRequestTimeout = 30 * time.Second
+
+// HarborRobots are the robot accounts minted for a single build.
+type HarborRobots struct {
+	// Credentials of the robot accounts, they replace the credentials of the build for their registries.
+	Credentials []hephv1.RegistryCredentials
+
+	log    logr.Logger
+	robots []harborRobot
+}
+
+type harborRobot struct {
+	id       int64
+	api      string
+	username string
+	password string
+	client   *http.Client
+}
+
+type harborRobotAccess struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+type harborRobotPermission struct {
+	Kind      string              `json:"kind"`
+	Namespace string              `json:"namespace"`
+	Access    []harborRobotAccess `json:"access"`
+}
+
+type harborRobotRequest struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Duration    int                     `json:"duration"`
+	Level       string                  `json:"level"`
+	Disable     bool                    `json:"disable"`
+	Permissions []harborRobotPermission `json:"permissions"`
+}
+
+type harborRobotResponse struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// MintHarborRobots creates a robot account allowed to push to and pull from the projects of the images for every
+// registry configured with Harbor robot accounts. Accounts of a single project are created at project level, accounts
+// spanning several projects at system level. The transport is used to talk to the Harbor API of each registry.
+func MintHarborRobots(
+	ctx context.Context,
+	log logr.Logger,
+	cfg *rest.Config,
+	conf config.Buildkit,
+	transport func(registry string) http.RoundTripper,
+	robotName string,
+	images []string,
+) (*HarborRobots, error) {
+	projects := map[string][]string{}
+	for _, image := range images {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			continue
+		}
+		registry := ref.Context().RegistryStr()
+		if opts := conf.Registries[registry]; opts.HarborRobot == nil {
+			continue
+		}
+
+		project, _, _ := strings.Cut(ref.Context().RepositoryStr(), "/")
+		if !slices.Contains(projects[registry], project) {
+			projects[registry] = append(projects[registry], project)
+		}
+	}
+
+	robots := &HarborRobots{log: log}
+	for registry, names := range projects {
+		opts := conf.Registries[registry].HarborRobot
+
+		username, password, err := readBasicAuth(ctx, cfg, conf.Namespace, opts.AdminSecretName)
+		if err != nil {
+			robots.Delete(ctx)
+			return nil, fmt.Errorf("cannot read Harbor admin credentials for registry %q: %w", registry, err)
+		}
+
+		robot := harborRobot{
+			api:      harborAPIURL(opts.URL, registry, conf.Registries[registry].HTTP),
+			username: username,
+			password: password,
+			client:   &http.Client{Transport: transport(registry), Timeout: harborRequestTimeout},
+		}
+		created, err := robot.create(ctx, robotName, names, opts.ExpiryDays)
+		if err != nil {
+			robots.Delete(ctx)
+			return nil, fmt.Errorf("cannot create Harbor robot account for registry %q: %w", registry, err)
+		}
+		robot.id = created.ID
+		robots.robots = append(robots.robots, robot)
+
+		log.Info("Created Harbor robot account", "registry", registry, "robot", created.Name, "projects", names)
+		robots.Credentials = append(robots.Credentials, hephv1.RegistryCredentials{
+			Server:    registry,
+			BasicAuth: &hephv1.BasicAuthCredentials{Username: created.Name, Password: created.Secret},
+		})
+	}
+
+	return robots, nil
+}
+
+// Delete removes the robot accounts from Harbor, failures are logged and the accounts expire on their own.
+func (r *HarborRobots) Delete(ctx context.Context) {
+	for _, robot := range r.robots {
+		if err := robot.delete(ctx); err != nil {
+			r.log.Error(err, "Failed to delete Harbor robot account", "api", robot.api, "id", robot.id)
+		}
+	}
+	r.robots = nil
+}
+
+func (r harborRobot) create(ctx context.Context, robotName string, projects []string, expiryDays int) (
+	*harborRobotResponse, error,
+) {
+	if expiryDays == 0 {
+		expiryDays = 1
+	}
+
+	req := harborRobotRequest{
+		Name:        robotName,
+		Description: "Created by hephaestus for a single image build",
+		Duration:    expiryDays,
+		Level:       "system",
+	}
+	if len(projects) == 1 {
+		req.Level = "project"
+	}
+	for _, project := range projects {
+		req.Permissions = append(req.Permissions, harborRobotPermission{
+			Kind:      "project",
+			Namespace: project,
+			Access: []harborRobotAccess{
+				{Resource: "repository", Action: "push"},
+				{Resource: "repository", Action: "pull"},
+			},
+		})
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var created harborRobotResponse
+	if err := r.do(ctx, http.MethodPost, "/api/v2.0/robots", body, http.StatusCreated, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (r harborRobot) delete(ctx context.Context) error {
+	return r.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v2.0/robots/%d", r.id), nil, http.StatusOK, nil)
+}
+
+func (r harborRobot) do(ctx context.Context, method, path string, body []byte, status int, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, r.api+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.username, r.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s returned status %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func harborAPIURL(apiURL, registry string, plainHTTP bool) string {
+	if apiURL != "" {
+		return strings.TrimSuffix(apiURL, "/")
+	}
+	if plainHTTP {
+		return "http://" + registry
+	}
+
+	return "https://" + registry
+}
+
+// readBasicAuth returns the username and password of a basic-auth secret.
+func readBasicAuth(ctx context.Context, cfg *rest.Config, namespace, secretName string) (string, string, error) {
+	clientset, err := clientsetFunc(cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", err
+	}
+
+	username, password := secret.Data[corev1.BasicAuthUsernameKey], secret.Data[corev1.BasicAuthPasswordKey]
+	if len(username) == 0 || len(password) == 0 {
+		return "", "", errors.New("secret must contain a username and password")
+	}
+
+	return string(username), string(password), nil
+}
@@ -0,0 +1,116 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func TestMintHarborRobots(t *testing.T) {
+	var (
+		created []harborRobotRequest
+		deleted []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "Harbor12345" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2.0/robots":
+			var req harborRobotRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			created = append(created, req)
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":7,"name":"robot$team+` + req.Name + `","secret":"minted"}`))
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	clientsetFunc = func(*rest.Config) (kubernetes.Interface, error) {
+		return fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "harbor-admin", Namespace: "buildkit"},
+			Type:       corev1.SecretTypeBasicAuth,
+			Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("Harbor12345")},
+		}), nil
+	}
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	conf := config.Buildkit{
+		Namespace: "buildkit",
+		Registries: map[string]config.RegistryConfig{
+			host: {HTTP: true, HarborRobot: &config.HarborRobot{AdminSecretName: "harbor-admin"}},
+		},
+	}
+	transport := func(string) http.RoundTripper { return http.DefaultTransport }
+	images := []string{host + "/team/app:v1", host + "/team/app:latest", "quay.io/team/app:v1"}
+
+	robots, err := MintHarborRobots(context.Background(), logr.Discard(), nil, conf, transport, "build-1", images)
+	require.NoError(t, err)
+
+	require.Len(t, created, 1)
+	assert.Equal(t, "build-1", created[0].Name)
+	assert.Equal(t, "project", created[0].Level)
+	assert.Equal(t, 1, created[0].Duration)
+	require.Len(t, created[0].Permissions, 1)
+	assert.Equal(t, "team", created[0].Permissions[0].Namespace)
+
+	assert.Equal(t, []hephv1.RegistryCredentials{{
+		Server:    host,
+		BasicAuth: &hephv1.BasicAuthCredentials{Username: "robot$team+build-1", Password: "minted"},
+	}}, robots.Credentials)
+
+	robots.Delete(context.Background())
+	assert.Equal(t, []string{"/api/v2.0/robots/7"}, deleted)
+
+	t.Run("multiple_projects", func(t *testing.T) {
+		created = nil
+		images := []string{host + "/team/app:v1", host + "/shared/base:v1"}
+
+		_, err := MintHarborRobots(context.Background(), logr.Discard(), nil, conf, transport, "build-2", images)
+		require.NoError(t, err)
+		require.Len(t, created, 1)
+		assert.Equal(t, "system", created[0].Level)
+		assert.Len(t, created[0].Permissions, 2)
+	})
+
+	t.Run("bad_admin_secret", func(t *testing.T) {
+		conf := config.Buildkit{
+			Namespace: "buildkit",
+			Registries: map[string]config.RegistryConfig{
+				host: {HTTP: true, HarborRobot: &config.HarborRobot{AdminSecretName: "missing"}},
+			},
+		}
+
+		_, err := MintHarborRobots(context.Background(), logr.Discard(), nil, conf, transport, "build-3", images)
+		assert.ErrorContains(t, err, "cannot read Harbor admin credentials")
+	})
+
+	t.Run("no_harbor_registries", func(t *testing.T) {
+		robots, err := MintHarborRobots(context.Background(), logr.Discard(), nil, config.Buildkit{}, transport,
+			"build-4", images)
+		require.NoError(t, err)
+		assert.Empty(t, robots.Credentials)
+	})
+}
@@ -0,0 +1,186 @@
+package phase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+const defaultHookTimeout = 10 * time.Second
+
+// TransitionHook runs custom side effects after an object has transitioned phases.
+//
+// Hooks are invoked synchronously once the transition has been saved, their errors are reported but never fail the
+// transition.
+type TransitionHook interface {
+	Name() string
+	OnTransition(ctx context.Context, event TransitionEvent) error
+}
+
+// TransitionEvent is the payload delivered to every hook. The object is only encoded as an ObjectSummary because its
+// spec may hold registry credentials.
+type TransitionEvent struct {
+	Phase      hephv1.Phase
+	OccurredAt time.Time
+	Object     PhasedObject
+}
+
+// ObjectSummary identifies the transitioned object in encoded transition events.
+type ObjectSummary struct {
+	Kind       string             `json:"kind"`
+	Namespace  string             `json:"namespace,omitempty"`
+	Name       string             `json:"name"`
+	UID        types.UID          `json:"uid"`
+	Phase      hephv1.Phase       `json:"phase"`
+	Images     []string           `json:"images,omitempty"`
+	Digest     string             `json:"digest,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// NewObjectSummary summarizes an object without any of its spec besides the images.
+func NewObjectSummary(obj PhasedObject) ObjectSummary {
+	summary := ObjectSummary{
+		Kind:       obj.GetObjectKind().GroupVersionKind().Kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		UID:        obj.GetUID(),
+		Phase:      obj.GetPhase(),
+		Conditions: *obj.GetConditions(),
+	}
+
+	// typed objects read through the client have no type meta
+	switch o := obj.(type) {
+	case *hephv1.ImageBuild:
+		summary.Kind = "ImageBuild"
+		summary.Images = o.Spec.Images
+		summary.Digest = o.Status.Digest
+	case *hephv1.ImageCache:
+		summary.Kind = "ImageCache"
+		summary.Images = o.Spec.Images
+	case *hephv1.ClusterImageCache:
+		summary.Kind = "ClusterImageCache"
+		summary.Images = o.Spec.Images
+	}
+
+	return summary
+}
+
+func (e TransitionEvent) MarshalJSON() ([]byte, error) {
+	event := struct {
+		Phase      hephv1.Phase   `json:"phase"`
+		OccurredAt time.Time      `json:"occurredAt"`
+		Object     *ObjectSummary `json:"object,omitempty"`
+	}{
+		Phase:      e.Phase,
+		OccurredAt: e.OccurredAt,
+	}
+	if e.Object != nil {
+		summary := NewObjectSummary(e.Object)
+		event.Object = &summary
+	}
+
+	return json.Marshal(event)
+}
+
+// NewTransitionHooks builds hooks from controller configuration.
+func NewTransitionHooks(cfgs []config.TransitionHook) []TransitionHook {
+	var hooks []TransitionHook
+	for _, cfg := range cfgs {
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = defaultHookTimeout
+		}
+
+		if cfg.URL != "" {
+			hooks = append(hooks, &WebhookHook{
+				HookName: cfg.Name,
+				URL:      cfg.URL,
+				Client:   &http.Client{Timeout: timeout},
+			})
+		} else {
+			hooks = append(hooks, &ExecHook{
+				HookName: cfg.Name,
+				Command:  cfg.Command,
+				Timeout:  timeout,
+			})
+		}
+	}
+
+	return hooks
+}
+
+// WebhookHook POSTs the JSON-encoded transition event to a URL.
+type WebhookHook struct {
+	HookName string
+	URL      string
+	Client   *http.Client
+}
+
+func (h *WebhookHook) Name() string {
+	return h.HookName
+}
+
+func (h *WebhookHook) OnTransition(ctx context.Context, event TransitionEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("hook %q returned unexpected status %d", h.HookName, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ExecHook runs a command with the JSON-encoded transition event provided on stdin.
+type ExecHook struct {
+	HookName string
+	Command  []string
+	Timeout  time.Duration
+}
+
+func (h *ExecHook) Name() string {
+	return h.HookName
+}
+
+func (h *ExecHook) OnTransition(ctx context.Context, event TransitionEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("hook %q failed: %w: %s", h.HookName, err, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package phase
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func testEvent() TransitionEvent {
+	return TransitionEvent{
+		Phase:      hephv1.PhaseSucceeded,
+		OccurredAt: time.Now(),
+		Object: &hephv1.ImageBuild{
+			ObjectMeta: metav1.ObjectMeta{Name: "build", Namespace: "ns"},
+		},
+	}
+}
+
+func TestTransitionEventJSON(t *testing.T) {
+	event := testEvent()
+	ib := event.Object.(*hephv1.ImageBuild)
+	ib.UID = "abc-123"
+	ib.Spec.Images = []string{"registry.example.com/app:v1"}
+	ib.Spec.RegistryAuth = []hephv1.RegistryCredentials{
+		{Server: "registry.example.com", BasicAuth: &hephv1.BasicAuthCredentials{Username: "u", Password: "hunter2"}},
+	}
+	ib.Status.Digest = "sha256:deadbeef"
+
+	body, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "hunter2", "the spec is never encoded")
+
+	var decoded struct {
+		Phase  hephv1.Phase  `json:"phase"`
+		Object ObjectSummary `json:"object"`
+	}
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, hephv1.PhaseSucceeded, decoded.Phase)
+	assert.Equal(t, ObjectSummary{
+		Kind:      "ImageBuild",
+		Namespace: "ns",
+		Name:      "build",
+		UID:       "abc-123",
+		Images:    []string{"registry.example.com/app:v1"},
+		Digest:    "sha256:deadbeef",
+	}, decoded.Object)
+}
+
+func TestNewTransitionHooks(t *testing.T) {
+	hooks := NewTransitionHooks([]config.TransitionHook{
+		{Name: "web", URL: "http://hooks.example.com"},
+		{Name: "cmd", Command: []string{"/bin/true"}, Timeout: time.Second},
+	})
+	require.Len(t, hooks, 2)
+
+	web, ok := hooks[0].(*WebhookHook)
+	require.True(t, ok)
+	assert.Equal(t, defaultHookTimeout, web.Client.Timeout)
+
+	cmd, ok := hooks[1].(*ExecHook)
+	require.True(t, ok)
+	assert.Equal(t, time.Second, cmd.Timeout)
+}
+
+func TestWebhookHook(t *testing.T) {
+	var received map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer srv.Close()
+
+	hook := &WebhookHook{HookName: "web", URL: srv.URL, Client: srv.Client()}
+	require.NoError(t, hook.OnTransition(context.Background(), testEvent()))
+	assert.Equal(t, "Succeeded", received["phase"])
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	hook = &WebhookHook{HookName: "web", URL: failing.URL, Client: failing.Client()}
+	assert.Error(t, hook.OnTransition(context.Background(), testEvent()))
+}
+
+func TestExecHook(t *testing.T) {
+	hook := &ExecHook{HookName: "cmd", Command: []string{"sh", "-c", "grep -q Succeeded"}, Timeout: 5 * time.Second}
+	assert.NoError(t, hook.OnTransition(context.Background(), testEvent()))
+
+	hook = &ExecHook{HookName: "cmd", Command: []string{"sh", "-c", "exit 1"}, Timeout: 5 * time.Second}
+	assert.Error(t, hook.OnTransition(context.Background(), testEvent()))
+}
@@ -1,6 +1,9 @@
 package phase
 
 import (
+	"context"
+	"time"
+
 	"github.com/dominodatalab/controller-util/core"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -8,6 +11,9 @@ import (
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
 )
 
+// maxHooksDuration bounds the time all hooks of a single transition may take together.
+const maxHooksDuration = 15 * time.Second
+
 type PhasedObject interface {
 	client.Object
 	core.ConditionObject
@@ -16,6 +22,11 @@ type PhasedObject interface {
 	SetPhase(p hephv1.Phase)
 }
 
+// TransitionPruner is implemented by objects that cap their transition history.
+type TransitionPruner interface {
+	PruneTransitions(limit int)
+}
+
 type TransitionConditions struct {
 	Initialize func() (string, string)
 	Running    func() (string, string)
@@ -26,6 +37,9 @@ type TransitionHelper struct {
 	Client         client.Client
 	ConditionMeta  TransitionConditions
 	ReadyCondition string
+	Hooks          []TransitionHook
+	// MaxTransitions kept by objects that implement TransitionPruner, every transition is kept when zero.
+	MaxTransitions int
 }
 
 func (h *TransitionHelper) SetInitializing(ctx *core.Context, obj PhasedObject) {
@@ -49,7 +63,7 @@ func (h *TransitionHelper) SetSucceeded(ctx *core.Context, obj PhasedObject) {
 func (h *TransitionHelper) SetRunning(ctx *core.Context, obj PhasedObject) {
 	obj.SetPhase(hephv1.PhaseRunning)
 
-	reason, message := h.ConditionMeta.Success()
+	reason, message := h.ConditionMeta.Running()
 	ctx.Conditions.SetUnknown(h.ReadyCondition, reason, message)
 
 	h.updateStatus(ctx, obj)
@@ -64,10 +78,31 @@ func (h *TransitionHelper) SetFailed(ctx *core.Context, obj PhasedObject, err er
 	return err
 }
 
+// SetProgress reports a step within the current phase through the ready condition. The phase is left unchanged, so
+// transition hooks are not invoked.
+func (h *TransitionHelper) SetProgress(ctx *core.Context, obj PhasedObject, reason, message string) {
+	ctx.Conditions.SetUnknown(h.ReadyCondition, reason, message)
+
+	// failures are reported through an event, progress is written again with the next step
+	_ = h.writeStatus(ctx, obj)
+}
+
 func (h *TransitionHelper) updateStatus(ctx *core.Context, obj PhasedObject) {
 	ctx.Log.Info("Transitioning status", "phase", obj.GetPhase())
 
-	if err := ctx.Client.Status().Update(ctx, obj); err != nil {
+	if pruner, ok := obj.(TransitionPruner); ok {
+		pruner.PruneTransitions(h.MaxTransitions)
+	}
+	// transitions that were not saved are retried, so hooks only see each saved transition once
+	if err := h.writeStatus(ctx, obj); err != nil {
+		return
+	}
+	h.runHooks(ctx, obj)
+}
+
+func (h *TransitionHelper) writeStatus(ctx *core.Context, obj PhasedObject) error {
+	err := ctx.Client.Status().Update(ctx, obj)
+	if err != nil {
 		ctx.Log.Error(err, "Failed to update status, emitting event")
 		ctx.Recorder.Eventf(
 			obj,
@@ -76,4 +111,34 @@ func (h *TransitionHelper) updateStatus(ctx *core.Context, obj PhasedObject) {
 			"Failed to update phase %s: %w", obj.GetPhase(), err,
 		)
 	}
+
+	return err
+}
+
+func (h *TransitionHelper) runHooks(ctx *core.Context, obj PhasedObject) {
+	if len(h.Hooks) == 0 {
+		return
+	}
+
+	event := TransitionEvent{
+		Phase:      obj.GetPhase(),
+		OccurredAt: time.Now(),
+		Object:     obj,
+	}
+
+	// hooks run inside the reconcile, slow hooks must not hold it up for the sum of their timeouts
+	hookCtx, cancel := context.WithTimeout(ctx, maxHooksDuration)
+	defer cancel()
+
+	for _, hook := range h.Hooks {
+		if err := hook.OnTransition(hookCtx, event); err != nil {
+			ctx.Log.Error(err, "Transition hook failed", "hook", hook.Name())
+			ctx.Recorder.Eventf(
+				obj,
+				corev1.EventTypeWarning,
+				"TransitionHook",
+				"Hook %s failed for phase %s: %v", hook.Name(), obj.GetPhase(), err,
+			)
+		}
+	}
 }
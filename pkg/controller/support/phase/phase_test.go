@@ -0,0 +1,65 @@
+package phase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dominodatalab/controller-util/core"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+type recordingHook struct {
+	phases []hephv1.Phase
+}
+
+func (h *recordingHook) Name() string {
+	return "recording"
+}
+
+func (h *recordingHook) OnTransition(_ context.Context, event TransitionEvent) error {
+	h.phases = append(h.phases, event.Phase)
+	return nil
+}
+
+func TestTransitionHooksSkipUnsavedTransitions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, hephv1.AddToScheme(scheme))
+
+	saved := &hephv1.ImageBuild{ObjectMeta: metav1.ObjectMeta{Name: "saved", Namespace: "ns"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(saved).WithStatusSubresource(saved).Build()
+
+	hook := &recordingHook{}
+	h := &TransitionHelper{
+		Client: c,
+		ConditionMeta: TransitionConditions{
+			Initialize: func() (string, string) { return "Setup", "" },
+		},
+		ReadyCondition: "Ready",
+		Hooks:          []TransitionHook{hook},
+	}
+	newContext := func(obj PhasedObject) *core.Context {
+		return &core.Context{
+			Context:    context.Background(),
+			Log:        logr.Discard(),
+			Object:     obj,
+			Client:     c,
+			Recorder:   record.NewFakeRecorder(10),
+			Conditions: core.NewConditionHelper(obj),
+		}
+	}
+
+	h.SetInitializing(newContext(saved), saved)
+	assert.Equal(t, []hephv1.Phase{hephv1.PhaseInitializing}, hook.phases)
+
+	missing := &hephv1.ImageBuild{ObjectMeta: metav1.ObjectMeta{Name: "missing", Namespace: "ns"}}
+	h.SetInitializing(newContext(missing), missing)
+	assert.Len(t, hook.phases, 1, "hooks are not invoked when the status update fails")
+}
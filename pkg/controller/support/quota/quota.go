@@ -0,0 +1,65 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+// DefaultWindow is used when the quota configuration does not specify a window.
+const DefaultWindow = time.Hour
+
+// Tracker records the build quota usage of namespaces in their BuildQuotaUsage, which the ImageBuild webhook checks
+// before admitting new builds.
+type Tracker struct {
+	client client.Client
+	window time.Duration
+	now    func() time.Time
+}
+
+// NewTracker returns a tracker that resets the usage of a namespace once the window elapses.
+func NewTracker(c client.Client, window time.Duration) *Tracker {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	return &Tracker{client: c, window: window, now: time.Now}
+}
+
+// Record adds builds and pushed bytes to the usage of the namespace. The BuildQuotaUsage is created when missing and
+// the update is retried when it races with another build of the same namespace.
+func (t *Tracker) Record(ctx context.Context, namespace string, builds, pushedBytes int64) error {
+	key := client.ObjectKey{Namespace: namespace, Name: hephv1.BuildQuotaUsageName}
+	retriable := func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}
+
+	err := retry.OnError(retry.DefaultRetry, retriable, func() error {
+		usage := &hephv1.BuildQuotaUsage{}
+		err := t.client.Get(ctx, key, usage)
+		if apierrors.IsNotFound(err) {
+			usage.Namespace, usage.Name = key.Namespace, key.Name
+			err = t.client.Create(ctx, usage)
+		}
+		if err != nil {
+			return err
+		}
+
+		usage.Status = usage.Status.Current(t.now(), t.window)
+		usage.Status.Builds += builds
+		usage.Status.PushedBytes += pushedBytes
+
+		return t.client.Status().Update(ctx, usage)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot record build quota usage of namespace %q: %w", namespace, err)
+	}
+
+	return nil
+}
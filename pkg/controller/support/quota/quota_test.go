@@ -0,0 +1,52 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+func TestTrackerRecord(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, hephv1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&hephv1.BuildQuotaUsage{}).Build()
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	tracker := NewTracker(c, 0)
+	tracker.now = func() time.Time { return now }
+	assert.Equal(t, DefaultWindow, tracker.window)
+
+	usage := func() hephv1.BuildQuotaUsageStatus {
+		obj := &hephv1.BuildQuotaUsage{}
+		key := client.ObjectKey{Namespace: "team-a", Name: hephv1.BuildQuotaUsageName}
+		require.NoError(t, c.Get(context.Background(), key, obj))
+		return obj.Status
+	}
+
+	require.NoError(t, tracker.Record(context.Background(), "team-a", 1, 0), "usage is created when missing")
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, tracker.Record(context.Background(), "team-a", 1, 0))
+	require.NoError(t, tracker.Record(context.Background(), "team-a", 0, 2048))
+
+	status := usage()
+	assert.True(t, status.WindowStart.Time.Equal(start))
+	assert.Equal(t, int64(2), status.Builds)
+	assert.Equal(t, int64(2048), status.PushedBytes)
+
+	now = start.Add(time.Hour)
+	require.NoError(t, tracker.Record(context.Background(), "team-a", 1, 0))
+
+	status = usage()
+	assert.True(t, status.WindowStart.Time.Equal(now), "counters are reset once the window elapses")
+	assert.Equal(t, int64(1), status.Builds)
+	assert.Zero(t, status.PushedBytes)
+}
@@ -0,0 +1,175 @@
+package registryquota
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+// defaultMaxUsedPercent matches the default storage quota of Artifactory instances.
+const defaultMaxUsedPercent = 95
+
+// Usage is the storage used in a registry and the limit it may not exceed. Registries without a limit report a
+// negative limit.
+type Usage struct {
+	UsedBytes  int64
+	LimitBytes int64
+}
+
+// Exceeded reports whether fewer than minFree bytes remain below the limit.
+func (u Usage) Exceeded(minFree int64) bool {
+	return u.LimitBytes >= 0 && u.UsedBytes+minFree >= u.LimitBytes
+}
+
+// Fetch queries the storage usage of the repository from the management API of its registry.
+func Fetch(
+	ctx context.Context,
+	client *http.Client,
+	cfg config.RegistryQuota,
+	repo name.Repository,
+	auth authn.Authenticator,
+) (Usage, error) {
+	switch cfg.Provider {
+	case config.RegistryQuotaHarbor:
+		return fetchHarbor(ctx, client, cfg, repo, auth)
+	case config.RegistryQuotaArtifactory:
+		return fetchArtifactory(ctx, client, cfg, repo, auth)
+	default:
+		return Usage{}, fmt.Errorf("unsupported registry quota provider %q", cfg.Provider)
+	}
+}
+
+type harborSummary struct {
+	Quota struct {
+		Hard struct {
+			Storage int64 `json:"storage"`
+		} `json:"hard"`
+		Used struct {
+			Storage int64 `json:"storage"`
+		} `json:"used"`
+	} `json:"quota"`
+}
+
+// fetchHarbor reads the storage quota of the project, i.e. the first path component of the repository.
+func fetchHarbor(
+	ctx context.Context,
+	client *http.Client,
+	cfg config.RegistryQuota,
+	repo name.Repository,
+	auth authn.Authenticator,
+) (Usage, error) {
+	project, _, _ := strings.Cut(repo.RepositoryStr(), "/")
+	endpoint := apiURL(cfg, repo, "") + "/api/v2.0/projects/" + url.PathEscape(project) + "/summary"
+
+	var summary harborSummary
+	header := http.Header{"X-Is-Resource-Name": []string{"true"}}
+	if err := getJSON(ctx, client, endpoint, header, auth, &summary); err != nil {
+		return Usage{}, err
+	}
+
+	return Usage{UsedBytes: summary.Quota.Used.Storage, LimitBytes: summary.Quota.Hard.Storage}, nil
+}
+
+type artifactoryStorageInfo struct {
+	FileStoreSummary struct {
+		TotalSpace string `json:"totalSpace"`
+		UsedSpace  string `json:"usedSpace"`
+	} `json:"fileStoreSummary"`
+}
+
+// fetchArtifactory reads the file store summary of the instance, sizes are reported in binary units such as
+// "1.95 TB" and used space is followed by its percentage, e.g. "1.07 TB (54.6%)".
+func fetchArtifactory(
+	ctx context.Context,
+	client *http.Client,
+	cfg config.RegistryQuota,
+	repo name.Repository,
+	auth authn.Authenticator,
+) (Usage, error) {
+	endpoint := apiURL(cfg, repo, "/artifactory") + "/api/storageinfo"
+
+	var info artifactoryStorageInfo
+	if err := getJSON(ctx, client, endpoint, nil, auth, &info); err != nil {
+		return Usage{}, err
+	}
+
+	total, err := parseSize(info.FileStoreSummary.TotalSpace)
+	if err != nil {
+		return Usage{}, fmt.Errorf("invalid total space: %w", err)
+	}
+	used, err := parseSize(info.FileStoreSummary.UsedSpace)
+	if err != nil {
+		return Usage{}, fmt.Errorf("invalid used space: %w", err)
+	}
+
+	maxUsed := cfg.MaxUsedPercent
+	if maxUsed == 0 {
+		maxUsed = defaultMaxUsedPercent
+	}
+
+	return Usage{UsedBytes: used, LimitBytes: total / 100 * int64(maxUsed)}, nil
+}
+
+func parseSize(s string) (int64, error) {
+	size, _, _ := strings.Cut(strings.TrimSpace(s), " (")
+	return units.RAMInBytes(size)
+}
+
+func apiURL(cfg config.RegistryQuota, repo name.Repository, path string) string {
+	if cfg.URL != "" {
+		return strings.TrimSuffix(cfg.URL, "/")
+	}
+
+	return fmt.Sprintf("%s://%s%s", repo.Scheme(), repo.RegistryStr(), path)
+}
+
+func getJSON(
+	ctx context.Context,
+	client *http.Client,
+	endpoint string,
+	header http.Header,
+	auth authn.Authenticator,
+	out any,
+) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	creds, err := auth.Authorization()
+	if err != nil {
+		return err
+	}
+	switch {
+	case creds.Username != "" || creds.Password != "":
+		req.SetBasicAuth(creds.Username, creds.Password)
+	case creds.RegistryToken != "":
+		req.Header.Set("Authorization", "Bearer "+creds.RegistryToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("GET %s returned status %d", endpoint, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
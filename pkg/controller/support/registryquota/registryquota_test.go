@@ -0,0 +1,74 @@
+package registryquota
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2.0/projects/team/summary", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "robot" || pass != "s3cr3t" || r.Header.Get("X-Is-Resource-Name") != "true" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"quota":{"hard":{"storage":1000},"used":{"storage":900}}}`))
+	})
+	mux.HandleFunc("/artifactory/api/storageinfo", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"fileStoreSummary":{"totalSpace":"100 GB","usedSpace":"96 GB (96%)"}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	repo, err := name.NewRepository(strings.TrimPrefix(srv.URL, "http://") + "/team/app")
+	require.NoError(t, err)
+	auth := authn.FromConfig(authn.AuthConfig{Username: "robot", Password: "s3cr3t"})
+
+	t.Run("harbor", func(t *testing.T) {
+		usage, err := Fetch(context.Background(), srv.Client(), config.RegistryQuota{Provider: "harbor"}, repo, auth)
+		require.NoError(t, err)
+		assert.Equal(t, Usage{UsedBytes: 900, LimitBytes: 1000}, usage)
+		assert.False(t, usage.Exceeded(0))
+		assert.True(t, usage.Exceeded(100))
+
+		_, err = Fetch(context.Background(), srv.Client(), config.RegistryQuota{Provider: "harbor"}, repo, authn.Anonymous)
+		assert.ErrorContains(t, err, "status 401")
+	})
+
+	t.Run("artifactory", func(t *testing.T) {
+		cfg := config.RegistryQuota{Provider: "artifactory"}
+		usage, err := Fetch(context.Background(), srv.Client(), cfg, repo, authn.Anonymous)
+		require.NoError(t, err)
+		assert.Equal(t, int64(96<<30), usage.UsedBytes)
+		assert.True(t, usage.Exceeded(0), "the default limit is 95% of the total space")
+
+		cfg.MaxUsedPercent = 98
+		usage, err = Fetch(context.Background(), srv.Client(), cfg, repo, authn.Anonymous)
+		require.NoError(t, err)
+		assert.False(t, usage.Exceeded(0))
+	})
+
+	t.Run("url", func(t *testing.T) {
+		cfg := config.RegistryQuota{Provider: "artifactory", URL: srv.URL + "/artifactory/"}
+		other, err := name.NewRepository("registry.example.com/team/app")
+		require.NoError(t, err)
+
+		_, err = Fetch(context.Background(), srv.Client(), cfg, other, authn.Anonymous)
+		assert.NoError(t, err)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		assert.False(t, Usage{UsedBytes: 1 << 40, LimitBytes: -1}.Exceeded(1<<30))
+	})
+}
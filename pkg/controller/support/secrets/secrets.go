@@ -22,23 +22,59 @@ var clientsetFunc = func(config *rest.Config) (kubernetes.Interface, error) {
 	return kubernetes.NewForConfig(config)
 }
 
+// ServiceAccountUsername returns the username used to impersonate a service account.
+func ServiceAccountUsername(namespace, name string) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name)
+}
+
+// ImpersonatedConfig returns a copy of cfg that impersonates the service account with the given name inside namespace.
+// cfg is returned unchanged when serviceAccount is blank.
+func ImpersonatedConfig(cfg *rest.Config, namespace, serviceAccount string) *rest.Config {
+	if serviceAccount == "" {
+		return cfg
+	}
+
+	conf := rest.CopyConfig(cfg)
+	conf.Impersonate = rest.ImpersonationConfig{UserName: ServiceAccountUsername(namespace, serviceAccount)}
+
+	return conf
+}
+
+// ReadSecrets extracts the data from all secrets referenced by an ImageBuild.
+//
+// When serviceAccount is provided, every secret is read while impersonating the service account with that name inside
+// the ImageBuild's namespace. This allows installations to grant each namespace access to the secrets it may use instead
+// of giving the controller cluster-wide read access.
 func ReadSecrets(
 	ctx context.Context,
 	obj *hephv1.ImageBuild,
 	log logr.Logger,
 	cfg *rest.Config,
 	scheme *runtime.Scheme,
+	serviceAccount string,
 ) (map[string][]byte, error) {
-	clientset, err := clientsetFunc(cfg)
-	if err != nil {
-		return map[string][]byte{}, fmt.Errorf("failure to get kubernetes client: %w", err)
+	var clientset kubernetes.Interface
+	getClientset := func() (kubernetes.Interface, error) {
+		if clientset != nil {
+			return clientset, nil
+		}
+
+		var err error
+		if clientset, err = clientsetFunc(ImpersonatedConfig(cfg, obj.Namespace, serviceAccount)); err != nil {
+			return nil, fmt.Errorf("failure to get kubernetes client: %w", err)
+		}
+
+		return clientset, nil
 	}
-	v1 := clientset.CoreV1()
 
 	// Extracts secrets into data to pass to buildkit
 	secretsData := make(map[string][]byte)
 	for _, secretRef := range obj.Spec.Secrets {
-		secretClient := v1.Secrets(secretRef.Namespace)
+		clientset, err := getClientset()
+		if err != nil {
+			return map[string][]byte{}, err
+		}
+		secretClient := clientset.CoreV1().Secrets(secretRef.Namespace)
 
 		path := strings.Join([]string{secretRef.Namespace, secretRef.Name}, "/")
 		log.Info("Finding secret", "path", path)
@@ -69,11 +105,31 @@ func ReadSecrets(
 			}
 		}
 
-		// builds a path for the secret like {namespace}/{name}/{key} to avoid hash key collisions
-		for filename, data := range secret.Data {
-			name := strings.Join([]string{path, filename}, "/")
-			secretsData[name] = data
-			log.Info("Read secret bytes", "path", name, "bytes", len(data))
+		data := secret.Data
+		if len(secretRef.Keys) != 0 {
+			data = make(map[string][]byte, len(secretRef.Keys))
+			for _, key := range secretRef.Keys {
+				value, ok := secret.Data[key]
+				if !ok {
+					return map[string][]byte{}, fmt.Errorf("secret %q is missing key %q", path, key)
+				}
+				data[key] = value
+			}
+		}
+
+		// builds a path for the secret like {namespace}/{name}/{key} to avoid hash key collisions unless the
+		// reference asks for a predictable {mountPath}/{key} id
+		prefix := path
+		if secretRef.MountPath != "" {
+			prefix = strings.Trim(secretRef.MountPath, "/")
+		}
+		for filename, value := range data {
+			name := strings.Join([]string{prefix, filename}, "/")
+			if _, exists := secretsData[name]; exists {
+				return map[string][]byte{}, fmt.Errorf("secret id %q is provided by more than one secret reference", name)
+			}
+			secretsData[name] = value
+			log.Info("Read secret bytes", "path", name, "bytes", len(value))
 		}
 	}
 
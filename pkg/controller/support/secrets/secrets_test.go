@@ -99,6 +99,67 @@ func TestReadSecrets(t *testing.T) {
 			},
 			Want: map[string][]byte{"domino-test/foo/bar": []byte("goodbye")},
 		},
+		"uses mount path as the secret id prefix": {
+			RequestedSecrets: []hephv1.SecretReference{{Namespace: "foo", Name: "bar", MountPath: "/pip/"}},
+			ClientResponse: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "bar",
+					Labels:    map[string]string{"hephaestus-accessible": "true"},
+				},
+				Data: map[string][]byte{"pip.conf": []byte("hello")},
+			}},
+			Want: map[string][]byte{"pip/pip.conf": []byte("hello")},
+		},
+		"returns only the requested keys": {
+			RequestedSecrets: []hephv1.SecretReference{{Namespace: "foo", Name: "bar", Keys: []string{"baz"}}},
+			ClientResponse: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "bar",
+					Labels:    map[string]string{"hephaestus-accessible": "true"},
+				},
+				Data: map[string][]byte{"baz": []byte("hello"), "qux": []byte("goodbye")},
+			}},
+			Want: map[string][]byte{"foo/bar/baz": []byte("hello")},
+		},
+		"errors for missing requested keys": {
+			RequestedSecrets: []hephv1.SecretReference{{Namespace: "foo", Name: "bar", Keys: []string{"qux"}}},
+			ClientResponse: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "foo",
+					Name:      "bar",
+					Labels:    map[string]string{"hephaestus-accessible": "true"},
+				},
+				Data: map[string][]byte{"baz": []byte("hello")},
+			}},
+			WantError: true,
+		},
+		"errors for colliding secret ids": {
+			RequestedSecrets: []hephv1.SecretReference{
+				{Namespace: "foo", Name: "bar", MountPath: "shared"},
+				{Namespace: "foo", Name: "baz", MountPath: "shared"},
+			},
+			ClientResponse: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "foo",
+						Name:      "bar",
+						Labels:    map[string]string{"hephaestus-accessible": "true"},
+					},
+					Data: map[string][]byte{"token": []byte("hello")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "foo",
+						Name:      "baz",
+						Labels:    map[string]string{"hephaestus-accessible": "true"},
+					},
+					Data: map[string][]byte{"token": []byte("goodbye")},
+				},
+			},
+			WantError: true,
+		},
 		"errors for missing secrets": {
 			RequestedSecrets: []hephv1.SecretReference{{Namespace: "foo", Name: "bar"}},
 			ClientResponse:   []runtime.Object{},
@@ -135,7 +196,7 @@ func TestReadSecrets(t *testing.T) {
 				return fake.NewSimpleClientset(tc.ClientResponse...), nil
 			}
 
-			secretData, err := ReadSecrets(context.Background(), img, logr.Discard(), nil, nil)
+			secretData, err := ReadSecrets(context.Background(), img, logr.Discard(), nil, nil, "")
 
 			if tc.WantError {
 				assert.Error(t, err)
@@ -217,7 +278,7 @@ func TestReadSecretsTakesOwnership(t *testing.T) {
 			clientsetFunc = func(*rest.Config) (kubernetes.Interface, error) { return simpleClient, nil }
 
 			schema, _ := hephv1.SchemeBuilder.Build()
-			secretData, err := ReadSecrets(context.Background(), img, logr.Discard(), nil, schema)
+			secretData, err := ReadSecrets(context.Background(), img, logr.Discard(), nil, schema, "")
 
 			assert.NoError(t, err)
 			assert.Equal(t, tc.Want, secretData)
@@ -234,3 +295,40 @@ func TestReadSecretsTakesOwnership(t *testing.T) {
 		})
 	}
 }
+
+func TestReadSecretsImpersonatesServiceAccount(t *testing.T) {
+	img := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{Name: "image-build-request", Namespace: "domino-compute"},
+		Spec: hephv1.ImageBuildSpec{
+			Secrets: []hephv1.SecretReference{
+				{Namespace: "domino-compute", Name: "foo"},
+				{Namespace: "domino-compute", Name: "bar"},
+				{Namespace: "domino-other", Name: "baz"},
+			},
+		},
+	}
+
+	var users []string
+	clientsetFunc = func(cfg *rest.Config) (kubernetes.Interface, error) {
+		users = append(users, cfg.Impersonate.UserName)
+
+		var objs []runtime.Object
+		for _, ref := range img.Spec.Secrets {
+			objs = append(objs, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: ref.Namespace,
+					Name:      ref.Name,
+					Labels:    map[string]string{"hephaestus-accessible": "true"},
+				},
+				Data: map[string][]byte{"key": []byte(ref.Name)},
+			})
+		}
+		return fake.NewSimpleClientset(objs...), nil
+	}
+
+	secretData, err := ReadSecrets(context.Background(), img, logr.Discard(), &rest.Config{}, nil, "secret-reader")
+	assert.NoError(t, err)
+	assert.Len(t, secretData, 3)
+	// secrets in other namespaces are still read as the service account of the build's namespace
+	assert.Equal(t, []string{"system:serviceaccount:domino-compute:secret-reader"}, users)
+}
@@ -38,9 +38,17 @@ var (
 
 // Apply will create or update all project CRDs inside a Kubernetes cluster.
 //
-// The latest available version of the CRD will be used to perform this operation.
-func Apply(ctx context.Context) error {
-	return operate(ctx, applyFn)
+// The latest available version of the CRD will be used to perform this operation. The customization is applied to
+// every definition beforehand.
+func Apply(ctx context.Context, custom Customization) error {
+	return operate(ctx, func(
+		ctx context.Context,
+		client apixv1client.CustomResourceDefinitionInterface,
+		crd *apixv1.CustomResourceDefinition,
+	) error {
+		custom.customize(crd)
+		return applyFn(ctx, client, crd)
+	})
 }
 
 // Delete will remove all project CRDs from a Kubernetes cluster.
@@ -72,31 +80,45 @@ func Exists(gv metav1.GroupVersion) (bool, error) {
 	return true, nil
 }
 
-// operate will read all available CRDS and apply state changes to the cluster using the processor func.
-func operate(ctx context.Context, processor crdProcessor) error {
-	log.Info("Loading all CRDs")
-
+// Definitions returns all project CRDs embedded in the binary.
+func Definitions() ([]*apixv1.CustomResourceDefinition, error) {
 	definitions, err := crds.ReadAll()
 	if err != nil {
-		return err
-	}
-
-	client, err := crdClientFn()
-	if err != nil {
-		return err
+		return nil, err
 	}
 
+	resources := make([]*apixv1.CustomResourceDefinition, 0, len(definitions))
 	for _, def := range definitions {
 		bs, err := yaml.YAMLToJSON(def.Contents)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		resource := new(apixv1.CustomResourceDefinition)
 		if err := json.Unmarshal(bs, resource); err != nil {
-			return err
+			return nil, err
 		}
+		resources = append(resources, resource)
+	}
+
+	return resources, nil
+}
+
+// operate will read all available CRDS and apply state changes to the cluster using the processor func.
+func operate(ctx context.Context, processor crdProcessor) error {
+	log.Info("Loading all CRDs")
+
+	definitions, err := Definitions()
+	if err != nil {
+		return err
+	}
+
+	client, err := crdClientFn()
+	if err != nil {
+		return err
+	}
 
+	for _, resource := range definitions {
 		if err := processor(ctx, client, resource); err != nil {
 			return err
 		}
@@ -36,7 +36,7 @@ func TestApply(t *testing.T) {
 
 		t.Cleanup(overrideCRDClient(fakeClient))
 
-		require.NoError(t, Apply(context.Background()))
+		require.NoError(t, Apply(context.Background(), Customization{}))
 		assert.True(t, created, "New CRD was not created")
 	})
 
@@ -62,7 +62,7 @@ func TestApply(t *testing.T) {
 
 		t.Cleanup(overrideCRDClient(fakeClient))
 
-		require.NoError(t, Apply(context.Background()))
+		require.NoError(t, Apply(context.Background(), Customization{}))
 		assert.True(t, updated, "Existing CRD was not updated")
 	})
 
@@ -76,11 +76,52 @@ func TestApply(t *testing.T) {
 
 		t.Cleanup(overrideCRDClient(fakeClient))
 
-		err := Apply(context.Background())
+		err := Apply(context.Background(), Customization{})
 		assert.Equalf(t, expected, err, "Received error %v did not match %v", err, expected)
 	})
 }
 
+func TestApplyCustomization(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset()
+
+	applied := map[string]*apixv1.CustomResourceDefinition{}
+	fakeClient.PrependReactor("create", "*", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+		obj := action.(k8stesting.CreateAction).GetObject().(*apixv1.CustomResourceDefinition)
+		applied[obj.Spec.Names.Plural] = obj
+		return true, obj, nil
+	})
+
+	t.Cleanup(overrideCRDClient(fakeClient))
+
+	digest := apixv1.CustomResourceColumnDefinition{Name: "Digest", Type: "string", JSONPath: ".status.digest"}
+	phase := apixv1.SelectableField{JSONPath: ".status.phase"}
+	custom := Customization{
+		Categories:       []string{"hephaestus"},
+		ShortNames:       map[string][]string{"imagebuilds": {"ib", "ibuild"}},
+		PrinterColumns:   map[string][]apixv1.CustomResourceColumnDefinition{"imagebuilds": {digest}},
+		SelectableFields: map[string][]apixv1.SelectableField{"imagebuilds": {phase}},
+	}
+	require.NoError(t, Apply(context.Background(), custom))
+
+	ib := applied["imagebuilds"]
+	require.NotNil(t, ib)
+	assert.Equal(t, []string{"hephaestus"}, ib.Spec.Names.Categories)
+	assert.Equal(t, []string{"ib", "ibuild"}, ib.Spec.Names.ShortNames)
+	for _, version := range ib.Spec.Versions {
+		assert.Contains(t, version.AdditionalPrinterColumns, digest)
+		assert.Equal(t, []apixv1.SelectableField{phase}, version.SelectableFields)
+	}
+
+	ibm := applied["imagebuildmessages"]
+	require.NotNil(t, ibm)
+	assert.Equal(t, []string{"hephaestus"}, ibm.Spec.Names.Categories)
+	assert.Equal(t, []string{"ibm"}, ibm.Spec.Names.ShortNames)
+	for _, version := range ibm.Spec.Versions {
+		assert.NotContains(t, version.AdditionalPrinterColumns, digest)
+		assert.Empty(t, version.SelectableFields)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		fakeClient := fake.NewSimpleClientset(&apixv1.CustomResourceDefinition{
@@ -0,0 +1,66 @@
+package crd
+
+import (
+	"slices"
+
+	apixv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// Customization alters the embedded definitions before they are applied to a cluster.
+//
+// Resources are keyed by their plural name (e.g. "imagebuilds").
+type Customization struct {
+	// Categories are added to every definition so that resources can be listed together, e.g. "kubectl get hephaestus".
+	Categories []string `json:"categories,omitempty"`
+	// ShortNames are added to the short names of a resource.
+	ShortNames map[string][]string `json:"shortNames,omitempty"`
+	// PrinterColumns are appended to the additional printer columns of every version of a resource.
+	PrinterColumns map[string][]apixv1.CustomResourceColumnDefinition `json:"printerColumns,omitempty"`
+	// SelectableFields are appended to the selectable fields of every version of a resource, e.g. ".status.phase" of
+	// "imagebuilds" lets the garbage collector list finished builds only. API servers before 1.30 ignore them.
+	SelectableFields map[string][]apixv1.SelectableField `json:"selectableFields,omitempty"`
+}
+
+// customize applies the customization to the definition in-place, skipping values that are already present.
+func (c Customization) customize(crd *apixv1.CustomResourceDefinition) {
+	names := &crd.Spec.Names
+	plural := names.Plural
+
+	names.Categories = appendMissing(names.Categories, c.Categories...)
+	names.ShortNames = appendMissing(names.ShortNames, c.ShortNames[plural]...)
+
+	columns := c.PrinterColumns[plural]
+	fields := c.SelectableFields[plural]
+
+	for i := range crd.Spec.Versions {
+		version := &crd.Spec.Versions[i]
+
+		for _, col := range columns {
+			exists := slices.ContainsFunc(version.AdditionalPrinterColumns, func(c apixv1.CustomResourceColumnDefinition) bool {
+				return c.Name == col.Name
+			})
+			if !exists {
+				version.AdditionalPrinterColumns = append(version.AdditionalPrinterColumns, col)
+			}
+		}
+
+		for _, field := range fields {
+			exists := slices.ContainsFunc(version.SelectableFields, func(f apixv1.SelectableField) bool {
+				return f.JSONPath == field.JSONPath
+			})
+			if !exists {
+				version.SelectableFields = append(version.SelectableFields, field)
+			}
+		}
+	}
+}
+
+func appendMissing(s []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(s, v) {
+			s = append(s, v)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,92 @@
+// Package istio coordinates the lifecycle of the commands with an injected istio-proxy sidecar.
+//
+// Commands must not use the network before the proxy is ready, and the proxy keeps the pod alive after the main
+// container exits unless it is asked to quit.
+package istio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+var (
+	// readyURL is the readiness endpoint exposed by the pilot agent.
+	readyURL = "http://localhost:15021/healthz/ready"
+	// quitURL instructs the pilot agent and the proxy to exit.
+	quitURL = "http://localhost:15020/quitquitquit"
+
+	pollInterval = time.Second
+	readyTimeout = 2 * time.Minute
+	quitTimeout  = 5 * time.Second
+)
+
+// RunWithSidecar waits for the sidecar to become ready, runs fn, and then asks the sidecar to quit regardless of the
+// outcome so that the pod can terminate.
+func RunWithSidecar(ctx context.Context, log logr.Logger, fn func() error) error {
+	log.Info("Waiting for istio sidecar to become ready", "url", readyURL, "timeout", readyTimeout)
+	if err := waitForReady(ctx); err != nil {
+		return fmt.Errorf("istio sidecar is not ready: %w", err)
+	}
+	log.Info("Istio sidecar is ready")
+
+	defer func() {
+		log.Info("Stopping istio sidecar", "url", quitURL)
+		if err := quit(context.Background()); err != nil {
+			log.Error(err, "Failed to stop istio sidecar")
+		}
+	}()
+
+	return fn()
+}
+
+func waitForReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		if lastErr = probe(ctx, http.MethodGet, readyURL); lastErr == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ctx.Err(), lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+func quit(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, quitTimeout)
+	defer cancel()
+
+	return probe(ctx, http.MethodPost, quitURL)
+}
+
+func probe(ctx context.Context, method, url string) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned status %d", method, url, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package istio
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeAgent(t *testing.T, readyAfter int32) (*atomic.Int32, *atomic.Bool) {
+	t.Helper()
+
+	var probes atomic.Int32
+	var quit atomic.Bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz/ready", func(w http.ResponseWriter, _ *http.Request) {
+		if probes.Add(1) < readyAfter {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	mux.HandleFunc("POST /quitquitquit", func(http.ResponseWriter, *http.Request) {
+		quit.Store(true)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	origReady, origQuit, origInterval, origTimeout := readyURL, quitURL, pollInterval, readyTimeout
+	t.Cleanup(func() {
+		readyURL, quitURL, pollInterval, readyTimeout = origReady, origQuit, origInterval, origTimeout
+	})
+	readyURL = srv.URL + "/healthz/ready"
+	quitURL = srv.URL + "/quitquitquit"
+	pollInterval = 10 * time.Millisecond
+
+	return &probes, &quit
+}
+
+func TestRunWithSidecar(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		probes, quit := fakeAgent(t, 3)
+
+		var ran bool
+		err := RunWithSidecar(context.Background(), logr.Discard(), func() error {
+			ran = true
+			assert.False(t, quit.Load(), "sidecar stopped before the command finished")
+			return nil
+		})
+		require.NoError(t, err)
+
+		assert.True(t, ran)
+		assert.Equal(t, int32(3), probes.Load())
+		assert.True(t, quit.Load())
+	})
+
+	t.Run("command_error", func(t *testing.T) {
+		_, quit := fakeAgent(t, 1)
+
+		err := RunWithSidecar(context.Background(), logr.Discard(), func() error { return errors.New("boom") })
+		assert.EqualError(t, err, "boom")
+		assert.True(t, quit.Load(), "sidecar must be stopped when the command fails")
+	})
+
+	t.Run("never_ready", func(t *testing.T) {
+		_, quit := fakeAgent(t, 1000)
+		readyTimeout = 50 * time.Millisecond
+
+		err := RunWithSidecar(context.Background(), logr.Discard(), func() error {
+			t.Fatal("command must not run before the sidecar is ready")
+			return nil
+		})
+		assert.ErrorContains(t, err, "istio sidecar is not ready")
+		assert.False(t, quit.Load())
+	})
+}
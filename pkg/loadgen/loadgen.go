@@ -0,0 +1,316 @@
+// Package loadgen submits synthetic ImageBuilds to a cluster and reports how the worker pool copes with the load.
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	hephclient "github.com/dominodatalab/hephaestus/pkg/client"
+)
+
+// Config controls the volume and shape of the generated load.
+type Config struct {
+	// Namespace where ImageBuilds are created.
+	Namespace string
+	// Repository the synthetic images are pushed to, each build uses a unique tag.
+	Repository string
+	// Builds is the total number of ImageBuilds to submit.
+	Builds int
+	// Concurrency limits the number of unfinished ImageBuilds at any point in time.
+	Concurrency int
+	// Interval between submissions.
+	Interval time.Duration
+	// Layers added to every synthetic image.
+	Layers int
+	// LayerSizeKB of random data written into each layer.
+	LayerSizeKB int
+	// Timeout for a single build to finish.
+	Timeout time.Duration
+
+	// StatefulSetName of the buildkit workers whose scale is sampled.
+	StatefulSetName string
+	// StatefulSetNamespace of the buildkit workers.
+	StatefulSetNamespace string
+	// SampleInterval between worker scale samples.
+	SampleInterval time.Duration
+}
+
+// Percentiles summarizes a set of durations.
+type Percentiles struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// ScaleSample records the size of the worker pool at a point in time.
+type ScaleSample struct {
+	Elapsed  time.Duration
+	Replicas int32
+	Ready    int32
+}
+
+// Report is the outcome of a load generation run.
+type Report struct {
+	Submitted int
+	Succeeded int
+	Failed    int
+	// Unfinished builds could not be created or did not finish within the timeout.
+	Unfinished int
+	Elapsed    time.Duration
+
+	LeaseLatency Percentiles
+	BuildTime    Percentiles
+	EndToEnd     Percentiles
+
+	MaxReplicas int32
+	Samples     []ScaleSample
+}
+
+// Run submits the configured builds, waits for all of them to finish and reports lease latencies and worker scale.
+func Run(
+	ctx context.Context,
+	log logr.Logger,
+	cfg Config,
+	hc *hephclient.Client,
+	kc kubernetes.Interface,
+) (*Report, error) {
+	if cfg.Builds < 1 || cfg.Concurrency < 1 {
+		return nil, errors.New("builds and concurrency must be positive")
+	}
+
+	start := time.Now()
+
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	samples := make(chan []ScaleSample, 1)
+	go func() {
+		samples <- sampleScale(sampleCtx, log, kc, cfg, start)
+	}()
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		report    = &Report{}
+		lease     []time.Duration
+		build     []time.Duration
+		endToEnd  []time.Duration
+		semaphore = make(chan struct{}, cfg.Concurrency)
+	)
+
+submit:
+	for i := 0; i < cfg.Builds; i++ {
+		if i > 0 && cfg.Interval > 0 {
+			select {
+			case <-ctx.Done():
+				break submit
+			case <-time.After(cfg.Interval):
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			break submit
+		case semaphore <- struct{}{}:
+		}
+
+		report.Submitted++
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			submitted := time.Now()
+			ib, err := hc.CreateAndWait(ctx, NewImageBuild(cfg), cfg.Timeout)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				log.Error(err, "Build did not finish")
+				report.Unfinished++
+
+				return
+			}
+
+			endToEnd = append(endToEnd, time.Since(submitted))
+			if ib.Status.AllocationTime != nil {
+				lease = append(lease, ib.Status.AllocationTime.Duration)
+			}
+			if ib.Status.BuildTime != nil {
+				build = append(build, ib.Status.BuildTime.Duration)
+			}
+
+			if ib.Status.Phase == hephv1.PhaseSucceeded {
+				report.Succeeded++
+			} else {
+				log.Info("Build failed", "name", ib.Name, "conditions", ib.Status.Conditions)
+				report.Failed++
+			}
+		}()
+	}
+	wg.Wait()
+
+	stopSampling()
+	report.Samples = <-samples
+	report.Elapsed = time.Since(start)
+	report.LeaseLatency = NewPercentiles(lease)
+	report.BuildTime = NewPercentiles(build)
+	report.EndToEnd = NewPercentiles(endToEnd)
+	for _, s := range report.Samples {
+		report.MaxReplicas = max(report.MaxReplicas, s.Replicas)
+	}
+
+	return report, ctx.Err()
+}
+
+// NewImageBuild returns an ImageBuild with a unique synthetic Dockerfile so that no layer can be served from cache.
+func NewImageBuild(cfg Config) *hephv1.ImageBuild {
+	id := string(uuid.NewUUID())
+
+	return &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "loadgen-",
+			Namespace:    cfg.Namespace,
+		},
+		Spec: hephv1.ImageBuildSpec{
+			DockerfileContents:      SyntheticDockerfile(id, cfg.Layers, cfg.LayerSizeKB),
+			Images:                  []string{fmt.Sprintf("%s:%s", cfg.Repository, id)},
+			LogKey:                  id,
+			DisableCacheLayerExport: true,
+		},
+	}
+}
+
+// SyntheticDockerfile writes the given number of layers of random data on top of a small base image. The id is baked
+// into the first instruction to bust any cache.
+func SyntheticDockerfile(id string, layers, layerSizeKB int) string {
+	var sb strings.Builder
+
+	sb.WriteString("FROM busybox:stable\n")
+	fmt.Fprintf(&sb, "RUN echo %s > /loadgen-id\n", id)
+	for i := 0; i < layers; i++ {
+		fmt.Fprintf(&sb, "RUN head -c %dK /dev/urandom > /layer-%d\n", layerSizeKB, i)
+	}
+
+	return sb.String()
+}
+
+// NewPercentiles computes nearest-rank percentiles of the durations.
+func NewPercentiles(ds []time.Duration) Percentiles {
+	if len(ds) == 0 {
+		return Percentiles{}
+	}
+
+	sorted := slices.Clone(ds)
+	slices.Sort(sorted)
+
+	rank := func(p float64) time.Duration {
+		idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(idx, 0)]
+	}
+
+	return Percentiles{
+		P50: rank(0.50),
+		P90: rank(0.90),
+		P99: rank(0.99),
+		Max: sorted[len(sorted)-1],
+	}
+}
+
+// Write renders the report as human-readable tables.
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Submitted\tSucceeded\tFailed\tUnfinished\tElapsed\tMax workers\n")
+	fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%s\t%d\n\n",
+		r.Submitted, r.Succeeded, r.Failed, r.Unfinished, r.Elapsed.Round(time.Second), r.MaxReplicas)
+
+	fmt.Fprintf(tw, "Duration\tp50\tp90\tp99\tmax\n")
+	for _, row := range []struct {
+		name string
+		p    Percentiles
+	}{
+		{"lease latency", r.LeaseLatency},
+		{"build time", r.BuildTime},
+		{"end to end", r.EndToEnd},
+	} {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", row.name, row.p.P50, row.p.P90, row.p.P99, row.p.Max)
+	}
+
+	if len(r.Samples) > 0 {
+		fmt.Fprintf(tw, "\nElapsed\tReplicas\tReady\n")
+		for _, s := range r.Samples {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", s.Elapsed.Round(time.Second), s.Replicas, s.Ready)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// sampleScale records the worker statefulset scale every sample interval until the context is done. Consecutive
+// identical samples are collapsed so the result only contains scale changes.
+func sampleScale(
+	ctx context.Context,
+	log logr.Logger,
+	kc kubernetes.Interface,
+	cfg Config,
+	start time.Time,
+) []ScaleSample {
+	if cfg.StatefulSetName == "" || cfg.SampleInterval <= 0 {
+		return nil
+	}
+
+	var samples []ScaleSample
+	sample := func() {
+		sts, err := kc.AppsV1().StatefulSets(cfg.StatefulSetNamespace).Get(ctx, cfg.StatefulSetName, metav1.GetOptions{})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Error(err, "Failed to sample worker scale")
+			}
+			return
+		}
+
+		var replicas int32
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+
+		s := ScaleSample{Elapsed: time.Since(start), Replicas: replicas, Ready: sts.Status.ReadyReplicas}
+		if n := len(samples); n > 0 && samples[n-1].Replicas == s.Replicas && samples[n-1].Ready == s.Ready {
+			return
+		}
+
+		log.Info("Worker scale changed", "replicas", s.Replicas, "ready", s.Ready)
+		samples = append(samples, s)
+	}
+
+	ticker := time.NewTicker(cfg.SampleInterval)
+	defer ticker.Stop()
+
+	for {
+		sample()
+
+		select {
+		case <-ctx.Done():
+			return samples
+		case <-ticker.C:
+		}
+	}
+}
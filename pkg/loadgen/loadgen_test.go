@@ -0,0 +1,145 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/ptr"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	hephclient "github.com/dominodatalab/hephaestus/pkg/client"
+	"github.com/dominodatalab/hephaestus/pkg/clientset/fake"
+)
+
+func TestNewPercentiles(t *testing.T) {
+	assert.Equal(t, Percentiles{}, NewPercentiles(nil))
+
+	var ds []time.Duration
+	for i := 100; i > 0; i-- {
+		ds = append(ds, time.Duration(i)*time.Second)
+	}
+
+	assert.Equal(t, Percentiles{
+		P50: 50 * time.Second,
+		P90: 90 * time.Second,
+		P99: 99 * time.Second,
+		Max: 100 * time.Second,
+	}, NewPercentiles(ds))
+	assert.Equal(t, 100*time.Second, ds[0], "input must not be sorted in place")
+
+	single := NewPercentiles([]time.Duration{time.Second})
+	assert.Equal(t, Percentiles{P50: time.Second, P90: time.Second, P99: time.Second, Max: time.Second}, single)
+}
+
+func TestSyntheticDockerfile(t *testing.T) {
+	expected := `FROM busybox:stable
+RUN echo abc > /loadgen-id
+RUN head -c 64K /dev/urandom > /layer-0
+RUN head -c 64K /dev/urandom > /layer-1
+`
+	assert.Equal(t, expected, SyntheticDockerfile("abc", 2, 64))
+}
+
+func TestRun(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	gvr := hephv1.SchemeGroupVersion.WithResource("imagebuilds")
+
+	// the fake clientset does not generate names, so name every build and finish it as soon as it is created
+	var created atomic.Int32
+	cs.PrependReactor("create", "imagebuilds", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		ib := action.(k8stesting.CreateAction).GetObject().(*hephv1.ImageBuild).DeepCopy()
+		n := created.Add(1)
+
+		ib.Name = fmt.Sprintf("%s%d", ib.GenerateName, n)
+		ib.Status.Phase = hephv1.PhaseSucceeded
+		if n == 3 {
+			ib.Status.Phase = hephv1.PhaseFailed
+		}
+		ib.Status.AllocationTime = &metav1.Duration{Duration: time.Duration(n) * time.Second}
+		ib.Status.BuildTime = &metav1.Duration{Duration: time.Minute}
+
+		return true, ib, cs.Tracker().Create(gvr, ib, ib.Namespace)
+	})
+	// the fake clientset ignores field selectors, which the client uses to follow a single build
+	cs.PrependReactor("list", "imagebuilds", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj, err := cs.Tracker().List(gvr, gvr.GroupVersion().WithKind("ImageBuild"), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+
+		list := obj.(*hephv1.ImageBuildList)
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+		list.Items = slices.DeleteFunc(list.Items, func(ib hephv1.ImageBuild) bool {
+			return !selector.Matches(fields.Set{"metadata.name": ib.Name})
+		})
+
+		return true, list, nil
+	})
+
+	kc := kubefake.NewSimpleClientset(&appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "buildkit", Namespace: "workers"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To[int32](2)},
+		Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1},
+	})
+
+	cfg := Config{
+		Namespace:            "ns",
+		Repository:           "registry/repo",
+		Builds:               4,
+		Concurrency:          2,
+		Layers:               1,
+		LayerSizeKB:          1,
+		Timeout:              10 * time.Second,
+		StatefulSetName:      "buildkit",
+		StatefulSetNamespace: "workers",
+		SampleInterval:       10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := Run(ctx, logr.Discard(), cfg, hephclient.New(cs), kc)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, report.Submitted)
+	assert.Equal(t, 3, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, 0, report.Unfinished)
+	assert.Equal(t, 2*time.Second, report.LeaseLatency.P50)
+	assert.Equal(t, 4*time.Second, report.LeaseLatency.Max)
+	assert.Equal(t, time.Minute, report.BuildTime.P99)
+	assert.Equal(t, int32(2), report.MaxReplicas)
+	assert.Equal(t, []ScaleSample{{Elapsed: report.Samples[0].Elapsed, Replicas: 2, Ready: 1}}, report.Samples)
+
+	builds, err := cs.HephaestusV1().ImageBuilds("ns").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, builds.Items, 4)
+	for _, ib := range builds.Items {
+		assert.True(t, strings.HasPrefix(ib.Spec.Images[0], "registry/repo:"+ib.Spec.LogKey))
+		assert.Contains(t, ib.Spec.DockerfileContents, ib.Spec.LogKey)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf))
+	assert.Contains(t, buf.String(), "lease latency")
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	_, err := Run(context.Background(), logr.Discard(), Config{}, nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+// AdmissionRecord describes a single admission decision of a webhook for change-control audits.
+type AdmissionRecord struct {
+	Timestamp   time.Time             `json:"timestamp"`
+	Webhook     string                `json:"webhook"`
+	UID         string                `json:"uid"`
+	Operation   string                `json:"operation"`
+	Kind        string                `json:"kind"`
+	Namespace   string                `json:"namespace,omitempty"`
+	Name        string                `json:"name,omitempty"`
+	User        string                `json:"user"`
+	Groups      []string              `json:"groups,omitempty"`
+	Allowed     bool                  `json:"allowed"`
+	Code        int32                 `json:"code,omitempty"`
+	Reason      string                `json:"reason,omitempty"`
+	FieldErrors []AdmissionFieldError `json:"fieldErrors,omitempty"`
+	Warnings    []string              `json:"warnings,omitempty"`
+	Patched     bool                  `json:"patched,omitempty"`
+}
+
+// AdmissionFieldError is a field of the admitted object that failed validation.
+type AdmissionFieldError struct {
+	Field   string `json:"field"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// NewAdmissionRecord builds an audit record from an admission request and the response of the webhook.
+func NewAdmissionRecord(path string, req admission.Request, resp admission.Response, ts time.Time) AdmissionRecord {
+	rec := AdmissionRecord{
+		Timestamp: ts,
+		Webhook:   path,
+		UID:       string(req.UID),
+		Operation: string(req.Operation),
+		Kind:      req.Kind.Kind,
+		Namespace: req.Namespace,
+		Name:      req.Name,
+		User:      req.UserInfo.Username,
+		Groups:    req.UserInfo.Groups,
+		Allowed:   resp.Allowed,
+		Warnings:  resp.Warnings,
+		Patched:   len(resp.Patches) != 0,
+	}
+
+	if result := resp.Result; result != nil {
+		rec.Code = result.Code
+		rec.Reason = result.Message
+		if details := result.Details; details != nil {
+			for _, cause := range details.Causes {
+				rec.FieldErrors = append(rec.FieldErrors, AdmissionFieldError{
+					Field:   cause.Field,
+					Type:    string(cause.Type),
+					Message: cause.Message,
+				})
+			}
+		}
+	}
+
+	return rec
+}
+
+// AdmissionAuditor writes a JSON line for every decision of the admission webhooks it wraps.
+type AdmissionAuditor struct {
+	log logr.Logger
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewAdmissionAuditor appends records to the configured file, or writes them to stdout when no file is configured.
+func NewAdmissionAuditor(log logr.Logger, cfg config.AdmissionAuditLogging) (*AdmissionAuditor, error) {
+	a := &AdmissionAuditor{log: log, out: os.Stdout}
+
+	if cfg.Filepath != "" {
+		f, err := os.OpenFile(cfg.Filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open admission audit log: %w", err)
+		}
+		a.out = f
+	}
+
+	return a, nil
+}
+
+// Handler records the decisions of the admission handler served at path. Failures to write a record are logged and
+// never change the decision.
+func (a *AdmissionAuditor) Handler(path string, handler admission.Handler) admission.Handler {
+	return admission.HandlerFunc(func(ctx context.Context, req admission.Request) admission.Response {
+		resp := handler.Handle(ctx, req)
+
+		if err := a.write(NewAdmissionRecord(path, req, resp, time.Now())); err != nil {
+			a.log.Error(err, "Failed to write admission audit record", "webhook", path, "uid", req.UID)
+		}
+
+		return resp
+	})
+}
+
+// Server wraps a webhook server so the decisions of every admission webhook registered with it are recorded.
+func (a *AdmissionAuditor) Server(server webhook.Server) webhook.Server {
+	return &auditedServer{Server: server, auditor: a}
+}
+
+func (a *AdmissionAuditor) write(rec AdmissionRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err = a.out.Write(append(line, '\n'))
+	return err
+}
+
+type auditedServer struct {
+	webhook.Server
+	auditor *AdmissionAuditor
+}
+
+func (s *auditedServer) Register(path string, hook http.Handler) {
+	if wh, ok := hook.(*admission.Webhook); ok {
+		wh.Handler = s.auditor.Handler(path, wh.Handler)
+	}
+
+	s.Server.Register(path, hook)
+}
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func TestAdmissionAuditor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admission.log")
+	auditor, err := NewAdmissionAuditor(logr.Discard(), config.AdmissionAuditLogging{Enabled: true, Filepath: path})
+	require.NoError(t, err)
+
+	invalid := apierrors.NewInvalid(schema.GroupKind{Group: "hephaestus.dominodatalab.com", Kind: "ImageBuild"}, "build",
+		field.ErrorList{field.Required(field.NewPath("spec", "images"), "must not be empty")})
+	handler := auditor.Handler("/validate-imagebuild", admission.HandlerFunc(
+		func(_ context.Context, req admission.Request) admission.Response {
+			if req.Name == "build" {
+				// validators respond with the status of the invalid error, including its causes
+				status := invalid.Status()
+				return admission.Response{AdmissionResponse: admissionv1.AdmissionResponse{Result: &status}}
+			}
+			return admission.Allowed("")
+		},
+	))
+
+	request := func(name string) admission.Request {
+		return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       types.UID("uid-" + name),
+			Kind:      metav1.GroupVersionKind{Kind: "ImageBuild"},
+			Namespace: "team-a",
+			Name:      name,
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "jane", Groups: []string{"builders"}},
+		}}
+	}
+	assert.False(t, handler.Handle(context.Background(), request("build")).Allowed)
+	assert.True(t, handler.Handle(context.Background(), request("other")).Allowed)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []AdmissionRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec AdmissionRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	require.Len(t, records, 2)
+
+	denied := records[0]
+	assert.Equal(t, "/validate-imagebuild", denied.Webhook)
+	assert.Equal(t, "uid-build", denied.UID)
+	assert.Equal(t, "CREATE", denied.Operation)
+	assert.Equal(t, "ImageBuild", denied.Kind)
+	assert.Equal(t, "jane", denied.User)
+	assert.Equal(t, []string{"builders"}, denied.Groups)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, int32(422), denied.Code)
+	assert.Equal(t, []AdmissionFieldError{
+		{Field: "spec.images", Type: "FieldValueRequired", Message: "Required value: must not be empty"},
+	}, denied.FieldErrors)
+
+	assert.True(t, records[1].Allowed)
+	assert.Empty(t, records[1].FieldErrors)
+}
+
+func TestAdmissionAuditorServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admission.log")
+	auditor, err := NewAdmissionAuditor(logr.Discard(), config.AdmissionAuditLogging{Enabled: true, Filepath: path})
+	require.NoError(t, err)
+
+	server := auditor.Server(webhook.NewServer(webhook.Options{}))
+	hook := &admission.Webhook{Handler: admission.HandlerFunc(func(context.Context, admission.Request) admission.Response {
+		return admission.Allowed("")
+	})}
+	server.Register("/mutate-imagebuild", hook)
+
+	hook.Handler.Handle(context.Background(), admission.Request{})
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"webhook":"/mutate-imagebuild"`, "registered webhooks are audited")
+}
@@ -0,0 +1,200 @@
+package logger
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels overrides the level of named loggers at runtime, e.g. to log "buildkit.worker-pool" at debug level during an
+// incident without restarting the controller. A logger uses the override of its own name or of its closest parent,
+// so "buildkit" also applies to "buildkit.worker-pool" unless that has its own override. Loggers without an override
+// use the level configured for each output.
+type Levels struct {
+	mu        sync.RWMutex
+	overrides map[string]zapcore.Level
+	min       zapcore.Level
+}
+
+func NewLevels() *Levels {
+	return &Levels{overrides: map[string]zapcore.Level{}, min: zapcore.InvalidLevel}
+}
+
+// Set overrides the level of the named logger and its children.
+func (l *Levels) Set(name string, level zapcore.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.overrides[name] = level
+	l.updateMin()
+}
+
+// Reset removes the override of the named logger.
+func (l *Levels) Reset(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.overrides, name)
+	l.updateMin()
+}
+
+// Overrides returns the overridden level of every logger name.
+func (l *Levels) Overrides() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	overrides := make(map[string]string, len(l.overrides))
+	for name, level := range l.overrides {
+		overrides[name] = levelName(level)
+	}
+
+	return overrides
+}
+
+// lookup returns the override that applies to the logger name.
+func (l *Levels) lookup(name string) (zapcore.Level, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for {
+		if level, ok := l.overrides[name]; ok {
+			return level, true
+		}
+
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	level, ok := l.overrides[""]
+
+	return level, ok
+}
+
+// lowest reports whether any override enables the level.
+func (l *Levels) lowest(level zapcore.Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.min != zapcore.InvalidLevel && level >= l.min
+}
+
+func (l *Levels) updateMin() {
+	l.min = zapcore.InvalidLevel
+	for _, level := range l.overrides {
+		if l.min == zapcore.InvalidLevel || level < l.min {
+			l.min = level
+		}
+	}
+}
+
+// Core applies the overrides to a core whose own level is enabler. The wrapped core must enable every level.
+func (l *Levels) Core(core zapcore.Core, enabler zapcore.LevelEnabler) zapcore.Core {
+	return &levelCore{Core: core, enabler: enabler, levels: l}
+}
+
+type levelCore struct {
+	zapcore.Core
+	enabler zapcore.LevelEnabler
+	levels  *Levels
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.enabler.Enabled(level) || c.levels.lowest(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), enabler: c.enabler, levels: c.levels}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if level, ok := c.levels.lookup(ent.LoggerName); ok {
+		if !level.Enabled(ent.Level) {
+			return ce
+		}
+	} else if !c.enabler.Enabled(ent.Level) {
+		return ce
+	}
+
+	return ce.AddCore(ent, c)
+}
+
+// ParseLevel accepts a level name or a verbosity, e.g. "2" is the level of logr V(2) messages.
+func ParseLevel(s string) (zapcore.Level, error) {
+	if v, err := strconv.Atoi(s); err == nil {
+		if v < 0 {
+			return 0, fmt.Errorf("%q is an invalid verbosity", s)
+		}
+		return zapcore.Level(-v), nil
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("%q is an invalid log level: %w", s, err)
+	}
+
+	return level, nil
+}
+
+func levelName(level zapcore.Level) string {
+	if level < zapcore.DebugLevel {
+		return strconv.Itoa(-int(level))
+	}
+
+	return level.String()
+}
+
+// Handler serves the overrides as a JSON object of logger names and levels. GET lists them, PUT sets the "level" of
+// the "logger" query parameters and DELETE removes the override of "logger", the blank name applies to every logger.
+// Requests must carry the bearer token read from tokenFile, it is read on every request so the token can be rotated.
+func (l *Levels) Handler(tokenFile string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Authorized(r, tokenFile) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		name := r.URL.Query().Get("logger")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			level, err := ParseLevel(r.URL.Query().Get("level"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			l.Set(name, level)
+		case http.MethodDelete:
+			l.Reset(name)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(l.Overrides())
+	})
+}
+
+// Authorized reports whether the request carries the bearer token read from tokenFile, every request is rejected
+// without a token.
+func Authorized(r *http.Request, tokenFile string) bool {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return false
+	}
+
+	want := strings.TrimSpace(string(token))
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return want != "" && ok && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
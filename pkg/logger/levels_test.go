@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLevelsCore(t *testing.T) {
+	levels := NewLevels()
+	obs, logs := observer.New(zapcore.DebugLevel - 10)
+	log := zap.New(levels.Core(obs, zapcore.InfoLevel))
+
+	pool := log.Named("buildkit").Named("worker-pool")
+	pool.Debug("hidden")
+	pool.Info("shown")
+	assert.Equal(t, 1, logs.Len(), "loggers without an override use the configured level")
+
+	levels.Set("buildkit", zapcore.DebugLevel)
+	pool.Debug("parent override")
+	log.Named("controller").Debug("hidden")
+	assert.Equal(t, 2, logs.Len(), "the override of the parent applies to its children")
+
+	levels.Set("buildkit.worker-pool", zapcore.ErrorLevel)
+	pool.Info("hidden")
+	log.Named("buildkit").Debug("parent override")
+	assert.Equal(t, 3, logs.Len(), "the override of the logger takes precedence over its parent")
+
+	levels.Reset("buildkit.worker-pool")
+	levels.Reset("buildkit")
+	pool.Debug("hidden")
+	assert.Equal(t, 3, logs.Len())
+	assert.Empty(t, levels.Overrides())
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("debug")
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.DebugLevel, level)
+
+	level, err = ParseLevel("3")
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.Level(-3), level)
+	assert.Equal(t, "3", levelName(level))
+
+	_, err = ParseLevel("-1")
+	assert.Error(t, err)
+
+	_, err = ParseLevel("loud")
+	assert.Error(t, err)
+}
+
+func TestLevelsHandler(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cr3t\n"), 0o600))
+
+	levels := NewLevels()
+	handler := levels.Handler(tokenFile)
+	serve := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/loglevel", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPut, "/loglevel?logger=a&level=debug", "wrong").Code)
+	assert.Empty(t, levels.Overrides())
+
+	rec := serve(http.MethodPut, "/loglevel?logger=buildkit.worker-pool&level=debug", "s3cr3t")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"buildkit.worker-pool":"debug"}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/loglevel?logger=a&level=loud", "s3cr3t").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/loglevel", "s3cr3t").Code)
+
+	rec = serve(http.MethodDelete, "/loglevel?logger=buildkit.worker-pool", "s3cr3t")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{}`, rec.Body.String())
+
+	require.NoError(t, os.Remove(tokenFile))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/loglevel", "s3cr3t").Code,
+		"requests are rejected without a token")
+}
@@ -18,7 +18,9 @@ var (
 	jsonEncoder    zapcore.Encoder
 )
 
-func NewZap(cfg config.Logging) (*zap.Logger, error) {
+// NewZap builds the controller logger. The levels of its outputs can be overridden per logger name at runtime when
+// levels is not nil.
+func NewZap(cfg config.Logging, levels *Levels) (*zap.Logger, error) {
 	// container logging
 	var containerEncoder zapcore.Encoder
 	enc := strings.ToLower(cfg.Container.Encoder)
@@ -38,7 +40,7 @@ func NewZap(cfg config.Logging) (*zap.Logger, error) {
 	}
 
 	cores := []zapcore.Core{
-		zapcore.NewCore(&ctrlzap.KubeAwareEncoder{Encoder: containerEncoder}, zapcore.Lock(os.Stdout), ll),
+		newCore(&ctrlzap.KubeAwareEncoder{Encoder: containerEncoder}, zapcore.Lock(os.Stdout), ll, levels),
 	}
 
 	// logfile logging
@@ -52,14 +54,11 @@ func NewZap(cfg config.Logging) (*zap.Logger, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid logfile log level: %w", err)
 		}
-		fileCore := zapcore.NewCore(
+		fileCore := newCore(
 			&ctrlzap.KubeAwareEncoder{Encoder: jsonEncoder},
-			zapcore.AddSync(&lumberjack.Logger{
-				Filename:   file.Name(),
-				MaxSize:    100,
-				MaxBackups: 1,
-			}),
+			zapcore.AddSync(logfileWriter(file.Name(), cfg.Logfile)),
 			level,
+			levels,
 		)
 
 		cores = append(cores, fileCore)
@@ -81,6 +80,40 @@ func NewZap(cfg config.Logging) (*zap.Logger, error) {
 	return log, nil
 }
 
+// newCore writes entries at or above level, unless the level of their logger is overridden.
+func newCore(
+	enc zapcore.Encoder,
+	out zapcore.WriteSyncer,
+	level zapcore.LevelEnabler,
+	levels *Levels,
+) zapcore.Core {
+	if levels == nil {
+		return zapcore.NewCore(enc, out, level)
+	}
+
+	all := zap.LevelEnablerFunc(func(zapcore.Level) bool { return true })
+	return levels.Core(zapcore.NewCore(enc, out, all), level)
+}
+
+// logfileWriter rotates the logfile once it reaches its maximum size, keeping the configured number of backups.
+func logfileWriter(filename string, cfg config.LogfileLogging) *lumberjack.Logger {
+	w := &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}
+	if w.MaxSize == 0 {
+		w.MaxSize = 100
+	}
+	if w.MaxBackups == 0 {
+		w.MaxBackups = 1
+	}
+
+	return w
+}
+
 func parseLevel(name string) (zapcore.LevelEnabler, error) {
 	lvl := zap.NewAtomicLevel()
 	if err := lvl.UnmarshalText([]byte(name)); err != nil {
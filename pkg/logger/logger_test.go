@@ -0,0 +1,24 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func TestLogfileWriter(t *testing.T) {
+	w := logfileWriter("/var/log/hephaestus/output.json", config.LogfileLogging{})
+	assert.Equal(t, "/var/log/hephaestus/output.json", w.Filename)
+	assert.Equal(t, 100, w.MaxSize)
+	assert.Equal(t, 1, w.MaxBackups)
+	assert.Zero(t, w.MaxAge)
+	assert.False(t, w.Compress)
+
+	w = logfileWriter("output.json", config.LogfileLogging{MaxSizeMB: 10, MaxBackups: 5, MaxAgeDays: 7, Compress: true})
+	assert.Equal(t, 10, w.MaxSize)
+	assert.Equal(t, 5, w.MaxBackups)
+	assert.Equal(t, 7, w.MaxAge)
+	assert.True(t, w.Compress)
+}
@@ -0,0 +1,283 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-logr/logr"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+const (
+	defaultRedisKeyTemplate = "{{ .LogKey }}"
+	redisBufferSize         = 4096
+	redisBatchSize          = 256
+)
+
+// redisEvent is the schema of the entries added to the Redis lists.
+type redisEvent struct {
+	Event    map[string]string `json:"event"`
+	Stream   string            `json:"stream"`
+	Time     string            `json:"time"`
+	TimeNano string            `json:"time_nano"`
+	Log      string            `json:"log"`
+	LogKey   string            `json:"logKey"`
+}
+
+type redisEntry struct {
+	key  string
+	data []byte
+}
+
+// RedisForwarder appends every log event carrying a "logKey" value to a Redis list. Events are written in the
+// background so logging never blocks on Redis, they are dropped while the buffer is full.
+//
+// Lists are capped to their most recent entries and long messages are truncated so unbounded build output, e.g. a RUN
+// instruction stuck in a loop, cannot exhaust the memory of the Redis server.
+type RedisForwarder struct {
+	log           logr.Logger
+	client        *redis.Client
+	key           *template.Template
+	ttl           time.Duration
+	maxEntries    int64
+	maxEntryBytes int
+	level         zapcore.LevelEnabler
+	entries       chan redisEntry
+}
+
+// NewRedisForwarder creates a forwarder for the given configuration. Events are buffered until Start is called.
+func NewRedisForwarder(log logr.Logger, cfg config.RedisLogging) (*RedisForwarder, error) {
+	keyTemplate := cfg.KeyTemplate
+	if keyTemplate == "" {
+		keyTemplate = defaultRedisKeyTemplate
+	}
+	key, err := template.New("redisKey").Option("missingkey=error").Parse(keyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis key template: %w", err)
+	}
+
+	levelName := cfg.LogLevel
+	if levelName == "" {
+		levelName = "info"
+	}
+	level, err := parseLevel(levelName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis log level: %w", err)
+	}
+
+	return &RedisForwarder{
+		log: log,
+		client: redis.NewClient(&redis.Options{
+			Addr:     cfg.Address,
+			Username: cfg.Username,
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		}),
+		key:           key,
+		ttl:           cfg.TTL,
+		maxEntries:    cfg.MaxEntries,
+		maxEntryBytes: cfg.MaxEntryBytes,
+		level:         level,
+		entries:       make(chan redisEntry, redisBufferSize),
+	}, nil
+}
+
+// Core returns a zap core that hands log events to the forwarder.
+func (f *RedisForwarder) Core() zapcore.Core {
+	return &redisCore{LevelEnabler: f.level, fwd: f}
+}
+
+// NeedLeaderElection is false because every controller replica forwards its own logs.
+func (f *RedisForwarder) NeedLeaderElection() bool {
+	return false
+}
+
+// Start writes buffered events to Redis until the context is cancelled, the remaining events are written before it
+// returns.
+func (f *RedisForwarder) Start(ctx context.Context) error {
+	defer f.client.Close()
+
+	batch := make([]redisEntry, 0, redisBatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case entry := <-f.entries:
+					batch = append(batch, entry)
+				default:
+					//nolint:contextcheck
+					f.write(context.Background(), batch)
+					return nil
+				}
+			}
+		case entry := <-f.entries:
+			batch = append(batch[:0], entry)
+		fill:
+			for len(batch) < redisBatchSize {
+				select {
+				case entry = <-f.entries:
+					batch = append(batch, entry)
+				default:
+					break fill
+				}
+			}
+
+			f.write(ctx, batch)
+		}
+	}
+}
+
+func (f *RedisForwarder) write(ctx context.Context, batch []redisEntry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	keys := map[string]bool{}
+	_, err := f.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, entry := range batch {
+			pipe.RPush(ctx, entry.key, entry.data)
+			keys[entry.key] = true
+		}
+		for key := range keys {
+			if f.maxEntries > 0 {
+				pipe.LTrim(ctx, key, -f.maxEntries, -1)
+			}
+			if f.ttl > 0 {
+				pipe.Expire(ctx, key, f.ttl)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		// these events carry no logKey, so they are never forwarded themselves
+		f.log.Error(err, "Failed to forward log events to redis", "events", len(batch))
+	}
+}
+
+func (f *RedisForwarder) enqueue(entry redisEntry) {
+	select {
+	case f.entries <- entry:
+	default:
+	}
+}
+
+type redisCore struct {
+	zapcore.LevelEnabler
+
+	fwd    *RedisForwarder
+	fields []zapcore.Field
+}
+
+func (c *redisCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(append([]zapcore.Field{}, c.fields...), fields...)
+
+	return &clone
+}
+
+func (c *redisCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+
+	return ce
+}
+
+func (c *redisCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(enc)
+	}
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+
+	logKey, _ := enc.Fields["logKey"].(string)
+	if strings.TrimSpace(logKey) == "" {
+		return nil
+	}
+
+	var key strings.Builder
+	if err := c.fwd.key.Execute(&key, struct{ LogKey string }{logKey}); err != nil {
+		return fmt.Errorf("cannot render redis key: %w", err)
+	}
+
+	entry.Message = truncate(entry.Message, c.fwd.maxEntryBytes)
+	data, err := json.Marshal(newRedisEvent(entry, enc.Fields, logKey))
+	if err != nil {
+		return err
+	}
+	c.fwd.enqueue(redisEntry{key: key.String(), data: data})
+
+	return nil
+}
+
+func (c *redisCore) Sync() error {
+	return nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence, n <= 0 disables truncation.
+func truncate(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+
+	// back off to the start of the rune that would be cut in half
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// newRedisEvent uses the stream and time of build step output when present, other events are reported as stdout at
+// the time they were logged.
+func newRedisEvent(entry zapcore.Entry, fields map[string]any, logKey string) redisEvent {
+	event := map[string]string{
+		"level": entry.Level.String(),
+		"msg":   entry.Message,
+		"ts":    entry.Time.UTC().Format(time.RFC3339Nano),
+	}
+	if entry.LoggerName != "" {
+		event["logger"] = entry.LoggerName
+	}
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			event[k] = s
+			continue
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			data = []byte(fmt.Sprint(v))
+		}
+		event[k] = string(data)
+	}
+
+	re := redisEvent{
+		Event:    event,
+		Stream:   "stdout",
+		Time:     event["ts"],
+		TimeNano: strconv.FormatInt(entry.Time.UnixNano(), 10),
+		Log:      entry.Message,
+		LogKey:   logKey,
+	}
+	if stream, timeNano := event["stream"], event["time_nano"]; stream != "" && timeNano != "" {
+		re.Stream = stream
+		re.Time = event["time"]
+		re.TimeNano = timeNano
+	}
+
+	return re
+}
@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func TestRedisForwarder(t *testing.T) {
+	srv := miniredis.RunT(t)
+	srv.RequireAuth("redis-password")
+
+	fwd, err := NewRedisForwarder(logr.Discard(), config.RedisLogging{
+		Enabled:     true,
+		Address:     srv.Addr(),
+		Password:    "redis-password",
+		KeyTemplate: "logs:{{ .LogKey }}",
+		TTL:         time.Hour,
+	})
+	require.NoError(t, err)
+
+	log := zapr.NewLogger(zap.New(fwd.Core())).WithName("buildkit")
+	buildLog := log.WithValues("logKey", "build-1")
+	buildLog.Info("Leasing buildkit worker")
+	buildLog.Info("building", "stream", "stderr", "time", "2024-05-01T12:00:00Z", "time_nano", "1714564800000000000")
+	buildLog.V(1).Info("below the forwarded level")
+	log.Info("Not part of any build")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, fwd.Start(ctx), "buffered events are written on shutdown")
+
+	assert.Equal(t, []string{"logs:build-1"}, srv.Keys())
+	assert.Equal(t, time.Hour, srv.TTL("logs:build-1"))
+
+	entries, err := srv.List("logs:build-1")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	var first, second redisEvent
+	require.NoError(t, json.Unmarshal([]byte(entries[0]), &first))
+	require.NoError(t, json.Unmarshal([]byte(entries[1]), &second))
+
+	assert.Equal(t, "Leasing buildkit worker", first.Log)
+	assert.Equal(t, "build-1", first.LogKey)
+	assert.Equal(t, "stdout", first.Stream)
+	assert.Equal(t, "buildkit", first.Event["logger"])
+	assert.NotEmpty(t, first.Time)
+	assert.NotEmpty(t, first.TimeNano)
+
+	assert.Equal(t, "building", second.Log)
+	assert.Equal(t, "stderr", second.Stream)
+	assert.Equal(t, "2024-05-01T12:00:00Z", second.Time)
+	assert.Equal(t, "1714564800000000000", second.TimeNano)
+}
+
+func TestRedisForwarderWithoutTTL(t *testing.T) {
+	srv := miniredis.RunT(t)
+
+	fwd, err := NewRedisForwarder(logr.Discard(), config.RedisLogging{Enabled: true, Address: srv.Addr()})
+	require.NoError(t, err)
+
+	zapr.NewLogger(zap.New(fwd.Core())).Info("Build complete", "logKey", "build-2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, fwd.Start(ctx))
+
+	assert.Equal(t, []string{"build-2"}, srv.Keys())
+	assert.Zero(t, srv.TTL("build-2"))
+
+	_, err = NewRedisForwarder(logr.Discard(), config.RedisLogging{Address: srv.Addr(), KeyTemplate: "{{ .LogKey"})
+	assert.Error(t, err)
+}
+
+func TestRedisForwarderLimits(t *testing.T) {
+	srv := miniredis.RunT(t)
+
+	fwd, err := NewRedisForwarder(logr.Discard(), config.RedisLogging{
+		Enabled:       true,
+		Address:       srv.Addr(),
+		MaxEntries:    3,
+		MaxEntryBytes: 7,
+	})
+	require.NoError(t, err)
+
+	log := zapr.NewLogger(zap.New(fwd.Core())).WithValues("logKey", "looping")
+	for i := 0; i < 10; i++ {
+		log.Info(fmt.Sprintf("line %d", i))
+	}
+	log.Info("ünïcödé output")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, fwd.Start(ctx))
+
+	entries, err := srv.List("looping")
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "only the most recent entries are kept")
+
+	var messages []string
+	for _, entry := range entries {
+		var event redisEvent
+		require.NoError(t, json.Unmarshal([]byte(entry), &event))
+		messages = append(messages, event.Log)
+	}
+	assert.Equal(t, []string{"line 8", "line 9", "ünïc"}, messages)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "output", truncate("output", 0))
+	assert.Equal(t, "output", truncate("output", 6))
+	assert.Equal(t, "out", truncate("output", 3))
+	assert.Equal(t, "a", truncate("aé", 2), "multi-byte runes are not split")
+}
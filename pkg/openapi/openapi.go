@@ -0,0 +1,191 @@
+// Package openapi builds the OpenAPI v3 document of the Hephaestus API without access to a Kubernetes cluster.
+//
+// Routes are derived from the structural schemas of the embedded CRDs the same way the API server does when they are
+// installed, whereas the models are replaced with the richer definitions generated from the API types so that client
+// generators produce named types for nested objects.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"k8s.io/apiextensions-apiserver/pkg/controller/openapi/builder"
+	apiextensionsopenapi "k8s.io/apiextensions-apiserver/pkg/generated/openapi"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/spec3"
+	"k8s.io/kube-openapi/pkg/util"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/crd"
+)
+
+const (
+	apiPackage   = "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	apiGroupName = "com.dominodatalab.hephaestus.v1"
+	quantityType = "k8s.io/apimachinery/pkg/api/resource.Quantity"
+)
+
+// compactNames shortens schema names, project types become ".<Type>" and apimachinery types become "v1.<Type>" or
+// "resource.<Type>".
+var compactNames = strings.NewReplacer(
+	apiGroupName, "",
+	"io.k8s.apimachinery.pkg.apis.meta.", "",
+	"io.k8s.apimachinery.pkg.api.", "",
+)
+
+// BuildV3 returns the OpenAPI v3 document for every served version of the project CRDs.
+func BuildV3(version string) (*spec3.OpenAPI, error) {
+	definitions, err := crd.Definitions()
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []*spec3.OpenAPI
+	for _, def := range definitions {
+		for _, v := range def.Spec.Versions {
+			if !v.Served {
+				continue
+			}
+
+			doc, err := builder.BuildOpenAPIV3(def, v.Name, builder.Options{})
+			if err != nil {
+				return nil, fmt.Errorf("cannot build OpenAPI document for %s/%s: %w", def.Name, v.Name, err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+
+	doc, err := builder.MergeSpecsV3(docs...)
+	if err != nil {
+		return nil, err
+	}
+
+	addModels(doc)
+	modifyRoutes(doc)
+	doc.Info = info(version)
+
+	return compact(doc)
+}
+
+// addModels replaces the project schemas with the generated definitions and adds every model they depend upon.
+func addModels(doc *spec3.OpenAPI) {
+	ref := func(path string) spec.Ref {
+		return spec.MustCreateRef("#/components/schemas/" + common.EscapeJsonPointer(schemaName(path)))
+	}
+
+	models := apiextensionsopenapi.GetOpenAPIDefinitions(ref)
+	models[quantityType] = quantityDefinition()
+	projectModels := hephv1.GetOpenAPIDefinitions(ref)
+	maps.Copy(models, projectModels)
+
+	var add func(name string)
+	add = func(name string) {
+		model, ok := models[name]
+		if !ok {
+			return
+		}
+		if _, exists := doc.Components.Schemas[schemaName(name)]; exists && !strings.HasPrefix(name, apiPackage) {
+			return
+		}
+
+		schema := model.Schema
+		doc.Components.Schemas[schemaName(name)] = &schema
+		for _, dep := range model.Dependencies {
+			add(dep)
+		}
+	}
+	for name := range projectModels {
+		add(name)
+	}
+}
+
+// quantityDefinition describes resource.Quantity, which provides its schema through methods rather than a generated
+// definition.
+func quantityDefinition() common.OpenAPIDefinition {
+	var oneOf []spec.Schema
+	for _, t := range (resource.Quantity{}).OpenAPIV3OneOfTypes() {
+		oneOf = append(oneOf, spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{t}}})
+	}
+
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Quantity is a fixed-point representation of a number, e.g. \"1Gi\" or \"1500m\".",
+				OneOf:       oneOf,
+			},
+		},
+	}
+}
+
+// modifyRoutes groups operations into services and simplifies their IDs.
+func modifyRoutes(doc *spec3.OpenAPI) {
+	for name, path := range doc.Paths.Paths {
+		var tags []string
+		switch {
+		case strings.Contains(name, "imagebuildmessages"):
+			tags = []string{"ImageBuildMessageService"}
+		case strings.Contains(name, "imagebuilds"):
+			tags = []string{"ImageBuildService"}
+		case strings.Contains(name, "imagecaches"):
+			tags = []string{"ImageCacheService"}
+		}
+
+		for _, op := range []*spec3.Operation{path.Get, path.Put, path.Post, path.Delete, path.Patch} {
+			if op == nil {
+				continue
+			}
+
+			op.Tags = tags
+			op.OperationId = strings.ReplaceAll(op.OperationId, "HephaestusDominodatalabComV1", "")
+		}
+	}
+}
+
+func info(version string) *spec.Info {
+	return &spec.Info{
+		InfoProps: spec.InfoProps{
+			Title:          "Hephaestus Kubernetes SDK",
+			Description:    "Client APIs and models",
+			TermsOfService: "https://www.dominodatalab.com/terms",
+			Contact: &spec.ContactInfo{
+				Name:  "Domino Data Lab, Inc.",
+				URL:   "https://www.dominodatalab.com/",
+				Email: "support@dominodatalab.com",
+			},
+			License: &spec.License{
+				Name: "Apache 2.0",
+				URL:  "https://www.apache.org/licenses/LICENSE-2.0",
+			},
+			Version: version,
+		},
+	}
+}
+
+// compact rewrites every schema name and reference using compactNames.
+func compact(doc *spec3.OpenAPI) (*spec3.OpenAPI, error) {
+	bs, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	bs = []byte(compactNames.Replace(string(bs)))
+
+	out := &spec3.OpenAPI{}
+	if err = json.Unmarshal(bs, out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// schemaName converts a Go type path into the schema name used by the API server.
+func schemaName(path string) string {
+	if name, ok := strings.CutPrefix(path, apiPackage+"."); ok {
+		return apiGroupName + "." + name
+	}
+
+	return util.ToRESTFriendlyName(path)
+}
@@ -0,0 +1,40 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildV3(t *testing.T) {
+	doc, err := BuildV3("1.2.3")
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.2.3", doc.Info.Version)
+
+	path, ok := doc.Paths.Paths["/apis/hephaestus.dominodatalab.com/v1/namespaces/{namespace}/imagebuilds/{name}"]
+	require.True(t, ok, "imagebuild route is missing")
+	require.NotNil(t, path.Get)
+	assert.Equal(t, []string{"ImageBuildService"}, path.Get.Tags)
+	assert.Equal(t, "readNamespacedImageBuild", path.Get.OperationId)
+	assert.Equal(t, "#/components/schemas/.ImageBuild",
+		path.Get.Responses.StatusCodeResponses[200].Content["application/json"].Schema.Ref.String())
+
+	for _, name := range []string{
+		".ImageBuild", ".ImageBuildSpec", ".ImageBuildStatus", ".ImageCache", ".ClusterImageCache",
+		"v1.ObjectMeta", "v1.Condition", "v1.Duration", "resource.Quantity",
+	} {
+		assert.Contains(t, doc.Components.Schemas, name)
+	}
+
+	// every reference must resolve to a schema in the document
+	bs, err := json.Marshal(doc)
+	require.NoError(t, err)
+	for _, ref := range strings.Split(string(bs), `"$ref":"`)[1:] {
+		name := strings.TrimPrefix(ref[:strings.Index(ref, `"`)], "#/components/schemas/")
+		assert.Contains(t, doc.Components.Schemas, name)
+	}
+}
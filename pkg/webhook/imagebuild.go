@@ -0,0 +1,391 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/distribution/reference"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+var imagebuildlog = logf.Log.WithName("webhook").WithName("imagebuild")
+
+// secretLookupTimeout bounds the API lookups of secrets and quota usage during admission.
+var secretLookupTimeout = 5 * time.Second
+
+// ImageBuildConfig holds the admission policies of ImageBuilds, the zero value only rejects malformed specs.
+type ImageBuildConfig struct {
+	// SecretReader enables admission checks of referenced secrets. It returns the reader used for the builds of a
+	// namespace, so installations that impersonate a service account per namespace check secrets with its access.
+	//
+	// These checks are best-effort: missing or inaccessible secrets are rejected, whereas lookup failures only produce
+	// warnings so that an API hiccup does not block builds.
+	SecretReader func(namespace string) (client.Reader, error)
+	// ReadOnlyRegistries are rejected as image destinations.
+	ReadOnlyRegistries []string
+	// KnownRegistries produce warnings about images pushed to any other registry. Such builds are still admitted, no
+	// warnings are returned when the list is empty.
+	KnownRegistries []string
+	// QuotaReader enables build quotas: new builds are rejected with a 429 status while the BuildQuotaUsage of their
+	// namespace shows an exhausted Quota. Lookup failures only produce warnings.
+	QuotaReader client.Reader
+	Quota       BuildQuota
+	// SpecLimits reject specs whose images, build args or registry auth exceed the limits.
+	SpecLimits SpecLimits
+}
+
+// SpecLimits caps the lists of ImageBuild specs so pathological specs cannot overwhelm buildkit or status message
+// consumers.
+type SpecLimits struct {
+	Images       ListLimit
+	BuildArgs    ListLimit
+	RegistryAuth ListLimit
+}
+
+// ListLimit caps the number of items in a list and their total size, limits are disabled when zero.
+type ListLimit struct {
+	MaxItems int
+	MaxBytes int
+}
+
+// BuildQuota limits the ImageBuilds a namespace may submit within a window.
+type BuildQuota struct {
+	// Window over which the usage recorded in a BuildQuotaUsage is counted.
+	Window time.Duration
+	// MaxBuilds submitted during the window, unlimited when zero.
+	MaxBuilds int64
+	// MaxPushedBytes of compressed images pushed during the window, unlimited when zero.
+	MaxPushedBytes int64
+}
+
+// ImageBuildDefaulter stamps ImageBuilds with the identity of the user that created them.
+//
+// The identity is taken from the admission request on create and carried over from the existing object on update so
+// that it cannot be altered after the fact. New ImageBuilds also receive a generated log key, normalized image
+// references and, when configured, cache import references rendered from a template.
+type ImageBuildDefaulter struct {
+	cacheImport *template.Template
+}
+
+// CacheImportData is passed to the cache import template once for every image.
+type CacheImportData struct {
+	// Image is the normalized image reference, e.g. "registry.example.com/team/app:v1".
+	Image string
+	// Repository is the image reference without its tag or digest, e.g. "registry.example.com/team/app".
+	Repository string
+	// Tag of the image, blank for digest references.
+	Tag string
+	// Namespace of the ImageBuild.
+	Namespace string
+}
+
+// NewImageBuildDefaulter returns a defaulter that renders cache import references for ImageBuilds that do not
+// specify any using the cacheImportTemplate, e.g. "{{ .Repository }}:buildcache". No cache imports are defaulted when
+// the template is blank.
+func NewImageBuildDefaulter(cacheImportTemplate string) (*ImageBuildDefaulter, error) {
+	d := &ImageBuildDefaulter{}
+	if cacheImportTemplate == "" {
+		return d, nil
+	}
+
+	tmpl, err := template.New("cacheImport").Option("missingkey=error").Parse(cacheImportTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache import template: %w", err)
+	}
+	d.cacheImport = tmpl
+
+	return d, nil
+}
+
+var _ admission.CustomDefaulter = &ImageBuildDefaulter{}
+
+func (d *ImageBuildDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	ib, ok := obj.(*hephv1.ImageBuild)
+	if !ok {
+		return fmt.Errorf("expected an ImageBuild but got %T", obj)
+	}
+
+	log := imagebuildlog.WithName("defaulter").WithValues("imagebuild", client.ObjectKeyFromObject(ib))
+	log.V(1).Info("Applying default values")
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch req.Operation {
+	case admissionv1.Create:
+		setAnnotation(ib, hephv1.RequestedByAnnotation, req.UserInfo.Username)
+		setAnnotation(ib, hephv1.RequestedByGroupsAnnotation, strings.Join(req.UserInfo.Groups, ","))
+
+		if strings.TrimSpace(ib.Spec.LogKey) == "" {
+			ib.Spec.LogKey = string(uuid.NewUUID())
+		}
+		for i, image := range ib.Spec.Images {
+			ib.Spec.Images[i] = normalizeImage(image)
+		}
+		if len(ib.Spec.ImportRemoteBuildCache) == 0 && d.cacheImport != nil {
+			refs, err := d.renderCacheImports(ib)
+			if err != nil {
+				return err
+			}
+			ib.Spec.ImportRemoteBuildCache = refs
+		}
+	case admissionv1.Update:
+		old := &hephv1.ImageBuild{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return fmt.Errorf("cannot decode previous ImageBuild: %w", err)
+		}
+
+		setAnnotation(ib, hephv1.RequestedByAnnotation, old.Annotations[hephv1.RequestedByAnnotation])
+		setAnnotation(ib, hephv1.RequestedByGroupsAnnotation, old.Annotations[hephv1.RequestedByGroupsAnnotation])
+	}
+
+	log.V(1).Info("Recorded requesting user", "username", ib.Annotations[hephv1.RequestedByAnnotation])
+
+	return nil
+}
+
+// renderCacheImports renders the cache import template for every image, dropping duplicates and blank results.
+func (d *ImageBuildDefaulter) renderCacheImports(ib *hephv1.ImageBuild) ([]string, error) {
+	var refs []string
+	for _, image := range ib.Spec.Images {
+		repo, suffix := splitImage(image)
+		tag, _, _ := strings.Cut(strings.TrimPrefix(suffix, ":"), "@")
+		if strings.HasPrefix(suffix, "@") {
+			tag = ""
+		}
+		data := CacheImportData{Image: image, Repository: repo, Tag: tag, Namespace: ib.Namespace}
+
+		var buf bytes.Buffer
+		if err := d.cacheImport.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("cannot render cache import for image %q: %w", image, err)
+		}
+
+		if ref := strings.TrimSpace(buf.String()); ref != "" && !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs, nil
+}
+
+// normalizeImage lowercases the repository of an image reference and adds the "latest" tag when it has neither a tag
+// nor a digest. References that cannot be parsed are returned unchanged so that validation can reject them.
+func normalizeImage(image string) string {
+	image = strings.TrimSpace(image)
+	repo, suffix := splitImage(image)
+
+	normalized := strings.ToLower(repo) + suffix
+	if _, err := reference.ParseNormalizedNamed(normalized); err != nil {
+		return image
+	}
+	if suffix == "" {
+		normalized += ":latest"
+	}
+
+	return normalized
+}
+
+// splitImage separates the repository of an image reference from its ":tag" and/or "@digest" suffix.
+func splitImage(image string) (repo, suffix string) {
+	repo = image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo, suffix = repo[:i], repo[i:]
+	}
+	// a colon after the last slash introduces the tag, earlier ones belong to a registry port
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, suffix = repo[:i], repo[i:]+suffix
+	}
+
+	return repo, suffix
+}
+
+// setAnnotation sets the annotation to value, removing it entirely when the value is blank.
+func setAnnotation(ib *hephv1.ImageBuild, key, value string) {
+	if value == "" {
+		delete(ib.Annotations, key)
+		return
+	}
+
+	if ib.Annotations == nil {
+		ib.Annotations = map[string]string{}
+	}
+	ib.Annotations[key] = value
+}
+
+// ImageBuildValidator admits ImageBuilds according to the policies of its config.
+type ImageBuildValidator struct {
+	cfg ImageBuildConfig
+}
+
+// NewImageBuildValidator returns a validator enforcing the policies of the config.
+func NewImageBuildValidator(cfg ImageBuildConfig) *ImageBuildValidator {
+	return &ImageBuildValidator{cfg: cfg}
+}
+
+var _ admission.CustomValidator = &ImageBuildValidator{}
+
+func (v *ImageBuildValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return v.validateImageBuild(ctx, nil, obj, "create")
+}
+
+func (v *ImageBuildValidator) ValidateUpdate(ctx context.Context, oldObj, obj runtime.Object) (admission.Warnings, error) {
+	// builds being deleted only have their finalizers removed, which must never be blocked by a stale spec
+	if in, ok := obj.(*hephv1.ImageBuild); ok && in.DeletionTimestamp != nil {
+		return admission.Warnings{}, nil
+	}
+
+	return v.validateImageBuild(ctx, oldObj, obj, "update")
+}
+
+func (v *ImageBuildValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return admission.Warnings{}, nil
+}
+
+func (v *ImageBuildValidator) validateImageBuild(
+	ctx context.Context,
+	oldObj, obj runtime.Object,
+	action string,
+) (admission.Warnings, error) {
+	in, ok := obj.(*hephv1.ImageBuild)
+	if !ok {
+		return nil, fmt.Errorf("expected an ImageBuild but got %T", obj)
+	}
+	// referenced secrets may be deleted once a build is done, so they are only looked up again when the spec changes
+	old, ok := oldObj.(*hephv1.ImageBuild)
+	specChanged := !ok || !equality.Semantic.DeepEqual(old.Spec, in.Spec)
+
+	log := imagebuildlog.WithName("validator").WithName(action).WithValues("imagebuild", client.ObjectKeyFromObject(in))
+	log.V(1).Info("Starting validation")
+
+	var errList field.ErrorList
+	fp := field.NewPath("spec")
+
+	if strings.TrimSpace(in.Spec.Context) == "" && strings.TrimSpace(in.Spec.DockerfileContents) == "" {
+		log.V(1).Info("Context and DockerfileContents are both blank")
+		errList = append(errList, field.Required(fp.Child("context"), "must not be blank if "+
+			fp.Child("dockerfileContents").String()+" is blank"))
+	}
+
+	if strings.TrimSpace(in.Spec.Context) != "" {
+		if _, err := url.ParseRequestURI(in.Spec.Context); err != nil {
+			log.V(1).Info("Context is not a valid URL")
+			errList = append(errList, field.Invalid(fp.Child("context"), in.Spec.Context, err.Error()))
+		}
+	}
+
+	if errs := validateImages(log, fp.Child("images"), in.Spec.Images); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateImageDestinations(log, fp.Child("images"), in.Spec.Images, v.cfg.ReadOnlyRegistries); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	builderEnvArgs := []string{hephv1.BuildNameArg, hephv1.BuildNamespaceArg, hephv1.RequestedByArg}
+	for idx, arg := range in.Spec.BuildArgs {
+		ss := strings.SplitN(arg, "=", 2)
+		if len(ss) != 2 || strings.TrimSpace(ss[0]) == "" {
+			log.V(1).Info("Build arg is invalid", "arg", arg)
+			errList = append(errList, field.Invalid(
+				fp.Child("buildArgs").Index(idx), arg, "must use a <key>=<value> format",
+			))
+			continue
+		}
+
+		if in.Spec.BuilderEnv && slices.Contains(builderEnvArgs, ss[0]) {
+			log.V(1).Info("Build arg is reserved by builderEnv", "arg", ss[0])
+			errList = append(errList, field.Forbidden(
+				fp.Child("buildArgs").Index(idx), fmt.Sprintf("%s is set by %s", ss[0], fp.Child("builderEnv")),
+			))
+		}
+	}
+
+	if errs := validateMetadataKeys(log, fp.Child("imageLabels"), in.Spec.ImageLabels); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateMetadataKeys(log, fp.Child("imageAnnotations"), in.Spec.ImageAnnotations); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateExpectedDigest(log, fp, in.Spec); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateContextSubPath(log, fp, in.Spec); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateIgnorePatterns(log, fp.Child("ignorePatterns"), in.Spec.IgnorePatterns); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validatePlatforms(log, fp.Child("platforms"), in.Spec.Platforms); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateBuilderName(log, fp.Child("builderName"), in.Spec.BuilderName); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateRegistryAuth(log, fp.Child("registryAuth"), in.Namespace, in.Spec.RegistryAuth); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateSecrets(log, fp.Child("secrets"), in.Spec.Secrets); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	if errs := validateSpecLimits(log, fp, in.Spec, v.cfg.SpecLimits); errs != nil {
+		errList = append(errList, errs...)
+	}
+
+	warnings := admission.Warnings{}
+	if v.cfg.SecretReader != nil && specChanged {
+		ctx, cancel := context.WithTimeout(ctx, secretLookupTimeout)
+		defer cancel()
+
+		if reader, err := v.cfg.SecretReader(in.Namespace); err != nil {
+			log.V(1).Info("Unable to create secret reader", "error", err)
+			warnings = append(warnings, fmt.Sprintf("%s: unable to verify secrets: %s", fp, err))
+		} else {
+			errs, warns := validateSecretReferences(ctx, log, reader, fp, in.Spec)
+			errList = append(errList, errs...)
+			warnings = append(warnings, warns...)
+		}
+	}
+
+	warnings = append(warnings, imageBuildWarnings(log, fp, in.Spec, v.cfg.KnownRegistries)...)
+
+	// quotas only apply to new builds that are otherwise valid
+	if action == "create" && v.cfg.QuotaReader != nil && len(errList) == 0 {
+		ctx, cancel := context.WithTimeout(ctx, secretLookupTimeout)
+		defer cancel()
+
+		warns, err := checkBuildQuota(ctx, log, v.cfg.QuotaReader, in.Namespace, v.cfg.Quota, time.Now())
+		warnings = append(warnings, warns...)
+		if err != nil {
+			return warnings, err
+		}
+	}
+
+	return warnings, invalidIfNotEmpty(hephv1.ImageBuildKind, in.Name, errList)
+}
@@ -0,0 +1,209 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+const testDigest = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func admissionContext(op admissionv1.Operation, old *hephv1.ImageBuild) context.Context {
+	req := admissionv1.AdmissionRequest{
+		Operation: op,
+		UserInfo: authenticationv1.UserInfo{
+			Username: "jane",
+			Groups:   []string{"system:authenticated", "data-science"},
+		},
+	}
+	if old != nil {
+		raw, _ := json.Marshal(old)
+		req.OldObject = runtime.RawExtension{Raw: raw}
+	}
+
+	return admission.NewContextWithRequest(context.Background(), admission.Request{AdmissionRequest: req})
+}
+
+func TestImageBuildDefaulter(t *testing.T) {
+	d := &ImageBuildDefaulter{}
+
+	t.Run("create", func(t *testing.T) {
+		ib := &hephv1.ImageBuild{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "build",
+				Annotations: map[string]string{hephv1.RequestedByAnnotation: "forged", "other": "kept"},
+			},
+		}
+		require.NoError(t, d.Default(admissionContext(admissionv1.Create, nil), ib))
+
+		assert.Equal(t, map[string]string{
+			hephv1.RequestedByAnnotation:       "jane",
+			hephv1.RequestedByGroupsAnnotation: "system:authenticated,data-science",
+			"other":                            "kept",
+		}, ib.Annotations)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		old := &hephv1.ImageBuild{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "build",
+				Annotations: map[string]string{hephv1.RequestedByAnnotation: "john"},
+			},
+		}
+		ib := &hephv1.ImageBuild{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "build",
+				Annotations: map[string]string{hephv1.RequestedByAnnotation: "jane", hephv1.RequestedByGroupsAnnotation: "admins"},
+			},
+		}
+		require.NoError(t, d.Default(admissionContext(admissionv1.Update, old), ib))
+
+		assert.Equal(t, map[string]string{hephv1.RequestedByAnnotation: "john"}, ib.Annotations)
+	})
+
+	t.Run("no_request", func(t *testing.T) {
+		assert.Error(t, d.Default(context.Background(), &hephv1.ImageBuild{}))
+	})
+
+	t.Run("spec", func(t *testing.T) {
+		ib := &hephv1.ImageBuild{
+			Spec: hephv1.ImageBuildSpec{Images: []string{"Registry.example.com:5000/Team/App", "app@sha256:" + testDigest}},
+		}
+		require.NoError(t, d.Default(admissionContext(admissionv1.Create, nil), ib))
+
+		assert.NotEmpty(t, ib.Spec.LogKey)
+		assert.Equal(t, []string{"registry.example.com:5000/team/app:latest", "app@sha256:" + testDigest}, ib.Spec.Images)
+		assert.Empty(t, ib.Spec.ImportRemoteBuildCache)
+
+		ib.Spec.LogKey = "kept"
+		require.NoError(t, d.Default(admissionContext(admissionv1.Create, nil), ib))
+		assert.Equal(t, "kept", ib.Spec.LogKey)
+	})
+
+	t.Run("update_spec", func(t *testing.T) {
+		ib := &hephv1.ImageBuild{Spec: hephv1.ImageBuildSpec{Images: []string{"App"}}}
+		require.NoError(t, d.Default(admissionContext(admissionv1.Update, &hephv1.ImageBuild{}), ib))
+
+		assert.Empty(t, ib.Spec.LogKey)
+		assert.Equal(t, []string{"App"}, ib.Spec.Images)
+	})
+}
+
+func TestImageBuildDefaulterCacheImport(t *testing.T) {
+	d, err := NewImageBuildDefaulter("{{ .Repository }}:cache-{{ .Namespace }}")
+	require.NoError(t, err)
+
+	ib := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns"},
+		Spec:       hephv1.ImageBuildSpec{Images: []string{"registry.example.com/app:v1", "registry.example.com/app:v2"}},
+	}
+	require.NoError(t, d.Default(admissionContext(admissionv1.Create, nil), ib))
+	assert.Equal(t, []string{"registry.example.com/app:cache-ns"}, ib.Spec.ImportRemoteBuildCache)
+
+	ib.Spec.ImportRemoteBuildCache = []string{"registry.example.com/explicit:cache"}
+	require.NoError(t, d.Default(admissionContext(admissionv1.Create, nil), ib))
+	assert.Equal(t, []string{"registry.example.com/explicit:cache"}, ib.Spec.ImportRemoteBuildCache)
+
+	_, err = NewImageBuildDefaulter("{{ .Repository ")
+	assert.Error(t, err)
+
+	d, err = NewImageBuildDefaulter("{{ .Unknown }}")
+	require.NoError(t, err)
+	assert.Error(t, d.Default(admissionContext(admissionv1.Create, nil), &hephv1.ImageBuild{Spec: hephv1.ImageBuildSpec{Images: []string{"app"}}}))
+}
+
+func TestNormalizeImage(t *testing.T) {
+	for image, expected := range map[string]string{
+		"app":                     "app:latest",
+		"App:V1":                  "app:V1",
+		"localhost:5000/Team/App": "localhost:5000/team/app:latest",
+		"registry.example.com/app:v1@sha256:" + testDigest: "registry.example.com/app:v1@sha256:" + testDigest,
+		"not a valid ref": "not a valid ref",
+	} {
+		assert.Equal(t, expected, normalizeImage(image), image)
+	}
+}
+
+func TestImageBuildValidator_Registries(t *testing.T) {
+	ib := &hephv1.ImageBuild{Spec: hephv1.ImageBuildSpec{
+		Context: "https://artifacts.example.com/ctx.tgz",
+		Images:  []string{"mirror.example.com/app:v1"},
+		LogKey:  "app-build",
+	}}
+
+	warnings, err := NewImageBuildValidator(ImageBuildConfig{}).ValidateCreate(context.Background(), ib)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	v := NewImageBuildValidator(ImageBuildConfig{KnownRegistries: []string{"registry.example.com"}})
+	warnings, err = v.ValidateCreate(context.Background(), ib)
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1, "pushes to unknown registries are admitted with a warning")
+
+	v = NewImageBuildValidator(ImageBuildConfig{ReadOnlyRegistries: []string{"mirror.example.com"}})
+	_, err = v.ValidateCreate(context.Background(), ib)
+	assert.ErrorContains(t, err, "mirror.example.com")
+
+	dockerHub := ib.DeepCopy()
+	dockerHub.Spec.Images = []string{"app:v1"}
+	for _, registry := range []string{"docker.io", "index.docker.io"} {
+		v = NewImageBuildValidator(ImageBuildConfig{ReadOnlyRegistries: []string{registry}})
+		_, err = v.ValidateCreate(context.Background(), dockerHub)
+		assert.ErrorContains(t, err, "is read-only", "registry %s", registry)
+	}
+
+	_, err = v.ValidateCreate(context.Background(), &hephv1.ImageCache{})
+	assert.ErrorContains(t, err, "expected an ImageBuild")
+}
+
+func TestImageBuildValidator_UpdateAfterSecretDeleted(t *testing.T) {
+	old := &hephv1.ImageBuild{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "app",
+			Namespace:  "ns",
+			Finalizers: []string{hephv1.ImageCleanupFinalizer},
+		},
+		Spec: hephv1.ImageBuildSpec{
+			Context: "https://artifacts.example.com/ctx.tgz",
+			Images:  []string{"registry.example.com/app:v1"},
+			LogKey:  "app-build",
+			Secrets: []hephv1.SecretReference{{Namespace: "ns", Name: "deleted"}},
+		},
+	}
+	reader := fake.NewClientBuilder().Build()
+	v := NewImageBuildValidator(ImageBuildConfig{
+		SecretReader: func(string) (client.Reader, error) { return reader, nil },
+	})
+
+	labeled := old.DeepCopy()
+	labeled.Labels = map[string]string{"team": "data-science"}
+	warnings, err := v.ValidateUpdate(context.Background(), old, labeled)
+	require.NoError(t, err, "metadata-only updates skip secret lookups")
+	assert.Empty(t, warnings)
+
+	deleting := old.DeepCopy()
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	removed := deleting.DeepCopy()
+	removed.Finalizers = nil
+	removed.Spec.Images = nil
+	_, err = v.ValidateUpdate(context.Background(), deleting, removed)
+	require.NoError(t, err, "builds being deleted are always admitted")
+
+	changed := old.DeepCopy()
+	changed.Spec.Images = []string{"registry.example.com/app:v2"}
+	_, err = v.ValidateUpdate(context.Background(), old, changed)
+	assert.ErrorContains(t, err, "ns/deleted")
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+var (
+	imagecachelog        = logf.Log.WithName("webhook").WithName("imagecache")
+	clusterimagecachelog = logf.Log.WithName("webhook").WithName("clusterimagecache")
+)
+
+// ImageCacheValidator admits ImageCaches and ClusterImageCaches.
+type ImageCacheValidator struct{}
+
+var _ admission.CustomValidator = &ImageCacheValidator{}
+
+func (v *ImageCacheValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return v.validateImageCache(obj, "create")
+}
+
+func (v *ImageCacheValidator) ValidateUpdate(_ context.Context, _, obj runtime.Object) (admission.Warnings, error) {
+	return v.validateImageCache(obj, "update")
+}
+
+func (v *ImageCacheValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return admission.Warnings{}, nil
+}
+
+func (v *ImageCacheValidator) validateImageCache(obj runtime.Object, action string) (admission.Warnings, error) {
+	var (
+		kind string
+		spec hephv1.ImageCacheSpec
+	)
+	log := imagecachelog
+	switch in := obj.(type) {
+	case *hephv1.ImageCache:
+		kind, spec = hephv1.ImageCacheKind, in.Spec
+		log = log.WithName("validator").WithName(action).WithValues("imagecache", client.ObjectKeyFromObject(in))
+	case *hephv1.ClusterImageCache:
+		kind, spec = hephv1.ClusterImageCacheKind, in.Spec
+		log = clusterimagecachelog.WithName("validator").WithName(action).
+			WithValues("clusterimagecache", client.ObjectKeyFromObject(in))
+	default:
+		return nil, fmt.Errorf("expected an ImageCache or ClusterImageCache but got %T", obj)
+	}
+	log.Info("Starting validation")
+
+	errList := validateImageCacheSpec(log, field.NewPath("spec"), obj.(client.Object).GetNamespace(), spec)
+
+	return admission.Warnings{}, invalidIfNotEmpty(kind, obj.(client.Object).GetName(), errList)
+}
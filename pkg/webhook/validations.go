@@ -0,0 +1,516 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/containerd/platforms"
+	"github.com/distribution/reference"
+	"github.com/go-logr/logr"
+	"github.com/moby/patternmatcher"
+	"github.com/opencontainers/go-digest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	"github.com/dominodatalab/hephaestus/pkg/config"
+)
+
+func validateImages(log logr.Logger, fp *field.Path, images []string) (errs field.ErrorList) {
+	if len(images) == 0 {
+		log.V(1).Info("No images provided")
+		errs = append(errs, field.Required(fp, "must contain at least 1 image"))
+
+		return
+	}
+
+	for _, ref := range images {
+		if _, err := reference.ParseAnyReference(ref); err != nil {
+			log.V(1).Info("Image reference failed to parse", "ref", ref)
+			errs = append(errs, field.Invalid(fp, ref, err.Error()))
+		}
+	}
+
+	return
+}
+
+// validateImageDestinations rejects images that resolve to the same reference once normalized, as well as images
+// pushed to read-only registries.
+func validateImageDestinations(
+	log logr.Logger,
+	fp *field.Path,
+	images []string,
+	readOnly []string,
+) (errs field.ErrorList) {
+	seen := make(map[string]bool, len(images))
+	for idx, image := range images {
+		named, err := reference.ParseNormalizedNamed(normalizeImage(image))
+		if err != nil {
+			continue // reported by validateImages
+		}
+
+		normalized := named.String()
+		if seen[normalized] {
+			log.V(1).Info("Image destination is duplicated", "ref", image)
+			errs = append(errs, field.Duplicate(fp.Index(idx), image))
+		}
+		seen[normalized] = true
+
+		domain := config.NormalizeRegistry(reference.Domain(named))
+		for _, registry := range readOnly {
+			if strings.EqualFold(domain, config.NormalizeRegistry(registry)) {
+				log.V(1).Info("Image destination registry is read-only", "ref", image, "registry", registry)
+				errs = append(errs, field.Forbidden(fp.Index(idx), fmt.Sprintf("registry %q is read-only", registry)))
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// validateMetadataKeys ensures image label and annotation keys can be passed through buildkit attributes.
+func validateMetadataKeys(log logr.Logger, fp *field.Path, metadata map[string]string) (errs field.ErrorList) {
+	for key := range metadata {
+		if strings.TrimSpace(key) == "" || strings.ContainsAny(key, " \t\n=") {
+			log.V(1).Info("Image metadata key is invalid", "key", key)
+			errs = append(errs, field.Invalid(fp, key, "keys must not be blank or contain whitespace or '='"))
+		}
+	}
+
+	return
+}
+
+func validateExpectedDigest(log logr.Logger, fp *field.Path, spec hephv1.ImageBuildSpec) (errs field.ErrorList) {
+	if spec.ExpectedDigest == "" {
+		return nil
+	}
+
+	if !spec.SkipIfExists {
+		log.V(1).Info("Expected digest provided without skipIfExists")
+		errs = append(errs, field.Forbidden(fp.Child("expectedDigest"), "requires "+fp.Child("skipIfExists").String()))
+	}
+	if _, err := digest.Parse(spec.ExpectedDigest); err != nil {
+		log.V(1).Info("Expected digest failed to parse", "digest", spec.ExpectedDigest)
+		errs = append(errs, field.Invalid(fp.Child("expectedDigest"), spec.ExpectedDigest, err.Error()))
+	}
+
+	return errs
+}
+
+// validateContextSubPath ensures the sub path is a clean relative path that cannot escape the remote context.
+func validateContextSubPath(log logr.Logger, fp *field.Path, spec hephv1.ImageBuildSpec) (errs field.ErrorList) {
+	subPath := spec.ContextSubPath
+	if subPath == "" {
+		return nil
+	}
+
+	if strings.TrimSpace(spec.Context) == "" {
+		log.V(1).Info("Context sub path provided without context")
+		errs = append(errs, field.Forbidden(fp.Child("contextSubPath"), "requires "+fp.Child("context").String()))
+	}
+	if path.IsAbs(subPath) || path.Clean(subPath) != subPath || subPath == ".." || strings.HasPrefix(subPath, "../") {
+		log.V(1).Info("Context sub path is invalid", "contextSubPath", subPath)
+		errs = append(errs, field.Invalid(
+			fp.Child("contextSubPath"), subPath, "must be a clean relative path inside the context",
+		))
+	}
+
+	return errs
+}
+
+// validatePlatforms ensures every platform can be parsed by buildkit.
+func validatePlatforms(log logr.Logger, fp *field.Path, specs []string) (errs field.ErrorList) {
+	for i, spec := range specs {
+		if _, err := platforms.Parse(spec); err != nil {
+			log.V(1).Info("Platform is invalid", "platform", spec)
+			errs = append(errs, field.Invalid(fp.Index(i), spec, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+// validateBuilderName ensures a pinned worker is a valid pod name.
+func validateBuilderName(log logr.Logger, fp *field.Path, name string) (errs field.ErrorList) {
+	if name == "" {
+		return nil
+	}
+
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		log.V(1).Info("Builder name is invalid", "builderName", name)
+		errs = append(errs, field.Invalid(fp, name, msg))
+	}
+
+	return errs
+}
+
+// validateIgnorePatterns ensures context ignore patterns use valid .dockerignore syntax.
+func validateIgnorePatterns(log logr.Logger, fp *field.Path, patterns []string) (errs field.ErrorList) {
+	for idx, pattern := range patterns {
+		if _, err := patternmatcher.New([]string{pattern}); err != nil || strings.TrimSpace(pattern) == "" {
+			log.V(1).Info("Ignore pattern is invalid", "pattern", pattern)
+			errs = append(errs, field.Invalid(fp.Index(idx), pattern, "must be a non-blank .dockerignore pattern"))
+		}
+	}
+
+	return errs
+}
+
+// validateRegistryAuth validates the registry credentials of a resource in the namespace. Credentials of cluster-scoped
+// resources are validated with a blank namespace.
+func validateRegistryAuth(
+	log logr.Logger,
+	fp *field.Path,
+	namespace string,
+	registryAuth []hephv1.RegistryCredentials,
+) field.ErrorList {
+	var errs field.ErrorList
+
+	for idx, auth := range registryAuth {
+		fp := fp.Index(idx)
+
+		if strings.TrimSpace(auth.Server) == "" {
+			log.V(1).Info("Registry credential server is blank")
+			errs = append(errs, field.Required(fp.Child("server"), "must not be blank"))
+		}
+
+		ba := auth.BasicAuth != nil
+		sa := auth.Secret != nil
+		aa := auth.Artifactory != nil
+
+		if (ba && sa) || (ba && aa) || (sa && aa) {
+			log.V(1).Info("Multiple registry credential sources provided")
+			errs = append(errs, field.Forbidden(fp, "cannot specify more than 1 credential source"))
+
+			continue
+		}
+
+		if auth.Provider != "" {
+			switch {
+			case ba || sa || aa:
+				log.V(1).Info("Registry credential provider combined with another credential source")
+				errs = append(errs, field.Forbidden(fp.Child("provider"), "only applies to cloud provided credentials"))
+			case !slices.Contains(hephv1.CloudProviders, auth.Provider):
+				log.V(1).Info("Registry credential provider is unsupported", "provider", auth.Provider)
+				errs = append(errs, field.NotSupported(fp.Child("provider"), auth.Provider, hephv1.CloudProviders))
+			}
+		}
+
+		switch {
+		case ba:
+			if strings.TrimSpace(auth.BasicAuth.Username) == "" {
+				log.V(1).Info("Registry credential basic auth username is missing")
+				errs = append(errs, field.Required(fp.Child("basicAuth", "username"), "must not be blank"))
+			}
+			if strings.TrimSpace(auth.BasicAuth.Password) == "" {
+				log.V(1).Info("Registry credentials basic auth password is missing")
+				errs = append(errs, field.Required(fp.Child("basicAuth", "password"), "must not be blank"))
+			}
+		case sa:
+			if strings.TrimSpace(auth.Secret.Name) == "" {
+				log.V(1).Info("Registry credentials secret name is missing")
+				errs = append(errs, field.Required(fp.Child("secret", "name"), "must not be blank"))
+			}
+			if strings.TrimSpace(auth.Secret.Namespace) == "" {
+				log.V(1).Info("Registry credentials secret namespace is missing")
+				errs = append(errs, field.Required(fp.Child("secret", "namespace"), "must not be blank"))
+			}
+		case aa:
+			errs = append(errs, validateArtifactoryToken(log, fp.Child("artifactory"), namespace, auth.Artifactory)...)
+		default:
+			log.V(1).Info("No registry credential sources provided")
+		}
+	}
+
+	return errs
+}
+
+func validateSpecLimits(log logr.Logger, fp *field.Path, spec hephv1.ImageBuildSpec, limits SpecLimits) field.ErrorList {
+	var errs field.ErrorList
+
+	stringsSize := func(list []string) (size int) {
+		for _, s := range list {
+			size += len(s)
+		}
+		return size
+	}
+	// credentials are measured the way they are serialized in the ImageBuild
+	authSize := 0
+	if len(spec.RegistryAuth) != 0 && limits.RegistryAuth.MaxBytes > 0 {
+		data, _ := json.Marshal(spec.RegistryAuth)
+		authSize = len(data)
+	}
+
+	errs = append(errs, validateListLimit(log, fp.Child("images"), limits.Images,
+		len(spec.Images), stringsSize(spec.Images))...)
+	errs = append(errs, validateListLimit(log, fp.Child("buildArgs"), limits.BuildArgs,
+		len(spec.BuildArgs), stringsSize(spec.BuildArgs))...)
+	errs = append(errs, validateListLimit(log, fp.Child("registryAuth"), limits.RegistryAuth,
+		len(spec.RegistryAuth), authSize)...)
+
+	return errs
+}
+
+func validateListLimit(log logr.Logger, fp *field.Path, limit ListLimit, items, size int) field.ErrorList {
+	var errs field.ErrorList
+
+	if limit.MaxItems > 0 && items > limit.MaxItems {
+		log.V(1).Info("List has too many items", "field", fp.String(), "items", items, "maxItems", limit.MaxItems)
+		errs = append(errs, field.TooMany(fp, items, limit.MaxItems))
+	}
+	if limit.MaxBytes > 0 && size > limit.MaxBytes {
+		log.V(1).Info("List is too large", "field", fp.String(), "bytes", size, "maxBytes", limit.MaxBytes)
+		errs = append(errs, field.TooLong(fp, size, limit.MaxBytes))
+	}
+
+	return errs
+}
+
+func validateArtifactoryToken(
+	log logr.Logger,
+	fp *field.Path,
+	namespace string,
+	creds *hephv1.ArtifactoryTokenCredentials,
+) field.ErrorList {
+	var errs field.ErrorList
+
+	u, err := url.Parse(creds.TokenEndpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.V(1).Info("Artifactory token endpoint is invalid", "tokenEndpoint", creds.TokenEndpoint)
+		errs = append(errs, field.Invalid(fp.Child("tokenEndpoint"), creds.TokenEndpoint, "must be an http(s) URL"))
+	}
+	if strings.TrimSpace(creds.Subject) == "" {
+		log.V(1).Info("Artifactory token subject is missing")
+		errs = append(errs, field.Required(fp.Child("subject"), "must not be blank"))
+	}
+	if creds.Secret == nil || strings.TrimSpace(creds.Secret.Name) == "" {
+		log.V(1).Info("Artifactory token secret name is missing")
+		errs = append(errs, field.Required(fp.Child("secret", "name"), "must not be blank"))
+	}
+	switch {
+	case creds.Secret == nil || strings.TrimSpace(creds.Secret.Namespace) == "":
+		log.V(1).Info("Artifactory token secret namespace is missing")
+		errs = append(errs, field.Required(fp.Child("secret", "namespace"), "must not be blank"))
+	case namespace != "" && creds.Secret.Namespace != namespace:
+		// the token allows issuing access tokens for the subject, it must not be readable from other namespaces
+		log.V(1).Info("Artifactory token secret is in another namespace", "namespace", creds.Secret.Namespace)
+		errs = append(errs, field.Forbidden(fp.Child("secret", "namespace"),
+			fmt.Sprintf("must be the namespace of the resource %q", namespace)))
+	}
+
+	return errs
+}
+
+func validateImageCacheSpec(
+	log logr.Logger,
+	fp *field.Path,
+	namespace string,
+	spec hephv1.ImageCacheSpec,
+) field.ErrorList {
+	var errs field.ErrorList
+
+	errs = append(errs, validateImages(log, fp.Child("images"), spec.Images)...)
+	errs = append(errs, validateRegistryAuth(log, fp.Child("registryAuth"), namespace, spec.RegistryAuth)...)
+
+	if size := spec.MaxCacheSizeBytes; size != nil && *size <= 0 {
+		log.V(1).Info("Max cache size is invalid", "maxCacheSizeBytes", *size)
+		errs = append(errs, field.Invalid(fp.Child("maxCacheSizeBytes"), *size, "must be greater than 0"))
+	}
+
+	return errs
+}
+
+func validateSecrets(log logr.Logger, fp *field.Path, secrets []hephv1.SecretReference) field.ErrorList {
+	var errs field.ErrorList
+
+	for idx, secret := range secrets {
+		fp := fp.Index(idx)
+
+		if secret.MountPath != "" && strings.Trim(secret.MountPath, "/ ") == "" {
+			log.V(1).Info("Secret mount path is invalid", "mountPath", secret.MountPath)
+			errs = append(errs, field.Invalid(fp.Child("mountPath"), secret.MountPath, "must contain at least 1 path segment"))
+		}
+
+		keys := map[string]bool{}
+		for kidx, key := range secret.Keys {
+			switch {
+			case strings.TrimSpace(key) == "":
+				log.V(1).Info("Secret key is blank")
+				errs = append(errs, field.Required(fp.Child("keys").Index(kidx), "must not be blank"))
+			case keys[key]:
+				log.V(1).Info("Secret key is duplicated", "key", key)
+				errs = append(errs, field.Duplicate(fp.Child("keys").Index(kidx), key))
+			}
+			keys[key] = true
+		}
+	}
+
+	return errs
+}
+
+func validateSecretReferences(
+	ctx context.Context,
+	log logr.Logger,
+	reader client.Reader,
+	fp *field.Path,
+	spec hephv1.ImageBuildSpec,
+) (field.ErrorList, admission.Warnings) {
+	var errs field.ErrorList
+	var warnings admission.Warnings
+
+	lookup := func(fp *field.Path, namespace, name string) *corev1.Secret {
+		secret := &corev1.Secret{}
+		err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret)
+
+		switch {
+		case err == nil:
+			return secret
+		case apierrors.IsNotFound(err):
+			log.V(1).Info("Referenced secret does not exist", "namespace", namespace, "name", name)
+			errs = append(errs, field.NotFound(fp, fmt.Sprintf("%s/%s", namespace, name)))
+		default:
+			log.V(1).Info("Unable to verify referenced secret", "namespace", namespace, "name", name, "error", err)
+			warnings = append(warnings, fmt.Sprintf("%s: unable to verify secret: %s", fp, err))
+		}
+
+		return nil
+	}
+
+	for idx, ref := range spec.Secrets {
+		fp := fp.Child("secrets").Index(idx)
+
+		secret := lookup(fp, ref.Namespace, ref.Name)
+		if secret == nil {
+			continue
+		}
+
+		if secret.Labels[hephv1.AccessLabel] != "true" {
+			log.V(1).Info("Referenced secret is not accessible", "namespace", ref.Namespace, "name", ref.Name)
+			errs = append(errs, field.Forbidden(fp, fmt.Sprintf("secret must be labeled %s=true", hephv1.AccessLabel)))
+		}
+
+		for kidx, key := range ref.Keys {
+			if _, ok := secret.Data[key]; !ok {
+				log.V(1).Info("Referenced secret key does not exist", "key", key)
+				errs = append(errs, field.NotFound(fp.Child("keys").Index(kidx), key))
+			}
+		}
+	}
+
+	for idx, auth := range spec.RegistryAuth {
+		secret, path := auth.Secret, fp.Child("registryAuth").Index(idx).Child("secret")
+		if auth.Artifactory != nil {
+			secret, path = auth.Artifactory.Secret, fp.Child("registryAuth").Index(idx).Child("artifactory", "secret")
+		}
+		if secret == nil || strings.TrimSpace(secret.Name) == "" || strings.TrimSpace(secret.Namespace) == "" {
+			continue
+		}
+
+		lookup(path, secret.Namespace, secret.Name)
+	}
+
+	return errs, warnings
+}
+
+// imageBuildWarnings reports soft issues that do not prevent the build from running, so they are returned as admission
+// warnings instead of errors.
+func imageBuildWarnings(
+	log logr.Logger,
+	fp *field.Path,
+	spec hephv1.ImageBuildSpec,
+	known []string,
+) (warnings admission.Warnings) {
+	if strings.TrimSpace(spec.Context) != "" && strings.TrimSpace(spec.DockerfileContents) != "" {
+		log.V(1).Info("DockerfileContents is ignored because context is set")
+		warnings = append(warnings, fmt.Sprintf("%s: ignored because %s is set",
+			fp.Child("dockerfileContents"), fp.Child("context")))
+	}
+
+	if strings.TrimSpace(spec.LogKey) == "" {
+		log.V(1).Info("LogKey is blank")
+		warnings = append(warnings, fmt.Sprintf("%s: blank log key will preclude post-log processing", fp.Child("logKey")))
+	}
+
+	if len(known) == 0 {
+		return warnings
+	}
+
+	for idx, image := range spec.Images {
+		named, err := reference.ParseNormalizedNamed(normalizeImage(image))
+		if err != nil {
+			continue // reported by validateImages
+		}
+
+		domain := reference.Domain(named)
+		if !slices.ContainsFunc(known, func(registry string) bool {
+			return strings.EqualFold(config.NormalizeRegistry(domain), config.NormalizeRegistry(registry))
+		}) {
+			log.V(1).Info("Image destination registry is not configured", "ref", image, "registry", domain)
+			warnings = append(warnings, fmt.Sprintf("%s: registry %q is not configured, the push may fail",
+				fp.Child("images").Index(idx), domain))
+		}
+	}
+
+	return warnings
+}
+
+// checkBuildQuota rejects new builds with a 429 status while the namespace has exhausted one of its quotas, clients are
+// asked to retry once the current window elapses. Namespaces without a BuildQuotaUsage have not used any quota.
+func checkBuildQuota(
+	ctx context.Context,
+	log logr.Logger,
+	reader client.Reader,
+	namespace string,
+	quota BuildQuota,
+	now time.Time,
+) (admission.Warnings, error) {
+	usage := &hephv1.BuildQuotaUsage{}
+	err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: hephv1.BuildQuotaUsageName}, usage)
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		log.V(1).Info("Unable to verify build quota", "namespace", namespace, "error", err)
+		return admission.Warnings{fmt.Sprintf("unable to verify build quota: %s", err)}, nil
+	}
+
+	current := usage.Status.Current(now, quota.Window)
+
+	var exceeded string
+	switch {
+	case quota.MaxBuilds > 0 && current.Builds >= quota.MaxBuilds:
+		exceeded = fmt.Sprintf("%d builds", quota.MaxBuilds)
+	case quota.MaxPushedBytes > 0 && current.PushedBytes >= quota.MaxPushedBytes:
+		exceeded = fmt.Sprintf("%d pushed bytes", quota.MaxPushedBytes)
+	default:
+		return nil, nil
+	}
+
+	retryAfter := current.WindowStart.Add(quota.Window).Sub(now)
+	log.Info("Build quota exceeded", "namespace", namespace, "quota", exceeded, "retryAfter", retryAfter)
+
+	return nil, apierrors.NewTooManyRequests(
+		fmt.Sprintf("namespace %q exceeded its quota of %s per %s", namespace, exceeded, quota.Window),
+		int(math.Ceil(retryAfter.Seconds())),
+	)
+}
+
+func invalidIfNotEmpty(kind, name string, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(hephv1.SchemeGroupVersion.WithKind(kind).GroupKind(), name, errs)
+}
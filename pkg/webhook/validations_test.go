@@ -0,0 +1,351 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+)
+
+func TestValidateSecretReferences(t *testing.T) {
+	reader := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "accessible", Labels: map[string]string{hephv1.AccessLabel: "true"}},
+			Data:       map[string][]byte{"token": []byte("hello")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "unlabeled"},
+		},
+	).Build()
+
+	for name, tc := range map[string]struct {
+		spec     hephv1.ImageBuildSpec
+		wantErrs int
+	}{
+		"valid": {
+			spec: hephv1.ImageBuildSpec{
+				Secrets:      []hephv1.SecretReference{{Namespace: "ns", Name: "accessible", Keys: []string{"token"}}},
+				RegistryAuth: []hephv1.RegistryCredentials{{Secret: &hephv1.SecretCredentials{Namespace: "ns", Name: "unlabeled"}}},
+			},
+		},
+		"missing secret": {
+			spec:     hephv1.ImageBuildSpec{Secrets: []hephv1.SecretReference{{Namespace: "ns", Name: "missing"}}},
+			wantErrs: 1,
+		},
+		"missing label": {
+			spec:     hephv1.ImageBuildSpec{Secrets: []hephv1.SecretReference{{Namespace: "ns", Name: "unlabeled"}}},
+			wantErrs: 1,
+		},
+		"missing key": {
+			spec:     hephv1.ImageBuildSpec{Secrets: []hephv1.SecretReference{{Namespace: "ns", Name: "accessible", Keys: []string{"nope"}}}},
+			wantErrs: 1,
+		},
+		"missing registry auth secret": {
+			spec: hephv1.ImageBuildSpec{
+				RegistryAuth: []hephv1.RegistryCredentials{{Secret: &hephv1.SecretCredentials{Namespace: "ns", Name: "missing"}}},
+			},
+			wantErrs: 1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			errs, warnings := validateSecretReferences(
+				context.Background(), logr.Discard(), reader, field.NewPath("spec"), tc.spec,
+			)
+			assert.Len(t, errs, tc.wantErrs)
+			assert.Empty(t, warnings)
+		})
+	}
+}
+
+func TestValidateClusterImageCache(t *testing.T) {
+	size := int64(0)
+	cache := &hephv1.ClusterImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "base-images"},
+		Spec:       hephv1.ImageCacheSpec{Images: []string{"python:3.10.1"}},
+	}
+
+	v := &ImageCacheValidator{}
+	_, err := v.ValidateCreate(context.Background(), cache)
+	assert.NoError(t, err)
+
+	cache.Spec.MaxCacheSizeBytes = &size
+	_, err = v.ValidateCreate(context.Background(), cache)
+	assert.Error(t, err)
+
+	cache.Spec = hephv1.ImageCacheSpec{}
+	_, err = v.ValidateUpdate(context.Background(), nil, cache)
+	assert.Error(t, err)
+}
+
+func TestValidateMetadataKeys(t *testing.T) {
+	fp := field.NewPath("spec", "imageLabels")
+
+	errs := validateMetadataKeys(logr.Discard(), fp, map[string]string{
+		"com.example.cost-center":         "ds-42",
+		"org.opencontainers.image.source": "https://github.com/example/repo",
+	})
+	assert.Empty(t, errs)
+
+	errs = validateMetadataKeys(logr.Discard(), fp, map[string]string{" ": "blank", "team name": "ml", "a=b": "c"})
+	assert.Len(t, errs, 3)
+}
+
+func TestValidateExpectedDigest(t *testing.T) {
+	fp := field.NewPath("spec")
+	valid := "sha256:" + strings.Repeat("a", 64)
+
+	assert.Empty(t, validateExpectedDigest(logr.Discard(), fp, hephv1.ImageBuildSpec{}))
+	assert.Empty(t, validateExpectedDigest(logr.Discard(), fp, hephv1.ImageBuildSpec{SkipIfExists: true, ExpectedDigest: valid}))
+
+	errs := validateExpectedDigest(logr.Discard(), fp, hephv1.ImageBuildSpec{ExpectedDigest: valid})
+	assert.Len(t, errs, 1)
+
+	errs = validateExpectedDigest(logr.Discard(), fp, hephv1.ImageBuildSpec{SkipIfExists: true, ExpectedDigest: "sha256:nope"})
+	assert.Len(t, errs, 1)
+}
+
+func TestValidateArtifactoryToken(t *testing.T) {
+	fp := field.NewPath("spec", "registryAuth")
+	valid := hephv1.ArtifactoryTokenCredentials{
+		TokenEndpoint: "https://artifactory.example.com/access/api/v1/tokens",
+		Subject:       "svc-builds",
+		Secret:        &hephv1.SecretCredentials{Name: "artifactory-token", Namespace: "ns"},
+	}
+	auth := func(creds hephv1.ArtifactoryTokenCredentials) []hephv1.RegistryCredentials {
+		return []hephv1.RegistryCredentials{{Server: "artifactory.example.com", Artifactory: &creds}}
+	}
+
+	assert.Empty(t, validateRegistryAuth(logr.Discard(), fp, "ns", auth(valid)))
+	assert.Len(t, validateRegistryAuth(logr.Discard(), fp, "ns", auth(hephv1.ArtifactoryTokenCredentials{})), 4)
+
+	invalid := valid
+	invalid.TokenEndpoint = "artifactory.example.com/access/api/v1/tokens"
+	assert.Len(t, validateRegistryAuth(logr.Discard(), fp, "ns", auth(invalid)), 1)
+
+	otherNamespace := valid
+	otherNamespace.Secret = &hephv1.SecretCredentials{Name: "artifactory-token", Namespace: "other"}
+	assert.Len(t, validateRegistryAuth(logr.Discard(), fp, "ns", auth(otherNamespace)), 1)
+	assert.Empty(t, validateRegistryAuth(logr.Discard(), fp, "", auth(otherNamespace)),
+		"cluster-scoped resources read secrets from any namespace")
+
+	multiple := auth(valid)
+	multiple[0].BasicAuth = &hephv1.BasicAuthCredentials{Username: "u", Password: "p"}
+	assert.Len(t, validateRegistryAuth(logr.Discard(), fp, "ns", multiple), 1)
+}
+
+func TestValidateProvider(t *testing.T) {
+	fp := field.NewPath("spec", "registryAuth")
+
+	assert.Empty(t, validateRegistryAuth(logr.Discard(), fp, "ns", []hephv1.RegistryCredentials{
+		{Server: "123456789012.dkr.ecr.us-west-2.amazonaws.com", Provider: hephv1.CloudProviderECR},
+	}))
+
+	errs := validateRegistryAuth(logr.Discard(), fp, "ns", []hephv1.RegistryCredentials{
+		{Server: "registry.example.com", Provider: "aws"},
+		{
+			Server:    "registry.example.com",
+			Provider:  hephv1.CloudProviderGCP,
+			BasicAuth: &hephv1.BasicAuthCredentials{Username: "u", Password: "p"},
+		},
+	})
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, field.ErrorTypeNotSupported, errs[0].Type)
+		assert.Equal(t, "spec.registryAuth[1].provider", errs[1].Field)
+	}
+}
+
+func TestValidateSpecLimits(t *testing.T) {
+	fp := field.NewPath("spec")
+	spec := hephv1.ImageBuildSpec{
+		Images:       []string{"registry.example.com/app:v1", "registry.example.com/app:latest"},
+		BuildArgs:    []string{"A=1", "B=2"},
+		RegistryAuth: []hephv1.RegistryCredentials{{Server: "registry.example.com"}},
+	}
+
+	assert.Empty(t, validateSpecLimits(logr.Discard(), fp, spec, SpecLimits{}), "limits are disabled when zero")
+	assert.Empty(t, validateSpecLimits(logr.Discard(), fp, spec, SpecLimits{
+		Images:       ListLimit{MaxItems: 2, MaxBytes: 58},
+		BuildArgs:    ListLimit{MaxItems: 2, MaxBytes: 6},
+		RegistryAuth: ListLimit{MaxItems: 1, MaxBytes: 1024},
+	}))
+
+	errs := validateSpecLimits(logr.Discard(), fp, spec, SpecLimits{
+		Images:       ListLimit{MaxItems: 1},
+		BuildArgs:    ListLimit{MaxBytes: 5},
+		RegistryAuth: ListLimit{MaxBytes: 16},
+	})
+	if assert.Len(t, errs, 3) {
+		assert.Equal(t, field.ErrorTypeTooMany, errs[0].Type)
+		assert.Equal(t, "spec.buildArgs", errs[1].Field)
+		assert.Equal(t, field.ErrorTypeTooLong, errs[2].Type)
+	}
+}
+
+func TestValidateBuilderName(t *testing.T) {
+	fp := field.NewPath("spec", "builderName")
+
+	assert.Empty(t, validateBuilderName(logr.Discard(), fp, ""))
+	assert.Empty(t, validateBuilderName(logr.Discard(), fp, "hephaestus-buildkit-3"))
+	assert.Len(t, validateBuilderName(logr.Discard(), fp, "Buildkit_3"), 1)
+}
+
+func TestValidateBuilderEnvArgs(t *testing.T) {
+	ib := &hephv1.ImageBuild{Spec: hephv1.ImageBuildSpec{
+		Context:   "https://artifacts.example.com/ctx.tgz",
+		Images:    []string{"registry.example.com/app:v1"},
+		BuildArgs: []string{"HEPHAESTUS_BUILD_NAME=spoofed"},
+	}}
+
+	v := NewImageBuildValidator(ImageBuildConfig{})
+	_, err := v.ValidateCreate(context.Background(), ib)
+	assert.NoError(t, err, "reserved names are only enforced with builderEnv")
+
+	ib.Spec.BuilderEnv = true
+	_, err = v.ValidateCreate(context.Background(), ib)
+	assert.ErrorContains(t, err, "HEPHAESTUS_BUILD_NAME is set by spec.builderEnv")
+}
+
+func TestValidateIgnorePatterns(t *testing.T) {
+	fp := field.NewPath("spec", "ignorePatterns")
+
+	assert.Empty(t, validateIgnorePatterns(logr.Discard(), fp, []string{"node_modules", "**/*.csv", "!data/keep.csv"}))
+	assert.Len(t, validateIgnorePatterns(logr.Discard(), fp, []string{"[", " ", "ok"}), 2)
+}
+
+func TestValidateContextSubPath(t *testing.T) {
+	fp := field.NewPath("spec")
+	spec := hephv1.ImageBuildSpec{Context: "https://example.com/ctx.tgz"}
+
+	for _, subPath := range []string{"", "app", "services/api", "."} {
+		spec.ContextSubPath = subPath
+		assert.Empty(t, validateContextSubPath(logr.Discard(), fp, spec), subPath)
+	}
+	for _, subPath := range []string{"/app", "..", "../app", "app/../..", "app/", "./app"} {
+		spec.ContextSubPath = subPath
+		assert.Len(t, validateContextSubPath(logr.Discard(), fp, spec), 1, subPath)
+	}
+
+	errs := validateContextSubPath(logr.Discard(), fp, hephv1.ImageBuildSpec{DockerfileContents: "FROM scratch", ContextSubPath: "app"})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "spec.contextSubPath: Forbidden: requires spec.context", errs[0].Error())
+	}
+}
+
+func TestValidatePlatforms(t *testing.T) {
+	fp := field.NewPath("spec", "platforms")
+
+	assert.Empty(t, validatePlatforms(logr.Discard(), fp, []string{"linux/amd64", "linux/arm64/v8", "arm64"}))
+
+	errs := validatePlatforms(logr.Discard(), fp, []string{"linux/arm64", "linux/arm64/v8/extra"})
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "spec.platforms[1]", errs[0].Field)
+	}
+}
+
+func TestImageBuildWarnings(t *testing.T) {
+	fp := field.NewPath("spec")
+	spec := hephv1.ImageBuildSpec{
+		Context: "https://example.com/ctx.tgz",
+		LogKey:  "build-1",
+		Images:  []string{"registry.example.com/app:v1", "Quay.io/team/app:v1", "app:v1", "not a valid ref"},
+	}
+
+	assert.Empty(t, imageBuildWarnings(logr.Discard(), fp, spec, nil), "registries are not checked unless configured")
+	assert.Equal(t, admission.Warnings{
+		`spec.images[2]: registry "docker.io" is not configured, the push may fail`,
+	}, imageBuildWarnings(logr.Discard(), fp, spec, []string{"registry.example.com", "quay.io"}))
+
+	spec = hephv1.ImageBuildSpec{Context: "https://example.com/ctx.tgz", DockerfileContents: "FROM scratch"}
+	assert.Equal(t, admission.Warnings{
+		"spec.dockerfileContents: ignored because spec.context is set",
+		"spec.logKey: blank log key will preclude post-log processing",
+	}, imageBuildWarnings(logr.Discard(), fp, spec, nil))
+}
+
+func TestCheckBuildQuota(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, hephv1.AddToScheme(scheme))
+
+	now := time.Now()
+	usage := &hephv1.BuildQuotaUsage{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "busy", Name: hephv1.BuildQuotaUsageName},
+		Status: hephv1.BuildQuotaUsageStatus{
+			WindowStart: metav1.NewTime(now.Add(-30 * time.Minute)),
+			Builds:      10,
+			PushedBytes: 512,
+		},
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(usage).Build()
+
+	check := func(namespace string, quota BuildQuota) error {
+		warnings, err := checkBuildQuota(context.Background(), logr.Discard(), reader, namespace, quota, now)
+		assert.Empty(t, warnings)
+		return err
+	}
+
+	assert.NoError(t, check("idle", BuildQuota{Window: time.Hour, MaxBuilds: 1}), "namespaces without usage")
+	assert.NoError(t, check("busy", BuildQuota{Window: time.Hour, MaxBuilds: 11, MaxPushedBytes: 1024}))
+	assert.NoError(t, check("busy", BuildQuota{Window: 20 * time.Minute, MaxBuilds: 10}), "elapsed window")
+
+	err := check("busy", BuildQuota{Window: time.Hour, MaxBuilds: 10})
+	require.Error(t, err)
+	assert.True(t, apierrors.IsTooManyRequests(err))
+	assert.Contains(t, err.Error(), `namespace "busy" exceeded its quota of 10 builds per 1h0m0s`)
+	delay, ok := apierrors.SuggestsClientDelay(err)
+	assert.True(t, ok)
+	assert.Equal(t, 1800, delay)
+
+	err = check("busy", BuildQuota{Window: time.Hour, MaxPushedBytes: 512})
+	assert.True(t, apierrors.IsTooManyRequests(err))
+	assert.Contains(t, err.Error(), "512 pushed bytes")
+}
+
+func TestValidateImageDestinations(t *testing.T) {
+	fp := field.NewPath("spec", "images")
+	readOnly := []string{"mirror.example.com", "docker.io"}
+
+	for name, tc := range map[string]struct {
+		images   []string
+		wantErrs []string
+	}{
+		"valid": {
+			images: []string{"registry.example.com/app:v1", "registry.example.com/app:v2"},
+		},
+		"duplicate": {
+			images:   []string{"registry.example.com/app:v1", "registry.example.com/app:v1"},
+			wantErrs: []string{"spec.images[1]: Duplicate value"},
+		},
+		"duplicate_after_normalization": {
+			images:   []string{"registry.example.com/App", "registry.example.com/app:latest"},
+			wantErrs: []string{"spec.images[1]: Duplicate value"},
+		},
+		"read_only": {
+			images:   []string{"Mirror.example.com/app:v1", "app:v1"},
+			wantErrs: []string{`spec.images[0]: Forbidden: registry "mirror.example.com"`, `spec.images[1]: Forbidden: registry "docker.io"`},
+		},
+		"unparseable": {
+			images: []string{"not a valid ref"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			errs := validateImageDestinations(logr.Discard(), fp, tc.images, readOnly)
+			assert.Len(t, errs, len(tc.wantErrs))
+			for i, err := range errs {
+				assert.True(t, strings.HasPrefix(err.Error(), tc.wantErrs[i]), err.Error())
+			}
+		})
+	}
+}
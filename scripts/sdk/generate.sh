@@ -1,7 +1,7 @@
 #!/usr/bin/env bash
 #
-# Generates the Java SDK for Hephaestus API. This should probably be moved into
-# a Docker image and possibly a separate repository.
+# Generates the Java, Python and TypeScript SDKs for Hephaestus API. This should
+# probably be moved into a Docker image and possibly a separate repository.
 #
 # Prerequisites:
 # - docker
@@ -18,11 +18,17 @@ PROJECT_DIR=$(cd "$SCRIPT_DIR"/../.. && pwd)
 SDKS_DIR=$(cd "$PROJECT_DIR"/sdks && pwd)
 GEN_DIR="$SDKS_DIR/gen"
 JAVA_DIR="$SDKS_DIR/java"
+PYTHON_DIR="$SDKS_DIR/python"
+TYPESCRIPT_DIR="$SDKS_DIR/typescript"
 
 KUBERNETES_SWAGGER_FILE=/tmp/dist.swagger.json
 SWAGGER_FILE=api/openapi-spec/swagger.json
+OPENAPI_FILE=api/openapi-spec/openapi.json
 
 OPENAPI_GENERATOR_CLI_VERSION=v5.2.1
+# the Python and TypeScript clients are generated from the self-contained
+# OpenAPI v3 document and require a newer generator
+OPENAPI_GENERATOR_V3_CLI_VERSION=v7.8.0
 
 info() {
 	echo -e "\033[0;32m[sdk-generate]\033[0m INFO: $*"
@@ -63,11 +69,34 @@ generate_kubernetes_swagger() {
 	kind delete cluster
 }
 
+# generate_client <generator> <output dir> <config> <additional properties>
+generate_client() {
+	local generator=$1 output=$2 config=$3 properties=$4
+
+	mkdir -p "$GEN_DIR"
+	docker run -q --user "$(id -u):$(id -g)" --rm -v "$PROJECT_DIR:/wd" --workdir /wd \
+		openapitools/openapi-generator-cli:$OPENAPI_GENERATOR_V3_CLI_VERSION generate \
+		--input-spec /wd/$OPENAPI_FILE \
+		--generator-name "$generator" \
+		--config "/wd/scripts/sdk/$config" \
+		--output /wd/sdks/gen \
+		--additional-properties "$properties"
+
+	find "$output" -mindepth 1 -not -name .gitignore -delete
+	cp -r "$GEN_DIR"/. "$output"
+	rm -rf "$GEN_DIR"
+}
+
 GIT_TAG=$(git describe --tags --candidates=0 --abbrev=0 2>/dev/null || echo untagged)
 if [[ $GIT_TAG == "untagged" ]]; then
 	VERSION="${BRANCH_NAME:-0.0.0}-SNAPSHOT"
+	# package registries require semantic (npm) and PEP 440 (pip) versions
+	NPM_VERSION="0.0.0-$VERSION"
+	PYTHON_VERSION="0.0.0.dev0"
 else
 	VERSION="${GIT_TAG#v}"
+	NPM_VERSION="$VERSION"
+	PYTHON_VERSION="$VERSION"
 fi
 info "Creating SDK version: $VERSION"
 
@@ -108,3 +137,14 @@ rm -rf "$GEN_DIR"
 info "Copying Maven configurations"
 sed "s/0.0.0-VERSION/$VERSION/" "$SCRIPT_DIR"/pom.xml >"$JAVA_DIR"/pom.xml
 cp "$SCRIPT_DIR"/settings.xml "$JAVA_DIR"/settings.xml
+
+info "Generating OpenAPI v3 document"
+go run "$PROJECT_DIR"/prototype/openapiv3 -version "$VERSION" -output "$PROJECT_DIR/$OPENAPI_FILE"
+
+info "Generating Python client library"
+generate_client python "$PYTHON_DIR" python.yaml "packageVersion=$PYTHON_VERSION"
+cp "$SCRIPT_DIR"/smoke/smoke_test.py "$PYTHON_DIR"/smoke_test.py
+
+info "Generating TypeScript client library"
+generate_client typescript-fetch "$TYPESCRIPT_DIR" typescript.yaml "npmVersion=$NPM_VERSION"
+cp "$SCRIPT_DIR"/smoke/smoke.cjs "$TYPESCRIPT_DIR"/smoke.cjs
@@ -132,10 +132,11 @@ func modifyDefinitions(swagger *spec.Swagger) {
 
 // swaggerRef strips the canonical prefix from definition names.
 //
-// project types become ".<Type>" and meta types become "v1.<Type>"
+// project types become ".<Type>", meta types become "v1.<Type>" and resource types become "resource.<Type>"
 func swaggerRef(name string) string {
 	name = strings.ReplaceAll(name, "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1", "")
 	name = strings.ReplaceAll(name, "k8s.io/apimachinery/pkg/apis/meta/", "")
+	name = strings.ReplaceAll(name, "k8s.io/apimachinery/pkg/api/", "")
 
 	return name
 }
@@ -0,0 +1,20 @@
+// Smoke test for the generated TypeScript client library.
+//
+// Ensures the built package loads, the API services can be constructed, and models round-trip through JSON.
+const assert = require("node:assert");
+const client = require(process.argv[2]);
+
+const payload = {
+  apiVersion: "hephaestus.dominodatalab.com/v1",
+  kind: "ImageBuild",
+  metadata: { name: "smoke", namespace: "default" },
+  spec: { images: ["registry.example.com/app:v1"], logKey: "smoke" },
+};
+
+const ib = client.ImageBuildFromJSON(payload);
+assert.deepStrictEqual(ib.spec.images, ["registry.example.com/app:v1"]);
+assert.strictEqual(client.ImageBuildToJSON(ib).spec.logKey, "smoke");
+
+new client.ImageBuildServiceApi(new client.Configuration({ basePath: "http://localhost" }));
+
+console.log("typescript client smoke test passed");
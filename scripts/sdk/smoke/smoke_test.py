@@ -0,0 +1,23 @@
+"""Smoke test for the generated Python client library.
+
+Ensures the package imports, the API services can be constructed, and models round-trip through their dict form.
+"""
+
+import hephaestus_client
+from hephaestus_client.api.image_build_service_api import ImageBuildServiceApi
+from hephaestus_client.models.image_build import ImageBuild
+
+payload = {
+    "apiVersion": "hephaestus.dominodatalab.com/v1",
+    "kind": "ImageBuild",
+    "metadata": {"name": "smoke", "namespace": "default"},
+    "spec": {"images": ["registry.example.com/app:v1"], "logKey": "smoke"},
+}
+
+ib = ImageBuild.from_dict(payload)
+assert ib.spec.images == ["registry.example.com/app:v1"], ib.spec.images
+assert ib.to_dict()["spec"]["logKey"] == "smoke", ib.to_dict()
+
+ImageBuildServiceApi(hephaestus_client.ApiClient(hephaestus_client.Configuration(host="http://localhost")))
+
+print("python client smoke test passed")
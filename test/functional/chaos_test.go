@@ -0,0 +1,185 @@
+//go:build functional && chaos
+
+package functional
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	hephclient "github.com/dominodatalab/hephaestus/pkg/client"
+)
+
+const (
+	buildkitSelector   = "app.kubernetes.io/instance=hephaestus,app.kubernetes.io/component=buildkit"
+	controllerSelector = "app.kubernetes.io/instance=hephaestus,app.kubernetes.io/component=controller"
+)
+
+func init() {
+	// builds interrupted by controller restarts must be retried for the chaos test to be meaningful
+	modeHelmfileValues = append(modeHelmfileValues, "controller.manager.imageBuild.redispatchInterrupted=true")
+}
+
+// TestChaos runs concurrent builds while buildkit pods are killed and the controller is restarted at random. Every
+// build must either succeed or fail after exhausting its worker eviction retries.
+//
+// The number of builds and the disruption interval can be tuned with CHAOS_BUILDS and CHAOS_INTERVAL.
+func (suite *GenericImageBuilderTestSuite) TestChaos() {
+	t := suite.T()
+	ctx := context.Background()
+
+	builds := 6
+	if v, ok := os.LookupEnv("CHAOS_BUILDS"); ok {
+		n, err := strconv.Atoi(v)
+		require.NoError(t, err, "invalid CHAOS_BUILDS")
+		builds = n
+	}
+
+	interval := 30 * time.Second
+	if v, ok := os.LookupEnv("CHAOS_INTERVAL"); ok {
+		d, err := time.ParseDuration(v)
+		require.NoError(t, err, "invalid CHAOS_INTERVAL")
+		interval = d
+	}
+
+	client := hephclient.New(suite.hephClient)
+
+	var created []*hephv1.ImageBuild
+	for i := 0; i < builds; i++ {
+		build := newImageBuild(dseBuildContext, "docker-registry:5000/test-ns/test-repo", nil)
+		build.Spec.DisableLocalBuildCache = true
+
+		ib, err := suite.hephClient.HephaestusV1().ImageBuilds(corev1.NamespaceDefault).Create(
+			ctx,
+			build,
+			metav1.CreateOptions{},
+		)
+		require.NoError(t, err)
+		created = append(created, ib)
+	}
+
+	chaosCtx, stopChaos := context.WithCancel(ctx)
+	chaosDone := make(chan struct{})
+	go func() {
+		defer close(chaosDone)
+		disrupt(chaosCtx, t, suite.k8sClient, interval)
+	}()
+
+	var wg sync.WaitGroup
+	results := make([]*hephv1.ImageBuild, len(created))
+	errs := make([]error, len(created))
+	for i, ib := range created {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = client.WaitForCompletion(ctx, ib.ObjectKey(), 30*time.Minute)
+		}()
+	}
+	wg.Wait()
+
+	stopChaos()
+	<-chaosDone
+
+	for i, ib := range results {
+		if !assert.NoErrorf(t, errs[i], "build %q did not finish", created[i].Name) {
+			continue
+		}
+
+		if ib.Status.Phase == hephv1.PhaseSucceeded {
+			continue
+		}
+
+		assert.Truef(
+			t,
+			meta.IsStatusConditionTrue(ib.Status.Conditions, "WorkerEvicted"),
+			"build %q failed without a retryable condition: %v",
+			ib.Name,
+			ib.Status.Conditions,
+		)
+	}
+
+	// later tests expect a healthy controller to admit and run their builds
+	require.NoError(t, waitForControllerReady(ctx, suite.k8sClient))
+}
+
+// disrupt deletes a random buildkit pod or every controller pod on each tick until the context is done.
+func disrupt(ctx context.Context, t *testing.T, client kubernetes.Interface, interval time.Duration) {
+	pods := client.CoreV1().Pods(corev1.NamespaceDefault)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if rand.Intn(2) == 0 {
+			list, err := pods.List(ctx, metav1.ListOptions{LabelSelector: buildkitSelector})
+			if err != nil || len(list.Items) == 0 {
+				t.Logf("Skipping buildkit disruption, no pods found: %v", err)
+				continue
+			}
+
+			pod := list.Items[rand.Intn(len(list.Items))]
+			t.Logf("Killing buildkit pod %s", pod.Name)
+			if err = pods.Delete(ctx, pod.Name, metav1.DeleteOptions{}); err != nil {
+				t.Logf("Failed to kill buildkit pod %s: %v", pod.Name, err)
+			}
+
+			continue
+		}
+
+		t.Log("Restarting controller")
+		err := pods.DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: controllerSelector})
+		if err != nil {
+			t.Logf("Failed to restart controller: %v", err)
+		}
+	}
+}
+
+func waitForControllerReady(ctx context.Context, client kubernetes.Interface) error {
+	return wait.PollUntilContextTimeout(ctx, 5*time.Second, 5*time.Minute, true, func(ctx context.Context) (bool, error) {
+		list, err := client.CoreV1().Pods(corev1.NamespaceDefault).List(
+			ctx,
+			metav1.ListOptions{LabelSelector: controllerSelector},
+		)
+		if err != nil {
+			return false, err
+		}
+
+		for _, pod := range list.Items {
+			if pod.DeletionTimestamp != nil || podReady(pod) != corev1.ConditionTrue {
+				return false, nil
+			}
+		}
+
+		return len(list.Items) > 0, nil
+	})
+}
+
+func podReady(pod corev1.Pod) corev1.ConditionStatus {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status
+		}
+	}
+
+	return corev1.ConditionUnknown
+}
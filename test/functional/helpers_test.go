@@ -22,22 +22,28 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/dominodatalab/testenv"
 
 	hephv1 "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1"
+	hephv1testing "github.com/dominodatalab/hephaestus/pkg/api/hephaestus/v1/testing"
+	hephclient "github.com/dominodatalab/hephaestus/pkg/client"
 	"github.com/dominodatalab/hephaestus/pkg/clientset"
 )
 
+// modeHelmfileValues are applied on top of the suite values by optional test modes enabled with build tags.
+var modeHelmfileValues []string
+
 type GenericImageBuilderTestSuite struct {
 	suite.Suite
 
 	CloudAuthTest   func(context.Context, *testing.T)
 	CloudConfigFunc func() testenv.CloudConfig
 	VariableFunc    func(context.Context)
+	// LocalCluster skips waiting for cloud resources to settle before the environment is destroyed.
+	LocalCluster bool
 
 	manager    testenv.Manager
 	hephClient clientset.Interface
@@ -73,6 +79,7 @@ func (suite *GenericImageBuilderTestSuite) SetupSuite() {
 	if suite.VariableFunc != nil {
 		suite.VariableFunc(ctx)
 	}
+	suite.helmfileValues = append(suite.helmfileValues, modeHelmfileValues...)
 
 	if managerImageTag, ok := os.LookupEnv("MANAGER_IMAGE_TAG"); ok {
 		suite.helmfileValues = append(suite.helmfileValues, fmt.Sprintf("controller.manager.image.tag=%s", managerImageTag))
@@ -111,7 +118,9 @@ func (suite *GenericImageBuilderTestSuite) TearDownSuite() {
 
 	// Let the cloud cluster settle.
 	// In particular, in AWS there is a tendency to leave ENIs dangling.
-	time.Sleep(5 * time.Minute)
+	if !suite.LocalCluster {
+		time.Sleep(5 * time.Minute)
+	}
 
 	assert.NoError(suite.T(), suite.manager.Destroy(ctx))
 }
@@ -256,17 +265,11 @@ func (suite *GenericImageBuilderTestSuite) TestImageBuildResourceValidation() {
 	for _, tc := range tt {
 		suite.T().Logf("Test case: %s", tc.name)
 		suite.T().Run(tc.name, func(t *testing.T) {
-			build := &hephv1.ImageBuild{
-				ObjectMeta: metav1.ObjectMeta{
-					GenerateName: "test-build-",
-				},
-				Spec: hephv1.ImageBuildSpec{
-					Context: "https://nowhere.com/docker-build-context.tgz",
-					Images: []string{
-						"registry/org/repo:tag",
-					},
-				},
-			}
+			build := hephv1testing.NewImageBuild("", "",
+				hephv1testing.WithGenerateName("test-build-"),
+				hephv1testing.WithContext("https://nowhere.com/docker-build-context.tgz"),
+				hephv1testing.WithImages("registry/org/repo:tag"),
+			)
 			tc.mutator(build)
 
 			var statusErr *apierrors.StatusError
@@ -517,51 +520,24 @@ func newImageBuild(bc remoteDockerBuildContext, image string, creds *hephv1.Regi
 		auth = append(auth, *creds)
 	}
 
-	return &hephv1.ImageBuild{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "test-build-",
-		},
-		Spec: hephv1.ImageBuildSpec{
-			Images:                  []string{fmt.Sprintf("%s:%s", image, uid)},
-			LogKey:                  uid,
-			Context:                 dockerContextURL,
-			RegistryAuth:            auth,
-			DisableCacheLayerExport: true,
-		},
-	}
+	build := hephv1testing.NewImageBuild("", "",
+		hephv1testing.WithGenerateName("test-build-"),
+		hephv1testing.WithImages(fmt.Sprintf("%s:%s", image, uid)),
+		hephv1testing.WithContext(dockerContextURL),
+		hephv1testing.WithRegistryAuth(auth...),
+	)
+	build.Spec.LogKey = uid
+	build.Spec.DisableCacheLayerExport = true
+
+	return build
 }
 
 func createBuild(t *testing.T, ctx context.Context, client clientset.Interface, build *hephv1.ImageBuild) *hephv1.ImageBuild {
 	t.Helper()
 
-	ibClient := client.HephaestusV1().ImageBuilds(corev1.NamespaceDefault)
-
-	build, err := ibClient.Create(ctx, build, metav1.CreateOptions{})
-	require.NoError(t, err, "failed to create build")
-
-	watcher, err := ibClient.Watch(ctx, metav1.SingleObject(build.ObjectMeta))
-	require.NoError(t, err, "failed to create build watch")
-	defer watcher.Stop()
-
-	ctxTimeout, cancel := context.WithTimeout(ctx, 10*time.Minute)
-	defer cancel()
-
-	var result *hephv1.ImageBuild
-	for loop := true; loop; {
-		select {
-		case <-ctxTimeout.Done():
-			t.Fatal("Build failed to finish within context deadline")
-		case event := <-watcher.ResultChan():
-			if event.Type != watch.Modified {
-				continue
-			}
-
-			result = event.Object.(*hephv1.ImageBuild)
-			if (result.Status.Phase == hephv1.PhaseSucceeded || result.Status.Phase == hephv1.PhaseFailed) && result.Status.Conditions != nil {
-				loop = false
-			}
-		}
-	}
+	build.Namespace = corev1.NamespaceDefault
+	result, err := hephclient.New(client).CreateAndWait(ctx, build, 10*time.Minute)
+	require.NoError(t, err, "build failed to finish")
 
 	return result
 }
@@ -0,0 +1,34 @@
+//go:build functional && kind
+
+package functional
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/dominodatalab/testenv"
+)
+
+func TestKindFunctionality(t *testing.T) {
+	suite.Run(t, new(KindTestSuite))
+}
+
+// KindTestSuite runs the generic suite against a local kind cluster. It does not exercise cloud registry auth.
+type KindTestSuite struct {
+	GenericImageBuilderTestSuite
+}
+
+func (suite *KindTestSuite) SetupSuite() {
+	suite.LocalCluster = true
+	suite.CloudConfigFunc = func() testenv.CloudConfig {
+		return testenv.KindConfig{
+			ClusterName:             os.Getenv("KIND_CLUSTER_NAME"),
+			KubernetesVersion:       os.Getenv("KUBERNETES_VERSION"),
+			LoadBalancerPortMapping: os.Getenv("KIND_LB_PORT_MAPPING") == "true",
+		}
+	}
+
+	suite.GenericImageBuilderTestSuite.SetupSuite()
+}
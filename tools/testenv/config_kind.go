@@ -0,0 +1,52 @@
+package testenv
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// KindConfig is used to create local test environments with kind. Docker must be running on the host.
+type KindConfig struct {
+	// ClusterName of the kind cluster, defaults to "testenv-kind".
+	ClusterName string
+	// KubernetesVersion with a published kindest/node image.
+	KubernetesVersion string
+	// LoadBalancerPortMapping publishes load balancer ports on the host. Enable it when the docker network cannot be
+	// routed from the host, as is the case with Docker Desktop on macOS.
+	LoadBalancerPortMapping bool
+}
+
+// ResourcePath to Terraform module.
+func (c KindConfig) ResourcePath() string {
+	return "resources/terraform/kind"
+}
+
+// Vars derived from struct fields.
+func (c KindConfig) Vars() []byte {
+	f := hclwrite.NewEmptyFile()
+
+	root := f.Body()
+	root.SetAttributeValue("lb_port_mapping", cty.BoolVal(c.LoadBalancerPortMapping))
+
+	if strings.TrimSpace(c.ClusterName) != "" {
+		root.SetAttributeValue("cluster_name", cty.StringVal(c.ClusterName))
+	}
+
+	if strings.TrimSpace(c.KubernetesVersion) != "" {
+		root.SetAttributeValue("kubernetes_version", cty.StringVal(c.KubernetesVersion))
+	}
+
+	return f.Bytes()
+}
+
+// Validate ensures provided variables are usable.
+func (c KindConfig) Validate() (err error) {
+	if c.ClusterName != strings.ToLower(c.ClusterName) {
+		err = errors.New("kind cluster name must be lowercase")
+	}
+
+	return err
+}
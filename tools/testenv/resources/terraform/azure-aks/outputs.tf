@@ -5,7 +5,7 @@ output "tenant_id" {
 
 output "client_id" {
   description = "The client ID of the AAD service principal created for testing."
-  value       = azuread_service_principal.app.application_id
+  value       = azuread_service_principal.app.client_id
 }
 
 output "client_secret" {
@@ -0,0 +1,50 @@
+provider "docker" {
+}
+
+## Cluster
+
+resource "kind_cluster" "main" {
+  name           = var.cluster_name
+  node_image     = var.kubernetes_version == null ? null : "kindest/node:v${trimprefix(var.kubernetes_version, "v")}"
+  wait_for_ready = true
+
+  kind_config {
+    kind        = "Cluster"
+    api_version = "kind.x-k8s.io/v1alpha4"
+
+    node {
+      role = "control-plane"
+    }
+
+    node {
+      role = "worker"
+    }
+  }
+}
+
+## Load balancers
+#
+# The suite reaches the registries, RabbitMQ and Redis through LoadBalancer services. cloud-provider-kind assigns them
+# addresses on the docker network the cluster nodes are attached to.
+
+resource "docker_image" "cloud_provider_kind" {
+  name = "registry.k8s.io/cloud-provider-kind/cloud-controller-manager:v0.4.0"
+}
+
+resource "docker_container" "cloud_provider_kind" {
+  name    = "${var.cluster_name}-cloud-provider"
+  image   = docker_image.cloud_provider_kind.image_id
+  command = var.lb_port_mapping ? ["-enable-lb-port-mapping"] : []
+  restart = "unless-stopped"
+
+  networks_advanced {
+    name = "kind"
+  }
+
+  volumes {
+    host_path      = "/var/run/docker.sock"
+    container_path = "/var/run/docker.sock"
+  }
+
+  depends_on = [kind_cluster.main]
+}
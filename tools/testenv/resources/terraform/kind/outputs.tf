@@ -0,0 +1,10 @@
+output "cluster_name" {
+  description = "The name of the kind cluster."
+  value       = kind_cluster.main.name
+}
+
+output "kubeconfig" {
+  description = "A kubeconfig file configured to access the kind cluster."
+  value       = kind_cluster.main.kubeconfig
+  sensitive   = true
+}
@@ -0,0 +1,17 @@
+variable "cluster_name" {
+  type        = string
+  description = "The name of the kind cluster."
+  default     = "testenv-kind"
+}
+
+variable "kubernetes_version" {
+  type        = string
+  description = "The Kubernetes version of the cluster, used to select the kindest/node image."
+  default     = null
+}
+
+variable "lb_port_mapping" {
+  type        = bool
+  description = "Publish load balancer ports on the host, required when the docker network is not routable (e.g. macOS)."
+  default     = false
+}